@@ -27,7 +27,20 @@ func main() {
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT)
-	<-stop
+
+	// SIGHUP reloads the signing keyring
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+wait:
+	for {
+		select {
+		case <-reload:
+			app.ReloadKeys()
+		case <-stop:
+			break wait
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -6,17 +6,23 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	staffy "github.com/devathh/staffy-proto/gen/go"
 	"github.com/devathh/staffy-sso/internal/application/services"
 	"github.com/devathh/staffy-sso/internal/infrastructure/cache/redis"
 	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/infrastructure/mail"
 	"github.com/devathh/staffy-sso/internal/infrastructure/observability/clickhouse"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence/file"
 	"github.com/devathh/staffy-sso/internal/infrastructure/persistence/postgres"
 	"github.com/devathh/staffy-sso/internal/infrastructure/server"
 	"github.com/devathh/staffy-sso/internal/infrastructure/server/handlers"
+	"github.com/devathh/staffy-sso/internal/lib/clientip"
 	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/internal/lib/password"
 	"github.com/devathh/staffy-sso/pkg/log"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
 )
@@ -24,6 +30,7 @@ import (
 type App struct {
 	log    *slog.Logger
 	server *server.Server
+	jwt    *jwt.JWT
 }
 
 func (a *App) Start() error {
@@ -36,6 +43,30 @@ func (a *App) Shutdown(ctx context.Context) error {
 	return a.server.Shutdown(ctx)
 }
 
+// ReloadKeys re-reads the signing keyring, so keys can be promoted n' retired without a restart
+func (a *App) ReloadKeys() {
+	if err := a.jwt.ReloadKeys(); err != nil {
+		a.log.Error("failed to reload signing keys", slog.String("error", err.Error()))
+		return
+	}
+
+	a.log.Info("signing keys are reloaded")
+}
+
+func (a *App) reloadKeysPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.ReloadKeys()
+		}
+	}
+}
+
 // SetupApp returns App, CleanUp() n' err
 func SetupApp() (*App, func(), error) {
 	if err := godotenv.Load(".env"); err != nil {
@@ -55,8 +86,6 @@ func SetupApp() (*App, func(), error) {
 
 	log.Info("config is uploaded", slog.Any("server", cfg.Server), slog.Any("service", cfg.App))
 
-	jwtGenerator := jwt.NewJWT(cfg)
-
 	db, err := postgres.ConnectToDB(cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect to db: %w", err)
@@ -80,6 +109,24 @@ func SetupApp() (*App, func(), error) {
 		return nil, nil, fmt.Errorf("failed to init user's cache: %w", err)
 	}
 
+	rt, err := redis.NewRefreshTokenStore(cfg, redisClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init refresh token's store: %w", err)
+	}
+
+	rl, err := redis.NewRevocationList(cfg, redisClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init revocation list: %w", err)
+	}
+
+	jwtGenerator, err := jwt.NewJWT(cfg, rl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init jwt: %w", err)
+	}
+	if len(jwtGenerator.IDTokenSigningAlgorithms()) == 0 {
+		log.Warn("openid connect is disabled: ID tokens can't be signed with symmetric key, use an asymmetric algorithm")
+	}
+
 	connClickhouse, err := clickhouse.ConnectToCH(context.Background(), cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect to ch: %w", err)
@@ -92,19 +139,180 @@ func SetupApp() (*App, func(), error) {
 		return nil, nil, fmt.Errorf("failed to create user clickhouse: %w", err)
 	}
 
-	service := services.NewSSOService(cfg, log, ur, uc, ch, jwtGenerator)
-	handler := handlers.NewHandler(service)
-	grpcServer := grpc.NewServer()
+	clients, err := postgres.NewClientRepository(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init client's repository: %w", err)
+	}
+
+	consents, err := postgres.NewConsentRepository(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init consent's repository: %w", err)
+	}
+
+	roles, err := postgres.NewRoleRepository(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init role's repository: %w", err)
+	}
+
+	roleChanges, err := postgres.NewRoleChangeRepository(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init role change's repository: %w", err)
+	}
+
+	organizations, err := postgres.NewOrganizationRepository(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init organization's repository: %w", err)
+	}
+
+	invitations, err := postgres.NewInvitationRepository(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init invitation's repository: %w", err)
+	}
+
+	totps, err := postgres.NewTOTPRepository(db, cfg.Secrets.MFA.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init totp's repository: %w", err)
+	}
+
+	passkeys, err := postgres.NewPasskeyRepository(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init passkey's repository: %w", err)
+	}
+
+	codes, err := redis.NewAuthorizationCodeStore(redisClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init authorization code's store: %w", err)
+	}
+
+	actionTokens, err := redis.NewActionTokenStore(redisClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init action token's store: %w", err)
+	}
+
+	ceremonies, err := redis.NewCeremonyStore(redisClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init ceremony's store: %w", err)
+	}
+
+	attempts, err := redis.NewAttemptStore(redisClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init attempt's store: %w", err)
+	}
+
+	relyingParty, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPName,
+		RPOrigins:     cfg.WebAuthn.Origins,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init webauthn: %w", err)
+	}
+
+	hasher, err := password.NewHasher(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init password hasher: %w", err)
+	}
+
+	hashingPool, err := password.NewPool(cfg, hasher, ch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init password hashing pool: %w", err)
+	}
+
+	var breachedList *file.BreachedList
+	if cfg.Password.BreachedList != "" {
+		breachedList, err = file.NewBreachedList(cfg.Password.BreachedList)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to init breached password's list: %w", err)
+		}
+	}
+
+	mailSender, err := mail.NewSender(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init mail sender: %w", err)
+	}
+
+	deps := services.Dependencies{
+		Users:         ur,
+		UserCache:     uc,
+		RefreshTokens: rt,
+		Revocations:   rl,
+		Clients:       clients,
+		Consents:      consents,
+		Codes:         codes,
+		ActionTokens:  actionTokens,
+		Roles:         roles,
+		RoleChanges:   roleChanges,
+		Organizations: organizations,
+		Invitations:   invitations,
+		TOTPs:         totps,
+		Passkeys:      passkeys,
+		Ceremonies:    ceremonies,
+		Attempts:      attempts,
+		Hasher:        hashingPool,
+		Mail:          mailSender,
+		CH:            ch,
+		JWT:           jwtGenerator,
+		WebAuthn:      relyingParty,
+	}
+	// The interface has to stay nil, when the list isn't configured
+	if breachedList != nil {
+		deps.Breached = breachedList
+	}
+
+	service := services.NewSSOService(cfg, log, deps)
+	oauthService := services.NewOAuthService(cfg, log, deps)
+	oidcService := services.NewOIDCService(cfg, log, deps)
+	introspectionService := services.NewIntrospectionService(cfg, log, deps)
+	if err := oauthService.SyncClients(context.Background()); err != nil {
+		return nil, nil, fmt.Errorf("failed to sync oauth clients: %w", err)
+	}
+	if err := service.SyncRoles(context.Background()); err != nil {
+		return nil, nil, fmt.Errorf("failed to sync roles: %w", err)
+	}
+
+	rateLimits, err := redis.NewRateLimitStore(redisClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init rate limit's store: %w", err)
+	}
+
+	rateLimiter, err := handlers.NewRateLimiter(cfg, log, rateLimits, ch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init rate limiter: %w", err)
+	}
+
+	clientIP, err := clientip.NewResolver(cfg.Server.ClientIP.Header, cfg.Server.ClientIP.TrustedProxies)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init client ip resolver: %w", err)
+	}
+
+	handler := handlers.NewHandler(service, oauthService, introspectionService)
+	// The client ip is resolved first, the rate limiter n' the lockout are charged to it
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(clientIP.UnaryInterceptor, rateLimiter.Unary))
 	staffy.RegisterSSOServer(grpcServer, handler)
 
-	server, err := server.NewServer(cfg, grpcServer)
+	httpHandler := handlers.NewHTTPHandler(cfg, log, jwtGenerator, oauthService, oidcService, introspectionService, rateLimiter)
+
+	server, err := server.NewServer(cfg, grpcServer, clientIP.Middleware(httpHandler.Routes()))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to init server: %w", err)
 	}
 
+	app := &App{
+		server: server,
+		log:    log,
+		jwt:    jwtGenerator,
+	}
+
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	if interval := cfg.Secrets.JWT.KeyringReloadInterval; interval > 0 {
+		go app.reloadKeysPeriodically(reloadCtx, interval)
+	}
+
 	log.Info("all components are loaded")
 
 	cleanup := func() {
+		stopReload()
+
 		if err := redis.Close(redisClient); err != nil {
 			log.Warn("failed to close connection with redis", slog.String("error", err.Error()))
 		} else {
@@ -116,10 +324,15 @@ func SetupApp() (*App, func(), error) {
 		} else {
 			log.Info("clickhouse connection was closed")
 		}
+
+		hashingPool.Close()
+
+		if breachedList != nil {
+			if err := breachedList.Close(); err != nil {
+				log.Warn("failed to close breached password's list", slog.String("error", err.Error()))
+			}
+		}
 	}
 
-	return &App{
-		server: server,
-		log:    log,
-	}, cleanup, nil
+	return app, cleanup, nil
 }
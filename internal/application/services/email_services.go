@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainToken "github.com/devathh/staffy-sso/internal/domain/token"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/codes"
+)
+
+// RequestEmailChange sends the confirmation link to the new email n' notifies the old one.
+// The email isn't changed until the link is followed.
+func (s *ssoService) RequestEmailChange(ctx context.Context, req *staffy.EmailChangeRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	newEmail, err := domain.NewEmail(strings.TrimSpace(req.GetNewEmail()))
+	if err != nil {
+		return nil, consts.ErrInvalidEmail
+	}
+
+	if req.GetPassword() == "" {
+		return nil, consts.ErrInvalidCredentials
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.persistence.GetByID(ctxTimeout, claims.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrUserDoesntExist
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	// A stolen session isn't enough to take the account over
+	ok, err := user.CheckThePassword(ctxTimeout, req.GetPassword(), s.hasher)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, consts.ErrInvalidCredentials
+	}
+
+	if user.Email() == newEmail.String() {
+		return nil, fmt.Errorf("%w: email is the same", consts.ErrInvalidArgs)
+	}
+
+	// The response is the same for a registered email, so it can't be used to find out registered emails.
+	// The unique column is the final check, this one just saves a useless link
+	if _, err := s.persistence.GetByEmail(ctxTimeout, newEmail.String()); err == nil {
+		s.sendEmailTaken(newEmail.String())
+	} else if errors.Is(err, consts.ErrUserDoesntExist) {
+		s.sendEmailChange(user, newEmail.String())
+	} else {
+		s.log.Error("failed to get user by email", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	// The owner can still stop the change by changing the password, it revokes the link
+	s.sendMail(&domainMail.Message{
+		To:      user.Email(),
+		Subject: "Your Staffy email is being changed",
+		Body: fmt.Sprintf("Hi %s,\r\n\r\nSomeone asked to change the email of your Staffy account to %s.\r\n\r\n"+
+			"If it wasn't you, change your password right now, it cancels the change.",
+			user.Name(), newEmail.String()),
+	})
+
+	go s.saveLog(context.TODO(), staffy.SSO_RequestEmailChange_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "confirmation link has been sent to the new email",
+	}, nil
+}
+
+// sendEmailChange issues the token n' mails the link to the new email in background, like sendMagicLink,
+// so the response time doesn't tell whether the email is registered
+func (s *ssoService) sendEmailChange(user *domain.User, newEmail string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.RWTimeout)
+		defer cancel()
+
+		token, rawToken, err := domainToken.NewActionToken(
+			domainToken.PurposeEmailChange,
+			user.ID(),
+			newEmail,
+			s.cfg.Account.EmailChangeTTL,
+		)
+		if err != nil {
+			s.log.Error("failed to generate email change token", slog.String("error", err.Error()))
+			return
+		}
+
+		if err := s.actionTokens.Save(ctx, token); err != nil {
+			s.log.Error("failed to save email change token", slog.String("error", err.Error()),
+				slog.String("user_id", user.ID().String()))
+			return
+		}
+
+		link, err := RedirectWithParams(s.cfg.Account.EmailChangeURL, url.Values{"token": {rawToken}})
+		if err != nil {
+			s.log.Error("failed to build email change link", slog.String("error", err.Error()))
+			return
+		}
+
+		s.sendMail(&domainMail.Message{
+			To:      newEmail,
+			Subject: "Confirm your new Staffy email",
+			Body: fmt.Sprintf("Hi %s,\r\n\r\nFollow the link to use this email for your Staffy account: %s\r\n\r\nThe link expires in %s.",
+				user.Name(), link, s.cfg.Account.EmailChangeTTL),
+		})
+	}()
+}
+
+// ConfirmEmailChange sets the new email by the token from the link. Old tokens carry the old email,
+// so all of them are revoked. New ones are issued like in Login: users with enabled mfa get the challenge,
+// the link alone isn't enough to sign in
+func (s *ssoService) ConfirmEmailChange(ctx context.Context, req *staffy.ConfirmEmailChangeRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	rawToken := strings.TrimSpace(req.GetToken())
+	if rawToken == "" {
+		return nil, consts.ErrNilToken
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	token, err := s.consumeActionToken(ctxTimeout, domainToken.PurposeEmailChange, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkActionTokenRevocation(ctxTimeout, token); err != nil {
+		return nil, err
+	}
+
+	user, err := s.persistence.GetByID(ctxTimeout, token.UserID())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	newEmail, err := domain.NewEmail(token.Email())
+	if err != nil {
+		return nil, consts.ErrInvalidToken
+	}
+
+	// previous keeps the old email, its cache entry must be evicted too
+	previous := *user
+
+	if err := user.ChangeEmail(newEmail); err != nil {
+		return nil, consts.ErrInvalidToken
+	}
+
+	// The link was followed, so the user owns the new email
+	if err := user.VerifyEmail(newEmail.String()); err != nil {
+		return nil, consts.ErrInvalidToken
+	}
+
+	if err := s.saveCredentials(ctxTimeout, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Delete(ctxTimeout, &previous); err != nil {
+		s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+			slog.String("user_id", user.ID().String()))
+		return nil, consts.ErrCache
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_ConfirmEmailChange_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.startLogin(ctxTimeout, user)
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+const (
+	changePassword = "correct horse battery staple"
+	oldEmail       = "old@example.com"
+	newEmail       = "new@example.com"
+)
+
+// receiveMails waits for n mails, they're sent in background in any order
+func (e *testEnv) receiveMails(t *testing.T, n int) map[string]*domainMail.Message {
+	t.Helper()
+
+	mails := make(map[string]*domainMail.Message, n)
+	for range n {
+		msg := e.receiveMail(t)
+		mails[msg.To] = msg
+	}
+	e.assertNoMail(t)
+
+	return mails
+}
+
+// requestEmailChange asks to move the user to the new email n' returns the token of the confirmation link
+func (e *testEnv) requestEmailChange(t *testing.T, user *domain.User) string {
+	t.Helper()
+
+	session, err := e.svc.toAuthResponse(t.Context(), user, newSession())
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	_, err = e.svc.RequestEmailChange(t.Context(), &staffy.EmailChangeRequest{
+		Token:    session.Token,
+		NewEmail: newEmail,
+		Password: changePassword,
+	})
+	if err != nil {
+		t.Fatalf("failed to request email change: %v", err)
+	}
+
+	msg, ok := e.receiveMails(t, 2)[newEmail]
+	if !ok {
+		t.Fatal("link isn't sent to the new email")
+	}
+
+	return linkToken(t, msg)
+}
+
+func TestRequestEmailChangeResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		// taken registers the new email for another account
+		taken bool
+		// failSave breaks the token store, the response mustn't depend on it
+		failSave bool
+		wantLink bool
+	}{
+		{name: "free email", wantLink: true},
+		{name: "registered email", taken: true},
+		{name: "free email with broken token store", failSave: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, oldEmail, changePassword)
+			if tt.taken {
+				env.newUser(t, newEmail, "another horse battery staple")
+			}
+			if tt.failSave {
+				env.svc.actionTokens = failingActionTokens{ActionTokenRepository: env.svc.actionTokens}
+			}
+
+			session, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+			if err != nil {
+				t.Fatalf("failed to issue tokens: %v", err)
+			}
+
+			resp, err := env.svc.RequestEmailChange(t.Context(), &staffy.EmailChangeRequest{
+				Token:    session.Token,
+				NewEmail: newEmail,
+				Password: changePassword,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusMessage != "confirmation link has been sent to the new email" {
+				t.Fatalf("unexpected response: %q", resp.StatusMessage)
+			}
+
+			// The current email is notified anyway, the new one gets the link or a notice of its owner
+			wantMails := 2
+			if tt.failSave {
+				wantMails = 1
+			}
+			mails := env.receiveMails(t, wantMails)
+			if _, ok := mails[oldEmail]; !ok {
+				t.Fatal("current email isn't notified")
+			}
+
+			msg, ok := mails[newEmail]
+			if tt.failSave {
+				if ok {
+					t.Fatal("link is sent without a token")
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("nothing is sent to the new email")
+			}
+			if hasLink := strings.Contains(msg.Body, "https://staffy.test/email"); hasLink != tt.wantLink {
+				t.Fatalf("link is sent: %t, want %t", hasLink, tt.wantLink)
+			}
+		})
+	}
+}
+
+func TestRequestEmailChangeChecksPassword(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, oldEmail, changePassword)
+
+	session, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	_, err = env.svc.RequestEmailChange(t.Context(), &staffy.EmailChangeRequest{
+		Token:    session.Token,
+		NewEmail: newEmail,
+		Password: "wrong horse battery staple",
+	})
+	if !errors.Is(err, consts.ErrInvalidCredentials) {
+		t.Fatalf("got %v, want %v", err, consts.ErrInvalidCredentials)
+	}
+	env.assertNoMail(t)
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	t.Run("email is changed once", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, oldEmail, changePassword)
+		old, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+		if err != nil {
+			t.Fatalf("failed to issue tokens: %v", err)
+		}
+		token := env.requestEmailChange(t, user)
+		// The watermark has millisecond precision, sessions issued in the same millisecond stay valid
+		time.Sleep(2 * time.Millisecond)
+
+		resp, err := env.svc.ConfirmEmailChange(t.Context(), &staffy.ConfirmEmailChangeRequest{Token: token})
+		if err != nil {
+			t.Fatalf("failed to confirm email change: %v", err)
+		}
+
+		claims, err := env.svc.jwt.ValidateToken(t.Context(), resp.Token)
+		if err != nil {
+			t.Fatalf("new access token is invalid: %v", err)
+		}
+		if claims.Email != newEmail {
+			t.Fatalf("token carries %s, want %s", claims.Email, newEmail)
+		}
+
+		stored, err := env.users.GetByID(t.Context(), user.ID())
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+		if stored.Email() != newEmail || !stored.IsEmailVerified() {
+			t.Fatalf("email is %s, verified %t", stored.Email(), stored.IsEmailVerified())
+		}
+
+		if _, err := env.svc.jwt.ValidateToken(t.Context(), old.Token); !errors.Is(err, jwt.ErrRevokedToken) {
+			t.Fatalf("session with the old email: got %v, want %v", err, jwt.ErrRevokedToken)
+		}
+
+		if _, err := env.svc.ConfirmEmailChange(t.Context(), &staffy.ConfirmEmailChangeRequest{Token: token}); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("reused token: got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+
+	t.Run("mfa is challenged", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, oldEmail, changePassword)
+		env.enrollTOTP(t, user)
+		token := env.requestEmailChange(t, user)
+
+		resp, err := env.svc.ConfirmEmailChange(t.Context(), &staffy.ConfirmEmailChangeRequest{Token: token})
+		if err != nil {
+			t.Fatalf("failed to confirm email change: %v", err)
+		}
+		if resp.MfaChallenge == "" || resp.Token != "" || resp.RefreshToken != "" {
+			t.Fatal("tokens are issued before the second factor")
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, oldEmail, changePassword)
+		token := env.requestEmailChange(t, user)
+
+		env.redis.FastForward(env.svc.cfg.Account.EmailChangeTTL + time.Second)
+
+		if _, err := env.svc.ConfirmEmailChange(t.Context(), &staffy.ConfirmEmailChangeRequest{Token: token}); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+
+	t.Run("password change cancels the link", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, oldEmail, changePassword)
+		token := env.requestEmailChange(t, user)
+		time.Sleep(2 * time.Millisecond)
+
+		session, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+		if err != nil {
+			t.Fatalf("failed to issue tokens: %v", err)
+		}
+		_, err = env.svc.ChangePassword(t.Context(), &staffy.ChangePasswordRequest{
+			Token:       session.Token,
+			OldPassword: changePassword,
+			NewPassword: "new horse battery staple",
+		})
+		if err != nil {
+			t.Fatalf("failed to change password: %v", err)
+		}
+
+		if _, err := env.svc.ConfirmEmailChange(t.Context(), &staffy.ConfirmEmailChangeRequest{Token: token}); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+}
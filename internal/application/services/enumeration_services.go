@@ -0,0 +1,44 @@
+package services
+
+import (
+	"fmt"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+)
+
+// registrationAccepted is the response of Register in the anti-enumeration mode. It's built from the request only,
+// so it's the same for new n' existing emails: no id n' no tokens, the user logs in after the verification
+func registrationAccepted(user *domain.User) *staffy.AuthResponse {
+	return &staffy.AuthResponse{
+		User: &staffy.User{
+			Email:       user.Email(),
+			Name:        user.Name(),
+			Surname:     user.Surname(),
+			IsRecruiter: user.IsRecruiter(),
+			Roles:       user.Roles(),
+		},
+	}
+}
+
+// sendAccountExists tells the owner of the email, that someone has tried to register it again
+func (s *ssoService) sendAccountExists(email string) {
+	s.sendMail(&domainMail.Message{
+		To:      email,
+		Subject: "Your Staffy account already exists",
+		Body: fmt.Sprintf("Hi,\r\n\r\nSomeone has tried to create a Staffy account with this email, but you already have one. "+
+			"If it was you, sign in: %s\r\n\r\nForgot the password? Reset it on the sign-in page. "+
+			"If it wasn't you, ignore this message.", s.cfg.OAuth.LoginURL),
+	})
+}
+
+// sendEmailTaken tells the owner of the email, that someone has tried to move another account to it
+func (s *ssoService) sendEmailTaken(email string) {
+	s.sendMail(&domainMail.Message{
+		To:      email,
+		Subject: "Your Staffy email was used",
+		Body: "Hi,\r\n\r\nSomeone has tried to change the email of another Staffy account to this one, " +
+			"but it already belongs to your account. Nothing has been changed. If it wasn't you, ignore this message.",
+	})
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+func withAntiEnumeration(cfg *config.Config) {
+	cfg.Account.AntiEnumeration = true
+}
+
+func TestLoginUnknownEmailChecksDummyHash(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure []func(*config.Config)
+		email     string
+		// wantVerified is the number of hashes compared, the known email with a wrong password compares one
+		wantVerified int64
+	}{
+		{name: "known email with a wrong password", email: lockoutEmail, wantVerified: 1},
+		{name: "unknown email in anti-enumeration mode", configure: []func(*config.Config){withAntiEnumeration}, email: "unknown@example.com", wantVerified: 1},
+		{name: "unknown email by default", email: "unknown@example.com", wantVerified: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, tt.configure...)
+			env.newUser(t, lockoutEmail, lockoutPassword)
+
+			hasher := &countingHasher{}
+			env.svc.hasher = hasher
+
+			_, err := env.svc.Login(t.Context(), &staffy.LoginRequest{Email: tt.email, Password: "wrong password"})
+			if !errors.Is(err, consts.ErrInvalidCredentials) {
+				t.Fatalf("got %v, want %v", err, consts.ErrInvalidCredentials)
+			}
+			if got := hasher.verified.Load(); got != tt.wantVerified {
+				t.Fatalf("%d hashes are compared, want %d", got, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestRegisterAntiEnumeration(t *testing.T) {
+	env := newTestEnv(t, withAntiEnumeration)
+	env.newUser(t, "taken@example.com", "correct horse battery staple")
+
+	register := func(email string) *staffy.AuthResponse {
+		t.Helper()
+
+		resp, err := env.svc.Register(t.Context(), &staffy.RegisterRequest{
+			Email:    email,
+			Password: "correct horse battery staple",
+			Name:     "Test",
+			Surname:  "User",
+		})
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", email, err)
+		}
+
+		return resp
+	}
+
+	fresh := register("fresh@example.com")
+	taken := register("taken@example.com")
+
+	for _, resp := range []*staffy.AuthResponse{fresh, taken} {
+		if resp.Token != "" || resp.RefreshToken != "" || resp.MfaChallenge != "" {
+			t.Fatal("tokens are issued by Register")
+		}
+		if resp.User == nil || resp.User.UserId != "" {
+			t.Fatalf("got user %+v, want one without the id", resp.User)
+		}
+	}
+
+	// Only the email differs, it's taken from the request
+	a, b := fresh.User, taken.User
+	if a.Name != b.Name || a.Surname != b.Surname || a.IsRecruiter != b.IsRecruiter ||
+		a.EmailVerified != b.EmailVerified || a.Version != b.Version || !slices.Equal(a.Roles, b.Roles) {
+		t.Fatalf("responses differ: %+v n' %+v", a, b)
+	}
+
+	mails := env.receiveMails(t, 2)
+	if !strings.Contains(mails["fresh@example.com"].Body, env.svc.cfg.Account.VerificationURL) {
+		t.Fatalf("new email got %q, want the verification link", mails["fresh@example.com"].Body)
+	}
+	if !strings.Contains(mails["taken@example.com"].Subject, "already exists") {
+		t.Fatalf("registered email got %q, want the notice", mails["taken@example.com"].Subject)
+	}
+
+	if _, err := env.users.GetByEmail(t.Context(), "fresh@example.com"); err != nil {
+		t.Fatalf("new user isn't saved: %v", err)
+	}
+}
+
+func TestRegisterExistingEmailByDefault(t *testing.T) {
+	env := newTestEnv(t)
+	env.newUser(t, "taken@example.com", "correct horse battery staple")
+
+	_, err := env.svc.Register(t.Context(), &staffy.RegisterRequest{
+		Email:    "taken@example.com",
+		Password: "correct horse battery staple",
+		Name:     "Test",
+		Surname:  "User",
+	})
+	if !errors.Is(err, consts.ErrUserAlreadyExists) {
+		t.Fatalf("got %v, want %v", err, consts.ErrUserAlreadyExists)
+	}
+	env.assertNoMail(t)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/codes"
+)
+
+// Introspection is the state of the token (RFC 7662 2.2). Inactive tokens have no other fields.
+type Introspection struct {
+	Active   bool   `json:"active"`
+	Subject  string `json:"sub,omitempty"`
+	Issuer   string `json:"iss,omitempty"`
+	Expires  int64  `json:"exp,omitempty"`
+	IssuedAt int64  `json:"iat,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// Type is whom the token was issued to: user, delegated (an oauth client on behalf of the user) or service
+	Type string `json:"type,omitempty"`
+}
+
+type IntrospectionService interface {
+	// Introspect reports whether the token is active. The signature, expiration n' revocation are always checked,
+	// the user is loaded to check that it still exists unless skipUserLookup is set.
+	Introspect(ctx context.Context, token string, skipUserLookup bool) (*Introspection, error)
+	// AuthenticateResourceServer checks credentials of the confidential client, which introspects tokens over http
+	AuthenticateResourceServer(ctx context.Context, clientID, secret string) error
+}
+
+func (s *ssoService) Introspect(ctx context.Context, token string, skipUserLookup bool) (*Introspection, error) {
+	start := time.Now().UTC()
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return &Introspection{Active: false}, nil
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.jwt.ValidateToken(ctxTimeout, token)
+	if err != nil {
+		// The gateway mustn't treat the token as inactive, if it just couldn't be checked
+		if errors.Is(err, jwt.ErrRevocationUnavailable) {
+			s.log.Error("failed to introspect token", slog.String("error", err.Error()))
+			return nil, consts.ErrCache
+		}
+
+		return &Introspection{Active: false}, nil
+	}
+
+	// Only access tokens are active, ID tokens n' anything else signed by the same keys aren't,
+	// even if the user isn't looked up
+	if claims.Kind() == "" {
+		return &Introspection{Active: false}, nil
+	}
+
+	cacheHit := false
+	if !skipUserLookup && !claims.IsService() {
+		if _, err := s.getUserFromCacheByID(ctxTimeout, claims.ID); err == nil {
+			cacheHit = true
+		} else if _, err := s.getUserByID(ctxTimeout, claims.ID); err != nil {
+			if errors.Is(err, consts.ErrUserDoesntExist) {
+				return &Introspection{Active: false}, nil
+			}
+
+			return nil, err
+		}
+	}
+
+	go s.saveLog(context.TODO(), "/introspect", time.Since(start), int(codes.OK), cacheHit)
+	return toIntrospection(claims), nil
+}
+
+func (s *ssoService) AuthenticateResourceServer(ctx context.Context, clientID, secret string) error {
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	client, err := s.authenticateClient(ctxTimeout, clientID, secret)
+	if err != nil {
+		return err
+	}
+
+	// Public clients can't keep a secret, so anyone could introspect on their behalf
+	if client.IsPublic() {
+		return consts.ErrInvalidClient
+	}
+
+	return nil
+}
+
+func toIntrospection(claims *jwt.CustomClaims) *Introspection {
+	introspection := &Introspection{
+		Active:   true,
+		Subject:  claims.Subject,
+		Issuer:   claims.Issuer,
+		Scope:    claims.Scope,
+		ClientID: claims.ClientID,
+		Type:     claims.Kind(),
+	}
+
+	if claims.ExpiresAt != nil {
+		introspection.Expires = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		introspection.IssuedAt = claims.IssuedAt.Unix()
+	}
+
+	return introspection
+}
+
+func NewIntrospectionService(cfg *config.Config, log *slog.Logger, deps Dependencies) IntrospectionService {
+	return newSSOService(cfg, log, deps)
+}
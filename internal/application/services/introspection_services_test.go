@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestIntrospect(t *testing.T) {
+	env := newTestEnv(t, withEdDSAKey(t))
+	user := env.newUser(t, "introspect@example.com", "correct horse battery staple")
+
+	userToken, err := env.svc.jwt.GenerateToken(user.Email(), user.ID(), uuid.New())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	delegatedToken, err := env.svc.jwt.GenerateToken(user.Email(), user.ID(), uuid.New(), jwt.WithClient("app", []string{"profile"}))
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	serviceToken, err := env.svc.jwt.GenerateServiceToken("billing", []string{"users:read"})
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	idToken, err := env.svc.jwt.GenerateIDToken(&jwt.IDTokenClaims{
+		RegisteredClaims: jwtlib.RegisteredClaims{
+			Subject:  user.ID().String(),
+			Audience: jwtlib.ClaimStrings{"app"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to generate id token: %v", err)
+	}
+	deletedToken, err := env.svc.jwt.GenerateToken("deleted@example.com", uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		skipUserLookup bool
+		wantActive     bool
+		wantType       string
+	}{
+		{name: "user token", token: userToken, wantActive: true, wantType: jwt.TokenKindUser},
+		{name: "delegated token", token: delegatedToken, wantActive: true, wantType: jwt.TokenKindDelegated},
+		{name: "service token", token: serviceToken, wantActive: true, wantType: jwt.TokenKindService},
+		{name: "id token", token: idToken, wantActive: false},
+		{name: "id token without user lookup", token: idToken, skipUserLookup: true, wantActive: false},
+		{name: "token of deleted user", token: deletedToken, wantActive: false},
+		{name: "token of deleted user without lookup", token: deletedToken, skipUserLookup: true, wantActive: true, wantType: jwt.TokenKindUser},
+		{name: "garbage", token: "not-a-token", wantActive: false},
+		{name: "empty", token: " ", wantActive: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := env.svc.Introspect(t.Context(), tt.token, tt.skipUserLookup)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got.Active != tt.wantActive || got.Type != tt.wantType {
+				t.Fatalf("got active %v type %q, want active %v type %q", got.Active, got.Type, tt.wantActive, tt.wantType)
+			}
+			if !got.Active && *got != (Introspection{}) {
+				t.Fatalf("inactive token has fields: %+v", *got)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	domainLockout "github.com/devathh/staffy-sso/internal/domain/lockout"
+	"github.com/devathh/staffy-sso/internal/domain/observability"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+// loginAttempt is the reservation of one login. It's settled by failLogin or resetLockout,
+// otherwise releaseLogin takes it back.
+type loginAttempt struct {
+	attempts []domainLockout.Attempt
+	// numbers are attempt numbers of subjects in the same order, nil if the reservation has failed
+	numbers []int64
+	settled bool
+}
+
+// loginAttempts are counters, which one login attempt is charged to
+func (s *ssoService) loginAttempts(email, ip string) []domainLockout.Attempt {
+	attempts := []domainLockout.Attempt{{
+		Scope:   domainLockout.ScopeAccount,
+		Subject: strings.ToLower(email),
+		Policy:  s.lockoutPolicy(domainLockout.ScopeAccount),
+	}}
+	if ip != "" {
+		attempts = append(attempts, domainLockout.Attempt{
+			Scope:   domainLockout.ScopeIP,
+			Subject: ip,
+			Policy:  s.lockoutPolicy(domainLockout.ScopeIP),
+		})
+	}
+
+	return attempts
+}
+
+// lockoutPolicy delays attempts to one account on every failure. The ip is only locked out after its threshold,
+// so a typo of one user doesn't slow down everyone behind the same address
+func (s *ssoService) lockoutPolicy(scope domainLockout.Scope) domainLockout.Policy {
+	if scope == domainLockout.ScopeIP {
+		return domainLockout.Policy{
+			Threshold: s.cfg.Lockout.IPThreshold,
+			Lockout:   s.cfg.Lockout.Duration,
+		}
+	}
+
+	return domainLockout.Policy{
+		Threshold: s.cfg.Lockout.Threshold,
+		BaseDelay: s.cfg.Lockout.BaseDelay,
+		MaxDelay:  s.cfg.Lockout.MaxDelay,
+		Lockout:   s.cfg.Lockout.Duration,
+	}
+}
+
+// reserveLogin charges the attempt to the account n' the ip before the password is checked, so parallel guesses
+// can't pass the threshold. It returns RetryAfterError, if they have to wait before the next attempt.
+// Errors of redis don't block logins, the password is still checked
+func (s *ssoService) reserveLogin(ctx context.Context, email, ip string) (*loginAttempt, error) {
+	attempts := s.loginAttempts(email, ip)
+
+	numbers, blockedUntil, err := s.attempts.Reserve(ctx, attempts, s.cfg.Lockout.Window)
+	if err != nil {
+		s.log.Error("failed to reserve login attempt", slog.String("error", err.Error()))
+		return &loginAttempt{settled: true}, nil
+	}
+
+	if retryAfter := time.Until(blockedUntil); retryAfter > 0 {
+		return nil, &consts.RetryAfterError{
+			RetryAfter: retryAfter,
+			Reason:     consts.RetryReasonAccountLocked,
+		}
+	}
+
+	return &loginAttempt{
+		attempts: attempts,
+		numbers:  numbers,
+	}, nil
+}
+
+// failLogin confirms the reservation as a failure, blocks the account n' the ip for the delay of the policy
+// n' returns ErrInvalidCredentials, the block is reported on the next attempt
+func (s *ssoService) failLogin(ctx context.Context, attempt *loginAttempt) error {
+	if attempt.settled {
+		return consts.ErrInvalidCredentials
+	}
+	attempt.settled = true
+
+	for i, a := range attempt.attempts {
+		failures := attempt.numbers[i]
+
+		delay, locked := a.Policy.Delay(failures)
+		if delay <= 0 {
+			continue
+		}
+
+		until := time.Now().UTC().Add(delay)
+		if err := s.attempts.Block(ctx, a.Scope, a.Subject, until); err != nil {
+			s.log.Error("failed to block attempts", slog.String("scope", string(a.Scope)), slog.String("error", err.Error()))
+			continue
+		}
+
+		if locked {
+			s.log.Warn("login is locked out", slog.String("scope", string(a.Scope)), slog.Int64("failures", failures))
+
+			go s.ch.SaveLockoutEvent(context.TODO(), &observability.LockoutEvent{
+				Scope:       string(a.Scope),
+				Subject:     a.Subject,
+				Failures:    failures,
+				LockedUntil: until,
+			})
+		}
+	}
+
+	return consts.ErrInvalidCredentials
+}
+
+// resetLockout forgets failures of the account after the successful login. The counter of the ip only gets
+// its reservation back, otherwise an attacker could clear it by logging into their own account between guesses
+func (s *ssoService) resetLockout(ctx context.Context, attempt *loginAttempt) {
+	if attempt.settled {
+		return
+	}
+	attempt.settled = true
+
+	others := make([]domainLockout.Attempt, 0, len(attempt.attempts))
+	for _, a := range attempt.attempts {
+		if a.Scope != domainLockout.ScopeAccount {
+			others = append(others, a)
+			continue
+		}
+
+		s.resetAccountLockout(ctx, a.Subject)
+	}
+
+	if err := s.attempts.Release(ctx, others); err != nil {
+		s.log.Error("failed to release login attempt", slog.String("error", err.Error()))
+	}
+}
+
+// resetAccountLockout forgets failures of the account, users with mfa get it after the second factor
+func (s *ssoService) resetAccountLockout(ctx context.Context, email string) {
+	if err := s.attempts.Reset(ctx, domainLockout.ScopeAccount, strings.ToLower(email)); err != nil {
+		s.log.Error("failed to reset failed logins", slog.String("error", err.Error()))
+	}
+}
+
+// releaseLogin takes back the reservation of the login, which has ended neither with a wrong password
+// nor with tokens, e.g. the hasher is overloaded
+func (s *ssoService) releaseLogin(ctx context.Context, attempt *loginAttempt) {
+	if attempt.settled {
+		return
+	}
+	attempt.settled = true
+
+	if err := s.attempts.Release(ctx, attempt.attempts); err != nil {
+		s.log.Error("failed to release login attempt", slog.String("error", err.Error()))
+	}
+}
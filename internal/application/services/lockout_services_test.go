@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	lockoutEmail    = "lockout@example.com"
+	lockoutPassword = "correct horse battery staple"
+)
+
+// countingHasher counts password checks, each check is a guess
+type countingHasher struct {
+	fakeHasher
+	verified atomic.Int64
+}
+
+func (h *countingHasher) Verify(ctx context.Context, password, hash string) (bool, error) {
+	h.verified.Add(1)
+	return h.fakeHasher.Verify(ctx, password, hash)
+}
+
+func contextFromIP(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 51000},
+	})
+}
+
+// login waits out the delay of the previous failure, the policy of tests delays for a millisecond
+func (e *testEnv) login(ctx context.Context, password string) error {
+	time.Sleep(2 * time.Millisecond)
+
+	_, err := e.svc.Login(ctx, &staffy.LoginRequest{Email: lockoutEmail, Password: password})
+	return err
+}
+
+func TestLoginLockout(t *testing.T) {
+	tests := []struct {
+		name string
+		// passwords are tried one by one, the last one is checked against wantErr
+		passwords []string
+		wantErr   error
+	}{
+		{
+			name:      "failures under the threshold",
+			passwords: []string{"wrong", "wrong", "wrong"},
+			wantErr:   consts.ErrInvalidCredentials,
+		},
+		{
+			name:      "threshold locks out even the right password",
+			passwords: []string{"wrong", "wrong", "wrong", lockoutPassword},
+			wantErr:   consts.ErrTooManyAttempts,
+		},
+		{
+			name:      "successful login resets the account",
+			passwords: []string{"wrong", "wrong", lockoutPassword, "wrong", "wrong", lockoutPassword},
+			wantErr:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.newUser(t, lockoutEmail, lockoutPassword)
+
+			var err error
+			for _, password := range tt.passwords {
+				err = env.login(t.Context(), password)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+
+			var retry *consts.RetryAfterError
+			if errors.As(err, &retry) {
+				if retry.Reason != consts.RetryReasonAccountLocked {
+					t.Fatalf("got reason %q, want %q", retry.Reason, consts.RetryReasonAccountLocked)
+				}
+				if retry.RetryAfter <= 14*time.Minute {
+					t.Fatalf("got retry after %s, want about the lockout duration", retry.RetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginLockoutOfParallelGuesses(t *testing.T) {
+	env := newTestEnv(t)
+	env.newUser(t, lockoutEmail, lockoutPassword)
+
+	hasher := &countingHasher{}
+	env.svc.hasher = hasher
+
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := env.svc.Login(t.Context(), &staffy.LoginRequest{Email: lockoutEmail, Password: "wrong"})
+			if !errors.Is(err, consts.ErrInvalidCredentials) && !errors.Is(err, consts.ErrTooManyAttempts) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := hasher.verified.Load(); got > env.svc.cfg.Lockout.Threshold {
+		t.Fatalf("%d passwords are checked, the threshold is %d", got, env.svc.cfg.Lockout.Threshold)
+	}
+}
+
+func TestLoginLockoutOfIP(t *testing.T) {
+	env := newTestEnv(t)
+	env.newUser(t, lockoutEmail, lockoutPassword)
+	ctx := contextFromIP("203.0.113.7")
+
+	// Failures of the ip are kept after the successful login, so guesses between own logins still count
+	for range 2 {
+		for range 2 {
+			if err := env.login(ctx, "wrong"); !errors.Is(err, consts.ErrInvalidCredentials) {
+				t.Fatalf("got %v, want %v", err, consts.ErrInvalidCredentials)
+			}
+		}
+		if err := env.login(ctx, lockoutPassword); err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+	}
+
+	if got, _ := env.redis.Get("{lockout}:attempts:ip:203.0.113.7"); got != "4" {
+		t.Fatalf("ip counter: got %s, want 4", got)
+	}
+
+	for range 2 {
+		if err := env.login(ctx, "wrong"); !errors.Is(err, consts.ErrInvalidCredentials) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidCredentials)
+		}
+	}
+	if err := env.login(ctx, lockoutPassword); !errors.Is(err, consts.ErrTooManyAttempts) {
+		t.Fatalf("got %v, want %v", err, consts.ErrTooManyAttempts)
+	}
+
+	// Other addresses aren't affected
+	if err := env.login(contextFromIP("198.51.100.1"), lockoutPassword); err != nil {
+		t.Fatalf("login from another ip failed: %v", err)
+	}
+}
+
+func TestLoginReleasesAttemptWhichHasntFailed(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Account.UnverifiedPolicy = UnverifiedBlock
+	})
+
+	addr, _ := domain.NewEmail(lockoutEmail)
+	user, err := domain.NewUser(t.Context(), addr, "Test", "User", lockoutPassword, false, fakeHasher{})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := env.users.Save(t.Context(), user); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+
+	ctx := contextFromIP("203.0.113.7")
+	for range 5 {
+		if err := env.login(ctx, lockoutPassword); !errors.Is(err, consts.ErrEmailNotVerified) {
+			t.Fatalf("got %v, want %v", err, consts.ErrEmailNotVerified)
+		}
+	}
+
+	if got, _ := env.redis.Get("{lockout}:attempts:account:" + lockoutEmail); got != "0" {
+		t.Fatalf("account counter: got %s, want 0", got)
+	}
+	if got, _ := env.redis.Get("{lockout}:attempts:ip:203.0.113.7"); got != "0" {
+		t.Fatalf("ip counter: got %s, want 0", got)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainToken "github.com/devathh/staffy-sso/internal/domain/token"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/codes"
+)
+
+// RequestMagicLink mails a single-use login link. Like RequestPasswordReset,
+// the response doesn't tell whether the account exists.
+func (s *ssoService) RequestMagicLink(ctx context.Context, req *staffy.MagicLinkRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	email, err := domain.NewEmail(strings.TrimSpace(req.GetEmail()))
+	if err != nil {
+		return nil, consts.ErrInvalidEmail
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	resp := &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "if the account exists, the login link has been sent",
+	}
+
+	user, err := s.persistence.GetByEmail(ctxTimeout, email.String())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return resp, nil
+		}
+
+		s.log.Error("failed to get user by email", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	s.sendMagicLink(user)
+
+	go s.saveLog(context.TODO(), staffy.SSO_RequestMagicLink_FullMethodName, time.Since(start), int(codes.OK), false)
+	return resp, nil
+}
+
+// sendMagicLink issues the token n' mails the link in background. Both branches of RequestMagicLink end
+// right after the lookup, so the response time doesn't tell whether the account exists.
+func (s *ssoService) sendMagicLink(user *domain.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.RWTimeout)
+		defer cancel()
+
+		token, rawToken, err := domainToken.NewActionToken(
+			domainToken.PurposeMagicLink,
+			user.ID(),
+			user.Email(),
+			s.cfg.Account.MagicLinkTTL,
+		)
+		if err != nil {
+			s.log.Error("failed to generate magic link token", slog.String("error", err.Error()))
+			return
+		}
+
+		if err := s.actionTokens.Save(ctx, token); err != nil {
+			s.log.Error("failed to save magic link token", slog.String("error", err.Error()),
+				slog.String("user_id", user.ID().String()))
+			return
+		}
+
+		link, err := RedirectWithParams(s.cfg.Account.MagicLinkURL, url.Values{"token": {rawToken}})
+		if err != nil {
+			s.log.Error("failed to build magic link", slog.String("error", err.Error()))
+			return
+		}
+
+		s.sendMail(&domainMail.Message{
+			To:      user.Email(),
+			Subject: "Sign in to Staffy",
+			Body: fmt.Sprintf("Hi %s,\r\n\r\nFollow the link to sign in: %s\r\n\r\n"+
+				"The link expires in %s n' works once. If you didn't ask to sign in, just ignore this email.",
+				user.Name(), link, s.cfg.Account.MagicLinkTTL),
+		})
+	}()
+}
+
+// RedeemMagicLink signs the user in by the token from the link. Following the link proves the email,
+// so it's verified too. Users with enabled mfa get the challenge like in Login.
+func (s *ssoService) RedeemMagicLink(ctx context.Context, req *staffy.RedeemMagicLinkRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	rawToken := strings.TrimSpace(req.GetToken())
+	if rawToken == "" {
+		return nil, consts.ErrNilToken
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	token, err := s.consumeActionToken(ctxTimeout, domainToken.PurposeMagicLink, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links sent before the password was changed or the user was deleted don't work
+	if err := s.checkActionTokenRevocation(ctxTimeout, token); err != nil {
+		return nil, err
+	}
+
+	// The user is found by the email, the link was sent to, n' must be the same one
+	user, err := s.persistence.GetByEmail(ctxTimeout, token.Email())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to get user by email", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+	if user.ID() != token.UserID() {
+		return nil, consts.ErrInvalidToken
+	}
+
+	if !user.IsEmailVerified() {
+		if err := user.VerifyEmail(token.Email()); err != nil {
+			return nil, consts.ErrInvalidToken
+		}
+
+		if err := s.persistence.Update(ctxTimeout, user); err != nil {
+			s.log.Error("failed to update user", slog.String("error", err.Error()))
+			return nil, consts.ErrDatabase
+		}
+
+		if err := s.cache.Delete(ctxTimeout, user); err != nil {
+			s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+				slog.String("user_id", user.ID().String()))
+			return nil, consts.ErrCache
+		}
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_RedeemMagicLink_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.startLogin(ctxTimeout, user)
+}
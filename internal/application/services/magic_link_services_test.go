@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainToken "github.com/devathh/staffy-sso/internal/domain/token"
+)
+
+// linkPattern matches links to the frontend, which are sent in mails
+var linkPattern = regexp.MustCompile(`https://staffy\.test/\S+`)
+
+// failingActionTokens fails to save tokens, the rest is passed to the real store
+type failingActionTokens struct {
+	domainToken.ActionTokenRepository
+}
+
+func (failingActionTokens) Save(context.Context, *domainToken.ActionToken) error {
+	return errors.New("cache is unavailable")
+}
+
+// receiveMail waits for the message sent in background
+func (e *testEnv) receiveMail(t *testing.T) *domainMail.Message {
+	t.Helper()
+
+	select {
+	case msg := <-e.mail.sent:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("mail hasn't been sent")
+		return nil
+	}
+}
+
+// receiveToken waits for the mail to the email n' returns the token of its link
+func (e *testEnv) receiveToken(t *testing.T, email string) string {
+	t.Helper()
+
+	msg := e.receiveMail(t)
+	if msg.To != email {
+		t.Fatalf("mail is sent to %s, want %s", msg.To, email)
+	}
+
+	return linkToken(t, msg)
+}
+
+func linkToken(t *testing.T, msg *domainMail.Message) string {
+	t.Helper()
+
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	if err != nil {
+		t.Fatalf("invalid link: %v", err)
+	}
+	token := link.Query().Get("token")
+	if token == "" {
+		t.Fatal("link has no token")
+	}
+
+	return token
+}
+
+func (e *testEnv) assertNoMail(t *testing.T) {
+	t.Helper()
+
+	select {
+	case msg := <-e.mail.sent:
+		t.Fatalf("unexpected mail to %s", msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRequestMagicLinkResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		// failSave breaks the token store, the response mustn't depend on it
+		failSave bool
+		wantMail bool
+	}{
+		{name: "existing account", email: "magic@example.com", wantMail: true},
+		{name: "unknown account", email: "unknown@example.com", wantMail: false},
+		{name: "existing account with broken token store", email: "magic@example.com", failSave: true, wantMail: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.newUser(t, "magic@example.com", "correct horse battery staple")
+			if tt.failSave {
+				env.svc.actionTokens = failingActionTokens{ActionTokenRepository: env.svc.actionTokens}
+			}
+
+			resp, err := env.svc.RequestMagicLink(t.Context(), &staffy.MagicLinkRequest{Email: tt.email})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusMessage != "if the account exists, the login link has been sent" {
+				t.Fatalf("unexpected response: %q", resp.StatusMessage)
+			}
+
+			if !tt.wantMail {
+				env.assertNoMail(t)
+				return
+			}
+
+			if msg := env.receiveMail(t); msg.To != tt.email {
+				t.Fatalf("mail is sent to %s, want %s", msg.To, tt.email)
+			}
+		})
+	}
+}
+
+func TestRequestMagicLinkThenRedeem(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, "magic@example.com", "correct horse battery staple")
+
+	if _, err := env.svc.RequestMagicLink(t.Context(), &staffy.MagicLinkRequest{Email: user.Email()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token := env.receiveToken(t, user.Email())
+
+	resp, err := env.svc.RedeemMagicLink(t.Context(), &staffy.RedeemMagicLinkRequest{Token: token})
+	if err != nil {
+		t.Fatalf("failed to redeem link: %v", err)
+	}
+	if resp.Token == "" {
+		t.Fatal("tokens aren't issued")
+	}
+
+	if _, err := env.svc.RedeemMagicLink(t.Context(), &staffy.RedeemMagicLinkRequest{Token: token}); err == nil {
+		t.Fatal("link is redeemed twice")
+	}
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMFA "github.com/devathh/staffy-sso/internal/domain/mfa"
+	domainToken "github.com/devathh/staffy-sso/internal/domain/token"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/internal/lib/totp"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// EnrollTOTP generates a new secret for the authenticator app. The login isn't protected by it,
+// until the user confirms it with the first code.
+func (s *ssoService) EnrollTOTP(ctx context.Context, req *staffy.EnrollTOTPRequest) (*staffy.EnrollTOTPResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUserByID(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// An unconfirmed enrollment is replaced, the user may have lost the first qr code
+	current, err := s.getTOTP(ctxTimeout, user.ID())
+	if err != nil && !errors.Is(err, consts.ErrMFANotEnrolled) {
+		return nil, err
+	}
+	if current != nil && current.IsConfirmed() {
+		return nil, consts.ErrMFAAlreadyEnabled
+	}
+
+	secret, uri, err := totp.Generate(s.cfg.Account.MFAIssuer, user.Email())
+	if err != nil {
+		s.log.Error("failed to generate totp secret", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	enrollment, err := domainMFA.NewTOTP(user.ID(), secret)
+	if err != nil {
+		s.log.Error("failed to create totp", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	if err := s.totps.Save(ctxTimeout, enrollment); err != nil {
+		s.log.Error("failed to save totp", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_EnrollTOTP_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    uri,
+	}, nil
+}
+
+// ConfirmTOTP enables the second factor n' returns recovery codes. They are shown only once.
+func (s *ssoService) ConfirmTOTP(ctx context.Context, req *staffy.ConfirmTOTPRequest) (*staffy.RecoveryCodesResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	code := strings.TrimSpace(req.GetCode())
+	if code == "" {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := s.getTOTP(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.IsConfirmed() {
+		return nil, consts.ErrMFAAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(enrollment.Secret(), code, time.Now().UTC())
+	if !ok {
+		return nil, consts.ErrInvalidMFACode
+	}
+
+	recoveryCodes, err := enrollment.Confirm(step)
+	if err != nil {
+		s.log.Error("failed to confirm totp", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	// The parallel confirmation has won, its recovery codes are the valid ones
+	if err := s.totps.Update(ctxTimeout, enrollment); err != nil {
+		switch {
+		case errors.Is(err, consts.ErrVersionConflict):
+			return nil, consts.ErrMFAAlreadyEnabled
+		case errors.Is(err, consts.ErrMFANotEnrolled):
+			return nil, consts.ErrMFANotEnrolled
+		}
+
+		s.log.Error("failed to update totp", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_ConfirmTOTP_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.RecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// DisableTOTP removes the second factor or an unconfirmed enrollment. The password is asked again,
+// a stolen access token isn't enough to turn the mfa off.
+func (s *ssoService) DisableTOTP(ctx context.Context, req *staffy.DisableTOTPRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	if req.GetPassword() == "" {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	// The user is taken from the db, the cache may keep the old password
+	user, err := s.persistence.GetByID(ctxTimeout, claims.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrUserDoesntExist
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	ok, err := user.CheckThePassword(ctxTimeout, req.GetPassword(), s.hasher)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, consts.ErrInvalidCredentials
+	}
+
+	if err := s.totps.Delete(ctxTimeout, user.ID()); err != nil {
+		if errors.Is(err, consts.ErrMFANotEnrolled) {
+			return nil, consts.ErrMFANotEnrolled
+		}
+
+		s.log.Error("failed to delete totp", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_DisableTOTP_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "mfa has been disabled",
+	}, nil
+}
+
+// VerifyMFA is the second step of the login. It takes the challenge n' either a code from the app
+// or one of recovery codes. The challenge is burnt by the first attempt, so a wrong code means a new login.
+func (s *ssoService) VerifyMFA(ctx context.Context, req *staffy.VerifyMFARequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	challenge := strings.TrimSpace(req.GetChallenge())
+	if challenge == "" {
+		return nil, consts.ErrNilToken
+	}
+
+	code, recoveryCode := strings.TrimSpace(req.GetCode()), strings.TrimSpace(req.GetRecoveryCode())
+	if (code == "") == (recoveryCode == "") {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	token, err := s.consumeActionToken(ctxTimeout, domainToken.PurposeMFAChallenge, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	// The password may have been changed since the first step
+	if err := s.checkActionTokenRevocation(ctxTimeout, token); err != nil {
+		return nil, err
+	}
+
+	user, err := s.persistence.GetByID(ctxTimeout, token.UserID())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+	if user.Email() != token.Email() {
+		return nil, consts.ErrInvalidToken
+	}
+
+	enrollment, err := s.getTOTP(ctxTimeout, user.ID())
+	if err != nil {
+		if errors.Is(err, consts.ErrMFANotEnrolled) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		return nil, err
+	}
+
+	if code != "" {
+		step, ok := totp.Validate(enrollment.Secret(), code, time.Now().UTC())
+		if !ok || enrollment.UseStep(step) != nil {
+			return nil, consts.ErrInvalidMFACode
+		}
+	} else if !enrollment.UseRecoveryCode(recoveryCode) {
+		return nil, consts.ErrInvalidMFACode
+	}
+
+	// A parallel login has used a code first, it may be the same one
+	if err := s.totps.Update(ctxTimeout, enrollment); err != nil {
+		switch {
+		case errors.Is(err, consts.ErrVersionConflict):
+			return nil, consts.ErrInvalidMFACode
+		case errors.Is(err, consts.ErrMFANotEnrolled):
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to update totp", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	// Failures of the password are forgotten only now, the password alone isn't a successful login
+	s.resetAccountLockout(ctxTimeout, user.Email())
+
+	go s.saveLog(context.TODO(), staffy.SSO_VerifyMFA_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.toAuthResponse(ctxTimeout, user, newSession())
+}
+
+// startLogin issues tokens to the user, who has entered the password. Users with confirmed totp
+// get only the challenge, which is exchanged for tokens by VerifyMFA.
+func (s *ssoService) startLogin(ctx context.Context, user *domain.User) (*staffy.AuthResponse, error) {
+	enrollment, err := s.getTOTP(ctx, user.ID())
+	if err != nil && !errors.Is(err, consts.ErrMFANotEnrolled) {
+		return nil, err
+	}
+	if enrollment == nil || !enrollment.IsConfirmed() {
+		return s.toAuthResponse(ctx, user, newSession())
+	}
+
+	token, rawToken, err := domainToken.NewActionToken(
+		domainToken.PurposeMFAChallenge,
+		user.ID(),
+		user.Email(),
+		s.cfg.Account.MFAChallengeTTL,
+	)
+	if err != nil {
+		s.log.Error("failed to generate mfa challenge", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	if err := s.actionTokens.Save(ctx, token); err != nil {
+		s.log.Error("failed to save mfa challenge", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	// Nothing about the user is returned before the second factor
+	return &staffy.AuthResponse{
+		MfaChallenge: rawToken,
+	}, nil
+}
+
+func (s *ssoService) getTOTP(ctx context.Context, userID uuid.UUID) (*domainMFA.TOTP, error) {
+	enrollment, err := s.totps.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, consts.ErrMFANotEnrolled) {
+			return nil, consts.ErrMFANotEnrolled
+		}
+
+		s.log.Error("failed to get totp", slog.String("error", err.Error()),
+			slog.String("user_id", userID.String()))
+		return nil, consts.ErrDatabase
+	}
+
+	return enrollment, nil
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMFA "github.com/devathh/staffy-sso/internal/domain/mfa"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+)
+
+// enrollTOTP enables the second factor of the user n' returns the secret with recovery codes
+func (e *testEnv) enrollTOTP(t *testing.T, user *domain.User) (string, []string) {
+	t.Helper()
+
+	resp, err := e.svc.toAuthResponse(t.Context(), user, newSession())
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	enrollment, err := e.svc.EnrollTOTP(t.Context(), &staffy.EnrollTOTPRequest{Token: resp.Token})
+	if err != nil {
+		t.Fatalf("failed to enroll totp: %v", err)
+	}
+
+	recovery, err := e.svc.ConfirmTOTP(t.Context(), &staffy.ConfirmTOTPRequest{
+		Token: resp.Token,
+		Code:  totpCode(t, enrollment.Secret, time.Now()),
+	})
+	if err != nil {
+		t.Fatalf("failed to confirm totp: %v", err)
+	}
+
+	return enrollment.Secret, recovery.RecoveryCodes
+}
+
+// challenge passes the first step of the login
+func (e *testEnv) challenge(t *testing.T, user *domain.User) string {
+	t.Helper()
+
+	resp, err := e.svc.startLogin(t.Context(), user)
+	if err != nil {
+		t.Fatalf("failed to start login: %v", err)
+	}
+	if resp.MfaChallenge == "" || resp.Token != "" {
+		t.Fatal("tokens are issued before the second factor")
+	}
+
+	return resp.MfaChallenge
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCode(secret, at)
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+
+	return code
+}
+
+func TestVerifyMFA(t *testing.T) {
+	tests := []struct {
+		name string
+		// code returns the code of the second step, the confirmation has used the current one
+		code         func(t *testing.T, secret string) string
+		recoveryCode func(codes []string) string
+		wantErr      error
+	}{
+		{
+			name: "code of the next step",
+			code: func(t *testing.T, secret string) string {
+				return totpCode(t, secret, time.Now().Add(30*time.Second))
+			},
+			wantErr: nil,
+		},
+		{
+			name: "code of an earlier step is a replay",
+			code: func(t *testing.T, secret string) string {
+				return totpCode(t, secret, time.Now().Add(-30*time.Second))
+			},
+			wantErr: consts.ErrInvalidMFACode,
+		},
+		{
+			name: "code out of the skew",
+			code: func(t *testing.T, secret string) string {
+				return totpCode(t, secret, time.Now().Add(5*time.Minute))
+			},
+			wantErr: consts.ErrInvalidMFACode,
+		},
+		{
+			name:         "recovery code",
+			recoveryCode: func(codes []string) string { return codes[0] },
+			wantErr:      nil,
+		},
+		{
+			name:         "unknown recovery code",
+			recoveryCode: func([]string) string { return "ffffffffff-ffffffffff" },
+			wantErr:      consts.ErrInvalidMFACode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, "mfa@example.com", "correct horse battery staple")
+			secret, recoveryCodes := env.enrollTOTP(t, user)
+
+			req := &staffy.VerifyMFARequest{Challenge: env.challenge(t, user)}
+			if tt.code != nil {
+				req.Code = tt.code(t, secret)
+			} else {
+				req.RecoveryCode = tt.recoveryCode(recoveryCodes)
+			}
+
+			resp, err := env.svc.VerifyMFA(t.Context(), req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && resp.Token == "" {
+				t.Fatal("tokens aren't issued")
+			}
+		})
+	}
+}
+
+func TestVerifyMFAReplay(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, "mfa@example.com", "correct horse battery staple")
+	secret, recoveryCodes := env.enrollTOTP(t, user)
+
+	code := totpCode(t, secret, time.Now().Add(30*time.Second))
+	steps := []struct {
+		name    string
+		req     func(challenge string) *staffy.VerifyMFARequest
+		wantErr error
+	}{
+		{
+			name:    "code is accepted",
+			req:     func(c string) *staffy.VerifyMFARequest { return &staffy.VerifyMFARequest{Challenge: c, Code: code} },
+			wantErr: nil,
+		},
+		{
+			name:    "same code is rejected",
+			req:     func(c string) *staffy.VerifyMFARequest { return &staffy.VerifyMFARequest{Challenge: c, Code: code} },
+			wantErr: consts.ErrInvalidMFACode,
+		},
+		{
+			name: "recovery code is accepted",
+			req: func(c string) *staffy.VerifyMFARequest {
+				return &staffy.VerifyMFARequest{Challenge: c, RecoveryCode: recoveryCodes[1]}
+			},
+			wantErr: nil,
+		},
+		{
+			name: "same recovery code is rejected",
+			req: func(c string) *staffy.VerifyMFARequest {
+				return &staffy.VerifyMFARequest{Challenge: c, RecoveryCode: recoveryCodes[1]}
+			},
+			wantErr: consts.ErrInvalidMFACode,
+		},
+		{
+			name: "other recovery codes are kept",
+			req: func(c string) *staffy.VerifyMFARequest {
+				return &staffy.VerifyMFARequest{Challenge: c, RecoveryCode: recoveryCodes[2]}
+			},
+			wantErr: nil,
+		},
+	}
+
+	for _, step := range steps {
+		if _, err := env.svc.VerifyMFA(t.Context(), step.req(env.challenge(t, user))); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: got %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+}
+
+func TestVerifyMFAChallengeIsSingleUse(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, "mfa@example.com", "correct horse battery staple")
+	_, recoveryCodes := env.enrollTOTP(t, user)
+
+	challenge := env.challenge(t, user)
+	if _, err := env.svc.VerifyMFA(t.Context(), &staffy.VerifyMFARequest{
+		Challenge:    challenge,
+		RecoveryCode: "ffffffffff-ffffffffff",
+	}); !errors.Is(err, consts.ErrInvalidMFACode) {
+		t.Fatalf("got %v, want %v", err, consts.ErrInvalidMFACode)
+	}
+
+	// The wrong attempt has burnt the challenge, a right code needs a new login
+	if _, err := env.svc.VerifyMFA(t.Context(), &staffy.VerifyMFARequest{
+		Challenge:    challenge,
+		RecoveryCode: recoveryCodes[0],
+	}); err == nil {
+		t.Fatal("challenge is accepted twice")
+	}
+}
+
+func TestConfirmTOTPTwice(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, "mfa@example.com", "correct horse battery staple")
+	secret, _ := env.enrollTOTP(t, user)
+
+	resp, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	if _, err := env.svc.ConfirmTOTP(t.Context(), &staffy.ConfirmTOTPRequest{
+		Token: resp.Token,
+		Code:  totpCode(t, secret, time.Now().Add(30*time.Second)),
+	}); !errors.Is(err, consts.ErrMFAAlreadyEnabled) {
+		t.Fatalf("got %v, want %v", err, consts.ErrMFAAlreadyEnabled)
+	}
+	if _, err := env.svc.EnrollTOTP(t.Context(), &staffy.EnrollTOTPRequest{Token: resp.Token}); !errors.Is(err, consts.ErrMFAAlreadyEnabled) {
+		t.Fatalf("re-enrollment: got %v, want %v", err, consts.ErrMFAAlreadyEnabled)
+	}
+}
+
+// barrierTOTPs lets readers go only when all of them have read the enrollment, so parallel logins see the same version
+type barrierTOTPs struct {
+	*fakeTOTPs
+	readers sync.WaitGroup
+}
+
+func (b *barrierTOTPs) GetByUserID(ctx context.Context, userID uuid.UUID) (*domainMFA.TOTP, error) {
+	totp, err := b.fakeTOTPs.GetByUserID(ctx, userID)
+	b.readers.Done()
+	b.readers.Wait()
+	return totp, err
+}
+
+func TestVerifyMFAParallelReuse(t *testing.T) {
+	const logins = 5
+
+	tests := []struct {
+		name string
+		req  func(t *testing.T, secret string, recoveryCodes []string) *staffy.VerifyMFARequest
+	}{
+		{
+			name: "same code",
+			req: func(t *testing.T, secret string, _ []string) *staffy.VerifyMFARequest {
+				return &staffy.VerifyMFARequest{Code: totpCode(t, secret, time.Now().Add(30*time.Second))}
+			},
+		},
+		{
+			name: "same recovery code",
+			req: func(_ *testing.T, _ string, recoveryCodes []string) *staffy.VerifyMFARequest {
+				return &staffy.VerifyMFARequest{RecoveryCode: recoveryCodes[0]}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, "mfa@example.com", "correct horse battery staple")
+			secret, recoveryCodes := env.enrollTOTP(t, user)
+
+			challenges := make([]string, logins)
+			for i := range challenges {
+				challenges[i] = env.challenge(t, user)
+			}
+
+			barrier := &barrierTOTPs{fakeTOTPs: env.totps}
+			barrier.readers.Add(logins)
+			env.svc.totps = barrier
+
+			var accepted atomic.Int64
+			var wg sync.WaitGroup
+			for _, challenge := range challenges {
+				req := tt.req(t, secret, recoveryCodes)
+				req.Challenge = challenge
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					_, err := env.svc.VerifyMFA(t.Context(), req)
+					switch {
+					case err == nil:
+						accepted.Add(1)
+					case !errors.Is(err, consts.ErrInvalidMFACode):
+						t.Errorf("unexpected error: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := accepted.Load(); got != 1 {
+				t.Fatalf("the code is accepted %d times", got)
+			}
+		})
+	}
+}
+
+func TestLoginLockoutWithMFA(t *testing.T) {
+	tests := []struct {
+		name string
+		// verify passes the second factor after the right password
+		verify  bool
+		wantErr error
+	}{
+		{name: "password alone doesn't reset failures", verify: false, wantErr: consts.ErrTooManyAttempts},
+		{name: "second factor resets failures", verify: true, wantErr: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, lockoutEmail, lockoutPassword)
+			secret, _ := env.enrollTOTP(t, user)
+
+			for range 2 {
+				if err := env.login(t.Context(), "wrong"); !errors.Is(err, consts.ErrInvalidCredentials) {
+					t.Fatalf("got %v, want %v", err, consts.ErrInvalidCredentials)
+				}
+			}
+
+			time.Sleep(2 * time.Millisecond)
+			resp, err := env.svc.Login(t.Context(), &staffy.LoginRequest{Email: lockoutEmail, Password: lockoutPassword})
+			if err != nil {
+				t.Fatalf("failed to login: %v", err)
+			}
+			if tt.verify {
+				if _, err := env.svc.VerifyMFA(t.Context(), &staffy.VerifyMFARequest{
+					Challenge: resp.MfaChallenge,
+					Code:      totpCode(t, secret, time.Now().Add(30*time.Second)),
+				}); err != nil {
+					t.Fatalf("failed to verify mfa: %v", err)
+				}
+			}
+
+			// The third failure in a row reaches the threshold
+			if err := env.login(t.Context(), "wrong"); !errors.Is(err, consts.ErrInvalidCredentials) {
+				t.Fatalf("got %v, want %v", err, consts.ErrInvalidCredentials)
+			}
+
+			if err := env.login(t.Context(), lockoutPassword); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,556 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainOAuth "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	ResponseTypeCode = "code"
+
+	GrantTypeAuthorizationCode = domainOAuth.GrantAuthorizationCode
+	GrantTypeRefreshToken      = domainOAuth.GrantRefreshToken
+	GrantTypeClientCredentials = domainOAuth.GrantClientCredentials
+
+	PromptNone    = "none"
+	PromptConsent = "consent"
+)
+
+// AuthorizeRequest holds parameters of the authorization request (RFC 6749 4.1.1, RFC 7636 4.3, OIDC Core 3.1.2.1)
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	Prompt              string
+}
+
+// TokenRequest holds parameters of the token request (RFC 6749 4.1.3, 6)
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+	ClientID     string
+	ClientSecret string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+type OAuthService interface {
+	// Authorize returns the redirect uri with the code, if the user is logged in n' has consented
+	Authorize(ctx context.Context, accessToken string, req *AuthorizeRequest) (string, error)
+	// Consent records the decision of the user n' returns the redirect uri with the code
+	Consent(ctx context.Context, accessToken string, req *AuthorizeRequest, approved bool) (string, error)
+	Token(ctx context.Context, req *TokenRequest) (*TokenResponse, error)
+	// SyncClients registers clients from the config
+	SyncClients(ctx context.Context) error
+}
+
+func (s *ssoService) Authorize(ctx context.Context, accessToken string, req *AuthorizeRequest) (string, error) {
+	if req == nil {
+		return "", consts.ErrNilRequest
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	client, scopes, err := s.validateAuthorizeRequest(ctxTimeout, req)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: accessToken})
+	if err != nil {
+		return "", consts.ErrLoginRequired
+	}
+
+	consent, err := s.consents.Get(ctxTimeout, claims.ID, client.ID())
+	if err != nil {
+		if errors.Is(err, consts.ErrConsentDoesntExist) {
+			return "", consts.ErrConsentRequired
+		}
+
+		s.log.Error("failed to get consent", slog.String("error", err.Error()))
+		return "", consts.ErrDatabase
+	}
+
+	if !consent.Covers(scopes) || hasPrompt(req.Prompt, PromptConsent) {
+		return "", consts.ErrConsentRequired
+	}
+
+	return s.issueCode(ctxTimeout, claims, client, req, scopes)
+}
+
+func (s *ssoService) Consent(ctx context.Context, accessToken string, req *AuthorizeRequest, approved bool) (string, error) {
+	if req == nil {
+		return "", consts.ErrNilRequest
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	client, scopes, err := s.validateAuthorizeRequest(ctxTimeout, req)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: accessToken})
+	if err != nil {
+		return "", consts.ErrLoginRequired
+	}
+
+	if !approved {
+		return "", consts.ErrAccessDenied
+	}
+
+	consent, err := s.consents.Get(ctxTimeout, claims.ID, client.ID())
+	switch {
+	case errors.Is(err, consts.ErrConsentDoesntExist):
+		consent = domainOAuth.NewConsent(claims.ID, client.ID(), scopes)
+	case err != nil:
+		s.log.Error("failed to get consent", slog.String("error", err.Error()))
+		return "", consts.ErrDatabase
+	default:
+		consent.Grant(scopes)
+	}
+
+	if err := s.consents.Save(ctxTimeout, consent); err != nil {
+		s.log.Error("failed to save consent", slog.String("error", err.Error()))
+		return "", consts.ErrDatabase
+	}
+
+	return s.issueCode(ctxTimeout, claims, client, req, scopes)
+}
+
+func (s *ssoService) Token(ctx context.Context, req *TokenRequest) (*TokenResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	client, err := s.authenticateClient(ctxTimeout, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *TokenResponse
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials:
+		if !client.AllowsGrant(req.GrantType) {
+			return nil, consts.ErrUnauthorizedClient
+		}
+	default:
+		return nil, consts.ErrUnsupportedGrantType
+	}
+
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		resp, err = s.exchangeCode(ctxTimeout, client, req)
+	case GrantTypeRefreshToken:
+		resp, err = s.refreshClientToken(ctxTimeout, client, req)
+	case GrantTypeClientCredentials:
+		resp, err = s.issueServiceToken(client, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), "/token", time.Since(start), int(codes.OK), false)
+	return resp, nil
+}
+
+func (s *ssoService) SyncClients(ctx context.Context) error {
+	for _, clientCfg := range s.cfg.OAuth.Clients {
+		client, err := domainOAuth.NewClient(
+			clientCfg.ID,
+			clientCfg.Name,
+			clientCfg.Secret,
+			clientCfg.RedirectURIs,
+			clientCfg.Scopes,
+			clientCfg.GrantTypes,
+		)
+		if err != nil {
+			return fmt.Errorf("invalid client %q: %w", clientCfg.ID, err)
+		}
+
+		if err := s.clients.Save(ctx, client); err != nil {
+			return fmt.Errorf("failed to save client %q: %w", clientCfg.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// validateAuthorizeRequest checks the client n' the redirect uri first: if they're invalid,
+// the user mustn't be redirected anywhere
+func (s *ssoService) validateAuthorizeRequest(ctx context.Context, req *AuthorizeRequest) (*domainOAuth.Client, []string, error) {
+	client, err := s.clients.GetByID(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, consts.ErrClientDoesntExist) {
+			return nil, nil, consts.ErrInvalidClient
+		}
+
+		s.log.Error("failed to get client", slog.String("error", err.Error()))
+		return nil, nil, consts.ErrDatabase
+	}
+
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, nil, consts.ErrInvalidRedirectURI
+	}
+
+	if !client.AllowsGrant(GrantTypeAuthorizationCode) {
+		return nil, nil, consts.ErrUnauthorizedClient
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return nil, nil, consts.ErrUnsupportedResponseType
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != domainOAuth.CodeChallengeMethodS256 {
+		return nil, nil, fmt.Errorf("%w: code_challenge with S256 method is required", consts.ErrInvalidArgs)
+	}
+
+	scopes := domainOAuth.ParseScope(req.Scope)
+	if len(scopes) == 0 || !client.AllowsScopes(scopes) {
+		return nil, nil, consts.ErrInvalidScope
+	}
+
+	// ID tokens signed with the HMAC secret can't be verified by the client
+	if containsScope(scopes, ScopeOpenID) && len(s.jwt.IDTokenSigningAlgorithms()) == 0 {
+		return nil, nil, fmt.Errorf("%w: %w", consts.ErrInvalidScope, consts.ErrOIDCDisabled)
+	}
+
+	return client, scopes, nil
+}
+
+func (s *ssoService) issueCode(ctx context.Context, claims *jwt.CustomClaims, client *domainOAuth.Client, req *AuthorizeRequest, scopes []string) (string, error) {
+	// Tokens issued before auth_time was introduced are as old as the login at most
+	authTime := claims.IssuedAt.Time
+	if claims.AuthTime != nil {
+		authTime = claims.AuthTime.Time
+	}
+
+	code, rawCode, err := domainOAuth.NewAuthorizationCode(
+		client.ID(),
+		claims.ID,
+		req.RedirectURI,
+		scopes,
+		req.CodeChallenge,
+		req.Nonce,
+		authTime,
+		s.cfg.OAuth.CodeTTL,
+	)
+	if err != nil {
+		s.log.Error("failed to generate authorization code", slog.String("error", err.Error()))
+		return "", consts.ErrGenerateToken
+	}
+
+	if err := s.codes.Save(ctx, code); err != nil {
+		s.log.Error("failed to save authorization code", slog.String("error", err.Error()))
+		return "", consts.ErrCache
+	}
+
+	params := url.Values{}
+	params.Set("code", rawCode)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return RedirectWithParams(req.RedirectURI, params)
+}
+
+// authenticateClient checks the secret of confidential clients. Public clients have no secret.
+func (s *ssoService) authenticateClient(ctx context.Context, clientID, secret string) (*domainOAuth.Client, error) {
+	if clientID == "" {
+		return nil, consts.ErrInvalidClient
+	}
+
+	client, err := s.clients.GetByID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, consts.ErrClientDoesntExist) {
+			return nil, consts.ErrInvalidClient
+		}
+
+		s.log.Error("failed to get client", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if client.IsPublic() {
+		if secret != "" {
+			return nil, consts.ErrInvalidClient
+		}
+
+		return client, nil
+	}
+
+	ok, err := client.CheckTheSecret(ctx, secret, s.hasher)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, consts.ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+func (s *ssoService) exchangeCode(ctx context.Context, client *domainOAuth.Client, req *TokenRequest) (*TokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, fmt.Errorf("%w: code n' code_verifier are required", consts.ErrInvalidArgs)
+	}
+
+	hash := domainOAuth.HashCode(req.Code)
+	code, err := s.codes.Consume(ctx, hash)
+	if err != nil {
+		if errors.Is(err, consts.ErrTokenDoesntExist) {
+			if err := s.revokeRedeemedCode(ctx, hash); err != nil {
+				return nil, err
+			}
+
+			return nil, consts.ErrInvalidGrant
+		}
+
+		s.log.Error("failed to consume authorization code", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	if code.IsExpired() ||
+		code.ClientID() != client.ID() ||
+		code.RedirectURI() != req.RedirectURI ||
+		!code.VerifyPKCE(req.CodeVerifier) {
+		return nil, consts.ErrInvalidGrant
+	}
+
+	user, err := s.getUserByID(ctx, code.UserID())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidGrant
+		}
+
+		return nil, err
+	}
+
+	sess := session{
+		familyID: uuid.New(),
+		authTime: code.AuthTime(),
+		clientID: client.ID(),
+		scopes:   code.Scopes(),
+		tokenID:  uuid.NewString(),
+	}
+
+	// The redemption is kept before tokens are issued, so a replay racing with the exchange revokes them too.
+	// Tokens can't outlive refresh ttl, so there's no need to keep it longer
+	if err := s.codes.MarkRedeemed(ctx, hash, domainOAuth.CodeRedemption{
+		FamilyID:      sess.familyID,
+		AccessTokenID: sess.tokenID,
+	}, s.cfg.Secrets.JWT.RefreshTTL); err != nil {
+		s.log.Error("failed to mark authorization code as redeemed", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	tokens, err := s.issueTokens(ctx, user, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := s.toTokenResponse(tokens, code.Scopes())
+	if containsScope(code.Scopes(), ScopeOpenID) {
+		resp.IDToken, err = s.issueIDToken(user, client.ID(), code.Scopes(), code.Nonce(), code.AuthTime())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// revokeRedeemedCode revokes tokens issued for the code, which is presented again (RFC 6749 4.1.2)
+func (s *ssoService) revokeRedeemedCode(ctx context.Context, hash string) error {
+	redemption, err := s.codes.GetRedemption(ctx, hash)
+	if err != nil {
+		if errors.Is(err, consts.ErrTokenDoesntExist) {
+			return nil
+		}
+
+		s.log.Error("failed to get redemption of authorization code", slog.String("error", err.Error()))
+		return consts.ErrCache
+	}
+
+	s.log.Warn("authorization code replay detected, revoking issued tokens",
+		slog.String("family_id", redemption.FamilyID.String()))
+
+	if err := s.refreshTokens.RevokeFamily(ctx, redemption.FamilyID); err != nil {
+		s.log.Error("failed to revoke refresh token family", slog.String("error", err.Error()))
+		return consts.ErrCache
+	}
+
+	// The access token was issued before the replay, so it expires within ttl from now
+	if err := s.revocations.RevokeToken(ctx, redemption.AccessTokenID, time.Now().Add(s.cfg.Secrets.JWT.TTL)); err != nil {
+		s.log.Error("failed to revoke access token", slog.String("error", err.Error()))
+		return consts.ErrCache
+	}
+
+	return nil
+}
+
+func (s *ssoService) refreshClientToken(ctx context.Context, client *domainOAuth.Client, req *TokenRequest) (*TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: refresh_token is required", consts.ErrInvalidArgs)
+	}
+
+	refreshToken, err := s.rotateRefreshToken(ctx, req.RefreshToken, client.ID())
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) {
+			return nil, consts.ErrInvalidGrant
+		}
+
+		return nil, err
+	}
+
+	// The client may narrow the scopes, but not extend them
+	scopes := refreshToken.Scopes()
+	if req.Scope != "" {
+		requested := domainOAuth.ParseScope(req.Scope)
+		for _, scope := range requested {
+			if !containsScope(scopes, scope) {
+				return nil, consts.ErrInvalidScope
+			}
+		}
+		scopes = requested
+	}
+
+	user, err := s.getUserByID(ctx, refreshToken.UserID())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidGrant
+		}
+
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, session{
+		familyID: refreshToken.FamilyID(),
+		authTime: refreshToken.AuthTime(),
+		clientID: client.ID(),
+		scopes:   scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The refreshed ID token has no nonce (OIDC Core 12.2)
+	resp := s.toTokenResponse(tokens, scopes)
+	if containsScope(scopes, ScopeOpenID) {
+		resp.IDToken, err = s.issueIDToken(user, client.ID(), scopes, "", refreshToken.AuthTime())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// issueServiceToken issues the token, which the service acts on its own behalf with.
+// No refresh token is issued, the service just requests a new one (RFC 6749 4.4.3).
+func (s *ssoService) issueServiceToken(client *domainOAuth.Client, req *TokenRequest) (*TokenResponse, error) {
+	scopes := client.Scopes()
+	if req.Scope != "" {
+		scopes = domainOAuth.ParseScope(req.Scope)
+	}
+
+	// There is no user, whom the openid scope could describe
+	if !client.AllowsScopes(scopes) || containsScope(scopes, ScopeOpenID) {
+		return nil, consts.ErrInvalidScope
+	}
+
+	accessToken, err := s.jwt.GenerateServiceToken(client.ID(), scopes)
+	if err != nil {
+		s.log.Error("failed to generate service token", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.OAuth.ServiceTokenTTL.Seconds()),
+		Scope:       domainOAuth.FormatScope(scopes),
+	}, nil
+}
+
+func (s *ssoService) toTokenResponse(tokens *tokenPair, scopes []string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  tokens.accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.cfg.Secrets.JWT.TTL.Seconds()),
+		RefreshToken: tokens.refreshToken,
+		Scope:        domainOAuth.FormatScope(scopes),
+	}
+}
+
+// hasPrompt checks the space-delimited prompt parameter
+func hasPrompt(prompt, value string) bool {
+	return containsScope(strings.Fields(prompt), value)
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedirectWithParams adds the params to the query of the uri, keeping the existing ones
+func RedirectWithParams(uri string, params url.Values) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect uri: %w", err)
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func NewOAuthService(cfg *config.Config, log *slog.Logger, deps Dependencies) OAuthService {
+	return newSSOService(cfg, log, deps)
+}
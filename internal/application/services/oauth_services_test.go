@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	domainOAuth "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+)
+
+const (
+	testVerifier  = "M25iVXpKU3puUjFaYWg3T1NDTDQtcW1ROUY2ZXhKb3h3"
+	testChallenge = "4mdEpB6p5MagxEW3oIN8slvbLftN-gHbZADENGTetNs"
+	testRedirect  = "https://app.example.com/callback"
+)
+
+func newTestClient(t *testing.T) *domainOAuth.Client {
+	t.Helper()
+
+	client, err := domainOAuth.NewClient("app", "App", "", []string{testRedirect}, []string{"profile"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return client
+}
+
+// saveTestCode stores the code of the user for the client n' returns its raw value
+func (e *testEnv) saveTestCode(t *testing.T, client *domainOAuth.Client, userID uuid.UUID) string {
+	t.Helper()
+
+	code, raw, err := domainOAuth.NewAuthorizationCode(client.ID(), userID, testRedirect, []string{"profile"},
+		testChallenge, "", time.Now().UTC(), time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create code: %v", err)
+	}
+	if err := e.svc.codes.Save(t.Context(), code); err != nil {
+		t.Fatalf("failed to save code: %v", err)
+	}
+
+	return raw
+}
+
+func TestExchangeCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     func(code string) *TokenRequest
+		wantErr error
+	}{
+		{
+			name: "valid exchange",
+			req: func(code string) *TokenRequest {
+				return &TokenRequest{Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier}
+			},
+		},
+		{
+			name: "wrong verifier",
+			req: func(code string) *TokenRequest {
+				return &TokenRequest{Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier[:43] + "X"}
+			},
+			wantErr: consts.ErrInvalidGrant,
+		},
+		{
+			name: "wrong redirect uri",
+			req: func(code string) *TokenRequest {
+				return &TokenRequest{Code: code, RedirectURI: "https://evil.example.com", CodeVerifier: testVerifier}
+			},
+			wantErr: consts.ErrInvalidGrant,
+		},
+		{
+			name: "no verifier",
+			req: func(code string) *TokenRequest {
+				return &TokenRequest{Code: code, RedirectURI: testRedirect}
+			},
+			wantErr: consts.ErrInvalidArgs,
+		},
+		{
+			name: "unknown code",
+			req: func(string) *TokenRequest {
+				return &TokenRequest{Code: "unknown", RedirectURI: testRedirect, CodeVerifier: testVerifier}
+			},
+			wantErr: consts.ErrInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, "oauth@example.com", "correct horse battery staple")
+			client := newTestClient(t)
+			raw := env.saveTestCode(t, client, user.ID())
+
+			resp, err := env.svc.exchangeCode(t.Context(), client, tt.req(raw))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (resp.AccessToken == "" || resp.RefreshToken == "") {
+				t.Fatal("tokens aren't issued")
+			}
+		})
+	}
+}
+
+func TestExchangeCodeReplayRevokesTokens(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, "replay@example.com", "correct horse battery staple")
+	client := newTestClient(t)
+	raw := env.saveTestCode(t, client, user.ID())
+	req := &TokenRequest{Code: raw, RedirectURI: testRedirect, CodeVerifier: testVerifier}
+
+	resp, err := env.svc.exchangeCode(t.Context(), client, req)
+	if err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+	if _, err := env.svc.jwt.ValidateToken(t.Context(), resp.AccessToken); err != nil {
+		t.Fatalf("issued access token is invalid: %v", err)
+	}
+
+	if _, err := env.svc.exchangeCode(t.Context(), client, req); !errors.Is(err, consts.ErrInvalidGrant) {
+		t.Fatalf("replayed code: got %v, want %v", err, consts.ErrInvalidGrant)
+	}
+
+	if _, err := env.svc.jwt.ValidateToken(t.Context(), resp.AccessToken); !errors.Is(err, jwt.ErrRevokedToken) {
+		t.Fatalf("access token of replayed code: got %v, want %v", err, jwt.ErrRevokedToken)
+	}
+	if _, err := env.svc.rotateRefreshToken(t.Context(), resp.RefreshToken, client.ID()); !errors.Is(err, consts.ErrInvalidToken) {
+		t.Fatalf("refresh token of replayed code: got %v, want %v", err, consts.ErrInvalidToken)
+	}
+}
+
+func TestTokenClientCredentials(t *testing.T) {
+	billing := domainOAuth.ClientFromPersistence("billing", "Billing", fakeHashPrefix+"billing-secret", nil,
+		[]string{"users:read", "users:write"}, []string{GrantTypeClientCredentials})
+	web := domainOAuth.ClientFromPersistence("web", "Web", fakeHashPrefix+"web-secret", []string{testRedirect},
+		[]string{"profile"}, nil)
+	public := domainOAuth.ClientFromPersistence("spa", "SPA", "", []string{testRedirect}, []string{"profile"}, nil)
+
+	tests := []struct {
+		name      string
+		req       *TokenRequest
+		wantScope string
+		wantErr   error
+	}{
+		{
+			name:      "all scopes of the client",
+			req:       &TokenRequest{ClientID: "billing", ClientSecret: "billing-secret"},
+			wantScope: "users:read users:write",
+		},
+		{
+			name:      "narrower scope",
+			req:       &TokenRequest{ClientID: "billing", ClientSecret: "billing-secret", Scope: "users:read"},
+			wantScope: "users:read",
+		},
+		{
+			name:    "scope of another client",
+			req:     &TokenRequest{ClientID: "billing", ClientSecret: "billing-secret", Scope: "users:read profile"},
+			wantErr: consts.ErrInvalidScope,
+		},
+		{
+			name:    "openid scope",
+			req:     &TokenRequest{ClientID: "billing", ClientSecret: "billing-secret", Scope: "openid"},
+			wantErr: consts.ErrInvalidScope,
+		},
+		{
+			name:    "wrong secret",
+			req:     &TokenRequest{ClientID: "billing", ClientSecret: "web-secret"},
+			wantErr: consts.ErrInvalidClient,
+		},
+		{
+			name:    "no secret",
+			req:     &TokenRequest{ClientID: "billing"},
+			wantErr: consts.ErrInvalidClient,
+		},
+		{
+			name:    "unknown client",
+			req:     &TokenRequest{ClientID: "unknown", ClientSecret: "billing-secret"},
+			wantErr: consts.ErrInvalidClient,
+		},
+		{
+			name:    "client without the grant",
+			req:     &TokenRequest{ClientID: "web", ClientSecret: "web-secret"},
+			wantErr: consts.ErrUnauthorizedClient,
+		},
+		{
+			name:    "public client",
+			req:     &TokenRequest{ClientID: "spa"},
+			wantErr: consts.ErrUnauthorizedClient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			for _, client := range []*domainOAuth.Client{billing, web, public} {
+				if err := env.clients.Save(t.Context(), client); err != nil {
+					t.Fatalf("failed to save client: %v", err)
+				}
+			}
+
+			tt.req.GrantType = GrantTypeClientCredentials
+			resp, err := env.svc.Token(t.Context(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if resp.RefreshToken != "" || resp.Scope != tt.wantScope {
+				t.Fatalf("unexpected response: %+v", resp)
+			}
+
+			claims, err := env.svc.jwt.ValidateToken(t.Context(), resp.AccessToken)
+			if err != nil {
+				t.Fatalf("service token is invalid: %v", err)
+			}
+			if !claims.IsService() || claims.ClientID != "billing" || claims.Subject != "billing" ||
+				claims.Scope != tt.wantScope || claims.Kind() != jwt.TokenKindService {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
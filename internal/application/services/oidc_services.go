@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	domainOAuth "github.com/devathh/staffy-sso/internal/domain/oauth"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	jwtv5 "github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// ScopeOpenID makes the request an OpenID Connect one: the client gets an ID token n' access to userinfo
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// UserInfo holds standard claims of the user (OIDC Core 5.1), only granted ones are set
+type UserInfo struct {
+	Subject    string `json:"sub"`
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Email      string `json:"email,omitempty"`
+	// EmailVerified is set along with Email
+	EmailVerified *bool `json:"email_verified,omitempty"`
+}
+
+// ProviderMetadata is the OpenID Provider configuration (OIDC Discovery 3)
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type OIDCService interface {
+	// UserInfo returns claims of the user, which the access token of the client is allowed to see
+	UserInfo(ctx context.Context, accessToken string) (*UserInfo, error)
+	// Discovery returns ErrOIDCDisabled, if the active jwt key is symmetric
+	Discovery() (*ProviderMetadata, error)
+}
+
+func (s *ssoService) UserInfo(ctx context.Context, accessToken string) (*UserInfo, error) {
+	start := time.Now().UTC()
+
+	accessToken = strings.TrimSpace(accessToken)
+	if accessToken == "" {
+		return nil, consts.ErrNilToken
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.jwt.ValidateToken(ctxTimeout, accessToken)
+	if err != nil {
+		s.log.Warn("invalid token detected", slog.String("error", err.Error()))
+		return nil, consts.ErrInvalidToken
+	}
+
+	// Only tokens issued to clients with openid scope are accepted here
+	scopes := domainOAuth.ParseScope(claims.Scope)
+	if !claims.IsDelegated() || !containsScope(scopes, ScopeOpenID) {
+		return nil, consts.ErrInvalidToken
+	}
+
+	user, err := s.getUserByID(ctxTimeout, claims.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), "/userinfo", time.Since(start), int(codes.OK), false)
+	return toUserInfo(user, scopes), nil
+}
+
+func (s *ssoService) Discovery() (*ProviderMetadata, error) {
+	algorithms := s.jwt.IDTokenSigningAlgorithms()
+	if len(algorithms) == 0 {
+		return nil, consts.ErrOIDCDisabled
+	}
+
+	issuer := strings.TrimSuffix(s.cfg.Secrets.JWT.Issuer, "/")
+
+	return &ProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:            []string{ResponseTypeCode},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{domainOAuth.CodeChallengeMethodS256},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "given_name", "family_name", "email", "email_verified",
+		},
+	}, nil
+}
+
+// issueIDToken issues the ID token for the client, profile claims are filtered by scopes
+func (s *ssoService) issueIDToken(user *domain.User, clientID string, scopes []string, nonce string, authTime time.Time) (string, error) {
+	info := toUserInfo(user, scopes)
+
+	claims := &jwt.IDTokenClaims{
+		Nonce:      nonce,
+		Name:       info.Name,
+		GivenName:  info.GivenName,
+		FamilyName: info.FamilyName,
+		Email:      info.Email,
+
+		EmailVerified: info.EmailVerified,
+		RegisteredClaims: jwtv5.RegisteredClaims{
+			Subject:  info.Subject,
+			Audience: jwtv5.ClaimStrings{clientID},
+		},
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = jwtv5.NewNumericDate(authTime)
+	}
+
+	idToken, err := s.jwt.GenerateIDToken(claims)
+	if err != nil {
+		s.log.Error("failed to generate id token", slog.String("error", err.Error()))
+		return "", consts.ErrGenerateToken
+	}
+
+	return idToken, nil
+}
+
+func toUserInfo(user *domain.User, scopes []string) *UserInfo {
+	info := &UserInfo{
+		Subject: user.ID().String(),
+	}
+
+	if containsScope(scopes, ScopeProfile) {
+		info.GivenName = user.Name()
+		info.FamilyName = user.Surname()
+		info.Name = strings.TrimSpace(user.Name() + " " + user.Surname())
+	}
+
+	if containsScope(scopes, ScopeEmail) {
+		verified := user.IsEmailVerified()
+		info.Email = user.Email()
+		info.EmailVerified = &verified
+	}
+
+	return info
+}
+
+func NewOIDCService(cfg *config.Config, log *slog.Logger, deps Dependencies) OIDCService {
+	return newSSOService(cfg, log, deps)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+// withEdDSAKey makes the service sign tokens with a new EdDSA key
+func withEdDSAKey(t *testing.T) func(*config.Config) {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "private.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return func(cfg *config.Config) {
+		cfg.Secrets.JWT.Algorithm = jwt.AlgorithmEdDSA
+		cfg.Secrets.JWT.PrivateKeyPath = path
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	t.Run("symmetric key", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		if _, err := env.svc.Discovery(); !errors.Is(err, consts.ErrOIDCDisabled) {
+			t.Fatalf("got %v, want %v", err, consts.ErrOIDCDisabled)
+		}
+	})
+
+	t.Run("asymmetric key", func(t *testing.T) {
+		env := newTestEnv(t, withEdDSAKey(t))
+
+		metadata, err := env.svc.Discovery()
+		if err != nil {
+			t.Fatalf("failed to get discovery: %v", err)
+		}
+		if !slices.Equal(metadata.IDTokenSigningAlgValuesSupported, []string{jwt.AlgorithmEdDSA}) {
+			t.Fatalf("got %v, want [%s]", metadata.IDTokenSigningAlgValuesSupported, jwt.AlgorithmEdDSA)
+		}
+	})
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainOrg "github.com/devathh/staffy-sso/internal/domain/organization"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// CreateOrganization creates the company on behalf of the recruiter, who becomes its owner
+func (s *ssoService) CreateOrganization(ctx context.Context, req *staffy.CreateOrganizationRequest) (*staffy.Organization, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUserByID(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsRecruiter() {
+		return nil, consts.ErrAccessDenied
+	}
+
+	organization, err := domainOrg.NewOrganization(req.GetName(), user.ID())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	if err := s.organizations.Save(ctxTimeout, organization); err != nil {
+		s.log.Error("failed to save organization", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_CreateOrganization_FullMethodName, time.Since(start), int(codes.OK), false)
+	return toStaffyOrganization(organization, domainOrg.RoleOwner), nil
+}
+
+// InviteMember mails the invitation to the email. Only owners n' admins can invite.
+func (s *ssoService) InviteMember(ctx context.Context, req *staffy.InviteMemberRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	email, err := domain.NewEmail(strings.TrimSpace(req.GetEmail()))
+	if err != nil {
+		return nil, consts.ErrInvalidEmail
+	}
+
+	role, err := domainOrg.ParseInvitedRole(req.GetRole())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	organization, member, err := s.getMembership(ctxTimeout, req.GetOrganizationId(), claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !member.Role().CanInvite() {
+		return nil, consts.ErrAccessDenied
+	}
+
+	invitee, err := s.persistence.GetByEmail(ctxTimeout, email.String())
+	if err == nil {
+		if _, ok := organization.Member(invitee.ID()); ok {
+			return nil, consts.ErrAlreadyMember
+		}
+	} else if !errors.Is(err, consts.ErrUserDoesntExist) {
+		s.log.Error("failed to get user by email", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	invitation, rawToken, err := domainOrg.NewInvitation(
+		organization.ID(),
+		email.String(),
+		role,
+		claims.ID,
+		s.cfg.Account.InvitationTTL,
+	)
+	if err != nil {
+		s.log.Error("failed to generate invitation", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	if err := s.invitations.Save(ctxTimeout, invitation); err != nil {
+		s.log.Error("failed to save invitation", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	link, err := RedirectWithParams(s.cfg.Account.InvitationURL, url.Values{"token": {rawToken}})
+	if err != nil {
+		s.log.Error("failed to build invitation link", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	s.sendMail(&domainMail.Message{
+		To:      email.String(),
+		Subject: fmt.Sprintf("Join %s on Staffy", organization.Name()),
+		Body: fmt.Sprintf("Hi,\r\n\r\nYou have been invited to join %s on Staffy as %s. "+
+			"Sign in or sign up with this email n' follow the link: %s\r\n\r\nThe link expires in %s.",
+			organization.Name(), role, link, s.cfg.Account.InvitationTTL),
+	})
+
+	go s.saveLog(context.TODO(), staffy.SSO_InviteMember_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "invitation has been sent",
+	}, nil
+}
+
+// AcceptInvitation adds the owner of the token to the organization. The user must own the invited email.
+func (s *ssoService) AcceptInvitation(ctx context.Context, req *staffy.AcceptInvitationRequest) (*staffy.Organization, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	rawInvitation := strings.TrimSpace(req.GetInvitationToken())
+	if rawInvitation == "" {
+		return nil, fmt.Errorf("%w: invitation token cannot be empty", consts.ErrInvalidArgs)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUserByID(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anyone can register with the email, only the verified owner can join
+	if !user.IsEmailVerified() {
+		return nil, consts.ErrEmailNotVerified
+	}
+
+	invitation, err := s.invitations.Consume(ctxTimeout, domainOrg.HashInvitation(rawInvitation))
+	if err != nil {
+		if errors.Is(err, consts.ErrTokenDoesntExist) {
+			return nil, fmt.Errorf("%w: invitation is invalid", consts.ErrInvalidArgs)
+		}
+
+		s.log.Error("failed to consume invitation", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if invitation.IsExpired() || invitation.Email() != user.Email() {
+		return nil, fmt.Errorf("%w: invitation is invalid", consts.ErrInvalidArgs)
+	}
+
+	organization, err := s.organizations.GetByID(ctxTimeout, invitation.OrganizationID())
+	if err != nil {
+		if errors.Is(err, consts.ErrOrganizationDoesntExist) {
+			return nil, consts.ErrOrganizationDoesntExist
+		}
+
+		s.log.Error("failed to get organization", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if err := organization.AddMember(user.ID(), invitation.Role()); err != nil {
+		return nil, consts.ErrAlreadyMember
+	}
+
+	if err := s.organizations.Save(ctxTimeout, organization); err != nil {
+		s.log.Error("failed to save organization", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_AcceptInvitation_FullMethodName, time.Since(start), int(codes.OK), false)
+	return toStaffyOrganization(organization, invitation.Role()), nil
+}
+
+// ListMembers returns members of the organization. Only members can see each other.
+func (s *ssoService) ListMembers(ctx context.Context, req *staffy.ListMembersRequest) (*staffy.ListMembersResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	organization, _, err := s.getMembership(ctxTimeout, req.GetOrganizationId(), claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*staffy.Member, 0, len(organization.Members()))
+	for _, member := range organization.Members() {
+		user, err := s.getUserByID(ctxTimeout, member.UserID())
+		if err != nil {
+			// Memberships of deleted users are dropped by the db
+			if errors.Is(err, consts.ErrUserDoesntExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		members = append(members, &staffy.Member{
+			UserId:   user.ID().String(),
+			Email:    user.Email(),
+			Name:     user.Name(),
+			Surname:  user.Surname(),
+			Role:     string(member.Role()),
+			JoinedAt: member.JoinedAt().Unix(),
+		})
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_ListMembers_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.ListMembersResponse{
+		Members: members,
+	}, nil
+}
+
+// SwitchOrganization issues tokens with the organization as the active one.
+// An empty organization id issues tokens without any.
+func (s *ssoService) SwitchOrganization(ctx context.Context, req *staffy.SwitchOrganizationRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUserByID(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := session{
+		familyID: claims.SessionID,
+		authTime: authTimeOf(claims),
+	}
+	if sess.familyID == uuid.Nil {
+		sess = newSession()
+	}
+
+	if req.GetOrganizationId() != "" {
+		_, member, err := s.getMembership(ctxTimeout, req.GetOrganizationId(), user.ID())
+		if err != nil {
+			return nil, err
+		}
+
+		sess.orgID, _ = uuid.Parse(req.GetOrganizationId())
+		sess.orgRole = string(member.Role())
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_SwitchOrganization_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.toAuthResponse(ctxTimeout, user, sess)
+}
+
+// getMembership returns the organization n' the membership of the user. Non-members get ErrAccessDenied,
+// so they can't find out which organizations exist.
+func (s *ssoService) getMembership(ctx context.Context, rawID string, userID uuid.UUID) (*domainOrg.Organization, domainOrg.Member, error) {
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return nil, domainOrg.Member{}, fmt.Errorf("%w: invalid organization id", consts.ErrInvalidArgs)
+	}
+
+	organization, err := s.organizations.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, consts.ErrOrganizationDoesntExist) {
+			return nil, domainOrg.Member{}, consts.ErrAccessDenied
+		}
+
+		s.log.Error("failed to get organization", slog.String("error", err.Error()))
+		return nil, domainOrg.Member{}, consts.ErrDatabase
+	}
+
+	member, ok := organization.Member(userID)
+	if !ok {
+		return nil, domainOrg.Member{}, consts.ErrAccessDenied
+	}
+
+	return organization, member, nil
+}
+
+// withOrganization sets the organization as the active one of the session, if the user is still its member
+func (s *ssoService) withOrganization(ctx context.Context, sess session, userID, orgID uuid.UUID) (session, error) {
+	if orgID == uuid.Nil {
+		return sess, nil
+	}
+
+	_, member, err := s.getMembership(ctx, orgID.String(), userID)
+	if err != nil {
+		if errors.Is(err, consts.ErrAccessDenied) {
+			return sess, nil
+		}
+
+		return session{}, err
+	}
+
+	sess.orgID = orgID
+	sess.orgRole = string(member.Role())
+	return sess, nil
+}
+
+// authTimeOf returns the time, when the user has entered credentials
+func authTimeOf(claims *jwt.CustomClaims) time.Time {
+	if claims.AuthTime != nil {
+		return claims.AuthTime.Time
+	}
+	if claims.IssuedAt != nil {
+		return claims.IssuedAt.Time
+	}
+
+	return time.Now().UTC()
+}
+
+func toStaffyOrganization(organization *domainOrg.Organization, role domainOrg.MemberRole) *staffy.Organization {
+	return &staffy.Organization{
+		Id:        organization.ID().String(),
+		Name:      organization.Name(),
+		CreatedAt: organization.CreatedAt().Unix(),
+		Role:      string(role),
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainPasskey "github.com/devathh/staffy-sso/internal/domain/passkey"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// webauthnUser adapts the user n' its passkeys to the webauthn library. The user handle is the id of the user,
+// so authenticators don't keep the email.
+type webauthnUser struct {
+	user     *domain.User
+	passkeys []*domainPasskey.Passkey
+}
+
+func (u webauthnUser) WebAuthnID() []byte {
+	id := u.user.ID()
+	return id[:]
+}
+
+func (u webauthnUser) WebAuthnName() string {
+	return u.user.Email()
+}
+
+func (u webauthnUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.user.Name() + " " + u.user.Surname())
+}
+
+func (u webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, passkey := range u.passkeys {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(passkey.Transports()))
+		for _, transport := range passkey.Transports() {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              passkey.ID(),
+			PublicKey:       passkey.PublicKey(),
+			AttestationType: passkey.AttestationType(),
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: passkey.IsBackupEligible(),
+				BackupState:    passkey.IsBackedUp(),
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    passkey.AAGUID(),
+				SignCount: passkey.SignCount(),
+			},
+		})
+	}
+
+	return credentials
+}
+
+// BeginPasskeyRegistration returns options for navigator.credentials.create(). Passkeys must be discoverable
+// n' verify the user, so they replace both the email n' the password.
+func (s *ssoService) BeginPasskeyRegistration(ctx context.Context, req *staffy.BeginPasskeyRegistrationRequest) (*staffy.PasskeyCeremonyResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getWebAuthnUser(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticators, which already keep a passkey of the user, refuse to create another one
+	creation, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		}),
+	)
+	if err != nil {
+		s.log.Error("failed to begin passkey registration", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	resp, err := s.startCeremony(ctxTimeout, domainPasskey.CeremonyRegistration, claims.ID, session, creation)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_BeginPasskeyRegistration_FullMethodName, time.Since(start), int(codes.OK), false)
+	return resp, nil
+}
+
+// FinishPasskeyRegistration checks the attestation n' stores the public key of the new passkey
+func (s *ssoService) FinishPasskeyRegistration(ctx context.Context, req *staffy.FinishPasskeyRegistrationRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	if strings.TrimSpace(req.GetCredential()) == "" {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony, session, err := s.finishCeremony(ctxTimeout, domainPasskey.CeremonyRegistration, req.GetCeremonyId())
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID() != claims.ID {
+		return nil, consts.ErrInvalidToken
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes([]byte(req.GetCredential()))
+	if err != nil {
+		return nil, consts.ErrInvalidPasskey
+	}
+
+	user, err := s.getWebAuthnUser(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		s.log.Warn("passkey registration rejected", slog.String("error", err.Error()),
+			slog.String("user_id", claims.ID.String()))
+		return nil, consts.ErrInvalidPasskey
+	}
+
+	// Credential ids are chosen by the authenticator, the one of another user mustn't be accepted
+	if _, err := s.passkeys.GetByID(ctxTimeout, credential.ID); err == nil {
+		return nil, consts.ErrInvalidPasskey
+	} else if !errors.Is(err, consts.ErrPasskeyDoesntExist) {
+		s.log.Error("failed to get passkey", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	passkey, err := domainPasskey.NewPasskey(
+		credential.ID,
+		claims.ID,
+		credential.PublicKey,
+		credential.AttestationType,
+		credential.Authenticator.AAGUID,
+		credential.Authenticator.SignCount,
+		transports,
+		credential.Flags.BackupEligible,
+		credential.Flags.BackupState,
+	)
+	if err != nil {
+		return nil, consts.ErrInvalidPasskey
+	}
+
+	if err := s.passkeys.Save(ctxTimeout, passkey); err != nil {
+		s.log.Error("failed to save passkey", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_FinishPasskeyRegistration_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "passkey has been registered",
+	}, nil
+}
+
+// BeginPasskeyLogin returns options for navigator.credentials.get(). The ceremony isn't bound to any user,
+// the authenticator offers the passkeys it keeps, so the response doesn't tell whether an account exists.
+func (s *ssoService) BeginPasskeyLogin(ctx context.Context) (*staffy.PasskeyCeremonyResponse, error) {
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		s.log.Error("failed to begin passkey login", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	resp, err := s.startCeremony(ctxTimeout, domainPasskey.CeremonyLogin, uuid.Nil, session, assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_BeginPasskeyLogin_FullMethodName, time.Since(start), int(codes.OK), false)
+	return resp, nil
+}
+
+// FinishPasskeyLogin checks the assertion n' issues tokens like Login. The passkey has verified the user itself,
+// so the totp isn't asked.
+func (s *ssoService) FinishPasskeyLogin(ctx context.Context, req *staffy.FinishPasskeyLoginRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	if strings.TrimSpace(req.GetCredential()) == "" {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	_, session, err := s.finishCeremony(ctxTimeout, domainPasskey.CeremonyLogin, req.GetCeremonyId())
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes([]byte(req.GetCredential()))
+	if err != nil {
+		return nil, consts.ErrInvalidPasskey
+	}
+
+	// The handler finds the owner of the passkey, its error is kept to tell a broken storage from a bad passkey
+	var (
+		owner      webauthnUser
+		handlerErr error
+	)
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		owner, handlerErr = s.getPasskeyOwner(ctxTimeout, rawID, userHandle)
+		return owner, handlerErr
+	}
+
+	credential, err := s.webauthn.ValidateDiscoverableLogin(handler, *session, parsed)
+	if err != nil {
+		if errors.Is(handlerErr, consts.ErrDatabase) || errors.Is(handlerErr, consts.ErrCache) {
+			return nil, handlerErr
+		}
+
+		s.log.Warn("passkey login rejected", slog.String("error", err.Error()))
+		return nil, consts.ErrInvalidPasskey
+	}
+
+	passkey := owner.passkeys[0]
+	if err := passkey.Use(credential.Authenticator.SignCount, credential.Flags.BackupState); err != nil {
+		s.log.Warn("passkey login rejected", slog.String("error", err.Error()),
+			slog.String("user_id", owner.user.ID().String()))
+		return nil, consts.ErrInvalidPasskey
+	}
+
+	// A concurrent login with the same signature has already raised the count
+	if err := s.passkeys.UpdateSignCount(ctxTimeout, passkey); err != nil {
+		if errors.Is(err, consts.ErrInvalidPasskey) {
+			s.log.Warn("passkey login rejected", slog.String("error", "sign count has been raised concurrently"),
+				slog.String("user_id", owner.user.ID().String()))
+			return nil, consts.ErrInvalidPasskey
+		}
+
+		s.log.Error("failed to update passkey", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if err := s.checkVerified(owner.user); err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_FinishPasskeyLogin_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.toAuthResponse(ctxTimeout, owner.user, newSession())
+}
+
+// getPasskeyOwner returns the user of the passkey with only this passkey, the user handle must match the owner
+func (s *ssoService) getPasskeyOwner(ctx context.Context, rawID, userHandle []byte) (webauthnUser, error) {
+	passkey, err := s.passkeys.GetByID(ctx, rawID)
+	if err != nil {
+		if errors.Is(err, consts.ErrPasskeyDoesntExist) {
+			return webauthnUser{}, consts.ErrPasskeyDoesntExist
+		}
+
+		s.log.Error("failed to get passkey", slog.String("error", err.Error()))
+		return webauthnUser{}, consts.ErrDatabase
+	}
+
+	userID, err := uuid.FromBytes(userHandle)
+	if err != nil || userID != passkey.UserID() {
+		return webauthnUser{}, consts.ErrInvalidPasskey
+	}
+
+	user, err := s.getUserByID(ctx, userID)
+	if err != nil {
+		return webauthnUser{}, err
+	}
+
+	return webauthnUser{
+		user:     user,
+		passkeys: []*domainPasskey.Passkey{passkey},
+	}, nil
+}
+
+func (s *ssoService) getWebAuthnUser(ctx context.Context, userID uuid.UUID) (webauthnUser, error) {
+	user, err := s.getUserByID(ctx, userID)
+	if err != nil {
+		return webauthnUser{}, err
+	}
+
+	passkeys, err := s.passkeys.GetByUserID(ctx, userID)
+	if err != nil {
+		s.log.Error("failed to get passkeys", slog.String("error", err.Error()),
+			slog.String("user_id", userID.String()))
+		return webauthnUser{}, consts.ErrDatabase
+	}
+
+	return webauthnUser{
+		user:     user,
+		passkeys: passkeys,
+	}, nil
+}
+
+// startCeremony keeps the session of the library until the ceremony is finished n' returns the options for the browser
+func (s *ssoService) startCeremony(ctx context.Context, kind domainPasskey.CeremonyKind, userID uuid.UUID,
+	session *webauthn.SessionData, options any) (*staffy.PasskeyCeremonyResponse, error) {
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		s.log.Error("failed to marshal webauthn session", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	optionsData, err := json.Marshal(options)
+	if err != nil {
+		s.log.Error("failed to marshal webauthn options", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	ceremony, err := domainPasskey.NewCeremony(kind, userID, sessionData, s.cfg.WebAuthn.CeremonyTTL)
+	if err != nil {
+		s.log.Error("failed to create ceremony", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	if err := s.ceremonies.Save(ctx, ceremony); err != nil {
+		s.log.Error("failed to save ceremony", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	return &staffy.PasskeyCeremonyResponse{
+		CeremonyId: ceremony.ID(),
+		Options:    string(optionsData),
+	}, nil
+}
+
+// finishCeremony burns the ceremony, so its challenge can't be answered twice
+func (s *ssoService) finishCeremony(ctx context.Context, kind domainPasskey.CeremonyKind, id string) (*domainPasskey.Ceremony, *webauthn.SessionData, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, nil, consts.ErrNilToken
+	}
+
+	ceremony, err := s.ceremonies.Consume(ctx, kind, id)
+	if err != nil {
+		if errors.Is(err, consts.ErrTokenDoesntExist) {
+			return nil, nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to consume ceremony", slog.String("error", err.Error()))
+		return nil, nil, consts.ErrCache
+	}
+
+	if ceremony.IsExpired() {
+		return nil, nil, consts.ErrInvalidToken
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(ceremony.Session(), &session); err != nil {
+		s.log.Error("failed to unmarshal webauthn session", slog.String("error", err.Error()))
+		return nil, nil, consts.ErrCache
+	}
+
+	return ceremony, &session, nil
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainPasskey "github.com/devathh/staffy-sso/internal/domain/passkey"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// softAuthenticator answers ceremonies like a platform authenticator with "none" attestation
+type softAuthenticator struct {
+	t            *testing.T
+	rpID         string
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, env *testEnv) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("failed to generate credential id: %v", err)
+	}
+
+	return &softAuthenticator{
+		t:            t,
+		rpID:         env.svc.cfg.WebAuthn.RPID,
+		origin:       env.svc.cfg.WebAuthn.Origins[0],
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+// create answers navigator.credentials.create() with the given options
+func (a *softAuthenticator) create(options string) string {
+	a.t.Helper()
+
+	var creation protocol.CredentialCreation
+	if err := json.Unmarshal([]byte(options), &creation); err != nil {
+		a.t.Fatalf("failed to parse creation options: %v", err)
+	}
+
+	userID, ok := creation.Response.User.ID.(string)
+	if !ok {
+		a.t.Fatalf("unexpected user id: %v", creation.Response.User.ID)
+	}
+	userHandle, err := base64.RawURLEncoding.DecodeString(userID)
+	if err != nil {
+		a.t.Fatalf("failed to decode user id: %v", err)
+	}
+	a.userHandle = userHandle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("failed to encode public key: %v", err)
+	}
+
+	authData := a.authData(flagUserPresent | flagUserVerified | flagAttestedCredData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatalf("failed to encode attestation: %v", err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(a.clientData(protocol.CreateCeremony, creation.Response.Challenge)),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// get answers navigator.credentials.get() with the given options, the sign count is raised before
+func (a *softAuthenticator) get(options string) string {
+	a.t.Helper()
+
+	var assertion protocol.CredentialAssertion
+	if err := json.Unmarshal([]byte(options), &assertion); err != nil {
+		a.t.Fatalf("failed to parse request options: %v", err)
+	}
+
+	a.signCount++
+
+	clientData := a.clientData(protocol.AssertCeremony, assertion.Response.Challenge)
+	authData := a.authData(flagUserPresent | flagUserVerified)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("failed to sign assertion: %v", err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	authData := append([]byte(nil), rpIDHash[:]...)
+	authData = append(authData, flags)
+	return binary.BigEndian.AppendUint32(authData, a.signCount)
+}
+
+func (a *softAuthenticator) clientData(ceremony protocol.CeremonyType, challenge protocol.URLEncodedBase64) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      string(ceremony),
+		"challenge": encode(challenge),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		a.t.Fatalf("failed to encode client data: %v", err)
+	}
+
+	return clientData
+}
+
+func (a *softAuthenticator) credential(response map[string]string) string {
+	credential, err := json.Marshal(map[string]any{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatalf("failed to encode credential: %v", err)
+	}
+
+	return string(credential)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// registerPasskey runs the registration ceremony of the user with the authenticator
+func (e *testEnv) registerPasskey(t *testing.T, user *domain.User, authenticator *softAuthenticator) {
+	t.Helper()
+
+	resp, err := e.svc.toAuthResponse(t.Context(), user, newSession())
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	ceremony, err := e.svc.BeginPasskeyRegistration(t.Context(), &staffy.BeginPasskeyRegistrationRequest{Token: resp.Token})
+	if err != nil {
+		t.Fatalf("failed to begin registration: %v", err)
+	}
+
+	if _, err := e.svc.FinishPasskeyRegistration(t.Context(), &staffy.FinishPasskeyRegistrationRequest{
+		Token:      resp.Token,
+		CeremonyId: ceremony.CeremonyId,
+		Credential: authenticator.create(ceremony.Options),
+	}); err != nil {
+		t.Fatalf("failed to finish registration: %v", err)
+	}
+}
+
+func TestPasskeyRegisterThenLogin(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, "passkey@example.com", "correct horse battery staple")
+	authenticator := newSoftAuthenticator(t, env)
+
+	env.registerPasskey(t, user, authenticator)
+
+	passkeys, err := env.passkeys.GetByUserID(t.Context(), user.ID())
+	if err != nil || len(passkeys) != 1 {
+		t.Fatalf("got %d passkeys n' %v, want 1", len(passkeys), err)
+	}
+
+	for i := range 2 {
+		ceremony, err := env.svc.BeginPasskeyLogin(t.Context())
+		if err != nil {
+			t.Fatalf("failed to begin login: %v", err)
+		}
+
+		resp, err := env.svc.FinishPasskeyLogin(t.Context(), &staffy.FinishPasskeyLoginRequest{
+			CeremonyId: ceremony.CeremonyId,
+			Credential: authenticator.get(ceremony.Options),
+		})
+		if err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+		if resp.Token == "" || resp.RefreshToken == "" {
+			t.Fatalf("login %d: tokens aren't issued", i+1)
+		}
+	}
+
+	passkey, err := env.passkeys.GetByID(t.Context(), authenticator.credentialID)
+	if err != nil {
+		t.Fatalf("failed to get passkey: %v", err)
+	}
+	if passkey.SignCount() != authenticator.signCount {
+		t.Fatalf("sign count: got %d, want %d", passkey.SignCount(), authenticator.signCount)
+	}
+}
+
+func TestPasskeyLoginRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		// login answers the given fresh ceremony n' returns the request to finish it
+		login   func(t *testing.T, env *testEnv, authenticator *softAuthenticator, ceremony *staffy.PasskeyCeremonyResponse) *staffy.FinishPasskeyLoginRequest
+		wantErr error
+	}{
+		{
+			name: "replayed ceremony",
+			login: func(t *testing.T, env *testEnv, authenticator *softAuthenticator, ceremony *staffy.PasskeyCeremonyResponse) *staffy.FinishPasskeyLoginRequest {
+				req := &staffy.FinishPasskeyLoginRequest{
+					CeremonyId: ceremony.CeremonyId,
+					Credential: authenticator.get(ceremony.Options),
+				}
+				if _, err := env.svc.FinishPasskeyLogin(t.Context(), req); err != nil {
+					t.Fatalf("first login failed: %v", err)
+				}
+
+				req.Credential = authenticator.get(ceremony.Options)
+				return req
+			},
+			wantErr: consts.ErrInvalidToken,
+		},
+		{
+			name: "assertion of another ceremony",
+			login: func(t *testing.T, env *testEnv, authenticator *softAuthenticator, ceremony *staffy.PasskeyCeremonyResponse) *staffy.FinishPasskeyLoginRequest {
+				other, err := env.svc.BeginPasskeyLogin(t.Context())
+				if err != nil {
+					t.Fatalf("failed to begin login: %v", err)
+				}
+
+				return &staffy.FinishPasskeyLoginRequest{
+					CeremonyId: ceremony.CeremonyId,
+					Credential: authenticator.get(other.Options),
+				}
+			},
+			wantErr: consts.ErrInvalidPasskey,
+		},
+		{
+			name: "user handle of another user",
+			login: func(t *testing.T, env *testEnv, authenticator *softAuthenticator, ceremony *staffy.PasskeyCeremonyResponse) *staffy.FinishPasskeyLoginRequest {
+				other := env.newUser(t, "other@example.com", "correct horse battery staple")
+				id := other.ID()
+				authenticator.userHandle = id[:]
+
+				return &staffy.FinishPasskeyLoginRequest{
+					CeremonyId: ceremony.CeremonyId,
+					Credential: authenticator.get(ceremony.Options),
+				}
+			},
+			wantErr: consts.ErrInvalidPasskey,
+		},
+		{
+			name: "sign count going backwards",
+			login: func(t *testing.T, env *testEnv, authenticator *softAuthenticator, ceremony *staffy.PasskeyCeremonyResponse) *staffy.FinishPasskeyLoginRequest {
+				first, err := env.svc.BeginPasskeyLogin(t.Context())
+				if err != nil {
+					t.Fatalf("failed to begin login: %v", err)
+				}
+
+				authenticator.signCount = 10
+				if _, err := env.svc.FinishPasskeyLogin(t.Context(), &staffy.FinishPasskeyLoginRequest{
+					CeremonyId: first.CeremonyId,
+					Credential: authenticator.get(first.Options),
+				}); err != nil {
+					t.Fatalf("first login failed: %v", err)
+				}
+
+				// A clone of the authenticator keeps counting from the moment it was copied
+				authenticator.signCount = 4
+				return &staffy.FinishPasskeyLoginRequest{
+					CeremonyId: ceremony.CeremonyId,
+					Credential: authenticator.get(ceremony.Options),
+				}
+			},
+			wantErr: consts.ErrInvalidPasskey,
+		},
+		{
+			name: "sign count raised by a concurrent login",
+			login: func(t *testing.T, env *testEnv, authenticator *softAuthenticator, ceremony *staffy.PasskeyCeremonyResponse) *staffy.FinishPasskeyLoginRequest {
+				req := &staffy.FinishPasskeyLoginRequest{
+					CeremonyId: ceremony.CeremonyId,
+					Credential: authenticator.get(ceremony.Options),
+				}
+
+				// The other login has passed between reading the passkey n' saving it
+				env.passkeys.mu.Lock()
+				stored := env.passkeys.passkeys[string(authenticator.credentialID)]
+				env.passkeys.mu.Unlock()
+				raised := clonePasskey(stored)
+				if err := raised.Use(authenticator.signCount, false); err != nil {
+					t.Fatalf("failed to raise sign count: %v", err)
+				}
+				env.svc.passkeys = racingPasskeys{fakePasskeys: env.passkeys, raised: raised}
+
+				return req
+			},
+			wantErr: consts.ErrInvalidPasskey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, "passkey@example.com", "correct horse battery staple")
+			authenticator := newSoftAuthenticator(t, env)
+			env.registerPasskey(t, user, authenticator)
+
+			ceremony, err := env.svc.BeginPasskeyLogin(t.Context())
+			if err != nil {
+				t.Fatalf("failed to begin login: %v", err)
+			}
+
+			_, err = env.svc.FinishPasskeyLogin(t.Context(), tt.login(t, env, authenticator, ceremony))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// racingPasskeys saves the raised passkey right before the update, like a concurrent login would
+type racingPasskeys struct {
+	*fakePasskeys
+	raised *domainPasskey.Passkey
+}
+
+func (r racingPasskeys) UpdateSignCount(ctx context.Context, passkey *domainPasskey.Passkey) error {
+	if err := r.fakePasskeys.UpdateSignCount(ctx, r.raised); err != nil {
+		return err
+	}
+
+	return r.fakePasskeys.UpdateSignCount(ctx, passkey)
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainToken "github.com/devathh/staffy-sso/internal/domain/token"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/codes"
+)
+
+// RequestPasswordReset sends the reset link to the email. The response is the same
+// whether the account exists or not, so it can't be used to find out registered emails.
+func (s *ssoService) RequestPasswordReset(ctx context.Context, req *staffy.PasswordResetRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	email, err := domain.NewEmail(strings.TrimSpace(req.GetEmail()))
+	if err != nil {
+		return nil, consts.ErrInvalidEmail
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	resp := &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "if the account exists, the reset link has been sent",
+	}
+
+	user, err := s.persistence.GetByEmail(ctxTimeout, email.String())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return resp, nil
+		}
+
+		s.log.Error("failed to get user by email", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	s.sendPasswordReset(user)
+
+	go s.saveLog(context.TODO(), staffy.SSO_RequestPasswordReset_FullMethodName, time.Since(start), int(codes.OK), false)
+	return resp, nil
+}
+
+// sendPasswordReset issues the token n' mails the link in background, like sendMagicLink,
+// so the response time doesn't tell whether the account exists
+func (s *ssoService) sendPasswordReset(user *domain.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.RWTimeout)
+		defer cancel()
+
+		token, rawToken, err := domainToken.NewActionToken(
+			domainToken.PurposePasswordReset,
+			user.ID(),
+			user.Email(),
+			s.cfg.Account.PasswordResetTTL,
+		)
+		if err != nil {
+			s.log.Error("failed to generate reset token", slog.String("error", err.Error()))
+			return
+		}
+
+		if err := s.actionTokens.Save(ctx, token); err != nil {
+			s.log.Error("failed to save reset token", slog.String("error", err.Error()),
+				slog.String("user_id", user.ID().String()))
+			return
+		}
+
+		link, err := RedirectWithParams(s.cfg.Account.PasswordResetURL, url.Values{"token": {rawToken}})
+		if err != nil {
+			s.log.Error("failed to build reset link", slog.String("error", err.Error()))
+			return
+		}
+
+		s.sendMail(&domainMail.Message{
+			To:      user.Email(),
+			Subject: "Reset your Staffy password",
+			Body: fmt.Sprintf("Hi %s,\r\n\r\nFollow the link to set a new password: %s\r\n\r\n"+
+				"The link expires in %s. If you didn't ask to reset the password, just ignore this email.",
+				user.Name(), link, s.cfg.Account.PasswordResetTTL),
+		})
+	}()
+}
+
+// ConfirmPasswordReset sets the new password n' revokes all sessions of the user
+func (s *ssoService) ConfirmPasswordReset(ctx context.Context, req *staffy.ConfirmPasswordResetRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	rawToken := strings.TrimSpace(req.GetToken())
+	if rawToken == "" {
+		return nil, consts.ErrNilToken
+	}
+
+	// The password is checked before the token is burned, so the user can retry
+	if req.GetNewPassword() == "" {
+		return nil, fmt.Errorf("%w: new password cannot be empty", consts.ErrInvalidArgs)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	token, err := s.consumeActionToken(ctxTimeout, domainToken.PurposePasswordReset, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changing the password revokes the user, so reset links sent earlier stop working
+	if err := s.checkActionTokenRevocation(ctxTimeout, token); err != nil {
+		return nil, err
+	}
+
+	// The user is taken from the db, the cache may keep the old password
+	user, err := s.persistence.GetByID(ctxTimeout, token.UserID())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	// The link was sent to the email, which the user doesn't own anymore
+	if user.Email() != token.Email() {
+		return nil, consts.ErrInvalidToken
+	}
+
+	if err := s.checkPassword("new_password", req.GetNewPassword(), user.Email(), user.Name(), user.Surname()); err != nil {
+		return nil, err
+	}
+
+	if err := user.ChangePassword(ctxTimeout, req.GetNewPassword(), s.hasher); err != nil {
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, consts.ErrOverloaded
+		}
+
+		return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	if err := s.saveCredentials(ctxTimeout, user); err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_ConfirmPasswordReset_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "password has been reset",
+	}, nil
+}
+
+// ChangePassword sets the new password, if the old one is right. All tokens of the user are revoked,
+// the caller gets new ones, so only the session, which changed the password, stays alive.
+func (s *ssoService) ChangePassword(ctx context.Context, req *staffy.ChangePasswordRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	if req.GetOldPassword() == "" || req.GetNewPassword() == "" {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	// The user is taken from the db, the cache may keep the old password
+	user, err := s.persistence.GetByID(ctxTimeout, claims.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrUserDoesntExist
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	ok, err := user.CheckThePassword(ctxTimeout, req.GetOldPassword(), s.hasher)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, consts.ErrInvalidCredentials
+	}
+
+	if err := s.checkPassword("new_password", req.GetNewPassword(), user.Email(), user.Name(), user.Surname()); err != nil {
+		return nil, err
+	}
+
+	if err := user.ChangePassword(ctxTimeout, req.GetNewPassword(), s.hasher); err != nil {
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, consts.ErrOverloaded
+		}
+
+		return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	if err := s.saveCredentials(ctxTimeout, user); err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_ChangePassword_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.toAuthResponse(ctxTimeout, user, newSession())
+}
+
+// consumeActionToken burns the token, so it can't be used twice
+func (s *ssoService) consumeActionToken(ctx context.Context, purpose domainToken.Purpose, raw string) (*domainToken.ActionToken, error) {
+	token, err := s.actionTokens.Consume(ctx, purpose, domainToken.HashActionToken(raw))
+	if err != nil {
+		if errors.Is(err, consts.ErrTokenDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to consume action token", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	if token.IsExpired() {
+		return nil, consts.ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// checkActionTokenRevocation rejects the token, if the user has been revoked after it was issued
+func (s *ssoService) checkActionTokenRevocation(ctx context.Context, token *domainToken.ActionToken) error {
+	revokedBefore, err := s.revocations.UserRevokedBefore(ctx, token.UserID())
+	if err != nil {
+		s.log.Error("failed to check user's revocation", slog.String("error", err.Error()))
+		return consts.ErrCache
+	}
+	if token.IssuedAt().Before(revokedBefore) {
+		return consts.ErrInvalidToken
+	}
+
+	return nil
+}
+
+// saveCredentials stores the user with changed credentials, evicts it from the cache
+// n' revokes all tokens issued before
+func (s *ssoService) saveCredentials(ctx context.Context, user *domain.User) error {
+	if err := s.persistence.Update(ctx, user); err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return consts.ErrUserDoesntExist
+		}
+		if errors.Is(err, consts.ErrUserAlreadyExists) {
+			return consts.ErrUserAlreadyExists
+		}
+
+		s.log.Error("failed to update user", slog.String("error", err.Error()))
+		return consts.ErrDatabase
+	}
+
+	if err := s.cache.Delete(ctx, user); err != nil {
+		s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+			slog.String("user_id", user.ID().String()))
+		return consts.ErrCache
+	}
+
+	if err := s.revocations.RevokeUser(ctx, user.ID(), time.Now().UTC()); err != nil {
+		s.log.Error("failed to revoke tokens of user", slog.String("error", err.Error()),
+			slog.String("user_id", user.ID().String()))
+		return consts.ErrCache
+	}
+
+	return nil
+}
+
+// checkPassword applies the policy n' the breached list to the new password of the field.
+// Errors of the list don't block the password, the policy is still applied
+func (s *ssoService) checkPassword(field, password, email, name, surname string) error {
+	policy := domain.PasswordPolicy{
+		MinLength:      s.cfg.Password.MinLength,
+		MaxLength:      s.cfg.Password.MaxLength,
+		MinCharClasses: s.cfg.Password.MinCharClasses,
+	}
+	violations := policy.Check(password, email, name, surname)
+
+	if s.breached != nil {
+		breached, err := s.breached.Contains(password)
+		if err != nil {
+			s.log.Error("failed to check breached passwords", slog.String("error", err.Error()))
+		} else if breached {
+			violations = append(violations, "has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &consts.PasswordPolicyError{Field: field, Violations: violations}
+	}
+
+	return nil
+}
+
+// upgradePassword rehashes the password, which has just been checked, if its hash is outdated.
+// The password stays the same, so tokens aren't revoked
+func (s *ssoService) upgradePassword(user *domain.User, password string) {
+	if !user.PasswordNeedsRehash(s.hasher) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.RWTimeout)
+		defer cancel()
+
+		// The user of the login may be shared with the cache, so the fresh one is changed
+		user, err := s.persistence.GetByID(ctx, user.ID())
+		if err != nil {
+			s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+			return
+		}
+
+		// The password may have been changed since the login
+		if !user.PasswordNeedsRehash(s.hasher) {
+			return
+		}
+		if ok, err := user.CheckThePassword(ctx, password, s.hasher); err != nil || !ok {
+			return
+		}
+
+		if err := user.ChangePassword(ctx, password, s.hasher); err != nil {
+			s.log.Error("failed to rehash password", slog.String("error", err.Error()))
+			return
+		}
+
+		if err := s.persistence.Update(ctx, user); err != nil {
+			// The next login tries again
+			s.log.Warn("failed to save rehashed password", slog.String("error", err.Error()),
+				slog.String("user_id", user.ID().String()))
+			return
+		}
+
+		if err := s.cache.Delete(ctx, user); err != nil {
+			s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+				slog.String("user_id", user.ID().String()))
+		}
+	}()
+}
+
+// sendMail delivers the message in background, so the response doesn't depend on the mail server
+func (s *ssoService) sendMail(msg *domainMail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.RWTimeout)
+		defer cancel()
+
+		if err := s.mail.Send(ctx, msg); err != nil {
+			s.log.Error("failed to send mail", slog.String("error", err.Error()))
+		}
+	}()
+}
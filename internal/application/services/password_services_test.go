@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	jwtv5 "github.com/golang-jwt/jwt/v5"
+)
+
+// fakeBreached is the list of leaked passwords, err makes the list unavailable
+type fakeBreached struct {
+	passwords []string
+	err       error
+}
+
+func (b fakeBreached) Contains(password string) (bool, error) {
+	if b.err != nil {
+		return false, b.err
+	}
+
+	return slices.Contains(b.passwords, password), nil
+}
+
+func TestRegisterChecksPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		breached fakeBreached
+		password string
+		want     []string
+	}{
+		{name: "strong", password: "Tr0ub4dor&3x"},
+		{
+			name:     "breached",
+			breached: fakeBreached{passwords: []string{"Password123"}},
+			password: "Password123",
+			want:     []string{"has appeared in a data breach"},
+		},
+		{
+			name:     "weak n' breached",
+			breached: fakeBreached{passwords: []string{"qwerty"}},
+			password: "qwerty",
+			want:     []string{"must be at least 10 characters long", "must contain at least 2 of lowercase letters, uppercase letters, digits n' symbols", "has appeared in a data breach"},
+		},
+		{
+			name:     "list is unavailable",
+			breached: fakeBreached{err: errors.New("disk is gone")},
+			password: "Password123",
+		},
+		{
+			name:     "policy without the list",
+			breached: fakeBreached{err: errors.New("disk is gone")},
+			password: "Short1",
+			want:     []string{"must be at least 10 characters long"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			e.svc.breached = tt.breached
+
+			_, err := e.svc.Register(t.Context(), &staffy.RegisterRequest{
+				Email:    "new@example.com",
+				Name:     "New",
+				Surname:  "User",
+				Password: tt.password,
+			})
+
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var policy *consts.PasswordPolicyError
+			if !errors.As(err, &policy) {
+				t.Fatalf("got %v, want PasswordPolicyError", err)
+			}
+			if !errors.Is(err, consts.ErrWeakPassword) {
+				t.Fatal("PasswordPolicyError doesn't match ErrWeakPassword")
+			}
+			if policy.Field != "password" || !slices.Equal(policy.Violations, tt.want) {
+				t.Fatalf("got %s %q, want password %q", policy.Field, policy.Violations, tt.want)
+			}
+		})
+	}
+}
+
+// legacyHashPrefix marks hashes of the outdated algorithm, upgradingHasher still verifies them
+const legacyHashPrefix = "legacy$"
+
+type legacyHasher struct {
+	fakeHasher
+}
+
+func (legacyHasher) Hash(_ context.Context, password string) (string, error) {
+	return legacyHashPrefix + password, nil
+}
+
+type upgradingHasher struct {
+	fakeHasher
+}
+
+func (h upgradingHasher) Verify(ctx context.Context, password, hash string) (bool, error) {
+	if strings.HasPrefix(hash, legacyHashPrefix) {
+		return hash == legacyHashPrefix+password, nil
+	}
+
+	return h.fakeHasher.Verify(ctx, password, hash)
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+		wantHash string
+	}{
+		{name: "right password", password: "Tr0ub4dor&3x", wantHash: fakeHashPrefix + "Tr0ub4dor&3x"},
+		{name: "wrong password", password: "wrong-password", wantErr: consts.ErrInvalidCredentials, wantHash: legacyHashPrefix + "Tr0ub4dor&3x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			e.svc.hasher = upgradingHasher{}
+
+			email, err := domain.NewEmail("legacy@example.com")
+			if err != nil {
+				t.Fatalf("invalid email: %v", err)
+			}
+			user, err := domain.NewUser(t.Context(), email, "Legacy", "User", "Tr0ub4dor&3x", false, legacyHasher{})
+			if err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			if _, err := e.users.Save(t.Context(), user); err != nil {
+				t.Fatalf("failed to save user: %v", err)
+			}
+
+			_, err = e.svc.Login(t.Context(), &staffy.LoginRequest{Email: "legacy@example.com", Password: tt.password})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+
+			// The hash is upgraded in background
+			deadline := time.Now().Add(time.Second)
+			for {
+				stored, err := e.users.GetByID(t.Context(), user.ID())
+				if err != nil {
+					t.Fatalf("failed to get user: %v", err)
+				}
+				if stored.Password() == tt.wantHash {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("hash: got %s, want %s", stored.Password(), tt.wantHash)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestRequestPasswordResetResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		// failSave breaks the token store, the response mustn't depend on it
+		failSave bool
+		wantMail bool
+	}{
+		{name: "existing account", email: "reset@example.com", wantMail: true},
+		{name: "unknown account", email: "unknown@example.com"},
+		{name: "existing account with broken token store", email: "reset@example.com", failSave: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.newUser(t, "reset@example.com", "correct horse battery staple")
+			if tt.failSave {
+				env.svc.actionTokens = failingActionTokens{ActionTokenRepository: env.svc.actionTokens}
+			}
+
+			resp, err := env.svc.RequestPasswordReset(t.Context(), &staffy.PasswordResetRequest{Email: tt.email})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusMessage != "if the account exists, the reset link has been sent" {
+				t.Fatalf("unexpected response: %q", resp.StatusMessage)
+			}
+
+			if !tt.wantMail {
+				env.assertNoMail(t)
+				return
+			}
+			env.receiveToken(t, tt.email)
+		})
+	}
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	const (
+		oldPassword = "correct horse battery staple"
+		newPassword = "new horse battery staple"
+	)
+
+	// requestReset sends the reset link n' returns its token
+	requestReset := func(t *testing.T, env *testEnv, email string) string {
+		t.Helper()
+
+		if _, err := env.svc.RequestPasswordReset(t.Context(), &staffy.PasswordResetRequest{Email: email}); err != nil {
+			t.Fatalf("failed to request reset: %v", err)
+		}
+		return env.receiveToken(t, email)
+	}
+
+	t.Run("token is single-use", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, "reset@example.com", oldPassword)
+		token := requestReset(t, env, user.Email())
+
+		req := &staffy.ConfirmPasswordResetRequest{Token: token, NewPassword: newPassword}
+		if _, err := env.svc.ConfirmPasswordReset(t.Context(), req); err != nil {
+			t.Fatalf("failed to reset password: %v", err)
+		}
+
+		stored, err := env.users.GetByID(t.Context(), user.ID())
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+		if ok, _ := stored.CheckThePassword(t.Context(), newPassword, fakeHasher{}); !ok {
+			t.Fatal("password hasn't been changed")
+		}
+
+		req.NewPassword = "third horse battery staple"
+		if _, err := env.svc.ConfirmPasswordReset(t.Context(), req); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("reused token: got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, "reset@example.com", oldPassword)
+		token := requestReset(t, env, user.Email())
+
+		env.redis.FastForward(env.svc.cfg.Account.PasswordResetTTL + time.Second)
+
+		req := &staffy.ConfirmPasswordResetRequest{Token: token, NewPassword: newPassword}
+		if _, err := env.svc.ConfirmPasswordReset(t.Context(), req); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+
+	t.Run("earlier link is revoked by the reset", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, "reset@example.com", oldPassword)
+		earlier := requestReset(t, env, user.Email())
+		token := requestReset(t, env, user.Email())
+		// The watermark has millisecond precision, links issued in the same millisecond stay valid
+		time.Sleep(2 * time.Millisecond)
+
+		req := &staffy.ConfirmPasswordResetRequest{Token: token, NewPassword: newPassword}
+		if _, err := env.svc.ConfirmPasswordReset(t.Context(), req); err != nil {
+			t.Fatalf("failed to reset password: %v", err)
+		}
+
+		req = &staffy.ConfirmPasswordResetRequest{Token: earlier, NewPassword: "third horse battery staple"}
+		if _, err := env.svc.ConfirmPasswordReset(t.Context(), req); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+
+	t.Run("weak password doesn't burn the token", func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.newUser(t, "reset@example.com", oldPassword)
+		token := requestReset(t, env, user.Email())
+
+		req := &staffy.ConfirmPasswordResetRequest{Token: token, NewPassword: ""}
+		if _, err := env.svc.ConfirmPasswordReset(t.Context(), req); !errors.Is(err, consts.ErrInvalidArgs) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidArgs)
+		}
+
+		req.NewPassword = newPassword
+		if _, err := env.svc.ConfirmPasswordReset(t.Context(), req); err != nil {
+			t.Fatalf("failed to reset password: %v", err)
+		}
+	})
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	const (
+		oldPassword = "correct horse battery staple"
+		newPassword = "new horse battery staple"
+	)
+
+	env := newTestEnv(t)
+	user := env.newUser(t, "change@example.com", oldPassword)
+
+	// Everything happens in one second, the watermark mustn't miss the session issued in it
+	if elapsed := time.Duration(time.Now().Nanosecond()); elapsed > 800*time.Millisecond {
+		time.Sleep(time.Second - elapsed)
+	}
+
+	login := func() *staffy.AuthResponse {
+		t.Helper()
+
+		resp, err := env.svc.Login(t.Context(), &staffy.LoginRequest{Email: user.Email(), Password: oldPassword})
+		if err != nil {
+			t.Fatalf("failed to login: %v", err)
+		}
+		return resp
+	}
+	other := login()
+	caller := login()
+
+	time.Sleep(2 * time.Millisecond)
+	resp, err := env.svc.ChangePassword(t.Context(), &staffy.ChangePasswordRequest{
+		Token:       caller.Token,
+		OldPassword: oldPassword,
+		NewPassword: newPassword,
+	})
+	if err != nil {
+		t.Fatalf("failed to change password: %v", err)
+	}
+
+	newClaims, err := env.svc.jwt.ValidateToken(t.Context(), resp.Token)
+	if err != nil {
+		t.Fatalf("new access token is invalid: %v", err)
+	}
+	if _, err := env.svc.Refresh(t.Context(), &staffy.Token{Token: resp.RefreshToken}); err != nil {
+		t.Fatalf("new refresh token is invalid: %v", err)
+	}
+
+	for name, session := range map[string]*staffy.AuthResponse{"other": other, "caller": caller} {
+		// The old session was issued in the same second as the new one, second precision would keep it alive
+		old, _, err := jwtv5.NewParser().ParseUnverified(session.Token, &jwt.CustomClaims{})
+		if err != nil {
+			t.Fatalf("failed to parse token: %v", err)
+		}
+		if issuedAt, _ := old.Claims.GetIssuedAt(); issuedAt.Unix() != newClaims.IssuedAt.Unix() {
+			t.Fatalf("%s session is issued at %d, not in the second of the change %d", name, issuedAt.Unix(), newClaims.IssuedAt.Unix())
+		}
+
+		if _, err := env.svc.jwt.ValidateToken(t.Context(), session.Token); !errors.Is(err, jwt.ErrRevokedToken) {
+			t.Fatalf("access token of %s session: got %v, want %v", name, err, jwt.ErrRevokedToken)
+		}
+		if _, err := env.svc.Refresh(t.Context(), &staffy.Token{Token: session.RefreshToken}); err == nil {
+			t.Fatalf("refresh token of %s session is still valid", name)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/codes"
+)
+
+// Paths of the profile, which can be set by UpdateProfile
+const (
+	ProfilePathName    = "name"
+	ProfilePathSurname = "surname"
+)
+
+// UpdateProfile sets only fields listed in the mask. The request carries the version of the user,
+// which the client has read, so changes made in the meantime aren't overwritten.
+func (s *ssoService) UpdateProfile(ctx context.Context, req *staffy.UpdateProfileRequest) (*staffy.User, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: update mask cannot be empty", consts.ErrInvalidArgs)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	// The version is checked against the db, the cache may be behind
+	user, err := s.persistence.GetByID(ctxTimeout, claims.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrUserDoesntExist
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if user.Version() != req.GetVersion() {
+		return nil, consts.ErrVersionConflict
+	}
+
+	for _, path := range paths {
+		switch path {
+		case ProfilePathName:
+			if err := user.ChangeName(req.GetName()); err != nil {
+				return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+			}
+		case ProfilePathSurname:
+			user.ChangeSurname(req.GetSurname())
+		default:
+			return nil, fmt.Errorf("%w: unknown path in update mask: %s", consts.ErrInvalidArgs, path)
+		}
+	}
+
+	if err := s.persistence.Update(ctxTimeout, user); err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) || errors.Is(err, consts.ErrVersionConflict) {
+			return nil, err
+		}
+
+		s.log.Error("failed to update user", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	// Both entries are overwritten, so none of them keeps the old profile
+	if err := s.saveUserToCacheByID(user); err != nil {
+		s.log.Error("failed to save user into cache", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+	if err := s.saveUserToCacheByEmail(user); err != nil {
+		s.log.Error("failed to save user into cache", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_UpdateProfile_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.toStaffyUser(user), nil
+}
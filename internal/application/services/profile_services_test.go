@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		paths       []string
+		newName     string
+		version     int64
+		wantErr     error
+		wantName    string
+		wantSurname string
+	}{
+		{name: "name only", paths: []string{ProfilePathName}, newName: "Jane", wantName: "Jane", wantSurname: "User"},
+		{name: "surname is cleared", paths: []string{ProfilePathSurname}, wantName: "Test", wantSurname: ""},
+		{name: "stale version", paths: []string{ProfilePathName}, newName: "Jane", version: 1, wantErr: consts.ErrVersionConflict},
+		{name: "empty name", paths: []string{ProfilePathName}, newName: " ", wantErr: consts.ErrInvalidArgs},
+		{name: "unknown path", paths: []string{"email"}, wantErr: consts.ErrInvalidArgs},
+		{name: "empty mask", paths: nil, wantErr: consts.ErrInvalidArgs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, "profile@example.com", "correct horse battery staple")
+			resp, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+			if err != nil {
+				t.Fatalf("failed to issue tokens: %v", err)
+			}
+
+			got, err := env.svc.UpdateProfile(t.Context(), &staffy.UpdateProfileRequest{
+				Token:      resp.Token,
+				Name:       tt.newName,
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: tt.paths},
+				Version:    tt.version,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.Name != tt.wantName || got.Surname != tt.wantSurname {
+				t.Fatalf("got %q %q, want %q %q", got.Name, got.Surname, tt.wantName, tt.wantSurname)
+			}
+			if got.Version != tt.version+1 {
+				t.Fatalf("got version %d, want %d", got.Version, tt.version+1)
+			}
+		})
+	}
+}
+
+func TestUpdateProfileConcurrentWriters(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.newUser(t, "writers@example.com", "correct horse battery staple")
+	resp, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	// Both clients have read version 0, only the first write wins
+	writes := []struct {
+		name    string
+		wantErr error
+	}{
+		{name: "Alice", wantErr: nil},
+		{name: "Bob", wantErr: consts.ErrVersionConflict},
+	}
+
+	for _, write := range writes {
+		_, err := env.svc.UpdateProfile(t.Context(), &staffy.UpdateProfileRequest{
+			Token:      resp.Token,
+			Name:       write.name,
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{ProfilePathName}},
+			Version:    0,
+		})
+		if !errors.Is(err, write.wantErr) {
+			t.Fatalf("%s: got %v, want %v", write.name, err, write.wantErr)
+		}
+	}
+
+	stored, err := env.users.GetByID(t.Context(), user.ID())
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if stored.Name() != "Alice" || stored.Version() != 1 {
+		t.Fatalf("got %q at version %d, want Alice at version 1", stored.Name(), stored.Version())
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainRole "github.com/devathh/staffy-sso/internal/domain/role"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// CheckPermission reports whether the owner of the token has the permission.
+// Current roles of the user are used, not the ones embedded in the token.
+func (s *ssoService) CheckPermission(ctx context.Context, req *staffy.CheckPermissionRequest) (*staffy.CheckPermissionResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	permission := strings.TrimSpace(req.GetPermission())
+	if permission == "" {
+		return nil, fmt.Errorf("%w: permission cannot be empty", consts.ErrInvalidArgs)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUserByID(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.hasPermission(ctxTimeout, user, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_CheckPermission_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.CheckPermissionResponse{
+		Allowed: allowed,
+		Roles:   user.Roles(),
+	}, nil
+}
+
+// AssignRole gives the role to the user. The caller must be allowed to manage roles.
+func (s *ssoService) AssignRole(ctx context.Context, req *staffy.RoleAssignmentRequest) (*staffy.User, error) {
+	return s.changeRoles(ctx, req, staffy.SSO_AssignRole_FullMethodName, (*domain.User).AssignRole)
+}
+
+// RevokeRole takes the role from the user. The caller must be allowed to manage roles.
+func (s *ssoService) RevokeRole(ctx context.Context, req *staffy.RoleAssignmentRequest) (*staffy.User, error) {
+	return s.changeRoles(ctx, req, staffy.SSO_RevokeRole_FullMethodName, (*domain.User).UnassignRole)
+}
+
+func (s *ssoService) changeRoles(
+	ctx context.Context,
+	req *staffy.RoleAssignmentRequest,
+	method string,
+	change func(*domain.User, string) error,
+) (*staffy.User, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user id", consts.ErrInvalidArgs)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.canManageRoles(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, consts.ErrAccessDenied
+	}
+
+	roles, err := s.roles.GetByNames(ctxTimeout, []string{req.GetRole()})
+	if err != nil {
+		s.log.Error("failed to get roles", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+	if len(roles) == 0 {
+		return nil, consts.ErrRoleDoesntExist
+	}
+
+	user, err := s.persistence.GetByID(ctxTimeout, userID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, fmt.Errorf("%w: user doesn't exist", consts.ErrInvalidArgs)
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if err := change(user, roles[0].Name()); err != nil {
+		return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	if err := s.persistence.Update(ctxTimeout, user); err != nil {
+		if errors.Is(err, consts.ErrVersionConflict) {
+			return nil, err
+		}
+
+		s.log.Error("failed to update user", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	// Tokens keep old roles till they're refreshed, the cache mustn't
+	if err := s.cache.Delete(ctxTimeout, user); err != nil {
+		s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+			slog.String("user_id", user.ID().String()))
+		return nil, consts.ErrCache
+	}
+
+	s.log.Info("roles of user have been changed",
+		slog.String("method", method),
+		slog.String("role", roles[0].Name()),
+		slog.String("user_id", user.ID().String()),
+		slog.String("actor_id", claims.ID.String()))
+
+	go s.saveLog(context.TODO(), method, time.Since(start), int(codes.OK), false)
+	return s.toStaffyUser(user), nil
+}
+
+// SyncRoles registers roles from the config
+func (s *ssoService) SyncRoles(ctx context.Context) error {
+	for _, roleCfg := range s.cfg.RBAC.Roles {
+		role, err := domainRole.NewRole(roleCfg.Name, roleCfg.Description, roleCfg.Permissions)
+		if err != nil {
+			return fmt.Errorf("invalid role %q: %w", roleCfg.Name, err)
+		}
+
+		if err := s.roles.Save(ctx, role); err != nil {
+			return fmt.Errorf("failed to save role %q: %w", roleCfg.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ssoService) hasPermission(ctx context.Context, user *domain.User, permission string) (bool, error) {
+	roles, err := s.roles.GetByNames(ctx, user.Roles())
+	if err != nil {
+		s.log.Error("failed to get roles", slog.String("error", err.Error()))
+		return false, consts.ErrDatabase
+	}
+
+	for _, role := range roles {
+		if role.HasPermission(permission) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// canManageRoles lets in role admins from the config, so the first roles can be assigned
+func (s *ssoService) canManageRoles(ctx context.Context, id uuid.UUID) (bool, error) {
+	if s.isRoleAdmin(id) {
+		return true, nil
+	}
+
+	user, err := s.getUserByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	return s.hasPermission(ctx, user, domainRole.PermissionManageRoles)
+}
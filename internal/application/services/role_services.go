@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainRole "github.com/devathh/staffy-sso/internal/domain/role"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// SwitchRole switches the user between recruiter n' applicant. Every switch is recorded in the audit trail.
+// If recruiter approval is on, promotion to recruiter waits for one of role admins.
+func (s *ssoService) SwitchRole(ctx context.Context, req *staffy.SwitchRoleRequest) (*staffy.RoleChangeResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.persistence.GetByID(ctxTimeout, claims.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrUserDoesntExist
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if user.IsRecruiter() == req.GetIsRecruiter() {
+		return nil, fmt.Errorf("%w: user already has this role", consts.ErrInvalidArgs)
+	}
+
+	needsApproval := req.GetIsRecruiter() && s.cfg.Account.RecruiterApproval
+	if needsApproval {
+		if _, err := s.roleChanges.GetPending(ctxTimeout, user.ID()); err == nil {
+			return nil, consts.ErrRoleChangePending
+		} else if !errors.Is(err, consts.ErrRoleChangeDoesntExist) {
+			s.log.Error("failed to get pending role change", slog.String("error", err.Error()))
+			return nil, consts.ErrDatabase
+		}
+	}
+
+	change, err := domainRole.NewRoleChange(user.ID(), claims.ID, req.GetIsRecruiter(), needsApproval)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	if !needsApproval {
+		if err := s.applyRole(ctxTimeout, user, change.ToRecruiter()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.saveRoleChange(ctxTimeout, change); err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_SwitchRole_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.toRoleChangeResponse(change, user), nil
+}
+
+// ReviewRoleChange approves or rejects the pending change. Only users, who can manage roles, review changes.
+func (s *ssoService) ReviewRoleChange(ctx context.Context, req *staffy.ReviewRoleChangeRequest) (*staffy.RoleChangeResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	changeID, err := uuid.Parse(req.GetChangeId())
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid change id", consts.ErrInvalidArgs)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, &staffy.Token{Token: req.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.canManageRoles(ctxTimeout, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, consts.ErrAccessDenied
+	}
+
+	change, err := s.roleChanges.GetByID(ctxTimeout, changeID)
+	if err != nil {
+		if errors.Is(err, consts.ErrRoleChangeDoesntExist) {
+			return nil, consts.ErrRoleChangeDoesntExist
+		}
+
+		s.log.Error("failed to get role change", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	user, err := s.persistence.GetByID(ctxTimeout, change.UserID())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrRoleChangeDoesntExist
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if req.GetApprove() {
+		if err := change.Approve(claims.ID); err != nil {
+			return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+		}
+
+		if err := s.applyRole(ctxTimeout, user, change.ToRecruiter()); err != nil {
+			return nil, err
+		}
+	} else if err := change.Reject(claims.ID); err != nil {
+		return nil, fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	if err := s.saveRoleChange(ctxTimeout, change); err != nil {
+		return nil, err
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_ReviewRoleChange_FullMethodName, time.Since(start), int(codes.OK), false)
+	return s.toRoleChangeResponse(change, user), nil
+}
+
+// applyRole switches the role of the user, stores it n' evicts the user from the cache
+func (s *ssoService) applyRole(ctx context.Context, user *domain.User, toRecruiter bool) error {
+	var err error
+	if toRecruiter {
+		err = user.ToRecruiter()
+	} else {
+		err = user.ToApplicant()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", consts.ErrInvalidArgs, err.Error())
+	}
+
+	if err := s.persistence.Update(ctx, user); err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) || errors.Is(err, consts.ErrVersionConflict) {
+			return err
+		}
+
+		s.log.Error("failed to update user", slog.String("error", err.Error()))
+		return consts.ErrDatabase
+	}
+
+	if err := s.cache.Delete(ctx, user); err != nil {
+		s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+			slog.String("user_id", user.ID().String()))
+		return consts.ErrCache
+	}
+
+	return nil
+}
+
+func (s *ssoService) saveRoleChange(ctx context.Context, change *domainRole.RoleChange) error {
+	if err := s.roleChanges.Save(ctx, change); err != nil {
+		s.log.Error("failed to save role change", slog.String("error", err.Error()),
+			slog.String("change_id", change.ID().String()),
+			slog.String("user_id", change.UserID().String()))
+		return consts.ErrDatabase
+	}
+
+	return nil
+}
+
+func (s *ssoService) isRoleAdmin(id uuid.UUID) bool {
+	return slices.ContainsFunc(s.cfg.Account.RoleAdmins, func(admin string) bool {
+		adminID, err := uuid.Parse(admin)
+		return err == nil && adminID == id
+	})
+}
+
+func (s *ssoService) toRoleChangeResponse(change *domainRole.RoleChange, user *domain.User) *staffy.RoleChangeResponse {
+	return &staffy.RoleChangeResponse{
+		ChangeId: change.ID().String(),
+		Status:   string(change.Status()),
+		User:     s.toStaffyUser(user),
+	}
+}
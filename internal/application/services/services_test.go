@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainMFA "github.com/devathh/staffy-sso/internal/domain/mfa"
+	domainOAuth "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/internal/domain/observability"
+	domainPasskey "github.com/devathh/staffy-sso/internal/domain/passkey"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/internal/infrastructure/cache/redis"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// testEnv is the service over miniredis n' in-memory repositories
+type testEnv struct {
+	svc      *ssoService
+	redis    *miniredis.Miniredis
+	users    *fakeUsers
+	totps    *fakeTOTPs
+	passkeys *fakePasskeys
+	clients  *fakeClients
+	mail     *fakeMail
+}
+
+func newTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Server.RWTimeout = 5 * time.Second
+	cfg.Secrets.JWT.Issuer = "staffy-test"
+	cfg.Secrets.JWT.TTL = time.Hour
+	cfg.Secrets.JWT.RefreshTTL = 24 * time.Hour
+	cfg.Secrets.JWT.SecretKey = "test-secret-key-of-32-characters"
+	cfg.Secrets.JWT.Algorithm = jwt.AlgorithmHS256
+	cfg.OAuth.ServiceTokenTTL = time.Hour
+	cfg.OAuth.CodeTTL = time.Minute
+	cfg.Secrets.Redis.TTL = time.Minute
+	cfg.Account.UnverifiedPolicy = UnverifiedAllow
+	cfg.Account.MFAIssuer = "staffy-test"
+	cfg.Account.MFAChallengeTTL = 5 * time.Minute
+	cfg.Lockout.Threshold = 3
+	cfg.Lockout.IPThreshold = 6
+	cfg.Lockout.BaseDelay = time.Millisecond
+	cfg.Lockout.MaxDelay = time.Millisecond
+	cfg.Lockout.Duration = 15 * time.Minute
+	cfg.Lockout.Window = time.Hour
+	cfg.Account.MagicLinkTTL = 15 * time.Minute
+	cfg.Account.MagicLinkURL = "https://staffy.test/magic"
+	cfg.Account.PasswordResetTTL = 15 * time.Minute
+	cfg.Account.PasswordResetURL = "https://staffy.test/reset"
+	cfg.Account.VerificationTTL = 24 * time.Hour
+	cfg.Account.VerificationURL = "https://staffy.test/verify"
+	cfg.Account.EmailChangeTTL = time.Hour
+	cfg.Account.EmailChangeURL = "https://staffy.test/email"
+	cfg.WebAuthn.RPID = "localhost"
+	cfg.WebAuthn.RPName = "Staffy"
+	cfg.WebAuthn.Origins = []string{"https://localhost"}
+	cfg.WebAuthn.CeremonyTTL = time.Minute
+	cfg.Password.MinLength = 10
+	cfg.Password.MaxLength = 64
+	cfg.Password.MinCharClasses = 2
+
+	return cfg
+}
+
+func newTestEnv(t *testing.T, configure ...func(*config.Config)) *testEnv {
+	t.Helper()
+
+	cfg := newTestConfig()
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	userCache, err := redis.NewUserCache(cfg, client)
+	if err != nil {
+		t.Fatalf("failed to create user cache: %v", err)
+	}
+	refreshTokens, err := redis.NewRefreshTokenStore(cfg, client)
+	if err != nil {
+		t.Fatalf("failed to create refresh token store: %v", err)
+	}
+	revocations, err := redis.NewRevocationList(cfg, client)
+	if err != nil {
+		t.Fatalf("failed to create revocation list: %v", err)
+	}
+	actionTokens, err := redis.NewActionTokenStore(client)
+	if err != nil {
+		t.Fatalf("failed to create action token store: %v", err)
+	}
+	codes, err := redis.NewAuthorizationCodeStore(client)
+	if err != nil {
+		t.Fatalf("failed to create authorization code store: %v", err)
+	}
+	ceremonies, err := redis.NewCeremonyStore(client)
+	if err != nil {
+		t.Fatalf("failed to create ceremony store: %v", err)
+	}
+	attempts, err := redis.NewAttemptStore(client)
+	if err != nil {
+		t.Fatalf("failed to create attempt store: %v", err)
+	}
+
+	jwtManager, err := jwt.NewJWT(cfg, revocations)
+	if err != nil {
+		t.Fatalf("failed to create jwt: %v", err)
+	}
+
+	relyingParty, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPName,
+		RPOrigins:     cfg.WebAuthn.Origins,
+	})
+	if err != nil {
+		t.Fatalf("failed to create webauthn: %v", err)
+	}
+
+	users := newFakeUsers()
+	totps := newFakeTOTPs()
+	passkeys := newFakePasskeys()
+	clients := newFakeClients()
+	mail := &fakeMail{sent: make(chan *domainMail.Message, 8)}
+	svc := newSSOService(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), Dependencies{
+		Users:         users,
+		TOTPs:         totps,
+		Passkeys:      passkeys,
+		Clients:       clients,
+		UserCache:     userCache,
+		RefreshTokens: refreshTokens,
+		Revocations:   revocations,
+		Codes:         codes,
+		ActionTokens:  actionTokens,
+		Ceremonies:    ceremonies,
+		Attempts:      attempts,
+		Mail:          mail,
+		Hasher:        fakeHasher{},
+		CH:            nopCH{},
+		JWT:           jwtManager,
+		WebAuthn:      relyingParty,
+	})
+
+	return &testEnv{
+		svc:      svc,
+		redis:    mr,
+		users:    users,
+		totps:    totps,
+		passkeys: passkeys,
+		clients:  clients,
+		mail:     mail,
+	}
+}
+
+// newUser saves a verified user with the given email n' password
+func (e *testEnv) newUser(t *testing.T, email, password string) *domain.User {
+	t.Helper()
+
+	addr, err := domain.NewEmail(email)
+	if err != nil {
+		t.Fatalf("invalid email: %v", err)
+	}
+
+	user, err := domain.NewUser(t.Context(), addr, "Test", "User", password, false, fakeHasher{})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := user.VerifyEmail(user.Email()); err != nil {
+		t.Fatalf("failed to verify email: %v", err)
+	}
+
+	if _, err := e.users.Save(t.Context(), user); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+
+	return user
+}
+
+// fakeHasher keeps passwords in plain text, the real hashing is tested in lib/password
+type fakeHasher struct{}
+
+const fakeHashPrefix = "plain$"
+
+func (fakeHasher) Hash(_ context.Context, password string) (string, error) {
+	return fakeHashPrefix + password, nil
+}
+
+func (fakeHasher) Verify(_ context.Context, password, hash string) (bool, error) {
+	return hash == fakeHashPrefix+password, nil
+}
+
+func (fakeHasher) NeedsRehash(hash string) bool {
+	return !strings.HasPrefix(hash, fakeHashPrefix)
+}
+
+func (fakeHasher) DummyHash() string {
+	return fakeHashPrefix + uuid.NewString()
+}
+
+// fakeMail hands sent messages to the test, mails are sent in background
+type fakeMail struct {
+	sent chan *domainMail.Message
+}
+
+func (f *fakeMail) Send(_ context.Context, msg *domainMail.Message) error {
+	f.sent <- msg
+	return nil
+}
+
+type nopCH struct{}
+
+func (nopCH) SavePerformanceLog(context.Context, *observability.PerformanceLog) {}
+func (nopCH) SaveLockoutEvent(context.Context, *observability.LockoutEvent)     {}
+func (nopCH) SaveThrottleEvent(context.Context, *observability.ThrottleEvent)   {}
+func (nopCH) SaveHashingMetric(context.Context, *observability.HashingMetric)   {}
+
+// fakeUsers stores copies of users n' checks versions the same way the postgres repository does
+type fakeUsers struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]*domain.User
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{
+		users: make(map[uuid.UUID]*domain.User),
+	}
+}
+
+func (f *fakeUsers) Save(_ context.Context, user *domain.User) (uuid.UUID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.users {
+		if u.Email() == user.Email() {
+			return uuid.Nil, consts.ErrUserAlreadyExists
+		}
+	}
+
+	f.users[user.ID()] = cloneUser(user)
+	return user.ID(), nil
+}
+
+func (f *fakeUsers) Update(_ context.Context, user *domain.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.users[user.ID()]
+	if !ok {
+		return consts.ErrUserDoesntExist
+	}
+	if stored.Version() != user.Version() {
+		return consts.ErrVersionConflict
+	}
+
+	user.IncrementVersion()
+	f.users[user.ID()] = cloneUser(user)
+	return nil
+}
+
+func (f *fakeUsers) Delete(_ context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[id]; !ok {
+		return consts.ErrUserDoesntExist
+	}
+
+	delete(f.users, id)
+	return nil
+}
+
+func (f *fakeUsers) GetByID(_ context.Context, id uuid.UUID) (*domain.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[id]
+	if !ok {
+		return nil, consts.ErrUserDoesntExist
+	}
+
+	return cloneUser(user), nil
+}
+
+func (f *fakeUsers) GetByEmail(_ context.Context, email string) (*domain.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if user.Email() == email {
+			return cloneUser(user), nil
+		}
+	}
+
+	return nil, consts.ErrUserDoesntExist
+}
+
+func cloneUser(user *domain.User) *domain.User {
+	email, _ := domain.NewEmail(user.Email())
+	return domain.FromPersistence(
+		user.ID(),
+		email,
+		user.Name(),
+		user.Surname(),
+		user.Password(),
+		append([]string(nil), user.Roles()...),
+		user.IsRecruiter(),
+		user.IsEmailVerified(),
+		user.Version(),
+	)
+}
+
+// fakeTOTPs stores copies of enrollments, so the service has to save changes explicitly
+type fakeTOTPs struct {
+	mu    sync.Mutex
+	totps map[uuid.UUID]*domainMFA.TOTP
+}
+
+func newFakeTOTPs() *fakeTOTPs {
+	return &fakeTOTPs{
+		totps: make(map[uuid.UUID]*domainMFA.TOTP),
+	}
+}
+
+func (f *fakeTOTPs) Save(_ context.Context, totp *domainMFA.TOTP) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The replaced enrollment gets a new version, the same way the postgres repository does
+	stored := cloneTOTP(totp)
+	if current, ok := f.totps[totp.UserID()]; ok {
+		stored = domainMFA.TOTPFromPersistence(stored.UserID(), stored.Secret(), stored.IsConfirmed(),
+			stored.RecoveryCodes(), stored.LastStep(), current.Version()+1, stored.CreatedAt())
+	}
+
+	f.totps[totp.UserID()] = stored
+	return nil
+}
+
+func (f *fakeTOTPs) Update(_ context.Context, totp *domainMFA.TOTP) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.totps[totp.UserID()]
+	if !ok {
+		return consts.ErrMFANotEnrolled
+	}
+	if stored.Version() != totp.Version() {
+		return consts.ErrVersionConflict
+	}
+
+	totp.IncrementVersion()
+	f.totps[totp.UserID()] = cloneTOTP(totp)
+	return nil
+}
+
+func (f *fakeTOTPs) GetByUserID(_ context.Context, userID uuid.UUID) (*domainMFA.TOTP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	totp, ok := f.totps[userID]
+	if !ok {
+		return nil, consts.ErrMFANotEnrolled
+	}
+
+	return cloneTOTP(totp), nil
+}
+
+func (f *fakeTOTPs) Delete(_ context.Context, userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.totps[userID]; !ok {
+		return consts.ErrMFANotEnrolled
+	}
+
+	delete(f.totps, userID)
+	return nil
+}
+
+func cloneTOTP(totp *domainMFA.TOTP) *domainMFA.TOTP {
+	return domainMFA.TOTPFromPersistence(
+		totp.UserID(),
+		totp.Secret(),
+		totp.IsConfirmed(),
+		append([]string(nil), totp.RecoveryCodes()...),
+		totp.LastStep(),
+		totp.Version(),
+		totp.CreatedAt(),
+	)
+}
+
+// fakePasskeys raises sign counts only if they grow, the same way the postgres repository does
+type fakePasskeys struct {
+	mu       sync.Mutex
+	passkeys map[string]*domainPasskey.Passkey
+}
+
+func newFakePasskeys() *fakePasskeys {
+	return &fakePasskeys{
+		passkeys: make(map[string]*domainPasskey.Passkey),
+	}
+}
+
+func (f *fakePasskeys) Save(_ context.Context, passkey *domainPasskey.Passkey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.passkeys[string(passkey.ID())] = clonePasskey(passkey)
+	return nil
+}
+
+func (f *fakePasskeys) UpdateSignCount(_ context.Context, passkey *domainPasskey.Passkey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.passkeys[string(passkey.ID())]
+	if !ok {
+		return consts.ErrInvalidPasskey
+	}
+	if passkey.SignCount() != 0 && stored.SignCount() >= passkey.SignCount() ||
+		passkey.SignCount() == 0 && stored.SignCount() != 0 {
+		return consts.ErrInvalidPasskey
+	}
+
+	f.passkeys[string(passkey.ID())] = clonePasskey(passkey)
+	return nil
+}
+
+func (f *fakePasskeys) GetByID(_ context.Context, id []byte) (*domainPasskey.Passkey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	passkey, ok := f.passkeys[string(id)]
+	if !ok {
+		return nil, consts.ErrPasskeyDoesntExist
+	}
+
+	return clonePasskey(passkey), nil
+}
+
+func (f *fakePasskeys) GetByUserID(_ context.Context, userID uuid.UUID) ([]*domainPasskey.Passkey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var passkeys []*domainPasskey.Passkey
+	for _, passkey := range f.passkeys {
+		if passkey.UserID() == userID {
+			passkeys = append(passkeys, clonePasskey(passkey))
+		}
+	}
+
+	return passkeys, nil
+}
+
+func clonePasskey(passkey *domainPasskey.Passkey) *domainPasskey.Passkey {
+	return domainPasskey.PasskeyFromPersistence(
+		passkey.ID(),
+		passkey.UserID(),
+		passkey.PublicKey(),
+		passkey.AttestationType(),
+		passkey.AAGUID(),
+		passkey.SignCount(),
+		append([]string(nil), passkey.Transports()...),
+		passkey.IsBackupEligible(),
+		passkey.IsBackedUp(),
+		passkey.CreatedAt(),
+		passkey.LastUsedAt(),
+	)
+}
+
+// fakeClients stores oauth clients, they aren't changed after registration
+type fakeClients struct {
+	mu      sync.Mutex
+	clients map[string]*domainOAuth.Client
+}
+
+func newFakeClients() *fakeClients {
+	return &fakeClients{
+		clients: make(map[string]*domainOAuth.Client),
+	}
+}
+
+func (f *fakeClients) Save(_ context.Context, client *domainOAuth.Client) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.clients[client.ID()] = client
+	return nil
+}
+
+func (f *fakeClients) GetByID(_ context.Context, id string) (*domainOAuth.Client, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	client, ok := f.clients[id]
+	if !ok {
+		return nil, consts.ErrClientDoesntExist
+	}
+
+	return client, nil
+}
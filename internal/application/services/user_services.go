@@ -12,22 +12,77 @@ import (
 
 	staffy "github.com/devathh/staffy-proto/gen/go"
 	domainCache "github.com/devathh/staffy-sso/internal/domain/cache"
+	domainLockout "github.com/devathh/staffy-sso/internal/domain/lockout"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainMFA "github.com/devathh/staffy-sso/internal/domain/mfa"
+	domainOAuth "github.com/devathh/staffy-sso/internal/domain/oauth"
 	"github.com/devathh/staffy-sso/internal/domain/observability"
+	domainOrg "github.com/devathh/staffy-sso/internal/domain/organization"
+	domainPasskey "github.com/devathh/staffy-sso/internal/domain/passkey"
+	domainRole "github.com/devathh/staffy-sso/internal/domain/role"
+	domainToken "github.com/devathh/staffy-sso/internal/domain/token"
 	domain "github.com/devathh/staffy-sso/internal/domain/user"
 	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/clientip"
 	"github.com/devathh/staffy-sso/internal/lib/jwt"
 	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
 )
 
 type ssoService struct {
-	log         *slog.Logger
-	persistence domain.UserRepository
-	cache       domainCache.UserCache
-	jwt         *jwt.JWT
-	cfg         *config.Config
-	ch          observability.UserCH
+	log           *slog.Logger
+	persistence   domain.UserRepository
+	cache         domainCache.UserCache
+	refreshTokens domainToken.RefreshTokenRepository
+	revocations   domainToken.RevocationList
+	clients       domainOAuth.ClientRepository
+	consents      domainOAuth.ConsentRepository
+	codes         domainOAuth.AuthorizationCodeRepository
+	actionTokens  domainToken.ActionTokenRepository
+	roles         domainRole.RoleRepository
+	roleChanges   domainRole.RoleChangeRepository
+	organizations domainOrg.OrganizationRepository
+	invitations   domainOrg.InvitationRepository
+	totps         domainMFA.TOTPRepository
+	passkeys      domainPasskey.PasskeyRepository
+	ceremonies    domainPasskey.CeremonyRepository
+	attempts      domainLockout.AttemptRepository
+	hasher        domain.PasswordHasher
+	breached      domain.BreachedPasswords
+	mail          domainMail.Sender
+	jwt           *jwt.JWT
+	webauthn      *webauthn.WebAuthn
+	cfg           *config.Config
+	ch            observability.UserCH
+}
+
+// Dependencies are storages n' tools, which services are built on
+type Dependencies struct {
+	Users         domain.UserRepository
+	UserCache     domainCache.UserCache
+	RefreshTokens domainToken.RefreshTokenRepository
+	Revocations   domainToken.RevocationList
+	Clients       domainOAuth.ClientRepository
+	Consents      domainOAuth.ConsentRepository
+	Codes         domainOAuth.AuthorizationCodeRepository
+	ActionTokens  domainToken.ActionTokenRepository
+	Roles         domainRole.RoleRepository
+	RoleChanges   domainRole.RoleChangeRepository
+	Organizations domainOrg.OrganizationRepository
+	Invitations   domainOrg.InvitationRepository
+	TOTPs         domainMFA.TOTPRepository
+	Passkeys      domainPasskey.PasskeyRepository
+	Ceremonies    domainPasskey.CeremonyRepository
+	Attempts      domainLockout.AttemptRepository
+	Hasher        domain.PasswordHasher
+	Mail          domainMail.Sender
+	CH            observability.UserCH
+	JWT           *jwt.JWT
+	WebAuthn      *webauthn.WebAuthn
+	// Breached is nil, if the list of leaked passwords isn't configured
+	Breached domain.BreachedPasswords
 }
 
 type SSOService interface {
@@ -35,7 +90,39 @@ type SSOService interface {
 	Login(ctx context.Context, req *staffy.LoginRequest) (*staffy.AuthResponse, error)
 	Register(ctx context.Context, req *staffy.RegisterRequest) (*staffy.AuthResponse, error)
 	Delete(ctx context.Context, token *staffy.Token) (*staffy.StatusResponse, error)
-	Refresh(ctx context.Context, token *staffy.Token) (*staffy.Token, error)
+	Refresh(ctx context.Context, token *staffy.Token) (*staffy.AuthResponse, error)
+	Logout(ctx context.Context, token *staffy.Token) (*staffy.StatusResponse, error)
+	GetJWKS(ctx context.Context) (*staffy.JWKS, error)
+	RequestPasswordReset(ctx context.Context, req *staffy.PasswordResetRequest) (*staffy.StatusResponse, error)
+	ConfirmPasswordReset(ctx context.Context, req *staffy.ConfirmPasswordResetRequest) (*staffy.StatusResponse, error)
+	ChangePassword(ctx context.Context, req *staffy.ChangePasswordRequest) (*staffy.AuthResponse, error)
+	VerifyEmail(ctx context.Context, req *staffy.VerifyEmailRequest) (*staffy.StatusResponse, error)
+	ResendVerification(ctx context.Context, req *staffy.ResendVerificationRequest) (*staffy.StatusResponse, error)
+	RequestEmailChange(ctx context.Context, req *staffy.EmailChangeRequest) (*staffy.StatusResponse, error)
+	ConfirmEmailChange(ctx context.Context, req *staffy.ConfirmEmailChangeRequest) (*staffy.AuthResponse, error)
+	RequestMagicLink(ctx context.Context, req *staffy.MagicLinkRequest) (*staffy.StatusResponse, error)
+	RedeemMagicLink(ctx context.Context, req *staffy.RedeemMagicLinkRequest) (*staffy.AuthResponse, error)
+	UpdateProfile(ctx context.Context, req *staffy.UpdateProfileRequest) (*staffy.User, error)
+	SwitchRole(ctx context.Context, req *staffy.SwitchRoleRequest) (*staffy.RoleChangeResponse, error)
+	ReviewRoleChange(ctx context.Context, req *staffy.ReviewRoleChangeRequest) (*staffy.RoleChangeResponse, error)
+	CheckPermission(ctx context.Context, req *staffy.CheckPermissionRequest) (*staffy.CheckPermissionResponse, error)
+	AssignRole(ctx context.Context, req *staffy.RoleAssignmentRequest) (*staffy.User, error)
+	RevokeRole(ctx context.Context, req *staffy.RoleAssignmentRequest) (*staffy.User, error)
+	CreateOrganization(ctx context.Context, req *staffy.CreateOrganizationRequest) (*staffy.Organization, error)
+	InviteMember(ctx context.Context, req *staffy.InviteMemberRequest) (*staffy.StatusResponse, error)
+	AcceptInvitation(ctx context.Context, req *staffy.AcceptInvitationRequest) (*staffy.Organization, error)
+	ListMembers(ctx context.Context, req *staffy.ListMembersRequest) (*staffy.ListMembersResponse, error)
+	SwitchOrganization(ctx context.Context, req *staffy.SwitchOrganizationRequest) (*staffy.AuthResponse, error)
+	EnrollTOTP(ctx context.Context, req *staffy.EnrollTOTPRequest) (*staffy.EnrollTOTPResponse, error)
+	ConfirmTOTP(ctx context.Context, req *staffy.ConfirmTOTPRequest) (*staffy.RecoveryCodesResponse, error)
+	DisableTOTP(ctx context.Context, req *staffy.DisableTOTPRequest) (*staffy.StatusResponse, error)
+	VerifyMFA(ctx context.Context, req *staffy.VerifyMFARequest) (*staffy.AuthResponse, error)
+	BeginPasskeyRegistration(ctx context.Context, req *staffy.BeginPasskeyRegistrationRequest) (*staffy.PasskeyCeremonyResponse, error)
+	FinishPasskeyRegistration(ctx context.Context, req *staffy.FinishPasskeyRegistrationRequest) (*staffy.StatusResponse, error)
+	BeginPasskeyLogin(ctx context.Context) (*staffy.PasskeyCeremonyResponse, error)
+	FinishPasskeyLogin(ctx context.Context, req *staffy.FinishPasskeyLoginRequest) (*staffy.AuthResponse, error)
+	// SyncRoles registers roles from the config
+	SyncRoles(ctx context.Context) error
 }
 
 func (s *ssoService) GetUserByToken(ctx context.Context, token *staffy.Token) (*staffy.User, error) {
@@ -45,14 +132,14 @@ func (s *ssoService) GetUserByToken(ctx context.Context, token *staffy.Token) (*
 
 	start := time.Now().UTC()
 
-	claims, err := s.getClaimsFromToken(token)
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, token)
 	if err != nil {
 		return nil, err
 	}
 
-	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
-	defer cancel()
-
 	// The first step is trying to get the user from the cache
 	user, err := s.getUserFromCacheByID(ctxTimeout, claims.ID)
 	if err == nil {
@@ -111,31 +198,60 @@ func (s *ssoService) Login(ctx context.Context, req *staffy.LoginRequest) (*staf
 	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
 	defer cancel()
 
+	attempt, err := s.reserveLogin(ctxTimeout, email, clientip.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseLogin(ctxTimeout, attempt)
+
 	// At first, try to get user from cache by email
 	user, err := s.getUserFromCacheByEmail(ctxTimeout, email)
 	if err == nil {
-		if !user.CheckThePassword(password) {
-			return nil, consts.ErrInvalidCredentials
+		ok, err := user.CheckThePassword(ctxTimeout, password, s.hasher)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, s.failLogin(ctxTimeout, attempt)
 		}
+		if err := s.checkVerified(user); err != nil {
+			return nil, err
+		}
+		s.upgradePassword(user, password)
 
 		go s.saveLog(context.TODO(), staffy.SSO_Login_FullMethodName, time.Since(start), int(codes.OK), true)
-		return s.toAuthResponse(user)
+		return s.finishLogin(ctxTimeout, user, attempt)
 	}
 
 	// If didn't work out - try to get from db
 	user, err = s.persistence.GetByEmail(ctxTimeout, email)
 	if err != nil {
 		if errors.Is(err, consts.ErrUserDoesntExist) {
-			return nil, consts.ErrInvalidCredentials
+			if s.cfg.Account.AntiEnumeration {
+				// Unknown emails take as long as wrong passwords
+				if _, err := s.hasher.Verify(ctxTimeout, password, s.hasher.DummyHash()); err != nil {
+					return nil, err
+				}
+			}
+
+			return nil, s.failLogin(ctxTimeout, attempt)
 		}
 
 		s.log.Error("failed to get user by email", slog.String("error", err.Error()))
 		return nil, consts.ErrDatabase
 	}
 
-	if !user.CheckThePassword(password) {
-		return nil, consts.ErrInvalidCredentials
+	ok, err := user.CheckThePassword(ctxTimeout, password, s.hasher)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.failLogin(ctxTimeout, attempt)
 	}
+	if err := s.checkVerified(user); err != nil {
+		return nil, err
+	}
+	s.upgradePassword(user, password)
 
 	// Save this user to cache
 	go func() {
@@ -145,7 +261,22 @@ func (s *ssoService) Login(ctx context.Context, req *staffy.LoginRequest) (*staf
 	}()
 
 	go s.saveLog(context.TODO(), staffy.SSO_Login_FullMethodName, time.Since(start), int(codes.OK), false)
-	return s.toAuthResponse(user)
+	return s.finishLogin(ctxTimeout, user, attempt)
+}
+
+// finishLogin resets the lockout only, when tokens are issued. The mfa challenge leaves failures of the account
+// as they are, the reservation is taken back n' VerifyMFA resets them after the second factor
+func (s *ssoService) finishLogin(ctx context.Context, user *domain.User, attempt *loginAttempt) (*staffy.AuthResponse, error) {
+	resp, err := s.startLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.GetMfaChallenge() == "" {
+		s.resetLockout(ctx, attempt)
+	}
+
+	return resp, nil
 }
 
 func (s *ssoService) Register(ctx context.Context, req *staffy.RegisterRequest) (*staffy.AuthResponse, error) {
@@ -160,36 +291,70 @@ func (s *ssoService) Register(ctx context.Context, req *staffy.RegisterRequest)
 		return nil, consts.ErrInvalidEmail
 	}
 
-	user, err := domain.NewUser(email, req.GetName(), req.GetSurname(), req.GetPassword(), req.GetIsRecruiter())
-	if err != nil {
-		s.log.Error("failed to create new user", slog.String("error", err.Error()))
-		return nil, consts.ErrCreateUser
+	if err := s.checkPassword("password", req.GetPassword(), email.String(), req.GetName(), req.GetSurname()); err != nil {
+		return nil, err
 	}
 
 	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
 	defer cancel()
 
+	user, err := domain.NewUser(ctxTimeout, email, req.GetName(), req.GetSurname(), req.GetPassword(), req.GetIsRecruiter(), s.hasher)
+	if err != nil {
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, consts.ErrOverloaded
+		}
+
+		s.log.Error("failed to create new user", slog.String("error", err.Error()))
+		return nil, consts.ErrCreateUser
+	}
+
 	// Save user to db
 	id, err := s.persistence.Save(ctxTimeout, user)
 	if err != nil {
 		if errors.Is(err, consts.ErrUserAlreadyExists) {
-			return nil, consts.ErrUserAlreadyExists
+			if !s.cfg.Account.AntiEnumeration {
+				return nil, consts.ErrUserAlreadyExists
+			}
+
+			s.sendAccountExists(email.String())
+
+			go s.saveLog(context.TODO(), staffy.SSO_Register_FullMethodName, time.Since(start), int(codes.OK), false)
+			return registrationAccepted(user), nil
 		}
 
 		s.log.Error("failed to save user", slog.String("error", err.Error()))
 		return nil, consts.ErrDatabase
 	}
 
-	go s.saveLog(context.TODO(), staffy.SSO_Register_FullMethodName, time.Since(start), int(codes.OK), false)
-	return s.toAuthResponse(
-		domain.FromPersistence(id,
-			email,
-			user.Name(),
-			user.Surname(),
-			user.Password(),
-			user.IsRecruiter(),
-		),
+	user = domain.FromPersistence(id,
+		email,
+		user.Name(),
+		user.Surname(),
+		user.Password(),
+		user.Roles(),
+		user.IsRecruiter(),
+		user.IsEmailVerified(),
+		user.Version(),
 	)
+
+	// The user is registered anyway, the link can be resent
+	s.sendVerification(user)
+
+	go s.saveLog(context.TODO(), staffy.SSO_Register_FullMethodName, time.Since(start), int(codes.OK), false)
+
+	// The response mustn't differ from the one for the existing email
+	if s.cfg.Account.AntiEnumeration {
+		return registrationAccepted(user), nil
+	}
+
+	// Blocked users get tokens only after the verification
+	if err := s.checkVerified(user); err != nil {
+		return &staffy.AuthResponse{
+			User: s.toStaffyUser(user),
+		}, nil
+	}
+
+	return s.toAuthResponse(ctxTimeout, user, newSession())
 }
 
 func (s *ssoService) Delete(ctx context.Context, token *staffy.Token) (*staffy.StatusResponse, error) {
@@ -199,21 +364,27 @@ func (s *ssoService) Delete(ctx context.Context, token *staffy.Token) (*staffy.S
 
 	start := time.Now().UTC()
 
-	tokenString := strings.TrimSpace(token.GetToken())
-	if tokenString == "" {
-		return nil, consts.ErrNilToken
-	}
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
 
-	claims, err := s.jwt.ValidateToken(tokenString)
+	claims, err := s.getClaimsFromToken(ctxTimeout, token)
 	if err != nil {
-		s.log.Warn("invalid token detected", slog.String("error", err.Error()))
-		return nil, consts.ErrInvalidToken
+		return nil, err
 	}
 
-	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
-	defer cancel()
+	// The user is read from the db, the cached one may have an outdated email
+	user, err := s.persistence.GetByID(ctxTimeout, claims.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrUserDoesntExist
+		}
 
-	if err := s.persistence.Delete(ctxTimeout, claims.ID); err != nil {
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()),
+			slog.String("user_id", claims.ID.String()))
+		return nil, consts.ErrDatabase
+	}
+
+	if err := s.persistence.Delete(ctxTimeout, user.ID()); err != nil {
 		if errors.Is(err, consts.ErrUserDoesntExist) {
 			return nil, consts.ErrUserDoesntExist
 		}
@@ -222,6 +393,20 @@ func (s *ssoService) Delete(ctx context.Context, token *staffy.Token) (*staffy.S
 		return nil, consts.ErrDatabase
 	}
 
+	// Otherwise the deleted user could still log in from the cache until it expires
+	if err := s.cache.Delete(ctxTimeout, user); err != nil {
+		s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+			slog.String("user_id", user.ID().String()))
+		return nil, consts.ErrCache
+	}
+
+	// Tokens of deleted user mustn't be accepted anymore
+	if err := s.revocations.RevokeUser(ctxTimeout, claims.ID, time.Now().UTC()); err != nil {
+		s.log.Error("failed to revoke tokens of deleted user", slog.String("error", err.Error()),
+			slog.String("user_id", claims.ID.String()))
+		return nil, consts.ErrCache
+	}
+
 	go s.saveLog(context.TODO(), staffy.SSO_Delete_FullMethodName, time.Since(start), int(codes.OK), false)
 	return &staffy.StatusResponse{
 		Timestamp:     time.Now().UTC().Unix(),
@@ -230,7 +415,8 @@ func (s *ssoService) Delete(ctx context.Context, token *staffy.Token) (*staffy.S
 	}, nil
 }
 
-func (s *ssoService) Refresh(ctx context.Context, token *staffy.Token) (*staffy.Token, error) {
+// Refresh rotates the given refresh token n' issues a new access token
+func (s *ssoService) Refresh(ctx context.Context, token *staffy.Token) (*staffy.AuthResponse, error) {
 	if token == nil {
 		return nil, consts.ErrNilToken
 	}
@@ -242,34 +428,246 @@ func (s *ssoService) Refresh(ctx context.Context, token *staffy.Token) (*staffy.
 		return nil, consts.ErrNilToken
 	}
 
-	claims, err := s.jwt.ValidateToken(tokenString)
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	// Tokens of oauth clients are refreshed only with client authentication
+	refreshToken, err := s.rotateRefreshToken(ctxTimeout, tokenString, "")
 	if err != nil {
-		s.log.Warn("invalid token detected", slog.String("error", err.Error()))
-		return nil, consts.ErrInvalidToken
+		return nil, err
 	}
 
-	newToken, err := s.jwt.GenerateToken(claims.Email, claims.ID)
+	user, err := s.getUserByID(ctxTimeout, refreshToken.UserID())
 	if err != nil {
-		s.log.Error("failed to generate new token", slog.String("error", err.Error()))
-		return nil, consts.ErrGenerateToken
+		return nil, err
+	}
+	if err := s.checkVerified(user); err != nil {
+		return nil, err
+	}
+
+	// The user may have left the organization since the token was issued
+	sess, err := s.withOrganization(ctxTimeout, session{
+		familyID: refreshToken.FamilyID(),
+		authTime: refreshToken.AuthTime(),
+	}, user.ID(), refreshToken.OrgID())
+	if err != nil {
+		return nil, err
 	}
 
 	go s.saveLog(context.TODO(), staffy.SSO_Refresh_FullMethodName, time.Since(start), int(codes.OK), false)
-	return &staffy.Token{
-		Token: newToken,
+	return s.toAuthResponse(ctxTimeout, user, sess)
+}
+
+// Logout revokes the given access token n' the refresh token family it was issued with
+func (s *ssoService) Logout(ctx context.Context, token *staffy.Token) (*staffy.StatusResponse, error) {
+	if token == nil {
+		return nil, consts.ErrNilToken
+	}
+
+	start := time.Now().UTC()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	claims, err := s.getClaimsFromToken(ctxTimeout, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.revocations.RevokeToken(ctxTimeout, claims.RegisteredClaims.ID, claims.ExpiresAt.Time); err != nil {
+		s.log.Error("failed to revoke token", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	if claims.SessionID != uuid.Nil {
+		if err := s.refreshTokens.RevokeFamily(ctxTimeout, claims.SessionID); err != nil {
+			s.log.Error("failed to revoke refresh token family", slog.String("error", err.Error()))
+			return nil, consts.ErrCache
+		}
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_Logout_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "user has been logged out",
+	}, nil
+}
+
+// GetJWKS returns public keys, which access tokens can be verified with
+func (s *ssoService) GetJWKS(ctx context.Context) (*staffy.JWKS, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, consts.ErrContext
+	}
+
+	jwks := s.jwt.JWKS()
+
+	keys := make([]*staffy.JWK, 0, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		keys = append(keys, &staffy.JWK{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+			Y:   key.Y,
+		})
+	}
+
+	return &staffy.JWKS{
+		Keys: keys,
+	}, nil
+}
+
+// rotateRefreshToken checks the refresh token of the client n' marks it as used. Every refresh token can be
+// used only once: presenting an already used one means it has leaked, so the whole family is revoked.
+func (s *ssoService) rotateRefreshToken(ctx context.Context, raw, clientID string) (*domainToken.RefreshToken, error) {
+	refreshToken, err := s.refreshTokens.GetByHash(ctx, domainToken.HashRefreshToken(raw))
+	if err != nil {
+		if errors.Is(err, consts.ErrTokenDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to get refresh token", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	if refreshToken.IsExpired() || refreshToken.ClientID() != clientID {
+		return nil, consts.ErrInvalidToken
+	}
+
+	revoked, err := s.refreshTokens.IsFamilyRevoked(ctx, refreshToken.FamilyID())
+	if err != nil {
+		s.log.Error("failed to check refresh token family", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+	if revoked {
+		return nil, consts.ErrInvalidToken
+	}
+
+	revokedBefore, err := s.revocations.UserRevokedBefore(ctx, refreshToken.UserID())
+	if err != nil {
+		s.log.Error("failed to check user's revocation", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+	if refreshToken.IssuedAt().Before(revokedBefore) {
+		return nil, consts.ErrInvalidToken
+	}
+
+	first, err := s.refreshTokens.MarkUsed(ctx, refreshToken)
+	if err != nil {
+		s.log.Error("failed to mark refresh token as used", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+	if !first {
+		s.log.Warn("refresh token reuse detected, revoking the family",
+			slog.String("user_id", refreshToken.UserID().String()),
+			slog.String("family_id", refreshToken.FamilyID().String()))
+
+		if err := s.refreshTokens.RevokeFamily(ctx, refreshToken.FamilyID()); err != nil {
+			s.log.Error("failed to revoke refresh token family", slog.String("error", err.Error()))
+			return nil, consts.ErrCache
+		}
+
+		return nil, consts.ErrInvalidToken
+	}
+
+	return refreshToken, nil
+}
+
+// toAuthResponse issues an access token n' a refresh token of the given session
+func (s *ssoService) toAuthResponse(ctx context.Context, user *domain.User, sess session) (*staffy.AuthResponse, error) {
+	tokens, err := s.issueTokens(ctx, user, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	return &staffy.AuthResponse{
+		Token:        tokens.accessToken,
+		RefreshToken: tokens.refreshToken,
+		User:         s.toStaffyUser(user),
 	}, nil
 }
 
-func (s *ssoService) toAuthResponse(user *domain.User) (*staffy.AuthResponse, error) {
-	tokenString, err := s.jwt.GenerateToken(user.Email(), user.ID())
+// session describes what tokens are issued for. Tokens of oauth clients carry the client n' granted scopes.
+type session struct {
+	familyID uuid.UUID
+	authTime time.Time
+	clientID string
+	scopes   []string
+	// orgID is the active organization, orgRole is set by withOrganization
+	orgID   uuid.UUID
+	orgRole string
+	// tokenID is the jti of the access token, it's random if empty
+	tokenID string
+}
+
+// newSession starts the session of the user, who has just entered credentials
+func newSession() session {
+	return session{
+		familyID: uuid.New(),
+		authTime: time.Now().UTC(),
+	}
+}
+
+type tokenPair struct {
+	accessToken  string
+	refreshToken string
+}
+
+func (s *ssoService) issueTokens(ctx context.Context, user *domain.User, sess session) (*tokenPair, error) {
+	var opts []jwt.TokenOption
+	if sess.clientID != "" {
+		opts = append(opts, jwt.WithClient(sess.clientID, sess.scopes))
+	}
+	if !sess.authTime.IsZero() {
+		opts = append(opts, jwt.WithAuthTime(sess.authTime))
+	}
+	if sess.orgID != uuid.Nil {
+		opts = append(opts, jwt.WithOrganization(sess.orgID, sess.orgRole))
+	}
+	if sess.tokenID != "" {
+		opts = append(opts, jwt.WithTokenID(sess.tokenID))
+	}
+	opts = append(opts, jwt.WithEmailVerified(user.IsEmailVerified()), jwt.WithRoles(user.Roles()))
+
+	// Unproven email isn't asserted to other services
+	email := user.Email()
+	if !user.IsEmailVerified() && s.cfg.Account.UnverifiedPolicy == UnverifiedRestrict {
+		email = ""
+	}
+
+	accessToken, err := s.jwt.GenerateToken(email, user.ID(), sess.familyID, opts...)
 	if err != nil {
 		s.log.Error("failed to generate new token", slog.String("error", err.Error()))
 		return nil, consts.ErrGenerateToken
 	}
 
-	return &staffy.AuthResponse{
-		Token: tokenString,
-		User:  s.toStaffyUser(user),
+	refreshToken, rawRefreshToken, err := domainToken.NewRefreshToken(
+		user.ID(),
+		sess.familyID,
+		sess.clientID,
+		sess.scopes,
+		sess.authTime,
+		sess.orgID,
+		s.cfg.Secrets.JWT.RefreshTTL,
+	)
+	if err != nil {
+		s.log.Error("failed to generate refresh token", slog.String("error", err.Error()))
+		return nil, consts.ErrGenerateToken
+	}
+
+	if err := s.refreshTokens.Save(ctx, refreshToken); err != nil {
+		s.log.Error("failed to save refresh token", slog.String("error", err.Error()))
+		return nil, consts.ErrCache
+	}
+
+	return &tokenPair{
+		accessToken:  accessToken,
+		refreshToken: rawRefreshToken,
 	}, nil
 }
 
@@ -280,9 +678,40 @@ func (s *ssoService) toStaffyUser(user *domain.User) *staffy.User {
 		Name:        user.Name(),
 		Surname:     user.Surname(),
 		IsRecruiter: user.IsRecruiter(),
+		Roles:       user.Roles(),
+
+		EmailVerified: user.IsEmailVerified(),
+		Version:       user.Version(),
 	}
 }
 
+// getUserByID tries to get the user from the cache, n' then from the db
+func (s *ssoService) getUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	user, err := s.getUserFromCacheByID(ctx, id)
+	if err == nil {
+		return user, nil
+	}
+
+	user, err = s.persistence.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrUserDoesntExist
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()),
+			slog.String("user_id", id.String()))
+		return nil, consts.ErrDatabase
+	}
+
+	go func() {
+		if err := s.saveUserToCacheByID(user); err != nil {
+			s.log.Error("failed to save user into cache", slog.String("error", err.Error()))
+		}
+	}()
+
+	return user, nil
+}
+
 func (s *ssoService) getUserFromCacheByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
 	user, err := s.cache.GetByID(ctx, id)
 	if err != nil {
@@ -331,18 +760,23 @@ func (s *ssoService) saveUserToCacheByEmail(user *domain.User) error {
 	return nil
 }
 
-func (s *ssoService) getClaimsFromToken(token *staffy.Token) (*jwt.CustomClaims, error) {
+func (s *ssoService) getClaimsFromToken(ctx context.Context, token *staffy.Token) (*jwt.CustomClaims, error) {
 	tokenString := strings.TrimSpace(token.GetToken())
 	if tokenString == "" {
 		return nil, consts.ErrNilToken
 	}
 
-	claims, err := s.jwt.ValidateToken(tokenString)
+	claims, err := s.jwt.ValidateToken(ctx, tokenString)
 	if err != nil {
 		s.log.Warn("invalid token detected", slog.String("error", err.Error()))
 		return nil, consts.ErrInvalidToken
 	}
 
+	// Tokens of oauth clients are limited by scopes, so they can't be used for the account itself
+	if claims.IsDelegated() {
+		return nil, consts.ErrInvalidToken
+	}
+
 	return claims, nil
 }
 
@@ -356,13 +790,35 @@ func (s *ssoService) saveLog(ctx context.Context, endpoint string, duration time
 	s.ch.SavePerformanceLog(ctx, &performanceLog)
 }
 
-func NewSSOService(cfg *config.Config, log *slog.Logger, persistence domain.UserRepository, cache domainCache.UserCache, ch observability.UserCH, jwt *jwt.JWT) SSOService {
+func NewSSOService(cfg *config.Config, log *slog.Logger, deps Dependencies) SSOService {
+	return newSSOService(cfg, log, deps)
+}
+
+func newSSOService(cfg *config.Config, log *slog.Logger, deps Dependencies) *ssoService {
 	return &ssoService{
-		log:         log,
-		persistence: persistence,
-		cache:       cache,
-		jwt:         jwt,
-		cfg:         cfg,
-		ch:          ch,
+		log:           log,
+		persistence:   deps.Users,
+		cache:         deps.UserCache,
+		refreshTokens: deps.RefreshTokens,
+		revocations:   deps.Revocations,
+		clients:       deps.Clients,
+		consents:      deps.Consents,
+		codes:         deps.Codes,
+		actionTokens:  deps.ActionTokens,
+		roles:         deps.Roles,
+		roleChanges:   deps.RoleChanges,
+		organizations: deps.Organizations,
+		invitations:   deps.Invitations,
+		totps:         deps.TOTPs,
+		passkeys:      deps.Passkeys,
+		ceremonies:    deps.Ceremonies,
+		attempts:      deps.Attempts,
+		hasher:        deps.Hasher,
+		breached:      deps.Breached,
+		mail:          deps.Mail,
+		jwt:           deps.JWT,
+		webauthn:      deps.WebAuthn,
+		cfg:           cfg,
+		ch:            deps.CH,
 	}
 }
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainCache "github.com/devathh/staffy-sso/internal/domain/cache"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+func TestRefreshReuseDetection(t *testing.T) {
+	tests := []struct {
+		name string
+		// replay presents the first refresh token again before the rotated one is used
+		replay  bool
+		wantErr error
+	}{
+		{
+			name:    "rotated token is accepted",
+			replay:  false,
+			wantErr: nil,
+		},
+		{
+			name:    "replay revokes the whole family",
+			replay:  true,
+			wantErr: consts.ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, "reuse@example.com", "correct horse battery staple")
+
+			login, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+			if err != nil {
+				t.Fatalf("failed to issue tokens: %v", err)
+			}
+
+			rotated, err := env.svc.Refresh(t.Context(), &staffy.Token{Token: login.RefreshToken})
+			if err != nil {
+				t.Fatalf("first refresh failed: %v", err)
+			}
+
+			if tt.replay {
+				if _, err := env.svc.Refresh(t.Context(), &staffy.Token{Token: login.RefreshToken}); !errors.Is(err, consts.ErrInvalidToken) {
+					t.Fatalf("replayed refresh: got %v, want %v", err, consts.ErrInvalidToken)
+				}
+			}
+
+			_, err = env.svc.Refresh(t.Context(), &staffy.Token{Token: rotated.RefreshToken})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("refresh of rotated token: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefreshRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   *staffy.Token
+		wantErr error
+	}{
+		{name: "nil token", token: nil, wantErr: consts.ErrNilToken},
+		{name: "blank token", token: &staffy.Token{Token: "  "}, wantErr: consts.ErrNilToken},
+		{name: "unknown token", token: &staffy.Token{Token: "unknown"}, wantErr: consts.ErrInvalidToken},
+	}
+
+	env := newTestEnv(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := env.svc.Refresh(t.Context(), tt.token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// failingCache fails evictions, the rest is passed to the real cache
+type failingCache struct {
+	domainCache.UserCache
+}
+
+func (failingCache) Delete(context.Context, *domain.User) error {
+	return errors.New("cache is unavailable")
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		failEvict bool
+		wantErr   error
+	}{
+		{name: "deleted user is evicted from cache", wantErr: nil},
+		{name: "failed eviction fails the request", failEvict: true, wantErr: consts.ErrCache},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.newUser(t, "delete@example.com", "correct horse battery staple")
+
+			if err := env.svc.cache.SetByEmail(t.Context(), user); err != nil {
+				t.Fatalf("failed to cache user: %v", err)
+			}
+			if err := env.svc.cache.SetByID(t.Context(), user); err != nil {
+				t.Fatalf("failed to cache user: %v", err)
+			}
+
+			resp, err := env.svc.toAuthResponse(t.Context(), user, newSession())
+			if err != nil {
+				t.Fatalf("failed to issue tokens: %v", err)
+			}
+
+			if tt.failEvict {
+				env.svc.cache = failingCache{UserCache: env.svc.cache}
+			}
+
+			_, err = env.svc.Delete(t.Context(), &staffy.Token{Token: resp.Token})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if _, err := env.svc.cache.GetByEmail(t.Context(), user.Email()); err == nil {
+				t.Fatal("user is still cached by email")
+			}
+			if _, err := env.svc.cache.GetByID(t.Context(), user.ID()); err == nil {
+				t.Fatal("user is still cached by id")
+			}
+
+			// Within the same second the watermark doesn't cover the token yet, the missing user rejects it then
+			if _, err := env.svc.Refresh(t.Context(), &staffy.Token{Token: resp.RefreshToken}); err == nil {
+				t.Fatal("refresh token of deleted user is accepted")
+			}
+		})
+	}
+}
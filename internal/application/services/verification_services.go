@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	domainMail "github.com/devathh/staffy-sso/internal/domain/mail"
+	domainToken "github.com/devathh/staffy-sso/internal/domain/token"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/codes"
+)
+
+// Policies for users, who haven't verified their email yet
+const (
+	UnverifiedAllow = "allow"
+	// UnverifiedRestrict issues tokens without the email, so it isn't trusted by other services
+	UnverifiedRestrict = "restrict"
+	UnverifiedBlock    = "block"
+)
+
+// VerifyEmail marks the email of the user as verified by the token from the link
+func (s *ssoService) VerifyEmail(ctx context.Context, req *staffy.VerifyEmailRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	rawToken := strings.TrimSpace(req.GetToken())
+	if rawToken == "" {
+		return nil, consts.ErrNilToken
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	token, err := s.consumeActionToken(ctxTimeout, domainToken.PurposeEmailVerification, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.persistence.GetByID(ctxTimeout, token.UserID())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, consts.ErrInvalidToken
+		}
+
+		s.log.Error("failed to get user by id", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	// The link was sent to the email, which the user doesn't own anymore
+	if err := user.VerifyEmail(token.Email()); err != nil {
+		return nil, consts.ErrInvalidToken
+	}
+
+	if err := s.persistence.Update(ctxTimeout, user); err != nil {
+		s.log.Error("failed to update user", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if err := s.cache.Delete(ctxTimeout, user); err != nil {
+		s.log.Error("failed to evict user from cache", slog.String("error", err.Error()),
+			slog.String("user_id", user.ID().String()))
+		return nil, consts.ErrCache
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_VerifyEmail_FullMethodName, time.Since(start), int(codes.OK), false)
+	return &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "email has been verified",
+	}, nil
+}
+
+// ResendVerification sends a new verification link. Like RequestPasswordReset,
+// the response doesn't tell whether the account exists.
+func (s *ssoService) ResendVerification(ctx context.Context, req *staffy.ResendVerificationRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, consts.ErrNilRequest
+	}
+
+	start := time.Now().UTC()
+
+	email, err := domain.NewEmail(strings.TrimSpace(req.GetEmail()))
+	if err != nil {
+		return nil, consts.ErrInvalidEmail
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, s.cfg.Server.RWTimeout)
+	defer cancel()
+
+	resp := &staffy.StatusResponse{
+		Timestamp:     time.Now().UTC().Unix(),
+		StatusCode:    http.StatusOK,
+		StatusMessage: "if the account exists n' isn't verified, the verification link has been sent",
+	}
+
+	user, err := s.persistence.GetByEmail(ctxTimeout, email.String())
+	if err != nil {
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return resp, nil
+		}
+
+		s.log.Error("failed to get user by email", slog.String("error", err.Error()))
+		return nil, consts.ErrDatabase
+	}
+
+	if !user.IsEmailVerified() {
+		s.sendVerification(user)
+	}
+
+	go s.saveLog(context.TODO(), staffy.SSO_ResendVerification_FullMethodName, time.Since(start), int(codes.OK), false)
+	return resp, nil
+}
+
+// sendVerification issues the verification token n' mails the link in background, like sendMagicLink,
+// so the response time doesn't tell whether the account exists n' is verified
+func (s *ssoService) sendVerification(user *domain.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.RWTimeout)
+		defer cancel()
+
+		token, rawToken, err := domainToken.NewActionToken(
+			domainToken.PurposeEmailVerification,
+			user.ID(),
+			user.Email(),
+			s.cfg.Account.VerificationTTL,
+		)
+		if err != nil {
+			s.log.Error("failed to generate verification token", slog.String("error", err.Error()))
+			return
+		}
+
+		if err := s.actionTokens.Save(ctx, token); err != nil {
+			s.log.Error("failed to save verification token", slog.String("error", err.Error()),
+				slog.String("user_id", user.ID().String()))
+			return
+		}
+
+		link, err := RedirectWithParams(s.cfg.Account.VerificationURL, url.Values{"token": {rawToken}})
+		if err != nil {
+			s.log.Error("failed to build verification link", slog.String("error", err.Error()))
+			return
+		}
+
+		s.sendMail(&domainMail.Message{
+			To:      user.Email(),
+			Subject: "Verify your Staffy email",
+			Body: fmt.Sprintf("Hi %s,\r\n\r\nFollow the link to verify your email: %s\r\n\r\nThe link expires in %s.",
+				user.Name(), link, s.cfg.Account.VerificationTTL),
+		})
+	}()
+}
+
+// checkVerified rejects users with unverified email, if the policy blocks them
+func (s *ssoService) checkVerified(user *domain.User) error {
+	if s.cfg.Account.UnverifiedPolicy == UnverifiedBlock && !user.IsEmailVerified() {
+		return consts.ErrEmailNotVerified
+	}
+
+	return nil
+}
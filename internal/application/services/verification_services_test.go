@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+// register registers the user with unverified email n' returns the token of the verification link
+func (e *testEnv) register(t *testing.T, email string) string {
+	t.Helper()
+
+	_, err := e.svc.Register(t.Context(), &staffy.RegisterRequest{
+		Email:    email,
+		Password: "correct horse battery staple",
+		Name:     "Test",
+		Surname:  "User",
+	})
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	return e.receiveToken(t, email)
+}
+
+func TestResendVerificationResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		// failSave breaks the token store, the response mustn't depend on it
+		failSave bool
+		wantMail bool
+	}{
+		{name: "unverified account", email: "unverified@example.com", wantMail: true},
+		{name: "verified account", email: "verified@example.com"},
+		{name: "unknown account", email: "unknown@example.com"},
+		{name: "unverified account with broken token store", email: "unverified@example.com", failSave: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.register(t, "unverified@example.com")
+			env.newUser(t, "verified@example.com", "correct horse battery staple")
+			if tt.failSave {
+				env.svc.actionTokens = failingActionTokens{ActionTokenRepository: env.svc.actionTokens}
+			}
+
+			resp, err := env.svc.ResendVerification(t.Context(), &staffy.ResendVerificationRequest{Email: tt.email})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusMessage != "if the account exists n' isn't verified, the verification link has been sent" {
+				t.Fatalf("unexpected response: %q", resp.StatusMessage)
+			}
+
+			if !tt.wantMail {
+				env.assertNoMail(t)
+				return
+			}
+			env.receiveToken(t, tt.email)
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	const email = "unverified@example.com"
+
+	t.Run("token is single-use", func(t *testing.T) {
+		env := newTestEnv(t)
+		token := env.register(t, email)
+
+		if _, err := env.svc.VerifyEmail(t.Context(), &staffy.VerifyEmailRequest{Token: token}); err != nil {
+			t.Fatalf("failed to verify email: %v", err)
+		}
+
+		user, err := env.users.GetByEmail(t.Context(), email)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+		if !user.IsEmailVerified() {
+			t.Fatal("email isn't verified")
+		}
+
+		if _, err := env.svc.VerifyEmail(t.Context(), &staffy.VerifyEmailRequest{Token: token}); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("reused token: got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+
+	t.Run("resent link", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.register(t, email)
+
+		if _, err := env.svc.ResendVerification(t.Context(), &staffy.ResendVerificationRequest{Email: email}); err != nil {
+			t.Fatalf("failed to resend verification: %v", err)
+		}
+		token := env.receiveToken(t, email)
+
+		if _, err := env.svc.VerifyEmail(t.Context(), &staffy.VerifyEmailRequest{Token: token}); err != nil {
+			t.Fatalf("failed to verify email: %v", err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		env := newTestEnv(t)
+		token := env.register(t, email)
+
+		env.redis.FastForward(env.svc.cfg.Account.VerificationTTL + time.Second)
+
+		if _, err := env.svc.VerifyEmail(t.Context(), &staffy.VerifyEmailRequest{Token: token}); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		if _, err := env.svc.VerifyEmail(t.Context(), &staffy.VerifyEmailRequest{Token: "unknown"}); !errors.Is(err, consts.ErrInvalidToken) {
+			t.Fatalf("got %v, want %v", err, consts.ErrInvalidToken)
+		}
+	})
+}
@@ -13,4 +13,6 @@ type UserCache interface {
 	SetByID(ctx context.Context, user *domain.User) error
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
+	// Delete evicts the user by id n' by email
+	Delete(ctx context.Context, user *domain.User) error
 }
@@ -0,0 +1,47 @@
+// Package domain implements failed login attempts n' the policy, which delays them
+package domain
+
+import "time"
+
+// Scope is what failed attempts are counted for
+type Scope string
+
+const (
+	ScopeAccount Scope = "account"
+	// ScopeIP has a higher threshold, many users may sign in from one address
+	ScopeIP Scope = "ip"
+)
+
+// Attempt is the login charged to one subject under the policy of its scope
+type Attempt struct {
+	Scope   Scope
+	Subject string
+	Policy  Policy
+}
+
+// Policy turns the number of failures into the time, the next attempt has to wait.
+// Every failure doubles the delay, after the threshold the subject is locked out.
+type Policy struct {
+	Threshold int64
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Lockout   time.Duration
+}
+
+// Delay returns how long attempts are blocked after the given number of failures n' whether it's a lockout
+func (p Policy) Delay(failures int64) (time.Duration, bool) {
+	if failures <= 0 {
+		return 0, false
+	}
+
+	if failures >= p.Threshold {
+		return p.Lockout, true
+	}
+
+	delay := p.BaseDelay
+	for i := int64(1); i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, p.MaxDelay), false
+}
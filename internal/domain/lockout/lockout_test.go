@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	account := Policy{
+		Threshold: 5,
+		BaseDelay: time.Second,
+		MaxDelay:  5 * time.Second,
+		Lockout:   15 * time.Minute,
+	}
+	ip := Policy{
+		Threshold: 50,
+		Lockout:   15 * time.Minute,
+	}
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		failures   int64
+		wantDelay  time.Duration
+		wantLocked bool
+	}{
+		{name: "no failures", policy: account, failures: 0, wantDelay: 0},
+		{name: "negative failures", policy: account, failures: -1, wantDelay: 0},
+		{name: "first failure waits the base delay", policy: account, failures: 1, wantDelay: time.Second},
+		{name: "second failure doubles the delay", policy: account, failures: 2, wantDelay: 2 * time.Second},
+		{name: "third failure doubles it again", policy: account, failures: 3, wantDelay: 4 * time.Second},
+		{name: "delay is capped", policy: account, failures: 4, wantDelay: 5 * time.Second},
+		{name: "threshold locks out", policy: account, failures: 5, wantDelay: 15 * time.Minute, wantLocked: true},
+		{name: "over the threshold stays locked", policy: account, failures: 100, wantDelay: 15 * time.Minute, wantLocked: true},
+		{name: "ip isn't delayed under the threshold", policy: ip, failures: 49, wantDelay: 0},
+		{name: "ip is locked out at the threshold", policy: ip, failures: 50, wantDelay: 15 * time.Minute, wantLocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, locked := tt.policy.Delay(tt.failures)
+			if delay != tt.wantDelay || locked != tt.wantLocked {
+				t.Fatalf("got %s, %v, want %s, %v", delay, locked, tt.wantDelay, tt.wantLocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type AttemptRepository interface {
+	// Reserve charges the attempt to every subject before the password is checked n' returns attempt numbers
+	// in the same order. It's atomic, so parallel attempts can't pass the threshold of the policy: the attempt
+	// over it locks the subject out. Blocked attempts aren't charged, the time the block ends is returned instead.
+	Reserve(ctx context.Context, attempts []Attempt, window time.Duration) ([]int64, time.Time, error)
+	// Release takes back the reservation of the attempt, which hasn't failed
+	Release(ctx context.Context, attempts []Attempt) error
+	// Block rejects attempts of the subject until the given time
+	Block(ctx context.Context, scope Scope, subject string, until time.Time) error
+	// Reset forgets failures n' the block of the subject
+	Reset(ctx context.Context, scope Scope, subject string) error
+}
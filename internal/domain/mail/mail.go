@@ -0,0 +1,15 @@
+// Package domain implements mail's domain interface
+package domain
+
+import "context"
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages to users. Implementations are picked by the config.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
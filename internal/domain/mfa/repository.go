@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type TOTPRepository interface {
+	// Save creates the totp of the user or replaces it
+	Save(ctx context.Context, totp *TOTP) error
+	// Update stores the totp only if it hasn't been updated since it was read, otherwise
+	// it fails with consts.ErrVersionConflict
+	Update(ctx context.Context, totp *TOTP) error
+	// GetByUserID fails with consts.ErrMFANotEnrolled, if the user hasn't started the enrollment
+	GetByUserID(ctx context.Context, userID uuid.UUID) (*TOTP, error)
+	Delete(ctx context.Context, userID uuid.UUID) error
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodesCount = 10
+	recoveryCodeSize   = 5
+)
+
+// TOTP is the authenticator app of the user. It protects the login only after it's confirmed with the first code.
+// Only hashes of recovery codes are kept.
+type TOTP struct {
+	userID        uuid.UUID
+	secret        string
+	confirmed     bool
+	recoveryCodes []string
+	// lastStep is the time step of the last accepted code, so a code can't be used twice
+	lastStep int64
+	// version is bumped on every update, so a code or a recovery code can't be accepted by two parallel logins
+	version   int64
+	createdAt time.Time
+}
+
+func (t TOTP) UserID() uuid.UUID {
+	return t.userID
+}
+
+func (t TOTP) Secret() string {
+	return t.secret
+}
+
+func (t TOTP) IsConfirmed() bool {
+	return t.confirmed
+}
+
+func (t TOTP) RecoveryCodes() []string {
+	return t.recoveryCodes
+}
+
+func (t TOTP) LastStep() int64 {
+	return t.lastStep
+}
+
+func (t TOTP) Version() int64 {
+	return t.version
+}
+
+// IncrementVersion is called by the repository, when the totp has been updated
+func (t *TOTP) IncrementVersion() {
+	t.version++
+}
+
+func (t TOTP) CreatedAt() time.Time {
+	return t.createdAt
+}
+
+// Confirm enables the totp n' returns raw recovery codes, which are shown to the user once
+func (t *TOTP) Confirm(step int64) ([]string, error) {
+	if t.confirmed {
+		return nil, errors.New("totp has already been confirmed")
+	}
+
+	if err := t.UseStep(step); err != nil {
+		return nil, err
+	}
+
+	raw, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	t.confirmed = true
+	t.recoveryCodes = hashes
+	return raw, nil
+}
+
+// UseStep accepts the code of the given time step, codes of the same or earlier steps are replays
+func (t *TOTP) UseStep(step int64) error {
+	if step <= t.lastStep {
+		return errors.New("code has already been used")
+	}
+
+	t.lastStep = step
+	return nil
+}
+
+// UseRecoveryCode burns the code, it returns false if the code is unknown
+func (t *TOTP) UseRecoveryCode(raw string) bool {
+	hash := HashRecoveryCode(raw)
+	for i, code := range t.recoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(code), []byte(hash)) == 1 {
+			t.recoveryCodes = append(t.recoveryCodes[:i:i], t.recoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// HashRecoveryCode ignores case n' dashes, so the code can be typed as the user likes
+func HashRecoveryCode(raw string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(raw), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	raw := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for range recoveryCodesCount {
+		buf := make([]byte, recoveryCodeSize*2)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		code := hex.EncodeToString(buf[:recoveryCodeSize]) + "-" + hex.EncodeToString(buf[recoveryCodeSize:])
+		raw = append(raw, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return raw, hashes, nil
+}
+
+// NewTOTP starts the enrollment, the totp is confirmed with the first code from the app
+func NewTOTP(userID uuid.UUID, secret string) (*TOTP, error) {
+	if userID == uuid.Nil || secret == "" {
+		return nil, errors.New("user id n' secret cannot be empty")
+	}
+
+	return &TOTP{
+		userID:    userID,
+		secret:    secret,
+		createdAt: time.Now().UTC(),
+	}, nil
+}
+
+func TOTPFromPersistence(userID uuid.UUID, secret string, confirmed bool, recoveryCodes []string, lastStep, version int64, createdAt time.Time) *TOTP {
+	return &TOTP{
+		userID:        userID,
+		secret:        secret,
+		confirmed:     confirmed,
+		recoveryCodes: recoveryCodes,
+		lastStep:      lastStep,
+		version:       version,
+		createdAt:     createdAt,
+	}
+}
@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNewTOTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		secret  string
+		wantErr bool
+	}{
+		{name: "valid", userID: uuid.New(), secret: "JBSWY3DPEHPK3PXP"},
+		{name: "nil user", userID: uuid.Nil, secret: "JBSWY3DPEHPK3PXP", wantErr: true},
+		{name: "empty secret", userID: uuid.New(), secret: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			totp, err := NewTOTP(tt.userID, tt.secret)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if totp.IsConfirmed() {
+				t.Fatal("new totp is confirmed")
+			}
+			if len(totp.RecoveryCodes()) != 0 {
+				t.Fatal("new totp has recovery codes")
+			}
+		})
+	}
+}
+
+func TestTOTPConfirm(t *testing.T) {
+	totp, err := NewTOTP(uuid.New(), "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	raw, err := totp.Confirm(100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !totp.IsConfirmed() {
+		t.Fatal("totp isn't confirmed")
+	}
+	if totp.LastStep() != 100 {
+		t.Fatalf("last step: got %d, want 100", totp.LastStep())
+	}
+	if len(raw) != recoveryCodesCount || len(totp.RecoveryCodes()) != recoveryCodesCount {
+		t.Fatalf("got %d raw n' %d stored codes, want %d", len(raw), len(totp.RecoveryCodes()), recoveryCodesCount)
+	}
+
+	seen := make(map[string]struct{})
+	for i, code := range raw {
+		if _, ok := seen[code]; ok {
+			t.Fatal("recovery code is repeated")
+		}
+		seen[code] = struct{}{}
+
+		if totp.RecoveryCodes()[i] != HashRecoveryCode(code) {
+			t.Fatal("raw recovery code is stored instead of its hash")
+		}
+	}
+
+	if _, err := totp.Confirm(101); err == nil {
+		t.Fatal("totp is confirmed twice")
+	}
+}
+
+func TestTOTPUseStep(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    int64
+		wantErr bool
+	}{
+		{name: "later step", step: 101},
+		{name: "same step is a replay", step: 100, wantErr: true},
+		{name: "earlier step is a replay", step: 99, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			totp := TOTPFromPersistence(uuid.New(), "JBSWY3DPEHPK3PXP", true, nil, 100, 0, time.Now())
+
+			err := totp.UseStep(tt.step)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error: %v", err, tt.wantErr)
+			}
+
+			want := tt.step
+			if tt.wantErr {
+				want = 100
+			}
+			if totp.LastStep() != want {
+				t.Fatalf("last step: got %d, want %d", totp.LastStep(), want)
+			}
+		})
+	}
+}
+
+func TestTOTPUseRecoveryCode(t *testing.T) {
+	const code = "0a1b2c3d4e-5f6a7b8c9d"
+
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "as issued", input: code, want: true},
+		{name: "upper case", input: strings.ToUpper(code), want: true},
+		{name: "without dash", input: strings.ReplaceAll(code, "-", ""), want: true},
+		{name: "with spaces", input: "  " + code + " ", want: true},
+		{name: "unknown code", input: "ffffffffff-ffffffffff", want: false},
+		{name: "empty", input: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			totp := TOTPFromPersistence(uuid.New(), "JBSWY3DPEHPK3PXP", true, []string{
+				HashRecoveryCode("aaaaaaaaaa-aaaaaaaaaa"),
+				HashRecoveryCode(code),
+			}, 0, 0, time.Now())
+
+			if got := totp.UseRecoveryCode(tt.input); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				if len(totp.RecoveryCodes()) != 2 {
+					t.Fatal("unknown code burned a recovery code")
+				}
+				return
+			}
+
+			if len(totp.RecoveryCodes()) != 1 {
+				t.Fatalf("got %d codes left, want 1", len(totp.RecoveryCodes()))
+			}
+			if totp.UseRecoveryCode(tt.input) {
+				t.Fatal("recovery code is accepted twice")
+			}
+			if !totp.UseRecoveryCode("aaaaaaaaaa-aaaaaaaaaa") {
+				t.Fatal("another recovery code is burned")
+			}
+		})
+	}
+}
+
+func TestTOTPUseRecoveryCodeKeepsPersistedSlice(t *testing.T) {
+	stored := []string{HashRecoveryCode("aaaaaaaaaa-aaaaaaaaaa"), HashRecoveryCode("bbbbbbbbbb-bbbbbbbbbb")}
+	totp := TOTPFromPersistence(uuid.New(), "JBSWY3DPEHPK3PXP", true, stored, 0, 0, time.Now())
+
+	if !totp.UseRecoveryCode("aaaaaaaaaa-aaaaaaaaaa") {
+		t.Fatal("recovery code isn't accepted")
+	}
+	if stored[0] != HashRecoveryCode("aaaaaaaaaa-aaaaaaaaaa") || stored[1] != HashRecoveryCode("bbbbbbbbbb-bbbbbbbbbb") {
+		t.Fatal("burning a code modified the persisted slice")
+	}
+}
@@ -0,0 +1,168 @@
+// Package domain implements oauth's domain structures
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// defaultGrants are allowed for clients registered without grant types
+var defaultGrants = []string{GrantAuthorizationCode, GrantRefreshToken}
+
+// Client is a third-party application, which acts on behalf of users, or a backend service,
+// which acts on its own behalf with the client_credentials grant.
+// Public clients (browser extensions, mobile apps) have no secret n' rely on PKCE only.
+type Client struct {
+	id           string
+	name         string
+	secretHash   string
+	redirectURIs []string
+	scopes       []string
+	grantTypes   []string
+}
+
+func (c Client) ID() string {
+	return c.id
+}
+
+func (c Client) Name() string {
+	return c.name
+}
+
+func (c Client) SecretHash() string {
+	return c.secretHash
+}
+
+func (c Client) RedirectURIs() []string {
+	return c.redirectURIs
+}
+
+func (c Client) Scopes() []string {
+	return c.scopes
+}
+
+func (c Client) GrantTypes() []string {
+	return c.grantTypes
+}
+
+func (c Client) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.grantTypes, grantType)
+}
+
+func (c Client) IsPublic() bool {
+	return c.secretHash == ""
+}
+
+// CheckTheSecret verifies the secret on the verifier, so a burst of token requests waits for the hashing pool
+func (c *Client) CheckTheSecret(ctx context.Context, secret string, verifier SecretVerifier) (bool, error) {
+	if c.IsPublic() {
+		return false, nil
+	}
+
+	return verifier.Verify(ctx, secret, c.secretHash)
+}
+
+// HasRedirectURI compares the uri with registered ones exactly, as OAuth 2.1 requires
+func (c Client) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.redirectURIs, uri)
+}
+
+// AllowsScopes reports whether all the scopes are registered for the client
+func (c Client) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewClient hashes the secret. Empty secret means the client is public.
+func NewClient(id, name, secret string, redirectURIs, scopes, grantTypes []string) (*Client, error) {
+	id, name = strings.TrimSpace(id), strings.TrimSpace(name)
+	if id == "" || name == "" {
+		return nil, errors.New("client id n' name cannot be empty")
+	}
+
+	if len(grantTypes) == 0 {
+		grantTypes = defaultGrants
+	}
+
+	for _, grantType := range grantTypes {
+		switch grantType {
+		case GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials:
+		default:
+			return nil, fmt.Errorf("unsupported grant type: %s", grantType)
+		}
+	}
+
+	if slices.Contains(grantTypes, GrantAuthorizationCode) && len(redirectURIs) == 0 {
+		return nil, errors.New("client must have at least one redirect uri")
+	}
+
+	// Services can't keep anything but a secret to authenticate with
+	if slices.Contains(grantTypes, GrantClientCredentials) && secret == "" {
+		return nil, errors.New("client_credentials grant requires a secret")
+	}
+
+	var secretHash string
+	if secret != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate hash of secret: %w", err)
+		}
+		secretHash = string(hash)
+	}
+
+	return &Client{
+		id:           id,
+		name:         name,
+		secretHash:   secretHash,
+		redirectURIs: redirectURIs,
+		scopes:       scopes,
+		grantTypes:   grantTypes,
+	}, nil
+}
+
+func ClientFromPersistence(id, name, secretHash string, redirectURIs, scopes, grantTypes []string) *Client {
+	if len(grantTypes) == 0 {
+		grantTypes = defaultGrants
+	}
+
+	return &Client{
+		id:           id,
+		name:         name,
+		secretHash:   secretHash,
+		redirectURIs: redirectURIs,
+		scopes:       scopes,
+		grantTypes:   grantTypes,
+	}
+}
+
+// ParseScope splits space-delimited scope parameter, duplicates are dropped
+func ParseScope(scope string) []string {
+	scopes := make([]string, 0)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
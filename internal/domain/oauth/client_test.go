@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptVerifier counts calls, so a public client can be checked not to reach the pool
+type bcryptVerifier struct {
+	calls int
+	err   error
+}
+
+func (v *bcryptVerifier) Verify(_ context.Context, secret, hash string) (bool, error) {
+	v.calls++
+	if v.err != nil {
+		return false, v.err
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil, nil
+}
+
+func TestCheckTheSecret(t *testing.T) {
+	confidential, err := NewClient("service", "Service", "s3cret", nil, []string{"users:read"}, []string{GrantClientCredentials})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	public, err := NewClient("app", "App", "", []string{"https://app.test/callback"}, []string{"profile"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		client    *Client
+		secret    string
+		verifyErr error
+		want      bool
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "right secret", client: confidential, secret: "s3cret", want: true, wantCalls: 1},
+		{name: "wrong secret", client: confidential, secret: "wrong", wantCalls: 1},
+		{name: "overloaded", client: confidential, secret: "s3cret", verifyErr: consts.ErrOverloaded, wantErr: consts.ErrOverloaded, wantCalls: 1},
+		{name: "public client", client: public, secret: "", wantCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &bcryptVerifier{err: tt.verifyErr}
+
+			ok, err := tt.client.CheckTheSecret(t.Context(), tt.secret, verifier)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error: got %v, want %v", err, tt.wantErr)
+			}
+			if ok != tt.want {
+				t.Fatalf("got %v, want %v", ok, tt.want)
+			}
+			if verifier.calls != tt.wantCalls {
+				t.Fatalf("verifier calls: got %d, want %d", verifier.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	codeSize = 32
+
+	// CodeChallengeMethodS256 is the only supported PKCE method, "plain" is rejected
+	CodeChallengeMethodS256 = "S256"
+)
+
+// AuthorizationCode is a single-use code, which is exchanged for tokens. Only hash of the code is kept.
+// Nonce n' auth time are passed to the ID token, if the openid scope is granted.
+type AuthorizationCode struct {
+	hash          string
+	clientID      string
+	userID        uuid.UUID
+	redirectURI   string
+	scopes        []string
+	codeChallenge string
+	nonce         string
+	authTime      time.Time
+	expiresAt     time.Time
+}
+
+func (c AuthorizationCode) Hash() string {
+	return c.hash
+}
+
+func (c AuthorizationCode) ClientID() string {
+	return c.clientID
+}
+
+func (c AuthorizationCode) UserID() uuid.UUID {
+	return c.userID
+}
+
+func (c AuthorizationCode) RedirectURI() string {
+	return c.redirectURI
+}
+
+func (c AuthorizationCode) Scopes() []string {
+	return c.scopes
+}
+
+func (c AuthorizationCode) CodeChallenge() string {
+	return c.codeChallenge
+}
+
+func (c AuthorizationCode) Nonce() string {
+	return c.nonce
+}
+
+func (c AuthorizationCode) AuthTime() time.Time {
+	return c.authTime
+}
+
+func (c AuthorizationCode) ExpiresAt() time.Time {
+	return c.expiresAt
+}
+
+func (c AuthorizationCode) IsExpired() bool {
+	return !time.Now().UTC().Before(c.expiresAt)
+}
+
+// VerifyPKCE checks that BASE64URL(SHA256(verifier)) equals the challenge
+func (c AuthorizationCode) VerifyPKCE(verifier string) bool {
+	// RFC 7636: verifier is 43-128 characters long
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(c.codeChallenge)) == 1
+}
+
+// CodeRedemption is what has been issued for the code. If the code is presented again, it has leaked,
+// so the session is revoked (RFC 6749 4.1.2)
+type CodeRedemption struct {
+	// FamilyID is the family of refresh tokens n' AccessTokenID is the jti of the access token
+	FamilyID      uuid.UUID
+	AccessTokenID string
+}
+
+func HashCode(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAuthorizationCode returns the code n' its raw value, which is given to the client
+func NewAuthorizationCode(clientID string, userID uuid.UUID, redirectURI string, scopes []string, codeChallenge, nonce string, authTime time.Time, ttl time.Duration) (*AuthorizationCode, string, error) {
+	if clientID == "" || userID == uuid.Nil || redirectURI == "" {
+		return nil, "", errors.New("client id, user id n' redirect uri cannot be empty")
+	}
+
+	if codeChallenge == "" {
+		return nil, "", errors.New("code challenge cannot be empty")
+	}
+
+	buf := make([]byte, codeSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	return &AuthorizationCode{
+		hash:          HashCode(raw),
+		clientID:      clientID,
+		userID:        userID,
+		redirectURI:   redirectURI,
+		scopes:        scopes,
+		codeChallenge: codeChallenge,
+		nonce:         nonce,
+		authTime:      authTime,
+		expiresAt:     time.Now().UTC().Add(ttl),
+	}, raw, nil
+}
+
+func CodeFromPersistence(hash, clientID string, userID uuid.UUID, redirectURI string, scopes []string, codeChallenge, nonce string, authTime, expiresAt time.Time) *AuthorizationCode {
+	return &AuthorizationCode{
+		hash:          hash,
+		clientID:      clientID,
+		userID:        userID,
+		redirectURI:   redirectURI,
+		scopes:        scopes,
+		codeChallenge: codeChallenge,
+		nonce:         nonce,
+		authTime:      authTime,
+		expiresAt:     expiresAt,
+	}
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testVerifier is 44 characters long, testChallenge is BASE64URL(SHA256(testVerifier))
+const (
+	testVerifier  = "M25iVXpKU3puUjFaYWg3T1NDTDQtcW1ROUY2ZXhKb3h3"
+	testChallenge = "4mdEpB6p5MagxEW3oIN8slvbLftN-gHbZADENGTetNs"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	long := make([]byte, 129)
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		verifier  string
+		want      bool
+	}{
+		{name: "s256 challenge", challenge: testChallenge, verifier: testVerifier, want: true},
+		{name: "wrong verifier", challenge: testChallenge, verifier: testVerifier[:43] + "X", want: false},
+		{name: "plain method is rejected", challenge: testVerifier, verifier: testVerifier, want: false},
+		{name: "too short verifier", challenge: testChallenge, verifier: testVerifier[:42], want: false},
+		{name: "too long verifier", challenge: testChallenge, verifier: string(long), want: false},
+		{name: "empty verifier", challenge: testChallenge, verifier: "", want: false},
+		{name: "empty challenge", challenge: "", verifier: testVerifier, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := CodeFromPersistence("hash", "client", uuid.New(), "https://app/cb", nil, tt.challenge, "", time.Time{}, time.Now().Add(time.Minute))
+			if got := code.VerifyPKCE(tt.verifier); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAuthorizationCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		clientID    string
+		userID      uuid.UUID
+		redirectURI string
+		challenge   string
+		wantErr     bool
+	}{
+		{name: "valid", clientID: "client", userID: uuid.New(), redirectURI: "https://app/cb", challenge: testChallenge},
+		{name: "no client", clientID: "", userID: uuid.New(), redirectURI: "https://app/cb", challenge: testChallenge, wantErr: true},
+		{name: "no user", clientID: "client", userID: uuid.Nil, redirectURI: "https://app/cb", challenge: testChallenge, wantErr: true},
+		{name: "no redirect uri", clientID: "client", userID: uuid.New(), redirectURI: "", challenge: testChallenge, wantErr: true},
+		{name: "no challenge", clientID: "client", userID: uuid.New(), redirectURI: "https://app/cb", challenge: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, raw, err := NewAuthorizationCode(tt.clientID, tt.userID, tt.redirectURI, []string{"openid"}, tt.challenge, "nonce", time.Now(), time.Minute)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if code.Hash() != HashCode(raw) {
+				t.Fatal("hash doesn't match the raw code")
+			}
+			if code.IsExpired() {
+				t.Fatal("new code is expired")
+			}
+			if !code.VerifyPKCE(testVerifier) {
+				t.Fatal("code doesn't verify its challenge")
+			}
+		})
+	}
+}
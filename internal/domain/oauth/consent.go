@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Consent is a record of scopes, which the user has granted to the client
+type Consent struct {
+	userID    uuid.UUID
+	clientID  string
+	scopes    []string
+	grantedAt time.Time
+}
+
+func (c Consent) UserID() uuid.UUID {
+	return c.userID
+}
+
+func (c Consent) ClientID() string {
+	return c.clientID
+}
+
+func (c Consent) Scopes() []string {
+	return c.scopes
+}
+
+func (c Consent) GrantedAt() time.Time {
+	return c.grantedAt
+}
+
+// Covers reports whether all the scopes have been granted
+func (c Consent) Covers(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Grant adds the scopes to already granted ones
+func (c *Consent) Grant(scopes []string) {
+	for _, scope := range scopes {
+		if !slices.Contains(c.scopes, scope) {
+			c.scopes = append(c.scopes, scope)
+		}
+	}
+	c.grantedAt = time.Now().UTC()
+}
+
+func NewConsent(userID uuid.UUID, clientID string, scopes []string) *Consent {
+	return &Consent{
+		userID:    userID,
+		clientID:  clientID,
+		scopes:    scopes,
+		grantedAt: time.Now().UTC(),
+	}
+}
+
+func ConsentFromPersistence(userID uuid.UUID, clientID string, scopes []string, grantedAt time.Time) *Consent {
+	return &Consent{
+		userID:    userID,
+		clientID:  clientID,
+		scopes:    scopes,
+		grantedAt: grantedAt,
+	}
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ClientRepository interface {
+	// Save creates the client or replaces the existing one
+	Save(ctx context.Context, client *Client) error
+	GetByID(ctx context.Context, id string) (*Client, error)
+}
+
+type ConsentRepository interface {
+	Save(ctx context.Context, consent *Consent) error
+	Get(ctx context.Context, userID uuid.UUID, clientID string) (*Consent, error)
+}
+
+type AuthorizationCodeRepository interface {
+	Save(ctx context.Context, code *AuthorizationCode) error
+	// Consume returns the code n' deletes it, so it can't be used twice
+	Consume(ctx context.Context, hash string) (*AuthorizationCode, error)
+	// MarkRedeemed keeps what has been issued for the consumed code
+	MarkRedeemed(ctx context.Context, hash string, redemption CodeRedemption, ttl time.Duration) error
+	// GetRedemption fails with consts.ErrTokenDoesntExist, if the code hasn't been redeemed
+	GetRedemption(ctx context.Context, hash string) (*CodeRedemption, error)
+}
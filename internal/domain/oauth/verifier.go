@@ -0,0 +1,9 @@
+package domain
+
+import "context"
+
+// SecretVerifier checks client secrets against their bcrypt hashes.
+// Verify may wait for a free worker, it fails with consts.ErrOverloaded, if there's none in time
+type SecretVerifier interface {
+	Verify(ctx context.Context, secret, hash string) (bool, error)
+}
@@ -13,6 +13,35 @@ type PerformanceLog struct {
 	CacheHit   bool
 }
 
+// LockoutEvent is written, when an account or an ip is locked out after failed logins
+type LockoutEvent struct {
+	Scope       string
+	Subject     string
+	Failures    int64
+	LockedUntil time.Time
+}
+
+// ThrottleEvent is written, when a call is rejected by the rate limit
+type ThrottleEvent struct {
+	Method     string
+	Dimension  string
+	Subject    string
+	RetryAfter time.Duration
+}
+
+// HashingMetric is written for every task of the password hashing pool
+type HashingMetric struct {
+	// Operation is hash or verify
+	Operation string
+	QueueWait time.Duration
+	Duration  time.Duration
+	// Outcome is ok, rejected (the queue is full) or timeout (no worker in time)
+	Outcome string
+}
+
 type UserCH interface {
 	SavePerformanceLog(ctx context.Context, log *PerformanceLog)
+	SaveLockoutEvent(ctx context.Context, event *LockoutEvent)
+	SaveThrottleEvent(ctx context.Context, event *ThrottleEvent)
+	SaveHashingMetric(ctx context.Context, metric *HashingMetric)
 }
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const invitationTokenSize = 32
+
+// Invitation is a single-use invitation to the organization. It's bound to the email, it was sent to.
+// Only hash of the token is kept.
+type Invitation struct {
+	hash           string
+	organizationID uuid.UUID
+	email          string
+	role           MemberRole
+	invitedBy      uuid.UUID
+	createdAt      time.Time
+	expiresAt      time.Time
+}
+
+func (i Invitation) Hash() string {
+	return i.hash
+}
+
+func (i Invitation) OrganizationID() uuid.UUID {
+	return i.organizationID
+}
+
+func (i Invitation) Email() string {
+	return i.email
+}
+
+func (i Invitation) Role() MemberRole {
+	return i.role
+}
+
+func (i Invitation) InvitedBy() uuid.UUID {
+	return i.invitedBy
+}
+
+func (i Invitation) CreatedAt() time.Time {
+	return i.createdAt
+}
+
+func (i Invitation) ExpiresAt() time.Time {
+	return i.expiresAt
+}
+
+func (i Invitation) IsExpired() bool {
+	return !time.Now().UTC().Before(i.expiresAt)
+}
+
+func HashInvitation(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewInvitation returns the invitation n' its raw token, which is sent to the email
+func NewInvitation(organizationID uuid.UUID, email string, role MemberRole, invitedBy uuid.UUID, ttl time.Duration) (*Invitation, string, error) {
+	if organizationID == uuid.Nil || invitedBy == uuid.Nil || email == "" {
+		return nil, "", errors.New("organization, inviter n' email cannot be empty")
+	}
+
+	if role == RoleOwner {
+		return nil, "", errors.New("owner can't be invited")
+	}
+
+	if ttl <= 0 {
+		return nil, "", errors.New("ttl must be positive")
+	}
+
+	buf := make([]byte, invitationTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	return &Invitation{
+		hash:           HashInvitation(raw),
+		organizationID: organizationID,
+		email:          email,
+		role:           role,
+		invitedBy:      invitedBy,
+		createdAt:      now,
+		expiresAt:      now.Add(ttl),
+	}, raw, nil
+}
+
+func InvitationFromPersistence(
+	hash string,
+	organizationID uuid.UUID,
+	email string,
+	role MemberRole,
+	invitedBy uuid.UUID,
+	createdAt, expiresAt time.Time,
+) *Invitation {
+	return &Invitation{
+		hash:           hash,
+		organizationID: organizationID,
+		email:          email,
+		role:           role,
+		invitedBy:      invitedBy,
+		createdAt:      createdAt,
+		expiresAt:      expiresAt,
+	}
+}
@@ -0,0 +1,150 @@
+// Package domain implements organizations (companies), which recruiters act on behalf of
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemberRole is the role of the user inside the organization
+type MemberRole string
+
+const (
+	// RoleOwner is the creator of the organization, it can't be invited
+	RoleOwner  MemberRole = "owner"
+	RoleAdmin  MemberRole = "admin"
+	RoleMember MemberRole = "member"
+)
+
+// CanInvite reports whether members with the role can invite other users
+func (r MemberRole) CanInvite() bool {
+	return r == RoleOwner || r == RoleAdmin
+}
+
+// ParseInvitedRole returns the role, which the invited user can get
+func ParseInvitedRole(role string) (MemberRole, error) {
+	switch MemberRole(role) {
+	case RoleAdmin, RoleMember:
+		return MemberRole(role), nil
+	default:
+		return "", fmt.Errorf("unsupported member role: %s", role)
+	}
+}
+
+type Member struct {
+	userID   uuid.UUID
+	role     MemberRole
+	joinedAt time.Time
+}
+
+func (m Member) UserID() uuid.UUID {
+	return m.userID
+}
+
+func (m Member) Role() MemberRole {
+	return m.role
+}
+
+func (m Member) JoinedAt() time.Time {
+	return m.joinedAt
+}
+
+func MemberFromPersistence(userID uuid.UUID, role MemberRole, joinedAt time.Time) Member {
+	return Member{
+		userID:   userID,
+		role:     role,
+		joinedAt: joinedAt,
+	}
+}
+
+// Organization is the aggregate of the company n' its members
+type Organization struct {
+	id        uuid.UUID
+	name      string
+	createdAt time.Time
+	members   []Member
+}
+
+func (o Organization) ID() uuid.UUID {
+	return o.id
+}
+
+func (o Organization) Name() string {
+	return o.name
+}
+
+func (o Organization) CreatedAt() time.Time {
+	return o.createdAt
+}
+
+func (o Organization) Members() []Member {
+	return slices.Clone(o.members)
+}
+
+// Member returns the membership of the user, if the user is a member
+func (o Organization) Member(userID uuid.UUID) (Member, bool) {
+	i := slices.IndexFunc(o.members, func(m Member) bool { return m.userID == userID })
+	if i < 0 {
+		return Member{}, false
+	}
+
+	return o.members[i], true
+}
+
+func (o *Organization) AddMember(userID uuid.UUID, role MemberRole) error {
+	if userID == uuid.Nil {
+		return errors.New("user cannot be empty")
+	}
+	if role == RoleOwner {
+		return errors.New("organization has only one owner")
+	}
+	if _, ok := o.Member(userID); ok {
+		return errors.New("user is already a member")
+	}
+
+	o.members = append(o.members, Member{
+		userID:   userID,
+		role:     role,
+		joinedAt: time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// NewOrganization creates the organization, the user becomes its owner
+func NewOrganization(name string, ownerID uuid.UUID) (*Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+
+	if ownerID == uuid.Nil {
+		return nil, errors.New("owner cannot be empty")
+	}
+
+	now := time.Now().UTC()
+	return &Organization{
+		id:        uuid.New(),
+		name:      name,
+		createdAt: now,
+		members: []Member{{
+			userID:   ownerID,
+			role:     RoleOwner,
+			joinedAt: now,
+		}},
+	}, nil
+}
+
+func OrganizationFromPersistence(id uuid.UUID, name string, createdAt time.Time, members []Member) *Organization {
+	return &Organization{
+		id:        id,
+		name:      name,
+		createdAt: createdAt,
+		members:   members,
+	}
+}
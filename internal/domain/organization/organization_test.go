@@ -0,0 +1,167 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNewOrganization(t *testing.T) {
+	ownerID := uuid.New()
+
+	org, err := NewOrganization("  Staffy  ", ownerID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if org.Name() != "Staffy" {
+		t.Fatalf("name: got %q, want Staffy", org.Name())
+	}
+
+	owner, ok := org.Member(ownerID)
+	if !ok || owner.Role() != RoleOwner {
+		t.Fatalf("creator: got %v, %v, want owner", owner.Role(), ok)
+	}
+
+	if _, err := NewOrganization(" ", ownerID); err == nil {
+		t.Fatal("organization without name is created")
+	}
+	if _, err := NewOrganization("Staffy", uuid.Nil); err == nil {
+		t.Fatal("organization without owner is created")
+	}
+}
+
+func TestOrganizationAddMember(t *testing.T) {
+	ownerID, memberID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		role    MemberRole
+		wantErr bool
+	}{
+		{name: "member", userID: uuid.New(), role: RoleMember},
+		{name: "admin", userID: uuid.New(), role: RoleAdmin},
+		{name: "second owner", userID: uuid.New(), role: RoleOwner, wantErr: true},
+		{name: "empty user", userID: uuid.Nil, role: RoleMember, wantErr: true},
+		{name: "owner again", userID: ownerID, role: RoleMember, wantErr: true},
+		{name: "member again", userID: memberID, role: RoleAdmin, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org, err := NewOrganization("Staffy", ownerID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := org.AddMember(memberID, RoleMember); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = org.AddMember(tt.userID, tt.role)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if len(org.Members()) != 2 {
+					t.Fatalf("members: got %d, want 2", len(org.Members()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			member, ok := org.Member(tt.userID)
+			if !ok || member.Role() != tt.role || member.JoinedAt().IsZero() {
+				t.Fatalf("got %v joined at %s, want %s", member.Role(), member.JoinedAt(), tt.role)
+			}
+		})
+	}
+}
+
+func TestMemberRoles(t *testing.T) {
+	tests := []struct {
+		role      string
+		want      MemberRole
+		wantErr   bool
+		canInvite bool
+	}{
+		{role: "admin", want: RoleAdmin, canInvite: true},
+		{role: "member", want: RoleMember},
+		{role: "owner", wantErr: true},
+		{role: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			got, err := ParseInvitedRole(tt.role)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %s, %v, want %s", got, err, tt.want)
+			}
+			if got.CanInvite() != tt.canInvite {
+				t.Fatalf("CanInvite: got %v, want %v", got.CanInvite(), tt.canInvite)
+			}
+		})
+	}
+
+	if !RoleOwner.CanInvite() {
+		t.Fatal("owner can't invite")
+	}
+}
+
+func TestNewInvitation(t *testing.T) {
+	orgID, inviterID := uuid.New(), uuid.New()
+
+	invitation, raw, err := NewInvitation(orgID, "new@example.com", RoleMember, inviterID, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw == "" || invitation.Hash() != HashInvitation(raw) {
+		t.Fatal("hash doesn't match the raw token")
+	}
+	if invitation.Hash() == raw {
+		t.Fatal("raw token is kept")
+	}
+	if invitation.IsExpired() {
+		t.Fatal("fresh invitation is expired")
+	}
+
+	tests := []struct {
+		name      string
+		orgID     uuid.UUID
+		email     string
+		role      MemberRole
+		inviterID uuid.UUID
+		ttl       time.Duration
+	}{
+		{name: "empty organization", orgID: uuid.Nil, email: "new@example.com", role: RoleMember, inviterID: inviterID, ttl: time.Hour},
+		{name: "empty email", orgID: orgID, email: "", role: RoleMember, inviterID: inviterID, ttl: time.Hour},
+		{name: "empty inviter", orgID: orgID, email: "new@example.com", role: RoleMember, inviterID: uuid.Nil, ttl: time.Hour},
+		{name: "owner", orgID: orgID, email: "new@example.com", role: RoleOwner, inviterID: inviterID, ttl: time.Hour},
+		{name: "zero ttl", orgID: orgID, email: "new@example.com", role: RoleMember, inviterID: inviterID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := NewInvitation(tt.orgID, tt.email, tt.role, tt.inviterID, tt.ttl); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestInvitationIsExpired(t *testing.T) {
+	now := time.Now().UTC()
+	expired := InvitationFromPersistence("hash", uuid.New(), "new@example.com", RoleMember, uuid.New(), now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	if !expired.IsExpired() {
+		t.Fatal("invitation past its ttl isn't expired")
+	}
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type OrganizationRepository interface {
+	// Save creates the organization or updates it n' its members
+	Save(ctx context.Context, organization *Organization) error
+	// GetByID returns the organization with all its members
+	GetByID(ctx context.Context, id uuid.UUID) (*Organization, error)
+}
+
+type InvitationRepository interface {
+	Save(ctx context.Context, invitation *Invitation) error
+	// Consume returns the invitation n' deletes it, so it can't be accepted twice
+	Consume(ctx context.Context, hash string) (*Invitation, error)
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const ceremonyIDSize = 32
+
+// CeremonyKind is what the ceremony ends with. A registration ceremony can't finish a login.
+type CeremonyKind string
+
+const (
+	CeremonyRegistration CeremonyKind = "registration"
+	// CeremonyLogin isn't bound to a user, the passkey tells who signs in
+	CeremonyLogin CeremonyKind = "login"
+)
+
+// Ceremony keeps the challenge of the started registration or login until it's finished.
+// Session is opaque for the domain, it's the state of the webauthn library.
+type Ceremony struct {
+	id        string
+	kind      CeremonyKind
+	userID    uuid.UUID
+	session   []byte
+	expiresAt time.Time
+}
+
+func (c Ceremony) ID() string {
+	return c.id
+}
+
+func (c Ceremony) Kind() CeremonyKind {
+	return c.kind
+}
+
+func (c Ceremony) UserID() uuid.UUID {
+	return c.userID
+}
+
+func (c Ceremony) Session() []byte {
+	return c.session
+}
+
+func (c Ceremony) ExpiresAt() time.Time {
+	return c.expiresAt
+}
+
+func (c Ceremony) IsExpired() bool {
+	return !time.Now().UTC().Before(c.expiresAt)
+}
+
+func NewCeremony(kind CeremonyKind, userID uuid.UUID, session []byte, ttl time.Duration) (*Ceremony, error) {
+	if kind == "" || len(session) == 0 {
+		return nil, errors.New("kind n' session cannot be empty")
+	}
+
+	if kind == CeremonyRegistration && userID == uuid.Nil {
+		return nil, errors.New("registration must be bound to the user")
+	}
+
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+
+	buf := make([]byte, ceremonyIDSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate ceremony id: %w", err)
+	}
+
+	return &Ceremony{
+		id:        base64.RawURLEncoding.EncodeToString(buf),
+		kind:      kind,
+		userID:    userID,
+		session:   session,
+		expiresAt: time.Now().UTC().Add(ttl),
+	}, nil
+}
+
+func CeremonyFromPersistence(id string, kind CeremonyKind, userID uuid.UUID, session []byte, expiresAt time.Time) *Ceremony {
+	return &Ceremony{
+		id:        id,
+		kind:      kind,
+		userID:    userID,
+		session:   session,
+		expiresAt: expiresAt,
+	}
+}
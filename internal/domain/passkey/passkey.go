@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Passkey is a WebAuthn credential of the user. Only the public key is kept, the private one never leaves the authenticator.
+type Passkey struct {
+	id              []byte
+	userID          uuid.UUID
+	publicKey       []byte
+	attestationType string
+	aaguid          []byte
+	signCount       uint32
+	transports      []string
+	// backupEligible can't change after the registration, backupState tells whether the passkey is synced now
+	backupEligible bool
+	backupState    bool
+	createdAt      time.Time
+	lastUsedAt     time.Time
+}
+
+func (p Passkey) ID() []byte {
+	return p.id
+}
+
+func (p Passkey) UserID() uuid.UUID {
+	return p.userID
+}
+
+func (p Passkey) PublicKey() []byte {
+	return p.publicKey
+}
+
+func (p Passkey) AttestationType() string {
+	return p.attestationType
+}
+
+func (p Passkey) AAGUID() []byte {
+	return p.aaguid
+}
+
+func (p Passkey) SignCount() uint32 {
+	return p.signCount
+}
+
+func (p Passkey) Transports() []string {
+	return p.transports
+}
+
+func (p Passkey) IsBackupEligible() bool {
+	return p.backupEligible
+}
+
+func (p Passkey) IsBackedUp() bool {
+	return p.backupState
+}
+
+func (p Passkey) CreatedAt() time.Time {
+	return p.createdAt
+}
+
+func (p Passkey) LastUsedAt() time.Time {
+	return p.lastUsedAt
+}
+
+// Use records the login. Authenticators, which count signatures, must return a greater count every time,
+// otherwise the passkey may have been cloned.
+func (p *Passkey) Use(signCount uint32, backupState bool) error {
+	if (signCount != 0 || p.signCount != 0) && signCount <= p.signCount {
+		return errors.New("sign count hasn't grown, the authenticator may be cloned")
+	}
+
+	p.signCount = signCount
+	p.backupState = backupState
+	p.lastUsedAt = time.Now().UTC()
+	return nil
+}
+
+func NewPasskey(id []byte, userID uuid.UUID, publicKey []byte, attestationType string, aaguid []byte,
+	signCount uint32, transports []string, backupEligible, backupState bool) (*Passkey, error) {
+	if len(id) == 0 || userID == uuid.Nil || len(publicKey) == 0 {
+		return nil, errors.New("id, user id n' public key cannot be empty")
+	}
+
+	now := time.Now().UTC()
+	return &Passkey{
+		id:              id,
+		userID:          userID,
+		publicKey:       publicKey,
+		attestationType: attestationType,
+		aaguid:          aaguid,
+		signCount:       signCount,
+		transports:      transports,
+		backupEligible:  backupEligible,
+		backupState:     backupState,
+		createdAt:       now,
+		lastUsedAt:      now,
+	}, nil
+}
+
+func PasskeyFromPersistence(id []byte, userID uuid.UUID, publicKey []byte, attestationType string, aaguid []byte,
+	signCount uint32, transports []string, backupEligible, backupState bool, createdAt, lastUsedAt time.Time) *Passkey {
+	return &Passkey{
+		id:              id,
+		userID:          userID,
+		publicKey:       publicKey,
+		attestationType: attestationType,
+		aaguid:          aaguid,
+		signCount:       signCount,
+		transports:      transports,
+		backupEligible:  backupEligible,
+		backupState:     backupState,
+		createdAt:       createdAt,
+		lastUsedAt:      lastUsedAt,
+	}
+}
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNewPasskey(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        []byte
+		userID    uuid.UUID
+		publicKey []byte
+		wantErr   bool
+	}{
+		{name: "valid", id: []byte("credential"), userID: uuid.New(), publicKey: []byte("key")},
+		{name: "empty id", id: nil, userID: uuid.New(), publicKey: []byte("key"), wantErr: true},
+		{name: "nil user", id: []byte("credential"), userID: uuid.Nil, publicKey: []byte("key"), wantErr: true},
+		{name: "empty public key", id: []byte("credential"), userID: uuid.New(), publicKey: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPasskey(tt.id, tt.userID, tt.publicKey, "none", nil, 0, nil, false, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPasskeyUse(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  uint32
+		used    uint32
+		wantErr bool
+	}{
+		{name: "count grows", stored: 5, used: 6},
+		{name: "count jumps", stored: 5, used: 100},
+		{name: "authenticator without a counter", stored: 0, used: 0},
+		{name: "authenticator starts counting", stored: 0, used: 1},
+		{name: "same count", stored: 5, used: 5, wantErr: true},
+		{name: "count goes backwards", stored: 5, used: 4, wantErr: true},
+		{name: "count is reset", stored: 5, used: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lastUsedAt := time.Now().UTC().Add(-time.Hour)
+			passkey := PasskeyFromPersistence([]byte("credential"), uuid.New(), []byte("key"), "none", nil,
+				tt.stored, nil, true, false, lastUsedAt, lastUsedAt)
+
+			err := passkey.Use(tt.used, true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error: %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if passkey.SignCount() != tt.stored || passkey.IsBackedUp() || !passkey.LastUsedAt().Equal(lastUsedAt) {
+					t.Fatal("rejected login has changed the passkey")
+				}
+				return
+			}
+
+			if passkey.SignCount() != tt.used || !passkey.IsBackedUp() || !passkey.LastUsedAt().After(lastUsedAt) {
+				t.Fatal("login isn't recorded")
+			}
+		})
+	}
+}
+
+func TestNewCeremony(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    CeremonyKind
+		userID  uuid.UUID
+		session []byte
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "registration", kind: CeremonyRegistration, userID: uuid.New(), session: []byte("{}"), ttl: time.Minute},
+		{name: "login isn't bound to a user", kind: CeremonyLogin, userID: uuid.Nil, session: []byte("{}"), ttl: time.Minute},
+		{name: "registration without a user", kind: CeremonyRegistration, userID: uuid.Nil, session: []byte("{}"), ttl: time.Minute, wantErr: true},
+		{name: "empty kind", kind: "", userID: uuid.New(), session: []byte("{}"), ttl: time.Minute, wantErr: true},
+		{name: "empty session", kind: CeremonyLogin, session: nil, ttl: time.Minute, wantErr: true},
+		{name: "zero ttl", kind: CeremonyLogin, session: []byte("{}"), ttl: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ceremony, err := NewCeremony(tt.kind, tt.userID, tt.session, tt.ttl)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ceremony.ID() == "" || ceremony.IsExpired() {
+				t.Fatal("new ceremony has no id or is expired")
+			}
+		})
+	}
+}
+
+func TestCeremonyIsExpired(t *testing.T) {
+	expired := CeremonyFromPersistence("id", CeremonyLogin, uuid.Nil, []byte("{}"), time.Now().UTC().Add(-time.Second))
+	if !expired.IsExpired() {
+		t.Fatal("ceremony isn't expired")
+	}
+}
@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type PasskeyRepository interface {
+	// Save creates the passkey, the owner n' the key of a known one are never changed
+	Save(ctx context.Context, passkey *Passkey) error
+	// UpdateSignCount records the login only if the stored sign count is less, so two logins with the same
+	// signature can't both pass. It returns consts.ErrInvalidPasskey otherwise.
+	UpdateSignCount(ctx context.Context, passkey *Passkey) error
+	GetByID(ctx context.Context, id []byte) (*Passkey, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*Passkey, error)
+}
+
+type CeremonyRepository interface {
+	Save(ctx context.Context, ceremony *Ceremony) error
+	// Consume returns the ceremony n' deletes it, so a challenge can't be answered twice
+	Consume(ctx context.Context, kind CeremonyKind, id string) (*Ceremony, error)
+}
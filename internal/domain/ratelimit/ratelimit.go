@@ -0,0 +1,48 @@
+// Package domain implements limits of requests to rpcs
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Dimension is what requests are counted for
+type Dimension string
+
+const (
+	// DimensionMethod counts all calls of the rpc together
+	DimensionMethod Dimension = "method"
+	DimensionIP     Dimension = "ip"
+	// DimensionEmail counts calls, which target the same email
+	DimensionEmail Dimension = "email"
+)
+
+// Limit allows Requests within the sliding Window
+type Limit struct {
+	Requests int64
+	Window   time.Duration
+}
+
+// Enabled is false for zero limits, they turn the dimension off
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+// Counter is one limit, which the request is charged to
+type Counter struct {
+	Key   string
+	Limit Limit
+}
+
+// Decision tells whether the request is allowed. Exceeded is the index of the counter, which has to wait the longest
+type Decision struct {
+	Allowed    bool
+	Exceeded   int
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow counts the request in every counter only if it fits all of them, a rejected request isn't counted anywhere.
+	// Keys of one request have to share the hash tag, e.g. {/sso.SSO/Login}, for Redis Cluster
+	Allow(ctx context.Context, counters []Counter) (Decision, error)
+}
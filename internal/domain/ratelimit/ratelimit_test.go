@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitEnabled(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		want  bool
+	}{
+		{name: "set", limit: Limit{Requests: 10, Window: time.Minute}, want: true},
+		{name: "zero", limit: Limit{}, want: false},
+		{name: "no requests", limit: Limit{Requests: 0, Window: time.Minute}, want: false},
+		{name: "no window", limit: Limit{Requests: 10, Window: 0}, want: false},
+		{name: "negative", limit: Limit{Requests: -1, Window: time.Minute}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limit.Enabled(); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type RoleRepository interface {
+	// Save creates the role or replaces the existing one
+	Save(ctx context.Context, role *Role) error
+	// GetByNames returns existing roles with the names, unknown names are skipped
+	GetByNames(ctx context.Context, names []string) ([]*Role, error)
+}
+
+type RoleChangeRepository interface {
+	// Save creates the change or replaces the existing one
+	Save(ctx context.Context, change *RoleChange) error
+	GetByID(ctx context.Context, id uuid.UUID) (*RoleChange, error)
+	// GetPending returns the change of the user, which waits for an approval
+	GetPending(ctx context.Context, userID uuid.UUID) (*RoleChange, error)
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// PermissionManageRoles allows to assign roles n' to review role changes
+const PermissionManageRoles = "roles.manage"
+
+// Role is a named set of permissions. Permissions are opaque for the sso, services decide what they allow.
+type Role struct {
+	name        string
+	description string
+	permissions []string
+}
+
+func (r Role) Name() string {
+	return r.name
+}
+
+func (r Role) Description() string {
+	return r.description
+}
+
+func (r Role) Permissions() []string {
+	return slices.Clone(r.permissions)
+}
+
+func (r Role) HasPermission(permission string) bool {
+	return slices.Contains(r.permissions, permission)
+}
+
+func NewRole(name, description string, permissions []string) (*Role, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+
+	for _, permission := range permissions {
+		if strings.TrimSpace(permission) == "" || strings.ContainsAny(permission, " \t") {
+			return nil, errors.New("permission cannot be empty or contain spaces")
+		}
+	}
+
+	return &Role{
+		name:        name,
+		description: strings.TrimSpace(description),
+		permissions: slices.Compact(slices.Sorted(slices.Values(permissions))),
+	}, nil
+}
+
+func RoleFromPersistence(name, description string, permissions []string) *Role {
+	return &Role{
+		name:        name,
+		description: description,
+		permissions: permissions,
+	}
+}
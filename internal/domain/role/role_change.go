@@ -0,0 +1,136 @@
+// Package domain implements roles of users n' the audit trail of their changes
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ChangeStatus string
+
+const (
+	// ChangePending waits for an admin, the role of the user isn't changed yet
+	ChangePending  ChangeStatus = "pending"
+	ChangeApplied  ChangeStatus = "applied"
+	ChangeRejected ChangeStatus = "rejected"
+)
+
+// RoleChange is a record of the audit trail: who has asked to switch the role of the user, when,
+// n' who has approved or rejected it
+type RoleChange struct {
+	id          uuid.UUID
+	userID      uuid.UUID
+	actorID     uuid.UUID
+	toRecruiter bool
+	status      ChangeStatus
+	reviewerID  uuid.UUID
+	createdAt   time.Time
+	decidedAt   time.Time
+}
+
+func (c RoleChange) ID() uuid.UUID {
+	return c.id
+}
+
+func (c RoleChange) UserID() uuid.UUID {
+	return c.userID
+}
+
+func (c RoleChange) ActorID() uuid.UUID {
+	return c.actorID
+}
+
+func (c RoleChange) ToRecruiter() bool {
+	return c.toRecruiter
+}
+
+func (c RoleChange) Status() ChangeStatus {
+	return c.status
+}
+
+// ReviewerID is uuid.Nil, if the change didn't need an approval
+func (c RoleChange) ReviewerID() uuid.UUID {
+	return c.reviewerID
+}
+
+func (c RoleChange) CreatedAt() time.Time {
+	return c.createdAt
+}
+
+// DecidedAt is zero, while the change is pending
+func (c RoleChange) DecidedAt() time.Time {
+	return c.decidedAt
+}
+
+func (c RoleChange) IsPending() bool {
+	return c.status == ChangePending
+}
+
+func (c *RoleChange) Approve(reviewerID uuid.UUID) error {
+	return c.decide(reviewerID, ChangeApplied)
+}
+
+func (c *RoleChange) Reject(reviewerID uuid.UUID) error {
+	return c.decide(reviewerID, ChangeRejected)
+}
+
+func (c *RoleChange) decide(reviewerID uuid.UUID, status ChangeStatus) error {
+	if !c.IsPending() {
+		return errors.New("change has already been decided")
+	}
+	if reviewerID == uuid.Nil {
+		return errors.New("reviewer cannot be empty")
+	}
+
+	c.status = status
+	c.reviewerID = reviewerID
+	c.decidedAt = time.Now().UTC()
+
+	return nil
+}
+
+// NewRoleChange records the change, which the actor has made. If it needs an approval, it stays pending.
+func NewRoleChange(userID, actorID uuid.UUID, toRecruiter, needsApproval bool) (*RoleChange, error) {
+	if userID == uuid.Nil || actorID == uuid.Nil {
+		return nil, errors.New("user n' actor cannot be empty")
+	}
+
+	now := time.Now().UTC()
+	change := &RoleChange{
+		id:          uuid.New(),
+		userID:      userID,
+		actorID:     actorID,
+		toRecruiter: toRecruiter,
+		status:      ChangeApplied,
+		createdAt:   now,
+		decidedAt:   now,
+	}
+
+	if needsApproval {
+		change.status = ChangePending
+		change.decidedAt = time.Time{}
+	}
+
+	return change, nil
+}
+
+func RoleChangeFromPersistence(
+	id, userID, actorID uuid.UUID,
+	toRecruiter bool,
+	status ChangeStatus,
+	reviewerID uuid.UUID,
+	createdAt, decidedAt time.Time,
+) *RoleChange {
+	return &RoleChange{
+		id:          id,
+		userID:      userID,
+		actorID:     actorID,
+		toRecruiter: toRecruiter,
+		status:      status,
+		reviewerID:  reviewerID,
+		createdAt:   createdAt,
+		decidedAt:   decidedAt,
+	}
+}
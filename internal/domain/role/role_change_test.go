@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewRoleChange(t *testing.T) {
+	userID, actorID := uuid.New(), uuid.New()
+
+	applied, err := NewRoleChange(userID, actorID, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied.Status() != ChangeApplied || applied.DecidedAt().IsZero() {
+		t.Fatalf("change without approval: got %s decided at %s, want applied", applied.Status(), applied.DecidedAt())
+	}
+	if applied.ReviewerID() != uuid.Nil {
+		t.Fatal("change without approval has a reviewer")
+	}
+
+	pending, err := NewRoleChange(userID, actorID, true, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !pending.IsPending() || !pending.DecidedAt().IsZero() {
+		t.Fatalf("change with approval: got %s decided at %s, want pending", pending.Status(), pending.DecidedAt())
+	}
+
+	if _, err := NewRoleChange(uuid.Nil, actorID, true, false); err == nil {
+		t.Fatal("change without user is created")
+	}
+	if _, err := NewRoleChange(userID, uuid.Nil, true, false); err == nil {
+		t.Fatal("change without actor is created")
+	}
+}
+
+func TestRoleChangeDecide(t *testing.T) {
+	tests := []struct {
+		name       string
+		decide     func(c *RoleChange, reviewerID uuid.UUID) error
+		wantStatus ChangeStatus
+	}{
+		{name: "approve", decide: (*RoleChange).Approve, wantStatus: ChangeApplied},
+		{name: "reject", decide: (*RoleChange).Reject, wantStatus: ChangeRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, err := NewRoleChange(uuid.New(), uuid.New(), true, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := tt.decide(change, uuid.Nil); err == nil {
+				t.Fatal("change is decided without reviewer")
+			}
+
+			reviewerID := uuid.New()
+			if err := tt.decide(change, reviewerID); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if change.Status() != tt.wantStatus || change.ReviewerID() != reviewerID || change.DecidedAt().IsZero() {
+				t.Fatalf("got %s by %s at %s, want %s by %s", change.Status(), change.ReviewerID(), change.DecidedAt(), tt.wantStatus, reviewerID)
+			}
+
+			// The audit trail keeps the first decision
+			if err := change.Approve(uuid.New()); err == nil {
+				t.Fatal("decided change is approved again")
+			}
+			if err := change.Reject(uuid.New()); err == nil {
+				t.Fatal("decided change is rejected again")
+			}
+			if change.Status() != tt.wantStatus || change.ReviewerID() != reviewerID {
+				t.Fatal("second decision has changed the record")
+			}
+		})
+	}
+}
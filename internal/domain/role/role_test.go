@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewRole(t *testing.T) {
+	tests := []struct {
+		name        string
+		roleName    string
+		permissions []string
+		wantName    string
+		want        []string
+		wantErr     bool
+	}{
+		{name: "sorted n' deduplicated", roleName: " admin ", permissions: []string{"users.read", "roles.manage", "users.read"}, wantName: "admin", want: []string{"roles.manage", "users.read"}},
+		{name: "without permissions", roleName: "guest", wantName: "guest"},
+		{name: "empty name", roleName: "  ", wantErr: true},
+		{name: "empty permission", roleName: "admin", permissions: []string{"users.read", " "}, wantErr: true},
+		{name: "permission with space", roleName: "admin", permissions: []string{"users read"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := NewRole(tt.roleName, "description", tt.permissions)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if role.Name() != tt.wantName {
+				t.Fatalf("name: got %q, want %q", role.Name(), tt.wantName)
+			}
+			if got := role.Permissions(); !slices.Equal(got, tt.want) {
+				t.Fatalf("permissions: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	role, err := NewRole("admin", "", []string{PermissionManageRoles, "users.read"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !role.HasPermission(PermissionManageRoles) {
+		t.Fatal("granted permission is missing")
+	}
+	if role.HasPermission("users.delete") {
+		t.Fatal("unknown permission is granted")
+	}
+
+	// Permissions returns a copy, the role can't be changed through it
+	permissions := role.Permissions()
+	permissions[0] = "users.delete"
+	if role.HasPermission("users.delete") {
+		t.Fatal("role is changed through its permissions")
+	}
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const actionTokenSize = 32
+
+// Purpose is the action, which the token confirms. A token of one purpose can't be used for another.
+type Purpose string
+
+const (
+	PurposePasswordReset     Purpose = "password_reset"
+	PurposeEmailVerification Purpose = "email_verification"
+	// PurposeEmailChange tokens are bound to the new email, the link is sent to
+	PurposeEmailChange Purpose = "email_change"
+	// PurposeMFAChallenge tokens are returned by the login instead of access tokens, they aren't mailed
+	PurposeMFAChallenge Purpose = "mfa_challenge"
+	PurposeMagicLink    Purpose = "magic_link"
+)
+
+// ActionToken is a single-use token, which is sent to the user by email to confirm an action.
+// It's bound to the email, it was sent to. Only hash of the token is kept.
+type ActionToken struct {
+	hash      string
+	purpose   Purpose
+	userID    uuid.UUID
+	email     string
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+func (t ActionToken) Hash() string {
+	return t.hash
+}
+
+func (t ActionToken) Purpose() Purpose {
+	return t.purpose
+}
+
+func (t ActionToken) UserID() uuid.UUID {
+	return t.userID
+}
+
+func (t ActionToken) Email() string {
+	return t.email
+}
+
+func (t ActionToken) IssuedAt() time.Time {
+	return t.issuedAt
+}
+
+func (t ActionToken) ExpiresAt() time.Time {
+	return t.expiresAt
+}
+
+func (t ActionToken) IsExpired() bool {
+	return !time.Now().UTC().Before(t.expiresAt)
+}
+
+func HashActionToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewActionToken returns the token n' its raw value, which is sent to the user
+func NewActionToken(purpose Purpose, userID uuid.UUID, email string, ttl time.Duration) (*ActionToken, string, error) {
+	if purpose == "" || userID == uuid.Nil || email == "" {
+		return nil, "", errors.New("purpose, user id n' email cannot be empty")
+	}
+
+	if ttl <= 0 {
+		return nil, "", errors.New("ttl must be positive")
+	}
+
+	buf := make([]byte, actionTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate action token: %w", err)
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	return &ActionToken{
+		hash:      HashActionToken(raw),
+		purpose:   purpose,
+		userID:    userID,
+		email:     email,
+		issuedAt:  now,
+		expiresAt: now.Add(ttl),
+	}, raw, nil
+}
+
+func ActionTokenFromPersistence(hash string, purpose Purpose, userID uuid.UUID, email string, issuedAt, expiresAt time.Time) *ActionToken {
+	return &ActionToken{
+		hash:      hash,
+		purpose:   purpose,
+		userID:    userID,
+		email:     email,
+		issuedAt:  issuedAt,
+		expiresAt: expiresAt,
+	}
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefreshTokenRepository interface {
+	Save(ctx context.Context, token *RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// MarkUsed returns false if the token has already been used
+	MarkUsed(ctx context.Context, token *RefreshToken) (bool, error)
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	IsFamilyRevoked(ctx context.Context, familyID uuid.UUID) (bool, error)
+}
+
+// RevocationList keeps tokens, which were revoked before their expiration
+type RevocationList interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeUser invalidates all tokens of the user, which were issued before the given time
+	RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time) error
+	// UserRevokedBefore returns zero time if tokens of the user have never been revoked
+	UserRevokedBefore(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+type ActionTokenRepository interface {
+	Save(ctx context.Context, token *ActionToken) error
+	// Consume returns the token n' deletes it, so it can't be used twice
+	Consume(ctx context.Context, purpose Purpose, hash string) (*ActionToken, error)
+}
@@ -0,0 +1,139 @@
+// Package domain implements refresh token's domain structure
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const refreshTokenSize = 32
+
+// RefreshToken is an opaque, server-side stored token. Only hash of the token is kept,
+// the raw value is given to the client once. Tokens issued by rotating each other
+// share the same family n' the time, when the user has logged in.
+// Tokens issued to oauth clients keep the client n' its scopes.
+type RefreshToken struct {
+	hash      string
+	userID    uuid.UUID
+	familyID  uuid.UUID
+	clientID  string
+	scopes    []string
+	authTime  time.Time
+	issuedAt  time.Time
+	expiresAt time.Time
+	// orgID is the active organization of the session, it's uuid.Nil if none is active
+	orgID uuid.UUID
+}
+
+func (t RefreshToken) Hash() string {
+	return t.hash
+}
+
+func (t RefreshToken) UserID() uuid.UUID {
+	return t.userID
+}
+
+func (t RefreshToken) FamilyID() uuid.UUID {
+	return t.familyID
+}
+
+func (t RefreshToken) ClientID() string {
+	return t.clientID
+}
+
+func (t RefreshToken) Scopes() []string {
+	return t.scopes
+}
+
+// AuthTime is the time, when the user has entered credentials. It's zero for tokens issued before it was kept.
+func (t RefreshToken) AuthTime() time.Time {
+	return t.authTime
+}
+
+func (t RefreshToken) OrgID() uuid.UUID {
+	return t.orgID
+}
+
+func (t RefreshToken) IssuedAt() time.Time {
+	return t.issuedAt
+}
+
+func (t RefreshToken) ExpiresAt() time.Time {
+	return t.expiresAt
+}
+
+func (t RefreshToken) IsExpired() bool {
+	return !time.Now().UTC().Before(t.expiresAt)
+}
+
+// HashRefreshToken returns the value under which raw token is stored
+func HashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRefreshToken returns the token n' its raw value, which must be given to the client
+func NewRefreshToken(
+	userID, familyID uuid.UUID,
+	clientID string,
+	scopes []string,
+	authTime time.Time,
+	orgID uuid.UUID,
+	ttl time.Duration,
+) (*RefreshToken, string, error) {
+	if userID == uuid.Nil || familyID == uuid.Nil {
+		return nil, "", errors.New("user id and family id cannot be empty")
+	}
+
+	if ttl <= 0 {
+		return nil, "", errors.New("ttl must be positive")
+	}
+
+	buf := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	return &RefreshToken{
+		hash:      HashRefreshToken(raw),
+		userID:    userID,
+		familyID:  familyID,
+		clientID:  clientID,
+		scopes:    scopes,
+		authTime:  authTime,
+		orgID:     orgID,
+		issuedAt:  now,
+		expiresAt: now.Add(ttl),
+	}, raw, nil
+}
+
+func FromPersistence(
+	hash string,
+	userID, familyID uuid.UUID,
+	clientID string,
+	scopes []string,
+	authTime time.Time,
+	orgID uuid.UUID,
+	issuedAt, expiresAt time.Time,
+) *RefreshToken {
+	return &RefreshToken{
+		hash:      hash,
+		userID:    userID,
+		familyID:  familyID,
+		clientID:  clientID,
+		scopes:    scopes,
+		authTime:  authTime,
+		orgID:     orgID,
+		issuedAt:  issuedAt,
+		expiresAt: expiresAt,
+	}
+}
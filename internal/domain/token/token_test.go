@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNewRefreshToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uuid.UUID
+		familyID uuid.UUID
+		ttl      time.Duration
+		wantErr  bool
+	}{
+		{name: "valid", userID: uuid.New(), familyID: uuid.New(), ttl: time.Hour},
+		{name: "nil user", userID: uuid.Nil, familyID: uuid.New(), ttl: time.Hour, wantErr: true},
+		{name: "nil family", userID: uuid.New(), familyID: uuid.Nil, ttl: time.Hour, wantErr: true},
+		{name: "zero ttl", userID: uuid.New(), familyID: uuid.New(), ttl: 0, wantErr: true},
+		{name: "negative ttl", userID: uuid.New(), familyID: uuid.New(), ttl: -time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, raw, err := NewRefreshToken(tt.userID, tt.familyID, "", nil, time.Time{}, uuid.Nil, tt.ttl)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if raw == "" {
+				t.Fatal("raw token is empty")
+			}
+			if token.Hash() != HashRefreshToken(raw) {
+				t.Fatal("hash doesn't match the raw token")
+			}
+			if token.Hash() == raw {
+				t.Fatal("raw token is stored as is")
+			}
+			if token.IsExpired() {
+				t.Fatal("new token is expired")
+			}
+			if token.UserID() != tt.userID || token.FamilyID() != tt.familyID {
+				t.Fatal("ids aren't kept")
+			}
+		})
+	}
+}
+
+func TestNewRefreshTokenIsUnique(t *testing.T) {
+	seen := make(map[string]struct{})
+	for range 100 {
+		_, raw, err := NewRefreshToken(uuid.New(), uuid.New(), "", nil, time.Time{}, uuid.Nil, time.Hour)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := seen[raw]; ok {
+			t.Fatal("refresh token is repeated")
+		}
+		seen[raw] = struct{}{}
+	}
+}
+
+func TestRefreshTokenIsExpired(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      bool
+	}{
+		{name: "in the future", expiresAt: now.Add(time.Minute), want: false},
+		{name: "in the past", expiresAt: now.Add(-time.Minute), want: true},
+		{name: "zero", expiresAt: time.Time{}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := FromPersistence("hash", uuid.New(), uuid.New(), "", nil, time.Time{}, uuid.Nil, now, tt.expiresAt)
+			if got := token.IsExpired(); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	if HashRefreshToken("a") == HashRefreshToken("b") {
+		t.Fatal("different tokens have the same hash")
+	}
+	if HashRefreshToken("a") != HashRefreshToken("a") {
+		t.Fatal("hash isn't deterministic")
+	}
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "context"
+
+// PasswordHasher hashes passwords into PHC strings, e.g. $argon2id$v=19$m=65536,t=3,p=2$salt$key.
+// Hash n' Verify may wait for a free worker, they fail with consts.ErrOverloaded, if there's none in time
+type PasswordHasher interface {
+	Hash(ctx context.Context, password string) (string, error)
+	// Verify checks the password against a hash of any supported algorithm
+	Verify(ctx context.Context, password, hash string) (bool, error)
+	// NeedsRehash is true for hashes of an outdated algorithm or parameters
+	NeedsRehash(hash string) bool
+	// DummyHash is a hash of a random password, verifying it costs as much as verifying a real one
+	DummyHash() string
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// personalMinLen is the shortest name, which the password mustn't contain, shorter ones match too often
+const personalMinLen = 3
+
+// PasswordPolicy is what passwords of users must look like
+type PasswordPolicy struct {
+	// MinLength is in characters
+	MinLength int
+	// MaxLength is in bytes, bcrypt ignores everything after 72
+	MaxLength int
+	// MinCharClasses is how many of lowercase, uppercase, digits n' symbols are required
+	MinCharClasses int
+}
+
+// BreachedPasswords are passwords, which have leaked, attackers try them first
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
+// Check returns descriptions of all broken rules, so the user can fix them at once.
+// The password mustn't contain the email or the name of the user
+func (p PasswordPolicy) Check(password, email, name, surname string) []string {
+	var violations []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	if len(password) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", p.MaxLength))
+	}
+
+	if classes := charClasses(password); classes < p.MinCharClasses {
+		violations = append(violations, fmt.Sprintf(
+			"must contain at least %d of lowercase letters, uppercase letters, digits n' symbols", p.MinCharClasses,
+		))
+	}
+
+	localPart, _, _ := strings.Cut(email, "@")
+	lowered := strings.ToLower(password)
+	for _, personal := range []string{localPart, name, surname} {
+		personal = strings.ToLower(strings.TrimSpace(personal))
+		if utf8.RuneCountInString(personal) >= personalMinLen && strings.Contains(lowered, personal) {
+			violations = append(violations, "must not contain the email or the name")
+			break
+		}
+	}
+
+	return violations
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+
+	return classes
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, MaxLength: 64, MinCharClasses: 3}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "strong", password: "Tr0ub4dor&3x"},
+		{name: "short", password: "Ab1!", want: []string{"must be at least 10 characters long"}},
+		{name: "long", password: "Ab1" + strings.Repeat("a", 62), want: []string{"must be at most 64 bytes long"}},
+		{
+			name:     "few classes",
+			password: "onlylowercase",
+			want:     []string{"must contain at least 3 of lowercase letters, uppercase letters, digits n' symbols"},
+		},
+		{name: "multibyte length is in characters", password: "Пароль-1234"},
+		{name: "email", password: "Jdoe-2024-pass", want: []string{"must not contain the email or the name"}},
+		{name: "surname", password: "SMITHS-house-1", want: []string{"must not contain the email or the name"}},
+		{
+			name:     "everything",
+			password: "john",
+			want: []string{
+				"must be at least 10 characters long",
+				"must contain at least 3 of lowercase letters, uppercase letters, digits n' symbols",
+				"must not contain the email or the name",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Check(tt.password, "jdoe@example.com", "John", "Smith")
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyIgnoresShortNames(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, MaxLength: 64, MinCharClasses: 3}
+
+	// "Al" n' "Li" are shorter than personalMinLen, they'd match too many passwords
+	if got := policy.Check("Always-Linked-42", "al@example.com", "Al", "Li"); len(got) != 0 {
+		t.Fatalf("got %q, want no violations", got)
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 type UserRepository interface {
 	Save(context.Context, *User) (uuid.UUID, error)
+	// Update fails with consts.ErrVersionConflict, if the user has been updated since it was read
+	Update(context.Context, *User) error
 	Delete(context.Context, uuid.UUID) error
 	GetByID(context.Context, uuid.UUID) (*User, error)
 	GetByEmail(context.Context, string) (*User, error)
@@ -2,29 +2,43 @@
 package domain
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+)
+
+// Every user is either an applicant or a recruiter, other roles are assigned on top of it
+const (
+	RoleApplicant = "applicant"
+	RoleRecruiter = "recruiter"
 )
 
 type User struct {
-	id          uuid.UUID
-	email       Email
-	password    string
-	name        string
-	surname     string
-	isRecruiter bool
+	id       uuid.UUID
+	email    Email
+	password string
+	name     string
+	surname  string
+	// roles are names of roles, permissions are resolved from them
+	roles []string
+	// emailVerified is set when the user has proven to own the email
+	emailVerified bool
+	// version is bumped on every write, so concurrent writes don't overwrite each other
+	version int64
 }
 
-func (u *User) CheckThePassword(password string) bool {
-	if err := bcrypt.CompareHashAndPassword([]byte(u.password), []byte(password)); err != nil {
-		return false
-	}
+func (u *User) CheckThePassword(ctx context.Context, password string, hasher PasswordHasher) (bool, error) {
+	return hasher.Verify(ctx, password, u.password)
+}
 
-	return true
+// PasswordNeedsRehash is true, if the hash was made with an outdated algorithm or parameters.
+// It's upgraded by ChangePassword with the same password right after it has been checked
+func (u *User) PasswordNeedsRehash(hasher PasswordHasher) bool {
+	return hasher.NeedsRehash(u.password)
 }
 
 func (u User) Password() string {
@@ -47,58 +61,194 @@ func (u User) Surname() string {
 	return u.surname
 }
 
+// IsRecruiter is kept for clients, which don't know about roles
 func (u User) IsRecruiter() bool {
-	return u.isRecruiter
+	return u.HasRole(RoleRecruiter)
+}
+
+func (u User) Roles() []string {
+	return slices.Clone(u.roles)
+}
+
+func (u User) HasRole(role string) bool {
+	return slices.Contains(u.roles, role)
+}
+
+func (u *User) AssignRole(role string) error {
+	role = strings.TrimSpace(role)
+	if role == "" {
+		return errors.New("role cannot be empty")
+	}
+	if role == RoleApplicant || role == RoleRecruiter {
+		return errors.New("role can only be switched")
+	}
+	if u.HasRole(role) {
+		return errors.New("user already has the role")
+	}
+	u.roles = append(u.roles, role)
+
+	return nil
+}
+
+// UnassignRole removes the role. Applicant n' recruiter are switched by ToRecruiter n' ToApplicant.
+func (u *User) UnassignRole(role string) error {
+	if role == RoleApplicant || role == RoleRecruiter {
+		return errors.New("role can only be switched")
+	}
+	if !u.HasRole(role) {
+		return errors.New("user doesn't have the role")
+	}
+	u.roles = slices.DeleteFunc(u.roles, func(r string) bool { return r == role })
+
+	return nil
+}
+
+func (u User) IsEmailVerified() bool {
+	return u.emailVerified
+}
+
+func (u User) Version() int64 {
+	return u.version
+}
+
+// IncrementVersion is called by the repository, when the user has been stored
+func (u *User) IncrementVersion() {
+	u.version++
+}
+
+func (u *User) ChangeName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	u.name = name
+
+	return nil
+}
+
+// ChangeSurname sets the surname, it can be empty
+func (u *User) ChangeSurname(surname string) {
+	u.surname = strings.TrimSpace(surname)
+}
+
+// VerifyEmail marks the email as verified, if it's still the email of the user
+func (u *User) VerifyEmail(email string) error {
+	if u.email.email != email {
+		return errors.New("email has been changed")
+	}
+	u.emailVerified = true
+
+	return nil
+}
+
+// ChangeEmail replaces the email, the new one isn't verified until the user proves to own it
+func (u *User) ChangeEmail(email Email) error {
+	if email.email == "" {
+		return errors.New("email cannot be empty")
+	}
+	if u.email.email == email.email {
+		return errors.New("email is the same")
+	}
+	u.email = email
+	u.emailVerified = false
+
+	return nil
+}
+
+// ChangePassword replaces the hash of the password
+func (u *User) ChangePassword(ctx context.Context, password string, hasher PasswordHasher) error {
+	passwordHash, err := hashPassword(ctx, password, hasher)
+	if err != nil {
+		return err
+	}
+	u.password = passwordHash
+
+	return nil
 }
 
 func (u *User) ToRecruiter() error {
-	if u.isRecruiter {
+	if u.IsRecruiter() {
 		return errors.New("user is already recruiter")
 	}
-	u.isRecruiter = true
+	u.switchBaseRole(RoleApplicant, RoleRecruiter)
 
 	return nil
 }
 
 func (u *User) ToApplicant() error {
-	if !u.isRecruiter {
+	if !u.IsRecruiter() {
 		return errors.New("user is already applicant")
 	}
-	u.isRecruiter = false
+	u.switchBaseRole(RoleRecruiter, RoleApplicant)
 
 	return nil
 }
 
-func NewUser(email Email, name, surname, password string, isRecruiter bool) (*User, error) {
+func (u *User) switchBaseRole(from, to string) {
+	u.roles = slices.DeleteFunc(u.roles, func(r string) bool { return r == from })
+	u.roles = append(u.roles, to)
+}
+
+// baseRoles returns roles of the new user
+func baseRoles(isRecruiter bool) []string {
+	if isRecruiter {
+		return []string{RoleRecruiter}
+	}
+
+	return []string{RoleApplicant}
+}
+
+func NewUser(ctx context.Context, email Email, name, surname, password string, isRecruiter bool, hasher PasswordHasher) (*User, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
 		return nil, errors.New("name cannot be empty")
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passwordHash, err := hashPassword(ctx, password, hasher)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate hash password: %w", err)
+		return nil, err
 	}
 
 	// Surname can be empty
 	surname = strings.TrimSpace(surname)
 	return &User{
-		id:          uuid.New(),
-		email:       email,
-		name:        name,
-		surname:     surname,
-		isRecruiter: isRecruiter,
-		password:    string(passwordHash),
+		id:       uuid.New(),
+		email:    email,
+		name:     name,
+		surname:  surname,
+		roles:    baseRoles(isRecruiter),
+		password: passwordHash,
 	}, nil
 }
 
-func FromPersistence(id uuid.UUID, email Email, name, surname, password string, isRecruiter bool) *User {
+func hashPassword(ctx context.Context, password string, hasher PasswordHasher) (string, error) {
+	if password == "" {
+		return "", errors.New("password cannot be empty")
+	}
+
+	passwordHash, err := hasher.Hash(ctx, password)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate hash password: %w", err)
+	}
+
+	return passwordHash, nil
+}
+
+// FromPersistence restores the user. Users stored before roles were introduced have only isRecruiter,
+// their base role is derived from it.
+func FromPersistence(id uuid.UUID, email Email, name, surname, password string, roles []string, isRecruiter, emailVerified bool, version int64) *User {
+	if len(roles) == 0 {
+		roles = baseRoles(isRecruiter)
+	}
+
 	return &User{
-		id:          id,
-		email:       email,
-		name:        name,
-		surname:     surname,
-		isRecruiter: isRecruiter,
-		password:    password,
+		id:            id,
+		email:         email,
+		name:          name,
+		surname:       surname,
+		roles:         roles,
+		password:      password,
+		emailVerified: emailVerified,
+		version:       version,
 	}
 }
@@ -0,0 +1,237 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// plainHasher keeps passwords as is, hashing is tested in lib/password
+type plainHasher struct{}
+
+func (plainHasher) Hash(_ context.Context, password string) (string, error) {
+	return "plain$" + password, nil
+}
+
+func (plainHasher) Verify(_ context.Context, password, hash string) (bool, error) {
+	return hash == "plain$"+password, nil
+}
+
+func (plainHasher) NeedsRehash(string) bool {
+	return false
+}
+
+func (plainHasher) DummyHash() string {
+	return "plain$"
+}
+
+func newTestUser(t *testing.T) *User {
+	t.Helper()
+
+	email, err := NewEmail("User@Example.com")
+	if err != nil {
+		t.Fatalf("invalid email: %v", err)
+	}
+
+	user, err := NewUser(t.Context(), email, " Test ", " User ", "secret", false, plainHasher{})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	return user
+}
+
+func TestNewUser(t *testing.T) {
+	email, _ := NewEmail("user@example.com")
+
+	tests := []struct {
+		name        string
+		userName    string
+		password    string
+		isRecruiter bool
+		wantErr     bool
+		wantRoles   []string
+	}{
+		{name: "applicant", userName: "Test", password: "secret", wantRoles: []string{RoleApplicant}},
+		{name: "recruiter", userName: "Test", password: "secret", isRecruiter: true, wantRoles: []string{RoleRecruiter}},
+		{name: "blank name", userName: "  ", password: "secret", wantErr: true},
+		{name: "empty password", userName: "Test", password: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := NewUser(t.Context(), email, tt.userName, "", tt.password, tt.isRecruiter, plainHasher{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(user.Roles(), tt.wantRoles) {
+				t.Fatalf("got roles %v, want %v", user.Roles(), tt.wantRoles)
+			}
+			if user.Version() != 0 || user.IsEmailVerified() {
+				t.Fatal("new user must be unverified at version 0")
+			}
+			if ok, _ := user.CheckThePassword(t.Context(), tt.password, plainHasher{}); !ok {
+				t.Fatal("password doesn't match")
+			}
+		})
+	}
+}
+
+func TestNewEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{email: "User@Example.com", want: "user@example.com"},
+		{email: "not-an-email", wantErr: true},
+		{email: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			got, err := NewEmail(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("got %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUserProfileChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(u *User) error
+		wantErr bool
+		check   func(u *User) bool
+	}{
+		{
+			name:   "name is trimmed",
+			change: func(u *User) error { return u.ChangeName("  Jane ") },
+			check:  func(u *User) bool { return u.Name() == "Jane" },
+		},
+		{
+			name:    "name cannot be blank",
+			change:  func(u *User) error { return u.ChangeName(" ") },
+			wantErr: true,
+			check:   func(u *User) bool { return u.Name() == "Test" },
+		},
+		{
+			name:   "surname can be cleared",
+			change: func(u *User) error { u.ChangeSurname(""); return nil },
+			check:  func(u *User) bool { return u.Surname() == "" },
+		},
+		{
+			name: "new email isn't verified",
+			change: func(u *User) error {
+				_ = u.VerifyEmail(u.Email())
+				email, _ := NewEmail("new@example.com")
+				return u.ChangeEmail(email)
+			},
+			check: func(u *User) bool { return u.Email() == "new@example.com" && !u.IsEmailVerified() },
+		},
+		{
+			name: "same email",
+			change: func(u *User) error {
+				email, _ := NewEmail(u.Email())
+				return u.ChangeEmail(email)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "verification of an outdated email",
+			change:  func(u *User) error { return u.VerifyEmail("old@example.com") },
+			wantErr: true,
+			check:   func(u *User) bool { return !u.IsEmailVerified() },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newTestUser(t)
+			if err := tt.change(user); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.check != nil && !tt.check(user) {
+				t.Fatal("user is in unexpected state")
+			}
+		})
+	}
+}
+
+func TestUserVersion(t *testing.T) {
+	email, _ := NewEmail("user@example.com")
+	user := FromPersistence(uuid.New(), email, "Test", "", "hash", nil, true, true, 7)
+
+	if user.Version() != 7 {
+		t.Fatalf("got version %d, want 7", user.Version())
+	}
+
+	// Changes of fields don't bump the version, only the repository does after a successful write
+	_ = user.ChangeName("Jane")
+	if user.Version() != 7 {
+		t.Fatalf("change bumped the version to %d", user.Version())
+	}
+
+	user.IncrementVersion()
+	if user.Version() != 8 {
+		t.Fatalf("got version %d, want 8", user.Version())
+	}
+}
+
+func TestUserRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(u *User) error
+		wantErr   bool
+		wantRoles []string
+	}{
+		{name: "assign", change: func(u *User) error { return u.AssignRole("admin") }, wantRoles: []string{RoleApplicant, "admin"}},
+		{name: "assign twice", change: func(u *User) error {
+			_ = u.AssignRole("admin")
+			return u.AssignRole("admin")
+		}, wantErr: true, wantRoles: []string{RoleApplicant, "admin"}},
+		{name: "base role can't be assigned", change: func(u *User) error { return u.AssignRole(RoleRecruiter) }, wantErr: true, wantRoles: []string{RoleApplicant}},
+		{name: "unassign missing role", change: func(u *User) error { return u.UnassignRole("admin") }, wantErr: true, wantRoles: []string{RoleApplicant}},
+		{name: "to recruiter", change: func(u *User) error { return u.ToRecruiter() }, wantRoles: []string{RoleRecruiter}},
+		{name: "already applicant", change: func(u *User) error { return u.ToApplicant() }, wantErr: true, wantRoles: []string{RoleApplicant}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newTestUser(t)
+			if err := tt.change(user); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(user.Roles(), tt.wantRoles) {
+				t.Fatalf("got roles %v, want %v", user.Roles(), tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestFromPersistenceDerivesBaseRole(t *testing.T) {
+	email, _ := NewEmail("user@example.com")
+
+	recruiter := FromPersistence(uuid.New(), email, "Test", "", "hash", nil, true, false, 0)
+	if !slices.Equal(recruiter.Roles(), []string{RoleRecruiter}) {
+		t.Fatalf("got roles %v, want recruiter", recruiter.Roles())
+	}
+
+	applicant := FromPersistence(uuid.New(), email, "Test", "", "hash", nil, false, false, 0)
+	if !slices.Equal(applicant.Roles(), []string{RoleApplicant}) {
+		t.Fatalf("got roles %v, want applicant", applicant.Roles())
+	}
+}
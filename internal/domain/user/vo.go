@@ -19,3 +19,7 @@ func NewEmail(email string) (Email, error) {
 		email: strings.ToLower(email),
 	}, nil
 }
+
+func (e Email) String() string {
+	return e.email
+}
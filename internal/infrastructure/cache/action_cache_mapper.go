@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"encoding/json"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/token"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type ActionTokenMapper struct {
+}
+
+func (a *ActionTokenMapper) ToModel(token *domain.ActionToken) (*ActionTokenModel, error) {
+	if token == nil {
+		return nil, consts.ErrNilToken
+	}
+
+	return &ActionTokenModel{
+		Hash:      token.Hash(),
+		Purpose:   string(token.Purpose()),
+		UserID:    token.UserID(),
+		Email:     token.Email(),
+		IssuedAt:  token.IssuedAt(),
+		ExpiresAt: token.ExpiresAt(),
+	}, nil
+}
+
+func (a *ActionTokenMapper) ToDomain(data []byte) (*domain.ActionToken, error) {
+	var result ActionTokenModel
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return domain.ActionTokenFromPersistence(
+		result.Hash,
+		domain.Purpose(result.Purpose),
+		result.UserID,
+		result.Email,
+		result.IssuedAt,
+		result.ExpiresAt,
+	), nil
+}
@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ActionTokenModel struct {
+	Hash      string    `json:"hash"`
+	Purpose   string    `json:"purpose"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"encoding/json"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/passkey"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type CeremonyMapper struct {
+}
+
+func (c *CeremonyMapper) ToModel(ceremony *domain.Ceremony) (*CeremonyModel, error) {
+	if ceremony == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &CeremonyModel{
+		ID:        ceremony.ID(),
+		Kind:      string(ceremony.Kind()),
+		UserID:    ceremony.UserID(),
+		Session:   ceremony.Session(),
+		ExpiresAt: ceremony.ExpiresAt(),
+	}, nil
+}
+
+func (c *CeremonyMapper) ToDomain(data []byte) (*domain.Ceremony, error) {
+	var result CeremonyModel
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return domain.CeremonyFromPersistence(
+		result.ID,
+		domain.CeremonyKind(result.Kind),
+		result.UserID,
+		result.Session,
+		result.ExpiresAt,
+	), nil
+}
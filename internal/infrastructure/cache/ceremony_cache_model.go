@@ -0,0 +1,15 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CeremonyModel struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	UserID    uuid.UUID `json:"user_id"`
+	Session   []byte    `json:"session"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"encoding/json"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type AuthorizationCodeMapper struct {
+}
+
+func (a *AuthorizationCodeMapper) ToModel(code *domain.AuthorizationCode) (*AuthorizationCodeModel, error) {
+	if code == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &AuthorizationCodeModel{
+		Hash:          code.Hash(),
+		ClientID:      code.ClientID(),
+		UserID:        code.UserID(),
+		RedirectURI:   code.RedirectURI(),
+		Scopes:        code.Scopes(),
+		CodeChallenge: code.CodeChallenge(),
+		Nonce:         code.Nonce(),
+		AuthTime:      code.AuthTime(),
+		ExpiresAt:     code.ExpiresAt(),
+	}, nil
+}
+
+func (a *AuthorizationCodeMapper) ToDomain(data []byte) (*domain.AuthorizationCode, error) {
+	var result AuthorizationCodeModel
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return domain.CodeFromPersistence(
+		result.Hash,
+		result.ClientID,
+		result.UserID,
+		result.RedirectURI,
+		result.Scopes,
+		result.CodeChallenge,
+		result.Nonce,
+		result.AuthTime,
+		result.ExpiresAt,
+	), nil
+}
+
+func (a *AuthorizationCodeMapper) RedemptionToModel(redemption domain.CodeRedemption) *CodeRedemptionModel {
+	return &CodeRedemptionModel{
+		FamilyID:      redemption.FamilyID,
+		AccessTokenID: redemption.AccessTokenID,
+	}
+}
+
+func (a *AuthorizationCodeMapper) RedemptionToDomain(data []byte) (*domain.CodeRedemption, error) {
+	var result CodeRedemptionModel
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return &domain.CodeRedemption{
+		FamilyID:      result.FamilyID,
+		AccessTokenID: result.AccessTokenID,
+	}, nil
+}
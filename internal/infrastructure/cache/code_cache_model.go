@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuthorizationCodeModel struct {
+	Hash          string    `json:"hash"`
+	ClientID      string    `json:"client_id"`
+	UserID        uuid.UUID `json:"user_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	CodeChallenge string    `json:"code_challenge"`
+	Nonce         string    `json:"nonce,omitempty"`
+	AuthTime      time.Time `json:"auth_time"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+type CodeRedemptionModel struct {
+	FamilyID      uuid.UUID `json:"family_id"`
+	AccessTokenID string    `json:"access_token_id"`
+}
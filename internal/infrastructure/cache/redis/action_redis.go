@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/token"
+	"github.com/devathh/staffy-sso/internal/infrastructure/cache"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/redis/go-redis/v9"
+)
+
+// ActionTokenStore keeps single-use tokens, which are sent by email, until they expire
+type ActionTokenStore struct {
+	client *redis.Client
+	mapper *cache.ActionTokenMapper
+}
+
+func (a *ActionTokenStore) Save(ctx context.Context, token *domain.ActionToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model, err := a.mapper.ToModel(token)
+	if err != nil {
+		return fmt.Errorf("invalid action token: %w", err)
+	}
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	ttl := time.Until(token.ExpiresAt())
+	if ttl <= 0 {
+		return errors.New("action token is already expired")
+	}
+
+	if err := a.client.Set(ctx, a.actionKey(token.Purpose(), token.Hash()), data, ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save action token: %w", err)
+	}
+
+	return nil
+}
+
+func (a *ActionTokenStore) Consume(ctx context.Context, purpose domain.Purpose, hash string) (*domain.ActionToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := a.client.GetDel(ctx, a.actionKey(purpose, hash)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, consts.ErrTokenDoesntExist
+		}
+		if isContextErr(err) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to consume action token: %w", err)
+	}
+
+	token, err := a.mapper.ToDomain(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return token, nil
+}
+
+func (a *ActionTokenStore) actionKey(purpose domain.Purpose, hash string) string {
+	return fmt.Sprintf("action:%s:%s", purpose, hash)
+}
+
+func NewActionTokenStore(client *redis.Client) (*ActionTokenStore, error) {
+	if client == nil {
+		return nil, errors.New("redis client is nil")
+	}
+
+	return &ActionTokenStore{
+		client: client,
+		mapper: &cache.ActionTokenMapper{},
+	}, nil
+}
@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/lockout"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/redis/go-redis/v9"
+)
+
+// reserveAttempt takes pairs of attempts n' blocked keys, ARGV are now, the window n' then the threshold
+// with the lockout of every pair. If any subject is blocked or would pass its threshold, nothing is charged
+// n' the end of the block is returned. Otherwise it returns 0 n' attempt numbers of subjects.
+var reserveAttempt = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local subjects = #KEYS / 2
+
+local blocked = 0
+for i = 1, subjects do
+	local blockedUntil = redis.call('GET', KEYS[2 * i])
+	if blockedUntil and tonumber(blockedUntil) > now then
+		blocked = math.max(blocked, tonumber(blockedUntil))
+	end
+end
+if blocked > 0 then
+	return {blocked}
+end
+
+for i = 1, subjects do
+	local attempts = tonumber(redis.call('GET', KEYS[2 * i - 1]) or '0')
+	if attempts >= tonumber(ARGV[1 + 2 * i]) then
+		local lockout = tonumber(ARGV[2 + 2 * i])
+		redis.call('SET', KEYS[2 * i], now + lockout, 'PX', lockout)
+		blocked = math.max(blocked, now + lockout)
+	end
+end
+if blocked > 0 then
+	return {blocked}
+end
+
+local result = {0}
+for i = 1, subjects do
+	result[i + 1] = redis.call('INCR', KEYS[2 * i - 1])
+	redis.call('PEXPIRE', KEYS[2 * i - 1], window)
+end
+
+return result
+`)
+
+// releaseAttempt decrements counters of attempts, which are still kept
+var releaseAttempt = redis.NewScript(`
+for i = 1, #KEYS do
+	if tonumber(redis.call('GET', KEYS[i]) or '0') > 0 then
+		redis.call('DECR', KEYS[i])
+	end
+end
+
+return 0
+`)
+
+type AttemptStore struct {
+	client *redis.Client
+}
+
+// Reserve prolongs the window on every attempt, so slow guessing is counted too
+func (a *AttemptStore) Reserve(ctx context.Context, attempts []domain.Attempt, window time.Duration) ([]int64, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if len(attempts) == 0 {
+		return nil, time.Time{}, nil
+	}
+
+	keys := make([]string, 0, len(attempts)*2)
+	args := []any{time.Now().UTC().UnixMilli(), window.Milliseconds()}
+	for _, attempt := range attempts {
+		keys = append(keys, a.attemptsKey(attempt.Scope, attempt.Subject), a.blockedKey(attempt.Scope, attempt.Subject))
+		args = append(args, attempt.Policy.Threshold, attempt.Policy.Lockout.Milliseconds())
+	}
+
+	result, err := reserveAttempt.Run(ctx, a.client, keys, args...).Int64Slice()
+	if err != nil {
+		if isContextErr(err) {
+			return nil, time.Time{}, consts.ErrContext
+		}
+
+		return nil, time.Time{}, fmt.Errorf("failed to reserve attempt: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, time.Time{}, errors.New("failed to reserve attempt: empty result")
+	}
+	if result[0] > 0 {
+		return nil, time.UnixMilli(result[0]).UTC(), nil
+	}
+	if len(result) != len(attempts)+1 {
+		return nil, time.Time{}, fmt.Errorf("failed to reserve attempt: got %d numbers, want %d", len(result)-1, len(attempts))
+	}
+
+	return result[1:], time.Time{}, nil
+}
+
+func (a *AttemptStore) Release(ctx context.Context, attempts []domain.Attempt) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(attempts) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		keys = append(keys, a.attemptsKey(attempt.Scope, attempt.Subject))
+	}
+
+	if err := releaseAttempt.Run(ctx, a.client, keys).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to release attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AttemptStore) Block(ctx context.Context, scope domain.Scope, subject string, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := a.client.Set(ctx, a.blockedKey(scope, subject), until.UTC().UnixMilli(), ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to block attempts: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AttemptStore) Reset(ctx context.Context, scope domain.Scope, subject string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := a.client.Del(ctx, a.attemptsKey(scope, subject), a.blockedKey(scope, subject)).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to reset attempts: %w", err)
+	}
+
+	return nil
+}
+
+// attemptsKey n' blockedKey share the hash tag, scripts touch keys of the account n' the ip at once,
+// so they have to be in one slot of Redis Cluster
+func (a *AttemptStore) attemptsKey(scope domain.Scope, subject string) string {
+	return fmt.Sprintf("{lockout}:attempts:%s:%s", scope, subject)
+}
+
+func (a *AttemptStore) blockedKey(scope domain.Scope, subject string) string {
+	return fmt.Sprintf("{lockout}:blocked:%s:%s", scope, subject)
+}
+
+func NewAttemptStore(client *redis.Client) (*AttemptStore, error) {
+	if client == nil {
+		return nil, errors.New("redis client is nil")
+	}
+
+	return &AttemptStore{
+		client: client,
+	}, nil
+}
@@ -0,0 +1,213 @@
+package redis
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/lockout"
+)
+
+func newTestAttempts(threshold int64) []domain.Attempt {
+	return []domain.Attempt{
+		{
+			Scope:   domain.ScopeAccount,
+			Subject: "user@example.com",
+			Policy:  domain.Policy{Threshold: threshold, Lockout: 15 * time.Minute},
+		},
+		{
+			Scope:   domain.ScopeIP,
+			Subject: "203.0.113.7",
+			Policy:  domain.Policy{Threshold: threshold * 10, Lockout: 15 * time.Minute},
+		},
+	}
+}
+
+func TestAttemptStoreReserve(t *testing.T) {
+	client, mr := newTestClient(t)
+	store, err := NewAttemptStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	attempts := newTestAttempts(3)
+	for want := int64(1); want <= 3; want++ {
+		numbers, blockedUntil, err := store.Reserve(t.Context(), attempts, time.Hour)
+		if err != nil {
+			t.Fatalf("attempt %d: %v", want, err)
+		}
+		if !blockedUntil.IsZero() {
+			t.Fatalf("attempt %d is blocked", want)
+		}
+		if len(numbers) != 2 || numbers[0] != want || numbers[1] != want {
+			t.Fatalf("attempt %d: got numbers %v", want, numbers)
+		}
+	}
+
+	if ttl := mr.TTL("{lockout}:attempts:account:user@example.com"); ttl != time.Hour {
+		t.Fatalf("counter ttl: got %s, want %s", ttl, time.Hour)
+	}
+
+	// The attempt over the threshold locks the account out n' isn't charged to any subject
+	numbers, blockedUntil, err := store.Reserve(t.Context(), attempts, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if numbers != nil || time.Until(blockedUntil) <= 14*time.Minute {
+		t.Fatalf("got numbers %v, blocked until %s", numbers, blockedUntil)
+	}
+	if got, _ := mr.Get("{lockout}:attempts:ip:203.0.113.7"); got != "3" {
+		t.Fatalf("ip counter: got %s, want 3", got)
+	}
+
+	// Blocked attempts aren't charged either
+	if _, again, err := store.Reserve(t.Context(), attempts, time.Hour); err != nil || !again.Equal(blockedUntil) {
+		t.Fatalf("got %s n' %v, want %s", again, err, blockedUntil)
+	}
+	if got, _ := mr.Get("{lockout}:attempts:account:user@example.com"); got != "3" {
+		t.Fatalf("account counter: got %s, want 3", got)
+	}
+}
+
+func TestAttemptStoreReserveIsAtomic(t *testing.T) {
+	client, _ := newTestClient(t)
+	store, err := NewAttemptStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	const threshold = 5
+	attempts := newTestAttempts(threshold)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			numbers, _, err := store.Reserve(t.Context(), attempts, time.Hour)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if numbers != nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != threshold {
+		t.Fatalf("got %d reserved attempts, want %d", reserved, threshold)
+	}
+}
+
+func TestAttemptStoreBlock(t *testing.T) {
+	client, _ := newTestClient(t)
+	store, err := NewAttemptStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	attempts := newTestAttempts(5)
+	until := time.Now().UTC().Add(time.Minute).Truncate(time.Millisecond)
+	if err := store.Block(t.Context(), domain.ScopeIP, "203.0.113.7", until); err != nil {
+		t.Fatalf("failed to block: %v", err)
+	}
+
+	// The block of one subject rejects the whole attempt
+	numbers, blockedUntil, err := store.Reserve(t.Context(), attempts, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if numbers != nil || !blockedUntil.Equal(until) {
+		t.Fatalf("got numbers %v, blocked until %s, want %s", numbers, blockedUntil, until)
+	}
+
+	// A block in the past is ignored
+	if err := store.Block(t.Context(), domain.ScopeAccount, "user@example.com", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to block: %v", err)
+	}
+	if err := store.Reset(t.Context(), domain.ScopeIP, "203.0.113.7"); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if numbers, _, err := store.Reserve(t.Context(), attempts, time.Hour); err != nil || numbers == nil {
+		t.Fatalf("got numbers %v n' %v after the reset", numbers, err)
+	}
+}
+
+func TestAttemptStoreRelease(t *testing.T) {
+	client, mr := newTestClient(t)
+	store, err := NewAttemptStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	attempts := newTestAttempts(5)
+	for range 2 {
+		if _, _, err := store.Reserve(t.Context(), attempts, time.Hour); err != nil {
+			t.Fatalf("failed to reserve: %v", err)
+		}
+	}
+
+	if err := store.Release(t.Context(), attempts[1:]); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if got, _ := mr.Get("{lockout}:attempts:ip:203.0.113.7"); got != "1" {
+		t.Fatalf("ip counter: got %s, want 1", got)
+	}
+	if got, _ := mr.Get("{lockout}:attempts:account:user@example.com"); got != "2" {
+		t.Fatalf("account counter: got %s, want 2", got)
+	}
+
+	// Counters don't go below zero n' unknown subjects are skipped
+	for range 3 {
+		if err := store.Release(t.Context(), attempts[1:]); err != nil {
+			t.Fatalf("failed to release: %v", err)
+		}
+	}
+	if got, _ := mr.Get("{lockout}:attempts:ip:203.0.113.7"); got != "0" {
+		t.Fatalf("ip counter: got %s, want 0", got)
+	}
+	if err := store.Release(t.Context(), []domain.Attempt{{Scope: domain.ScopeIP, Subject: "unknown"}}); err != nil {
+		t.Fatalf("failed to release unknown subject: %v", err)
+	}
+	if mr.Exists("{lockout}:attempts:ip:unknown") {
+		t.Fatal("release has created a counter")
+	}
+}
+
+func TestAttemptStoreKeysShareHashTag(t *testing.T) {
+	client, mr := newTestClient(t)
+	store, err := NewAttemptStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	attempts := newTestAttempts(3)
+	if _, _, err := store.Reserve(t.Context(), attempts, time.Hour); err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if err := store.Block(t.Context(), domain.ScopeIP, "203.0.113.7", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to block: %v", err)
+	}
+
+	// Scripts touch the account n' the ip at once, Redis Cluster needs them in one slot
+	keys := mr.Keys()
+	if len(keys) != 3 {
+		t.Fatalf("got keys %v", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "{lockout}:") {
+			t.Fatalf("key %q isn't tagged", key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/passkey"
+	"github.com/devathh/staffy-sso/internal/infrastructure/cache"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/redis/go-redis/v9"
+)
+
+// CeremonyStore keeps challenges of started passkey ceremonies until they are finished or expire
+type CeremonyStore struct {
+	client *redis.Client
+	mapper *cache.CeremonyMapper
+}
+
+func (c *CeremonyStore) Save(ctx context.Context, ceremony *domain.Ceremony) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model, err := c.mapper.ToModel(ceremony)
+	if err != nil {
+		return fmt.Errorf("invalid ceremony: %w", err)
+	}
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	ttl := time.Until(ceremony.ExpiresAt())
+	if ttl <= 0 {
+		return errors.New("ceremony is already expired")
+	}
+
+	if err := c.client.Set(ctx, c.ceremonyKey(ceremony.Kind(), ceremony.ID()), data, ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save ceremony: %w", err)
+	}
+
+	return nil
+}
+
+func (c *CeremonyStore) Consume(ctx context.Context, kind domain.CeremonyKind, id string) (*domain.Ceremony, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := c.client.GetDel(ctx, c.ceremonyKey(kind, id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, consts.ErrTokenDoesntExist
+		}
+		if isContextErr(err) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to consume ceremony: %w", err)
+	}
+
+	ceremony, err := c.mapper.ToDomain(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return ceremony, nil
+}
+
+func (c *CeremonyStore) ceremonyKey(kind domain.CeremonyKind, id string) string {
+	return fmt.Sprintf("ceremony:%s:%s", kind, id)
+}
+
+func NewCeremonyStore(client *redis.Client) (*CeremonyStore, error) {
+	if client == nil {
+		return nil, errors.New("redis client is nil")
+	}
+
+	return &CeremonyStore{
+		client: client,
+		mapper: &cache.CeremonyMapper{},
+	}, nil
+}
@@ -0,0 +1,140 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/internal/infrastructure/cache"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/redis/go-redis/v9"
+)
+
+type AuthorizationCodeStore struct {
+	client *redis.Client
+	mapper *cache.AuthorizationCodeMapper
+}
+
+func (a *AuthorizationCodeStore) Save(ctx context.Context, code *domain.AuthorizationCode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model, err := a.mapper.ToModel(code)
+	if err != nil {
+		return fmt.Errorf("invalid authorization code: %w", err)
+	}
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	ttl := time.Until(code.ExpiresAt())
+	if ttl <= 0 {
+		return errors.New("authorization code is already expired")
+	}
+
+	if err := a.client.Set(ctx, a.codeKey(code.Hash()), data, ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save authorization code: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AuthorizationCodeStore) Consume(ctx context.Context, hash string) (*domain.AuthorizationCode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := a.client.GetDel(ctx, a.codeKey(hash)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, consts.ErrTokenDoesntExist
+		}
+		if isContextErr(err) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to consume authorization code: %w", err)
+	}
+
+	code, err := a.mapper.ToDomain(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return code, nil
+}
+
+func (a *AuthorizationCodeStore) MarkRedeemed(ctx context.Context, hash string, redemption domain.CodeRedemption, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(a.mapper.RedemptionToModel(redemption))
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	if err := a.client.Set(ctx, a.redeemedKey(hash), data, ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to mark authorization code as redeemed: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AuthorizationCodeStore) GetRedemption(ctx context.Context, hash string) (*domain.CodeRedemption, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := a.client.Get(ctx, a.redeemedKey(hash)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, consts.ErrTokenDoesntExist
+		}
+		if isContextErr(err) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to get redemption of authorization code: %w", err)
+	}
+
+	redemption, err := a.mapper.RedemptionToDomain(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return redemption, nil
+}
+
+func (a *AuthorizationCodeStore) codeKey(hash string) string {
+	return fmt.Sprintf("oauth:code:%s", hash)
+}
+
+func (a *AuthorizationCodeStore) redeemedKey(hash string) string {
+	return fmt.Sprintf("oauth:code:redeemed:%s", hash)
+}
+
+func NewAuthorizationCodeStore(client *redis.Client) (*AuthorizationCodeStore, error) {
+	if client == nil {
+		return nil, errors.New("redis client is nil")
+	}
+
+	return &AuthorizationCodeStore{
+		client: client,
+		mapper: &cache.AuthorizationCodeMapper{},
+	}, nil
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+)
+
+func TestAuthorizationCodeStoreConsume(t *testing.T) {
+	client, _ := newTestClient(t)
+	store, err := NewAuthorizationCodeStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	code, raw, err := domain.NewAuthorizationCode("client", uuid.New(), "https://app/cb", []string{"openid"},
+		"4mdEpB6p5MagxEW3oIN8slvbLftN-gHbZADENGTetNs", "nonce", time.Now().UTC(), time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create code: %v", err)
+	}
+	if err := store.Save(t.Context(), code); err != nil {
+		t.Fatalf("failed to save code: %v", err)
+	}
+
+	steps := []struct {
+		name    string
+		wantErr error
+	}{
+		{name: "first exchange", wantErr: nil},
+		{name: "code is single-use", wantErr: consts.ErrTokenDoesntExist},
+	}
+
+	for _, step := range steps {
+		got, err := store.Consume(t.Context(), domain.HashCode(raw))
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: got %v, want %v", step.name, err, step.wantErr)
+		}
+		if err == nil && got.UserID() != code.UserID() {
+			t.Fatalf("%s: stored code differs", step.name)
+		}
+	}
+}
+
+func TestAuthorizationCodeStoreRedemption(t *testing.T) {
+	client, mr := newTestClient(t)
+	store, err := NewAuthorizationCodeStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	redemption := domain.CodeRedemption{FamilyID: uuid.New(), AccessTokenID: uuid.NewString()}
+	if err := store.MarkRedeemed(t.Context(), "redeemed", redemption, time.Hour); err != nil {
+		t.Fatalf("failed to mark code: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    string
+		want    *domain.CodeRedemption
+		wantErr error
+	}{
+		{name: "redeemed code", hash: "redeemed", want: &redemption},
+		{name: "unknown code", hash: "unknown", wantErr: consts.ErrTokenDoesntExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.GetRedemption(t.Context(), tt.hash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Fatalf("got %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+
+	mr.FastForward(time.Hour)
+	if _, err := store.GetRedemption(t.Context(), "redeemed"); !errors.Is(err, consts.ErrTokenDoesntExist) {
+		t.Fatalf("redemption outlived its ttl: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/ratelimit"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindow keeps timestamps of allowed requests in sorted sets, one per counter. ARGV are now, the id
+// of the request n' then the window with the limit of every counter. The request is added to all counters
+// only if it fits each of them, so a counter, which rejects it, doesn't eat the budget of the others, n'
+// hammering doesn't prolong the wait. It returns {0, 0}, if the request is allowed, or the milliseconds
+// to wait with the number of the counter, which has to wait the longest
+var slidingWindow = redis.NewScript(`
+local now = tonumber(ARGV[1])
+
+local wait, exceeded = 0, 0
+for i = 1, #KEYS do
+	local window = tonumber(ARGV[1 + 2 * i])
+	local limit = tonumber(ARGV[2 + 2 * i])
+
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', now - window)
+	if redis.call('ZCARD', KEYS[i]) >= limit then
+		local oldest = redis.call('ZRANGE', KEYS[i], 0, 0, 'WITHSCORES')
+		local counterWait = math.max(tonumber(oldest[2]) + window - now, 1)
+		if counterWait > wait then
+			wait, exceeded = counterWait, i
+		end
+	end
+end
+
+if wait > 0 then
+	return {wait, exceeded}
+end
+
+for i = 1, #KEYS do
+	redis.call('ZADD', KEYS[i], now, ARGV[2])
+	redis.call('PEXPIRE', KEYS[i], ARGV[1 + 2 * i])
+end
+
+return {0, 0}
+`)
+
+type RateLimitStore struct {
+	client *redis.Client
+}
+
+// Allow skips disabled limits, they don't count requests
+func (r *RateLimitStore) Allow(ctx context.Context, counters []domain.Counter) (domain.Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Decision{}, err
+	}
+
+	keys := make([]string, 0, len(counters))
+	// indexes map counters of the script to the given ones
+	indexes := make([]int, 0, len(counters))
+	args := []any{time.Now().UTC().UnixMilli(), uuid.NewString()}
+	for i, counter := range counters {
+		if !counter.Limit.Enabled() {
+			continue
+		}
+
+		keys = append(keys, r.limitKey(counter.Key))
+		indexes = append(indexes, i)
+		args = append(args, counter.Limit.Window.Milliseconds(), counter.Limit.Requests)
+	}
+
+	if len(keys) == 0 {
+		return domain.Decision{Allowed: true}, nil
+	}
+
+	result, err := slidingWindow.Run(ctx, r.client, keys, args...).Int64Slice()
+	if err != nil {
+		if isContextErr(err) {
+			return domain.Decision{}, consts.ErrContext
+		}
+
+		return domain.Decision{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+
+	if len(result) != 2 {
+		return domain.Decision{}, fmt.Errorf("failed to check rate limit: unexpected result %v", result)
+	}
+
+	wait, exceeded := result[0], result[1]
+	if wait <= 0 {
+		return domain.Decision{Allowed: true}, nil
+	}
+	if exceeded < 1 || exceeded > int64(len(indexes)) {
+		return domain.Decision{}, fmt.Errorf("failed to check rate limit: unknown counter %d", exceeded)
+	}
+
+	return domain.Decision{
+		Exceeded:   indexes[exceeded-1],
+		RetryAfter: time.Duration(wait) * time.Millisecond,
+	}, nil
+}
+
+func (r *RateLimitStore) limitKey(key string) string {
+	return fmt.Sprintf("ratelimit:%s", key)
+}
+
+func NewRateLimitStore(client *redis.Client) (*RateLimitStore, error) {
+	if client == nil {
+		return nil, errors.New("redis client is nil")
+	}
+
+	return &RateLimitStore{
+		client: client,
+	}, nil
+}
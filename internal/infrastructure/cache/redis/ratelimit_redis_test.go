@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/ratelimit"
+)
+
+func newTestRateLimitStore(t *testing.T) *RateLimitStore {
+	t.Helper()
+
+	client, _ := newTestClient(t)
+	store, err := NewRateLimitStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	return store
+}
+
+func TestRateLimitStoreSlidingWindow(t *testing.T) {
+	store := newTestRateLimitStore(t)
+	counters := []domain.Counter{{Key: "method", Limit: domain.Limit{Requests: 3, Window: 200 * time.Millisecond}}}
+
+	for i := range 3 {
+		decision, err := store.Allow(t.Context(), counters)
+		if err != nil || !decision.Allowed {
+			t.Fatalf("request %d: got %+v n' %v, want allowed", i+1, decision, err)
+		}
+	}
+
+	decision, err := store.Allow(t.Context(), counters)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decision.Allowed || decision.Exceeded != 0 {
+		t.Fatalf("got %+v, want rejected by the first counter", decision)
+	}
+	if decision.RetryAfter <= 0 || decision.RetryAfter > 200*time.Millisecond {
+		t.Fatalf("got retry after %s, want within the window", decision.RetryAfter)
+	}
+
+	// Rejected requests aren't counted, so the wait doesn't grow n' the window frees up in time
+	time.Sleep(decision.RetryAfter + 10*time.Millisecond)
+	if decision, err := store.Allow(t.Context(), counters); err != nil || !decision.Allowed {
+		t.Fatalf("got %+v n' %v after the window, want allowed", decision, err)
+	}
+}
+
+// rateCall is one call of the limiter n' its expected decision
+type rateCall struct {
+	counters     []domain.Counter
+	wantAllowed  bool
+	wantExceeded int
+}
+
+func TestRateLimitStoreAllOrNothing(t *testing.T) {
+	method := domain.Counter{Key: "method", Limit: domain.Limit{Requests: 10, Window: time.Minute}}
+	ip := domain.Counter{Key: "ip", Limit: domain.Limit{Requests: 2, Window: time.Minute}}
+	email := domain.Counter{Key: "email", Limit: domain.Limit{Requests: 1, Window: time.Minute}}
+	disabled := domain.Counter{Key: "disabled", Limit: domain.Limit{}}
+
+	tests := []struct {
+		name  string
+		calls []rateCall
+		// wantMethod is the number of calls the method counter has left at the end
+		wantMethod int
+	}{
+		{
+			name: "rejected calls don't use up the method",
+			calls: []rateCall{
+				{counters: []domain.Counter{method, ip}, wantAllowed: true},
+				{counters: []domain.Counter{method, ip}, wantAllowed: true},
+				{counters: []domain.Counter{method, ip}, wantExceeded: 1},
+				{counters: []domain.Counter{method, ip}, wantExceeded: 1},
+				{counters: []domain.Counter{method, ip}, wantExceeded: 1},
+			},
+			wantMethod: 8,
+		},
+		{
+			name: "order of counters doesn't matter",
+			calls: []rateCall{
+				{counters: []domain.Counter{email, ip, method}, wantAllowed: true},
+				{counters: []domain.Counter{email, ip, method}, wantExceeded: 0},
+				{counters: []domain.Counter{ip, method, email}, wantExceeded: 2},
+			},
+			wantMethod: 9,
+		},
+		{
+			name: "disabled counters are skipped",
+			calls: []rateCall{
+				{counters: []domain.Counter{disabled, email}, wantAllowed: true},
+				{counters: []domain.Counter{disabled, email}, wantExceeded: 1},
+				{counters: []domain.Counter{disabled}, wantAllowed: true},
+			},
+			wantMethod: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestRateLimitStore(t)
+
+			for i, call := range tt.calls {
+				decision, err := store.Allow(t.Context(), call.counters)
+				if err != nil {
+					t.Fatalf("call %d: unexpected error: %v", i+1, err)
+				}
+				if decision.Allowed != call.wantAllowed {
+					t.Fatalf("call %d: got %+v, want allowed: %v", i+1, decision, call.wantAllowed)
+				}
+				if !decision.Allowed && decision.Exceeded != call.wantExceeded {
+					t.Fatalf("call %d: got exceeded %d, want %d", i+1, decision.Exceeded, call.wantExceeded)
+				}
+			}
+
+			left := 0
+			for {
+				decision, err := store.Allow(t.Context(), []domain.Counter{method})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !decision.Allowed {
+					break
+				}
+				left++
+			}
+			if left != tt.wantMethod {
+				t.Fatalf("method has %d calls left, want %d", left, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestRateLimitStoreLongestWait(t *testing.T) {
+	store := newTestRateLimitStore(t)
+	short := domain.Counter{Key: "short", Limit: domain.Limit{Requests: 1, Window: time.Second}}
+	long := domain.Counter{Key: "long", Limit: domain.Limit{Requests: 1, Window: time.Hour}}
+
+	if decision, err := store.Allow(t.Context(), []domain.Counter{short, long}); err != nil || !decision.Allowed {
+		t.Fatalf("got %+v n' %v, want allowed", decision, err)
+	}
+
+	decision, err := store.Allow(t.Context(), []domain.Counter{short, long})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decision.Allowed || decision.Exceeded != 1 || decision.RetryAfter <= time.Minute {
+		t.Fatalf("got %+v, want the wait of the long counter", decision)
+	}
+}
+
+func TestRateLimitStoreParallelCalls(t *testing.T) {
+	store := newTestRateLimitStore(t)
+	counters := []domain.Counter{
+		{Key: "method", Limit: domain.Limit{Requests: 100, Window: time.Minute}},
+		{Key: "ip", Limit: domain.Limit{Requests: 5, Window: time.Minute}},
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			decision, err := store.Allow(t.Context(), counters)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if decision.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Fatalf("got %d allowed calls, want 5", allowed)
+	}
+}
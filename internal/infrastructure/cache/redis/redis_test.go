@@ -0,0 +1,30 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient returns a client of miniredis, which is closed with the test
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client, mr
+}
+
+func newTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Secrets.JWT.TTL = time.Hour
+	cfg.Secrets.JWT.RefreshTTL = 24 * time.Hour
+	cfg.Secrets.Redis.TTL = time.Minute
+
+	return cfg
+}
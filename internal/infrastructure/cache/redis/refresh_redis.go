@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/token"
+	"github.com/devathh/staffy-sso/internal/infrastructure/cache"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+type RefreshTokenStore struct {
+	client *redis.Client
+	mapper *cache.RefreshTokenMapper
+	cfg    *config.Config
+}
+
+func (r *RefreshTokenStore) Save(ctx context.Context, token *domain.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model, err := r.mapper.ToModel(token)
+	if err != nil {
+		return fmt.Errorf("invalid refresh token: %w", err)
+	}
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	ttl := time.Until(token.ExpiresAt())
+	if ttl <= 0 {
+		return errors.New("refresh token is already expired")
+	}
+
+	if err := r.client.Set(ctx, r.tokenKey(token.Hash()), data, ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenStore) GetByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := r.client.Get(ctx, r.tokenKey(hash)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, consts.ErrTokenDoesntExist
+		}
+		if isContextErr(err) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	token, err := r.mapper.ToDomain(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return token, nil
+}
+
+func (r *RefreshTokenStore) MarkUsed(ctx context.Context, token *domain.RefreshToken) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// The marker lives as long as the token itself, so reuse of it is detected until it expires
+	ttl := max(time.Until(token.ExpiresAt()), time.Second)
+
+	first, err := r.client.SetNX(ctx, r.usedKey(token.Hash()), token.FamilyID().String(), ttl).Result()
+	if err != nil {
+		if isContextErr(err) {
+			return false, consts.ErrContext
+		}
+
+		return false, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+
+	return first, nil
+}
+
+func (r *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// No token of the family can outlive refresh ttl, so there's no need to keep the marker longer
+	if err := r.client.Set(ctx, r.familyKey(familyID), 1, r.cfg.Secrets.JWT.RefreshTTL).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenStore) IsFamilyRevoked(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	n, err := r.client.Exists(ctx, r.familyKey(familyID)).Result()
+	if err != nil {
+		if isContextErr(err) {
+			return false, consts.ErrContext
+		}
+
+		return false, fmt.Errorf("failed to check refresh token family: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *RefreshTokenStore) tokenKey(hash string) string {
+	return fmt.Sprintf("refresh:%s", hash)
+}
+
+func (r *RefreshTokenStore) usedKey(hash string) string {
+	return fmt.Sprintf("refresh:used:%s", hash)
+}
+
+func (r *RefreshTokenStore) familyKey(familyID uuid.UUID) string {
+	return fmt.Sprintf("refresh:family:revoked:%s", familyID)
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled)
+}
+
+func NewRefreshTokenStore(cfg *config.Config, client *redis.Client) (*RefreshTokenStore, error) {
+	if client == nil {
+		return nil, errors.New("redis client is nil")
+	}
+
+	return &RefreshTokenStore{
+		client: client,
+		cfg:    cfg,
+		mapper: &cache.RefreshTokenMapper{},
+	}, nil
+}
@@ -0,0 +1,155 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/token"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+)
+
+func newTestRefreshToken(t *testing.T) (*domain.RefreshToken, string) {
+	t.Helper()
+
+	token, raw, err := domain.NewRefreshToken(uuid.New(), uuid.New(), "", []string{"openid"}, time.Now().UTC(), uuid.Nil, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+
+	return token, raw
+}
+
+func TestRefreshTokenStoreSaveAndGet(t *testing.T) {
+	client, _ := newTestClient(t)
+	store, err := NewRefreshTokenStore(newTestConfig(), client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	token, raw := newTestRefreshToken(t)
+	if err := store.Save(t.Context(), token); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr error
+	}{
+		{name: "stored token", hash: domain.HashRefreshToken(raw)},
+		{name: "raw value isn't a key", hash: raw, wantErr: consts.ErrTokenDoesntExist},
+		{name: "unknown token", hash: domain.HashRefreshToken("unknown"), wantErr: consts.ErrTokenDoesntExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.GetByHash(t.Context(), tt.hash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.UserID() != token.UserID() || got.FamilyID() != token.FamilyID() {
+				t.Fatal("stored token differs")
+			}
+		})
+	}
+}
+
+func TestRefreshTokenStoreMarkUsed(t *testing.T) {
+	client, mr := newTestClient(t)
+	store, err := NewRefreshTokenStore(newTestConfig(), client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	token, _ := newTestRefreshToken(t)
+	other, _ := newTestRefreshToken(t)
+
+	steps := []struct {
+		name      string
+		token     *domain.RefreshToken
+		wantFirst bool
+	}{
+		{name: "first use", token: token, wantFirst: true},
+		{name: "reuse is detected", token: token, wantFirst: false},
+		{name: "other token isn't affected", token: other, wantFirst: true},
+	}
+
+	for _, step := range steps {
+		first, err := store.MarkUsed(t.Context(), step.token)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if first != step.wantFirst {
+			t.Fatalf("%s: got %v, want %v", step.name, first, step.wantFirst)
+		}
+	}
+
+	// The marker must outlive no token it guards
+	if ttl := mr.TTL(store.usedKey(token.Hash())); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("unexpected marker ttl: %v", ttl)
+	}
+}
+
+func TestRefreshTokenStoreRevokeFamily(t *testing.T) {
+	client, mr := newTestClient(t)
+	cfg := newTestConfig()
+	store, err := NewRefreshTokenStore(cfg, client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	revoked, kept := uuid.New(), uuid.New()
+	if err := store.RevokeFamily(t.Context(), revoked); err != nil {
+		t.Fatalf("failed to revoke: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		familyID uuid.UUID
+		want     bool
+	}{
+		{name: "revoked family", familyID: revoked, want: true},
+		{name: "other family", familyID: kept, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.IsFamilyRevoked(t.Context(), tt.familyID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// No token of the family outlives refresh ttl
+	mr.FastForward(cfg.Secrets.JWT.RefreshTTL)
+	if got, _ := store.IsFamilyRevoked(t.Context(), revoked); got {
+		t.Fatal("family marker outlived refresh ttl")
+	}
+}
+
+func TestRefreshTokenStoreCanceledContext(t *testing.T) {
+	client, _ := newTestClient(t)
+	store, err := NewRefreshTokenStore(newTestConfig(), client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	token, _ := newTestRefreshToken(t)
+	if _, err := store.MarkUsed(ctx, token); err == nil {
+		t.Fatal("expected an error for canceled context")
+	}
+}
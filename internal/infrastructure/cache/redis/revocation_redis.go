@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+type RevocationList struct {
+	client *redis.Client
+	cfg    *config.Config
+}
+
+func (r *RevocationList) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if jti == "" {
+		return consts.ErrInvalidArgs
+	}
+
+	// There's no sense to keep the token after its expiration
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := r.client.Set(ctx, r.tokenKey(jti), 1, ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RevocationList) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	n, err := r.client.Exists(ctx, r.tokenKey(jti)).Result()
+	if err != nil {
+		if isContextErr(err) {
+			return false, consts.ErrContext
+		}
+
+		return false, fmt.Errorf("failed to check token: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *RevocationList) RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Refresh tokens live longer than access ones, so the watermark has to outlive all of them
+	ttl := max(r.cfg.Secrets.JWT.RefreshTTL, r.cfg.Secrets.JWT.TTL)
+
+	if err := r.client.Set(ctx, r.userKey(userID), before.UTC().UnixMilli(), ttl).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to revoke user's tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RevocationList) UserRevokedBefore(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	ms, err := r.client.Get(ctx, r.userKey(userID)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		if isContextErr(err) {
+			return time.Time{}, consts.ErrContext
+		}
+
+		return time.Time{}, fmt.Errorf("failed to get user's revocation: %w", err)
+	}
+
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+func (r *RevocationList) tokenKey(jti string) string {
+	return fmt.Sprintf("revoked:jti:%s", jti)
+}
+
+func (r *RevocationList) userKey(userID uuid.UUID) string {
+	return fmt.Sprintf("revoked:user:%s", userID)
+}
+
+func NewRevocationList(cfg *config.Config, client *redis.Client) (*RevocationList, error) {
+	if client == nil {
+		return nil, errors.New("redis client is nil")
+	}
+
+	return &RevocationList{
+		client: client,
+		cfg:    cfg,
+	}, nil
+}
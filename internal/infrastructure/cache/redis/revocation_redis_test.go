@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevocationListWatermark(t *testing.T) {
+	client, mr := newTestClient(t)
+	cfg := newTestConfig()
+	list, err := NewRevocationList(cfg, client)
+	if err != nil {
+		t.Fatalf("failed to create revocation list: %v", err)
+	}
+
+	revoked, other := uuid.New(), uuid.New()
+	before := time.Now().UTC().Truncate(time.Millisecond)
+	if err := list.RevokeUser(t.Context(), revoked, before); err != nil {
+		t.Fatalf("failed to revoke user: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		want   time.Time
+	}{
+		{name: "revoked user", userID: revoked, want: before},
+		{name: "never revoked user", userID: other, want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := list.UserRevokedBefore(t.Context(), tt.userID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A later revocation moves the watermark
+	later := before.Add(time.Minute)
+	if err := list.RevokeUser(t.Context(), revoked, later); err != nil {
+		t.Fatalf("failed to revoke user: %v", err)
+	}
+	if got, _ := list.UserRevokedBefore(t.Context(), revoked); !got.Equal(later) {
+		t.Fatalf("watermark hasn't moved: got %v, want %v", got, later)
+	}
+
+	// The watermark must outlive every token issued before it
+	if ttl := mr.TTL(list.userKey(revoked)); ttl != cfg.Secrets.JWT.RefreshTTL {
+		t.Fatalf("got ttl %v, want %v", ttl, cfg.Secrets.JWT.RefreshTTL)
+	}
+}
+
+func TestRevocationListRevokeToken(t *testing.T) {
+	client, _ := newTestClient(t)
+	list, err := NewRevocationList(newTestConfig(), client)
+	if err != nil {
+		t.Fatalf("failed to create revocation list: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		jti       string
+		expiresAt time.Time
+		wantErr   bool
+		want      bool
+	}{
+		{name: "valid token", jti: "live", expiresAt: time.Now().Add(time.Hour), want: true},
+		{name: "expired token isn't kept", jti: "expired", expiresAt: time.Now().Add(-time.Hour), want: false},
+		{name: "empty jti", jti: "", expiresAt: time.Now().Add(time.Hour), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := list.RevokeToken(t.Context(), tt.jti, tt.expiresAt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got, err := list.IsTokenRevoked(t.Context(), tt.jti)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
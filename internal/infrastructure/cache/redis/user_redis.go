@@ -90,6 +90,29 @@ func (u *UserCache) get(ctx context.Context, key string) (*domain.User, error) {
 	return user, nil
 }
 
+func (u *UserCache) Delete(ctx context.Context, user *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if user == nil {
+		return consts.ErrEmptyUser
+	}
+
+	if err := u.client.Del(ctx,
+		u.userKey(u.userKey(user.ID())),
+		u.userKey(u.userKey(user.Email())),
+	).Err(); err != nil {
+		if isContextErr(err) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to delete from cache: %w", err)
+	}
+
+	return nil
+}
+
 func (u *UserCache) userKey(key any) string {
 	return fmt.Sprintf("user:%s", key)
 }
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"encoding/json"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/token"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type RefreshTokenMapper struct {
+}
+
+func (r *RefreshTokenMapper) ToModel(token *domain.RefreshToken) (*RefreshTokenModel, error) {
+	if token == nil {
+		return nil, consts.ErrNilToken
+	}
+
+	return &RefreshTokenModel{
+		Hash:      token.Hash(),
+		UserID:    token.UserID(),
+		FamilyID:  token.FamilyID(),
+		ClientID:  token.ClientID(),
+		Scopes:    token.Scopes(),
+		AuthTime:  token.AuthTime(),
+		OrgID:     token.OrgID(),
+		IssuedAt:  token.IssuedAt(),
+		ExpiresAt: token.ExpiresAt(),
+	}, nil
+}
+
+func (r *RefreshTokenMapper) ToDomain(data []byte) (*domain.RefreshToken, error) {
+	var result RefreshTokenModel
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return domain.FromPersistence(
+		result.Hash,
+		result.UserID,
+		result.FamilyID,
+		result.ClientID,
+		result.Scopes,
+		result.AuthTime,
+		result.OrgID,
+		result.IssuedAt,
+		result.ExpiresAt,
+	), nil
+}
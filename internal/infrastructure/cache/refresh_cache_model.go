@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefreshTokenModel struct {
+	Hash      string    `json:"hash"`
+	UserID    uuid.UUID `json:"user_id"`
+	FamilyID  uuid.UUID `json:"family_id"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	AuthTime  time.Time `json:"auth_time"`
+	OrgID     uuid.UUID `json:"org_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -22,7 +22,11 @@ func (c *CacheMapper) ToModel(user *domain.User) (*UserModel, error) {
 		Name:        user.Name(),
 		Surname:     user.Surname(),
 		IsRecruiter: user.IsRecruiter(),
+		Roles:       user.Roles(),
 		Password:    user.Password(),
+
+		EmailVerified: user.IsEmailVerified(),
+		Version:       user.Version(),
 	}, nil
 }
 
@@ -43,6 +47,9 @@ func (c *CacheMapper) ToDomain(data []byte) (*domain.User, error) {
 		result.Name,
 		result.Surname,
 		result.Password,
+		result.Roles,
 		result.IsRecruiter,
+		result.EmailVerified,
+		result.Version,
 	), nil
 }
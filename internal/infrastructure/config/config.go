@@ -2,13 +2,18 @@
 package config
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/goccy/go-yaml"
+	"github.com/google/uuid"
 )
 
 // TODO: add validator
@@ -25,9 +30,32 @@ type grpc struct {
 	Protocol string `yaml:"protocol" env-default:"tcp"`
 }
 
+type http struct {
+	Port string `yaml:"port" env-default:"8080"`
+	Host string `yaml:"host" env-default:"localhost"`
+}
+
+// clientIP tells how the address of the client is found behind proxies, lockouts n' rate limits are charged to it
+type clientIP struct {
+	// Header carries addresses of the client n' proxies, e.g. X-Forwarded-For
+	Header string `yaml:"header"`
+	// TrustedProxies are CIDRs of proxies in front of the service, the header is taken only from them
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
 type jwt struct {
-	TTL       time.Duration `yaml:"ttl" env-default:"24h"`
-	SecretKey string        `yaml:"key"`
+	// Issuer is the iss claim n' the base url of OpenID Connect endpoints
+	Issuer     string        `yaml:"issuer" env-default:"staffy"`
+	TTL        time.Duration `yaml:"ttl" env-default:"15m"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env-default:"720h"`
+	SecretKey  string        `yaml:"key"`
+	// Algorithm is one of HS256, RS256, ES256, EdDSA. Asymmetric ones require PrivateKeyPath
+	Algorithm      string `yaml:"algorithm" env-default:"HS256"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+	// KeyringPath is a manifest of rotated keys, it replaces Algorithm n' PrivateKeyPath
+	KeyringPath           string        `yaml:"keyring_path"`
+	KeyGracePeriod        time.Duration `yaml:"key_grace_period"`
+	KeyringReloadInterval time.Duration `yaml:"keyring_reload_interval"`
 }
 
 type postgres struct {
@@ -50,34 +78,221 @@ type clickhouse struct {
 	Addr     string `yaml:"addr"`
 }
 
+// mfa holds the key, which totp secrets are encrypted with in the db
+type mfa struct {
+	// Key is base64 of 32 random bytes
+	Key string `yaml:"key"`
+}
+
+type oauthClient struct {
+	ID     string `yaml:"id"`
+	Name   string `yaml:"name"`
+	Secret string `yaml:"secret"`
+	// RedirectURIs are compared with the requested one exactly
+	RedirectURIs []string `yaml:"redirect_uris"`
+	Scopes       []string `yaml:"scopes"`
+	// GrantTypes default to authorization_code n' refresh_token. Services use client_credentials.
+	GrantTypes []string `yaml:"grant_types"`
+}
+
+type oauth struct {
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"1m"`
+	// ServiceTokenTTL is the lifetime of tokens issued with the client_credentials grant
+	ServiceTokenTTL time.Duration `yaml:"service_token_ttl" env-default:"1h"`
+	// LoginURL n' ConsentURL are pages of the frontend, where /authorize redirects the user
+	LoginURL      string `yaml:"login_url"`
+	ConsentURL    string `yaml:"consent_url"`
+	SessionCookie string `yaml:"session_cookie" env-default:"staffy_token"`
+	// Clients are registered on start
+	Clients []oauthClient `yaml:"clients"`
+}
+
+type role struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Permissions []string `yaml:"permissions"`
+}
+
+type rbac struct {
+	// Roles are registered on start, applicant n' recruiter are required
+	Roles []role `yaml:"roles"`
+}
+
+type webauthn struct {
+	// RPID is the domain of the frontend, passkeys are bound to it
+	RPID   string `yaml:"rp_id"`
+	RPName string `yaml:"rp_name"`
+	// Origins are pages, which run ceremonies, e.g. http://localhost:3000
+	Origins []string `yaml:"origins"`
+	// CeremonyTTL is how long the challenge of a started registration or login is kept
+	CeremonyTTL time.Duration `yaml:"ceremony_ttl" env-default:"5m"`
+}
+
+type lockout struct {
+	// Threshold is the number of failed logins of one account, after which it's locked out
+	Threshold int64 `yaml:"threshold" env-default:"5"`
+	// IPThreshold is the same for one client ip, it's higher because of shared addresses
+	IPThreshold int64         `yaml:"ip_threshold" env-default:"50"`
+	BaseDelay   time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay    time.Duration `yaml:"max_delay" env-default:"1m"`
+	Duration    time.Duration `yaml:"duration" env-default:"15m"`
+	// Window is how long failures are remembered since the last one
+	Window time.Duration `yaml:"window" env-default:"1h"`
+}
+
+type limit struct {
+	// Requests are allowed within the sliding window, 0 turns the limit off
+	Requests int64         `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
+type methodLimit struct {
+	// Method limits all calls of the rpc together
+	Method limit `yaml:"method"`
+	IP     limit `yaml:"ip"`
+	// Email limits calls, which target the same email, e.g. Login or RequestPasswordReset
+	Email limit `yaml:"email"`
+}
+
+type rateLimit struct {
+	Enabled bool `yaml:"enabled"`
+	// Default is for rpcs, which aren't listed in Methods
+	Default methodLimit `yaml:"default"`
+	// Methods are keyed by full names of rpcs, e.g. /sso.SSO/Login
+	Methods map[string]methodLimit `yaml:"methods"`
+}
+
+type argon2 struct {
+	// Memory is in KiB
+	Memory      uint32 `yaml:"memory" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+}
+
+type password struct {
+	// Algorithm hashes new passwords: argon2id or bcrypt. Hashes of the other algorithm
+	// or with other parameters are upgraded on login
+	Algorithm  string `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int    `yaml:"bcrypt_cost" env-default:"12"`
+	Argon2     argon2 `yaml:"argon2"`
+	// MinLength is in characters
+	MinLength int `yaml:"min_length" env-default:"10"`
+	// MaxLength is in bytes, bcrypt ignores everything after 72
+	MaxLength int `yaml:"max_length" env-default:"64"`
+	// MinCharClasses is how many of lowercase, uppercase, digits n' symbols are required
+	MinCharClasses int `yaml:"min_char_classes" env-default:"2"`
+	// Workers is how many passwords are hashed at once, 0 is the number of cpus
+	Workers int `yaml:"workers"`
+	// QueueDepth is how many calls wait for a worker, the rest are rejected with Unavailable
+	QueueDepth int `yaml:"queue_depth" env-default:"64"`
+	// BreachedList is the sorted file of sha-1 hashes of leaked passwords (HASH:COUNT per line, like the HIBP dump),
+	// empty turns the check off
+	BreachedList string `yaml:"breached_list"`
+}
+
+type mail struct {
+	// Driver is stdout or file, both are for local development
+	Driver string `yaml:"driver" env-default:"stdout"`
+	// Dir is where the file driver saves messages
+	Dir  string `yaml:"dir"`
+	From string `yaml:"from"`
+}
+
+type account struct {
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env-default:"15m"`
+	// PasswordResetURL is the page of the frontend, which the reset token is appended to
+	PasswordResetURL string        `yaml:"password_reset_url"`
+	VerificationTTL  time.Duration `yaml:"verification_ttl" env-default:"24h"`
+	// VerificationURL is the page of the frontend, which the verification token is appended to
+	VerificationURL string        `yaml:"verification_url"`
+	EmailChangeTTL  time.Duration `yaml:"email_change_ttl" env-default:"1h"`
+	// EmailChangeURL is the page of the frontend, which the email change token is appended to
+	EmailChangeURL string        `yaml:"email_change_url"`
+	InvitationTTL  time.Duration `yaml:"invitation_ttl" env-default:"168h"`
+	// InvitationURL is the page of the frontend, which the organization invitation token is appended to
+	InvitationURL string        `yaml:"invitation_url"`
+	MagicLinkTTL  time.Duration `yaml:"magic_link_ttl" env-default:"15m"`
+	// MagicLinkURL is the page of the frontend, which the login token is appended to
+	MagicLinkURL string `yaml:"magic_link_url"`
+	// RecruiterApproval makes promotions to recruiter wait for one of RoleAdmins
+	RecruiterApproval bool `yaml:"recruiter_approval"`
+	// RoleAdmins are ids of users, who review role changes
+	RoleAdmins []string `yaml:"role_admins"`
+	// MFAIssuer is the account name prefix, which authenticator apps show
+	MFAIssuer string `yaml:"mfa_issuer" env-default:"Staffy"`
+	// MFAChallengeTTL is how long the second step of the login waits for the code
+	MFAChallengeTTL time.Duration `yaml:"mfa_challenge_ttl" env-default:"5m"`
+	// AntiEnumeration hides, which emails are registered: Login checks a dummy hash for unknown emails
+	// n' Register responds the same way, mailing the owner of the existing account instead of an error
+	AntiEnumeration bool `yaml:"anti_enumeration"`
+	// UnverifiedPolicy is what users with unverified email can do: allow, restrict (tokens don't carry the email) or block (no login)
+	UnverifiedPolicy string `yaml:"unverified_policy" env-default:"allow"`
+}
+
 type Config struct {
 	App    app `yaml:"app"`
 	Server struct {
 		GRPC      grpc          `yaml:"grpc"`
+		HTTP      http          `yaml:"http"`
 		RWTimeout time.Duration `yaml:"rw_timeout" env-default:"2s"`
+		ClientIP  clientIP      `yaml:"client_ip"`
 	} `yaml:"server"`
 	Secrets struct {
 		JWT        jwt        `yaml:"jwt"`
 		Postgres   postgres   `yaml:"postgres"`
 		Redis      redis      `yaml:"redis"`
 		Clickhouse clickhouse `yaml:"clickhouse"`
+		MFA        mfa        `yaml:"mfa"`
 	} `yaml:"secrets"`
+	OAuth   oauth   `yaml:"oauth"`
+	Mail    mail    `yaml:"mail"`
+	Account account `yaml:"account"`
+	RBAC    rbac    `yaml:"rbac"`
+	// WebAuthn is the relying party of passkeys
+	WebAuthn webauthn `yaml:"webauthn"`
+	// Password is how passwords are hashed
+	Password password `yaml:"password"`
+	// Lockout slows down password guessing
+	Lockout lockout `yaml:"lockout"`
+	// RateLimit limits calls of rpcs per method, client ip n' target email
+	RateLimit rateLimit `yaml:"rate_limit"`
 }
 
 // Validate implements validation of config fields (dsn, secret key)
 func (c *Config) Validate() error {
-	if c.Secrets.JWT.SecretKey == "" {
-		return errors.New("jwt secret key is empty")
+	switch c.Secrets.JWT.Algorithm {
+	case "", "HS256":
+		if c.Secrets.JWT.SecretKey == "" && c.Secrets.JWT.KeyringPath == "" {
+			return errors.New("jwt secret key is empty")
+		}
+	case "RS256", "ES256", "EdDSA":
+		if c.Secrets.JWT.PrivateKeyPath == "" && c.Secrets.JWT.KeyringPath == "" {
+			return errors.New("jwt private key path is empty")
+		}
+	default:
+		return fmt.Errorf("unsupported jwt algorithm: %s", c.Secrets.JWT.Algorithm)
 	}
 	// DSN is validated when gorm connecting to pg
 	if c.Secrets.Postgres.DSN == "" {
 		return errors.New("invalid postgres dsn")
 	}
 
+	if c.Secrets.JWT.Issuer == "" {
+		return errors.New("jwt issuer is empty")
+	}
+
 	if c.Secrets.JWT.TTL < time.Minute {
 		return errors.New("jwt ttl is too short")
 	}
 
+	if c.Secrets.JWT.KeyGracePeriod != 0 && c.Secrets.JWT.KeyGracePeriod < c.Secrets.JWT.TTL {
+		return errors.New("key grace period must be longer than jwt ttl")
+	}
+
+	if c.Secrets.JWT.RefreshTTL <= c.Secrets.JWT.TTL {
+		return errors.New("refresh ttl must be longer than jwt ttl")
+	}
+
 	if c.Secrets.Redis.Addr == "" {
 		return errors.New("invalid addr for redis")
 	}
@@ -86,6 +301,182 @@ func (c *Config) Validate() error {
 		return errors.New("redis ttl is too short")
 	}
 
+	if c.OAuth.CodeTTL <= 0 || c.OAuth.CodeTTL > 10*time.Minute {
+		return errors.New("oauth code ttl must be in (0, 10m]")
+	}
+
+	if c.OAuth.ServiceTokenTTL < time.Minute {
+		return errors.New("oauth service token ttl is too short")
+	}
+
+	if c.OAuth.LoginURL == "" || c.OAuth.ConsentURL == "" {
+		return errors.New("oauth login n' consent urls cannot be empty")
+	}
+
+	if c.Mail.From == "" {
+		return errors.New("mail sender address is empty")
+	}
+
+	if c.Account.PasswordResetTTL <= 0 || c.Account.PasswordResetTTL > time.Hour {
+		return errors.New("password reset ttl must be in (0, 1h]")
+	}
+
+	if c.Account.PasswordResetURL == "" {
+		return errors.New("password reset url cannot be empty")
+	}
+
+	if c.Account.VerificationTTL <= 0 {
+		return errors.New("verification ttl must be positive")
+	}
+
+	if c.Account.VerificationURL == "" {
+		return errors.New("verification url cannot be empty")
+	}
+
+	if c.Account.EmailChangeTTL <= 0 {
+		return errors.New("email change ttl must be positive")
+	}
+
+	if c.Account.EmailChangeURL == "" {
+		return errors.New("email change url cannot be empty")
+	}
+
+	if c.Account.InvitationTTL <= 0 {
+		return errors.New("invitation ttl must be positive")
+	}
+
+	if c.Account.InvitationURL == "" {
+		return errors.New("invitation url cannot be empty")
+	}
+
+	if c.Account.MagicLinkTTL <= 0 || c.Account.MagicLinkTTL > time.Hour {
+		return errors.New("magic link ttl must be in (0, 1h]")
+	}
+
+	if c.Account.MagicLinkURL == "" {
+		return errors.New("magic link url cannot be empty")
+	}
+
+	for _, admin := range c.Account.RoleAdmins {
+		if _, err := uuid.Parse(admin); err != nil {
+			return fmt.Errorf("invalid role admin id %q: %w", admin, err)
+		}
+	}
+
+	if c.Account.MFAIssuer == "" {
+		return errors.New("mfa issuer is empty")
+	}
+
+	if c.Account.MFAChallengeTTL <= 0 || c.Account.MFAChallengeTTL > 15*time.Minute {
+		return errors.New("mfa challenge ttl must be in (0, 15m]")
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(c.Secrets.MFA.Key); err != nil || len(key) != 32 {
+		return errors.New("mfa key must be base64 of 32 bytes")
+	}
+
+	switch c.Password.Algorithm {
+	case "argon2id":
+		// 19 MiB is the minimum of OWASP for argon2id
+		if c.Password.Argon2.Memory < 19*1024 || c.Password.Argon2.Iterations == 0 || c.Password.Argon2.Parallelism == 0 {
+			return errors.New("argon2 memory must be at least 19456 KiB, iterations n' parallelism must be positive")
+		}
+	case "bcrypt":
+		if c.Password.BcryptCost < 10 || c.Password.BcryptCost > 31 {
+			return errors.New("bcrypt cost must be in [10, 31]")
+		}
+	default:
+		return fmt.Errorf("unsupported password algorithm: %s", c.Password.Algorithm)
+	}
+
+	if c.Password.MinLength < 8 {
+		return errors.New("password min length must be at least 8")
+	}
+
+	if c.Password.MaxLength < c.Password.MinLength || c.Password.MaxLength > 72 {
+		return errors.New("password max length must be in [min length, 72]")
+	}
+
+	if c.Password.MinCharClasses < 0 || c.Password.MinCharClasses > 4 {
+		return errors.New("password min char classes must be in [0, 4]")
+	}
+
+	if c.Password.Workers < 0 || c.Password.QueueDepth <= 0 {
+		return errors.New("password workers must not be negative n' queue depth must be positive")
+	}
+
+	if c.Lockout.Threshold <= 0 || c.Lockout.IPThreshold < c.Lockout.Threshold {
+		return errors.New("lockout threshold must be positive n' not greater than ip threshold")
+	}
+
+	if c.Lockout.BaseDelay <= 0 || c.Lockout.MaxDelay < c.Lockout.BaseDelay ||
+		c.Lockout.Duration < c.Lockout.MaxDelay {
+		return errors.New("lockout delays must be positive n' grow: base delay <= max delay <= duration")
+	}
+
+	if c.Lockout.Window <= c.Lockout.Duration {
+		return errors.New("lockout window must be longer than lockout duration")
+	}
+
+	for _, cidr := range c.Server.ClientIP.TrustedProxies {
+		if _, err := netip.ParsePrefix(strings.TrimSpace(cidr)); err != nil {
+			return fmt.Errorf("trusted proxy must be a cidr: %s", cidr)
+		}
+	}
+
+	if err := c.RateLimit.Default.validate(); err != nil {
+		return fmt.Errorf("invalid default rate limit: %w", err)
+	}
+
+	for method, limits := range c.RateLimit.Methods {
+		if !strings.HasPrefix(method, "/") {
+			return fmt.Errorf("rate limit method must be a full name of rpc: %s", method)
+		}
+		if err := limits.validate(); err != nil {
+			return fmt.Errorf("invalid rate limit of %s: %w", method, err)
+		}
+	}
+
+	if c.Account.RecruiterApproval && len(c.Account.RoleAdmins) == 0 {
+		return errors.New("recruiter approval requires at least one role admin")
+	}
+
+	roles := make(map[string]bool, len(c.RBAC.Roles))
+	for _, r := range c.RBAC.Roles {
+		if roles[r.Name] {
+			return fmt.Errorf("duplicated role: %s", r.Name)
+		}
+		roles[r.Name] = true
+	}
+
+	if !roles["applicant"] || !roles["recruiter"] {
+		return errors.New("applicant n' recruiter roles are required")
+	}
+
+	switch c.Account.UnverifiedPolicy {
+	case "allow", "restrict", "block":
+	default:
+		return fmt.Errorf("unsupported unverified policy: %s", c.Account.UnverifiedPolicy)
+	}
+
+	if c.WebAuthn.RPID == "" || c.WebAuthn.RPName == "" || len(c.WebAuthn.Origins) == 0 {
+		return errors.New("webauthn rp id, name n' origins cannot be empty")
+	}
+
+	if c.WebAuthn.CeremonyTTL <= 0 || c.WebAuthn.CeremonyTTL > 10*time.Minute {
+		return errors.New("webauthn ceremony ttl must be in (0, 10m]")
+	}
+
+	return nil
+}
+
+func (m methodLimit) validate() error {
+	for _, l := range []limit{m.Method, m.IP, m.Email} {
+		if l.Requests < 0 || (l.Requests > 0 && l.Window <= 0) {
+			return errors.New("requests must not be negative n' window must be positive")
+		}
+	}
+
 	return nil
 }
 
@@ -102,6 +493,10 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := applyDefaults(reflect.ValueOf(&cfg)); err != nil {
+		return nil, fmt.Errorf("failed to apply defaults: %w", err)
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
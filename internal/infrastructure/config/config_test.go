@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// minimalConfig sets only fields without defaults, the rest is left to env-default tags
+const minimalConfig = `
+server:
+  rw_timeout: 5s
+secrets:
+  jwt:
+    key: test-secret-key-of-32-characters
+  postgres:
+    dsn: host=localhost
+  redis:
+    addr: localhost:6379
+    ttl: 1m
+  mfa:
+    key: a2tra2tra2tra2tra2tra2tra2tra2tra2tra2tra2s=
+oauth:
+  login_url: https://staffy.test/login
+  consent_url: https://staffy.test/consent
+mail:
+  from: sso@staffy.test
+account:
+  password_reset_url: https://staffy.test/reset
+  verification_url: https://staffy.test/verify
+  email_change_url: https://staffy.test/email
+  invitation_url: https://staffy.test/invite
+  magic_link_url: https://staffy.test/magic
+rbac:
+  roles:
+    - name: applicant
+    - name: recruiter
+webauthn:
+  rp_id: localhost
+  rp_name: Staffy
+  origins: [https://localhost]
+password:
+  min_length: 12
+`
+
+func TestLoadAppliesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(minimalConfig), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "value of the config is kept", got: cfg.Server.RWTimeout, want: 5 * time.Second},
+		{name: "int of the config is kept", got: cfg.Password.MinLength, want: 12},
+		{name: "string", got: cfg.Secrets.JWT.Algorithm, want: "HS256"},
+		{name: "duration", got: cfg.Secrets.JWT.TTL, want: 15 * time.Minute},
+		{name: "int", got: cfg.Password.MaxLength, want: 64},
+		{name: "int64", got: cfg.Lockout.IPThreshold, want: int64(50)},
+		{name: "uint32", got: cfg.Password.Argon2.Memory, want: uint32(65536)},
+		{name: "uint8", got: cfg.Password.Argon2.Parallelism, want: uint8(2)},
+		{name: "nested struct", got: cfg.Server.GRPC.Port, want: "50051"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Fatalf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	type item struct {
+		Name string `env-default:"item"`
+	}
+	type nested struct {
+		Items []item
+		Ptr   *item
+		Nil   *item
+	}
+
+	v := struct {
+		Nested nested
+		Ratio  float64 `env-default:"0.5"`
+		On     bool    `env-default:"true"`
+	}{
+		Nested: nested{
+			Items: []item{{}, {Name: "kept"}},
+			Ptr:   &item{},
+		},
+	}
+
+	if err := applyDefaults(reflect.ValueOf(&v)); err != nil {
+		t.Fatalf("failed to apply defaults: %v", err)
+	}
+
+	if v.Nested.Items[0].Name != "item" || v.Nested.Items[1].Name != "kept" {
+		t.Fatalf("got items %+v", v.Nested.Items)
+	}
+	if v.Nested.Ptr.Name != "item" || v.Nested.Nil != nil {
+		t.Fatalf("got pointers %+v n' %+v", v.Nested.Ptr, v.Nested.Nil)
+	}
+	if v.Ratio != 0.5 || !v.On {
+		t.Fatalf("got %v n' %v", v.Ratio, v.On)
+	}
+}
+
+func TestApplyDefaultsRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{name: "not a number", v: &struct {
+			N int `env-default:"five"`
+		}{}},
+		{name: "overflow", v: &struct {
+			N uint8 `env-default:"256"`
+		}{}},
+		{name: "not a duration", v: &struct {
+			D time.Duration `env-default:"5"`
+		}{}},
+		{name: "unsupported type", v: &struct {
+			S []string `env-default:"a,b"`
+		}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := applyDefaults(reflect.ValueOf(tt.v)); err == nil {
+				t.Fatal("invalid default is accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const defaultTag = "env-default"
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// applyDefaults sets values of env-default tags to zero fields. The yaml loader doesn't know the tag, so fields,
+// which the config leaves out, are filled here. A zero written in the config can't be told from a missing one,
+// it gets the default too.
+func applyDefaults(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return applyDefaults(v.Elem())
+	case reflect.Slice:
+		for i := range v.Len() {
+			if err := applyDefaults(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+	default:
+		return nil
+	}
+
+	for i := range v.NumField() {
+		field, value := v.Type().Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		def, ok := field.Tag.Lookup(defaultTag)
+		if !ok {
+			if err := applyDefaults(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !value.IsZero() {
+			continue
+		}
+
+		if err := setDefault(value, def); err != nil {
+			return fmt.Errorf("invalid default of %s: %w", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// setDefault parses the default by the kind of the field, durations are written like 15m
+func setDefault(value reflect.Value, def string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(def)
+		if err != nil {
+			return err
+		}
+
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(def)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(def)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(def, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(def, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(def, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/mail"
+	"github.com/google/uuid"
+)
+
+// FileSender saves every message as .eml file in the directory, it's for local development
+type FileSender struct {
+	from string
+	dir  string
+}
+
+func (s *FileSender) Send(ctx context.Context, msg *domain.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The recipient is put into the name, so messages of the user are easy to find
+	name := fmt.Sprintf("%s-%s-%s.eml",
+		time.Now().UTC().Format("20060102T150405"),
+		strings.NewReplacer("/", "_", "\\", "_").Replace(msg.To),
+		uuid.NewString()[:8],
+	)
+
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create message file: %w", err)
+	}
+
+	if err := writeMessage(f, s.from, msg); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return f.Close()
+}
+
+func NewFileSender(from, dir string) (*FileSender, error) {
+	if dir == "" {
+		return nil, errors.New("mail dir is empty")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail dir: %w", err)
+	}
+
+	return &FileSender{
+		from: from,
+		dir:  dir,
+	}, nil
+}
@@ -0,0 +1,48 @@
+// Package mail implements senders of emails
+package mail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/mail"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+const (
+	DriverStdout = "stdout"
+	DriverFile   = "file"
+)
+
+// NewSender returns the sender, which is set in the config
+func NewSender(cfg *config.Config) (domain.Sender, error) {
+	if cfg == nil {
+		return nil, consts.ErrNilCfg
+	}
+
+	switch cfg.Mail.Driver {
+	case DriverStdout:
+		return NewWriterSender(cfg.Mail.From, os.Stdout), nil
+	case DriverFile:
+		return NewFileSender(cfg.Mail.From, cfg.Mail.Dir)
+	default:
+		return nil, fmt.Errorf("unsupported mail driver: %s", cfg.Mail.Driver)
+	}
+}
+
+// writeMessage writes the message in RFC 5322 format, so it can be opened by mail clients
+func writeMessage(w io.Writer, from string, msg *domain.Message) error {
+	_, err := fmt.Fprintf(w,
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		from,
+		msg.To,
+		msg.Subject,
+		time.Now().UTC().Format(time.RFC1123Z),
+		msg.Body,
+	)
+
+	return err
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/mail"
+)
+
+// WriterSender prints messages instead of sending them, it's for local development
+type WriterSender struct {
+	mu   sync.Mutex
+	from string
+	w    io.Writer
+}
+
+func (s *WriterSender) Send(ctx context.Context, msg *domain.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeMessage(s.w, s.from, msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
+
+func NewWriterSender(from string, w io.Writer) *WriterSender {
+	return &WriterSender{
+		from: from,
+		w:    w,
+	}
+}
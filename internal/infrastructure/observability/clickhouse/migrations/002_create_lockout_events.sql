@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS lockout_events (
+    timestamp DateTime64(3) DEFAULT now64(),
+    scope LowCardinality(String),
+    subject String,
+    failures Int64,
+    locked_until DateTime64(3),
+
+    INDEX idx_subject subject TYPE bloom_filter GRANULARITY 1
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (timestamp, scope, subject)
+TTL timestamp + INTERVAL 90 DAY;
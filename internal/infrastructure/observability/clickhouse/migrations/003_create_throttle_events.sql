@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS throttle_events (
+    timestamp DateTime64(3) DEFAULT now64(),
+    method String,
+    dimension LowCardinality(String),
+    subject String,
+    retry_after Int64,
+
+    INDEX idx_method method TYPE bloom_filter GRANULARITY 1,
+    INDEX idx_subject subject TYPE bloom_filter GRANULARITY 1
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (timestamp, method, dimension)
+TTL timestamp + INTERVAL 30 DAY;
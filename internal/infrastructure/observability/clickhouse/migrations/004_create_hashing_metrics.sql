@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS hashing_metrics (
+    timestamp DateTime64(3) DEFAULT now64(),
+    operation LowCardinality(String),
+    queue_wait Int64,
+    duration Int64,
+    outcome LowCardinality(String),
+
+    INDEX idx_outcome outcome TYPE set(0) GRANULARITY 1
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (timestamp, operation, outcome)
+TTL timestamp + INTERVAL 30 DAY;
@@ -41,6 +41,87 @@ func (u *UserCH) SavePerformanceLog(ctx context.Context, log *observability.Perf
 	}
 }
 
+func (u *UserCH) SaveLockoutEvent(ctx context.Context, event *observability.LockoutEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			u.log.Warn("panic in lockout event",
+				slog.Any("panic", r),
+				slog.String("scope", event.Scope))
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		u.log.Debug("context error", slog.String("error", err.Error()))
+		return
+	}
+
+	err := u.conn.Exec(ctx, `INSERT INTO lockout_events (
+			scope,
+			subject,
+			failures,
+			locked_until
+		) VALUES (?, ?, ?, ?)`, event.Scope, event.Subject, event.Failures, event.LockedUntil)
+
+	if err != nil {
+		u.log.Error("failed to insert event to lockout_events", slog.String("error", err.Error()),
+			slog.String("scope", event.Scope))
+	}
+}
+
+func (u *UserCH) SaveThrottleEvent(ctx context.Context, event *observability.ThrottleEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			u.log.Warn("panic in throttle event",
+				slog.Any("panic", r),
+				slog.String("method", event.Method))
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		u.log.Debug("context error", slog.String("error", err.Error()))
+		return
+	}
+
+	err := u.conn.Exec(ctx, `INSERT INTO throttle_events (
+			method,
+			dimension,
+			subject,
+			retry_after
+		) VALUES (?, ?, ?, ?)`, event.Method, event.Dimension, event.Subject, int64(event.RetryAfter))
+
+	if err != nil {
+		u.log.Error("failed to insert event to throttle_events", slog.String("error", err.Error()),
+			slog.String("method", event.Method))
+	}
+}
+
+func (u *UserCH) SaveHashingMetric(ctx context.Context, metric *observability.HashingMetric) {
+	defer func() {
+		if r := recover(); r != nil {
+			u.log.Warn("panic in hashing metric",
+				slog.Any("panic", r),
+				slog.String("operation", metric.Operation))
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		u.log.Debug("context error", slog.String("error", err.Error()))
+		return
+	}
+
+	err := u.conn.Exec(ctx, `INSERT INTO hashing_metrics (
+			operation,
+			queue_wait,
+			duration,
+			outcome
+		) VALUES (?, ?, ?, ?)`, metric.Operation, int64(metric.QueueWait), int64(metric.Duration), metric.Outcome)
+
+	if err != nil {
+		u.log.Error("failed to insert metric to hashing_metrics", slog.String("error", err.Error()),
+			slog.String("operation", metric.Operation))
+	}
+}
+
 func NewUserCH(log *slog.Logger, conn driver.Conn) (*UserCH, error) {
 	if conn == nil || log == nil {
 		return nil, consts.ErrInvalidArgs
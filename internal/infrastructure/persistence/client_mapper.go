@@ -0,0 +1,35 @@
+package persistence
+
+import (
+	domain "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type ClientMapper struct {
+}
+
+func (c *ClientMapper) ToModel(client *domain.Client) (*ClientModel, error) {
+	if client == nil {
+		return nil, consts.ErrEmptyClient
+	}
+
+	return &ClientModel{
+		ID:           client.ID(),
+		Name:         client.Name(),
+		SecretHash:   client.SecretHash(),
+		RedirectURIs: client.RedirectURIs(),
+		Scopes:       client.Scopes(),
+		GrantTypes:   client.GrantTypes(),
+	}, nil
+}
+
+func (c *ClientMapper) ToDomain(client *ClientModel) (*domain.Client, error) {
+	if client == nil {
+		return nil, consts.ErrEmptyClient
+	}
+
+	return domain.ClientFromPersistence(
+		client.ID, client.Name, client.SecretHash,
+		client.RedirectURIs, client.Scopes, client.GrantTypes,
+	), nil
+}
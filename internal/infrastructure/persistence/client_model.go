@@ -0,0 +1,14 @@
+package persistence
+
+type ClientModel struct {
+	ID           string `gorm:"primarykey"`
+	Name         string `gorm:"not null"`
+	SecretHash   string
+	RedirectURIs []string `gorm:"serializer:json"`
+	Scopes       []string `gorm:"serializer:json"`
+	GrantTypes   []string `gorm:"serializer:json"`
+}
+
+func (ClientModel) TableName() string {
+	return "oauth_clients"
+}
@@ -0,0 +1,33 @@
+package persistence
+
+import (
+	domain "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type ConsentMapper struct {
+}
+
+func (c *ConsentMapper) ToModel(consent *domain.Consent) (*ConsentModel, error) {
+	if consent == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &ConsentModel{
+		UserID:    consent.UserID(),
+		ClientID:  consent.ClientID(),
+		Scopes:    consent.Scopes(),
+		GrantedAt: consent.GrantedAt(),
+	}, nil
+}
+
+func (c *ConsentMapper) ToDomain(consent *ConsentModel) (*domain.Consent, error) {
+	if consent == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return domain.ConsentFromPersistence(
+		consent.UserID, consent.ClientID,
+		consent.Scopes, consent.GrantedAt,
+	), nil
+}
@@ -0,0 +1,18 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ConsentModel struct {
+	UserID    uuid.UUID `gorm:"primarykey"`
+	ClientID  string    `gorm:"primarykey"`
+	Scopes    []string  `gorm:"serializer:json"`
+	GrantedAt time.Time `gorm:"not null"`
+}
+
+func (ConsentModel) TableName() string {
+	return "oauth_consents"
+}
@@ -0,0 +1,136 @@
+// Package file implements storages, which are read from local files
+package file
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxLineLen is more than enough for HASH:COUNT lines of the HIBP dump
+const maxLineLen = 256
+
+// BreachedList looks up sha-1 hashes of passwords in a file of HIBP format: one HASH:COUNT per line,
+// sorted by the hash. Lines may keep only a prefix of the hash, the prefix of the same length is compared.
+// The file isn't loaded in memory, it's binary searched, so dumps of any size fit
+type BreachedList struct {
+	file *os.File
+	size int64
+}
+
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// lo is always the start of a line, the line of the target starts in [lo, hi)
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		start := lo
+		if mid := lo + (hi-lo)/2; mid > lo {
+			next, err := b.nextLineStart(mid)
+			if err != nil {
+				return false, err
+			}
+			if next < hi {
+				start = next
+			}
+		}
+
+		key, end, err := b.readKey(start)
+		if err != nil {
+			return false, err
+		}
+
+		cmp := compareKey(key, target)
+		switch {
+		case cmp == 0:
+			return true, nil
+		case cmp < 0:
+			lo = end
+		case start == lo:
+			return false, nil
+		default:
+			hi = start
+		}
+	}
+
+	return false, nil
+}
+
+// nextLineStart returns the offset after the first line break at or after offset-1
+func (b *BreachedList) nextLineStart(offset int64) (int64, error) {
+	buf := make([]byte, maxLineLen)
+	n, err := b.file.ReadAt(buf, offset-1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("failed to read breached list: %w", err)
+	}
+
+	i := bytes.IndexByte(buf[:n], '\n')
+	if i < 0 {
+		return b.size, nil
+	}
+
+	return offset + int64(i), nil
+}
+
+// readKey returns the hash of the line at the offset n' the offset of the next line
+func (b *BreachedList) readKey(offset int64) (string, int64, error) {
+	buf := make([]byte, maxLineLen)
+	n, err := b.file.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", 0, fmt.Errorf("failed to read breached list: %w", err)
+	}
+
+	line := buf[:n]
+	end := offset + int64(n)
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+		end = offset + int64(i) + 1
+	} else if offset+int64(n) < b.size {
+		return "", 0, errors.New("line of breached list is too long")
+	}
+
+	key, _, _ := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+	return strings.ToUpper(string(key)), end, nil
+}
+
+// compareKey compares the key with the prefix of the target of the same length
+func compareKey(key, target string) int {
+	// Blank lines are skipped
+	if key == "" {
+		return -1
+	}
+
+	if len(key) < len(target) {
+		target = target[:len(key)]
+	}
+
+	return strings.Compare(key, target)
+}
+
+func (b *BreachedList) Close() error {
+	return b.file.Close()
+}
+
+func NewBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached list: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat breached list: %w", err)
+	}
+
+	return &BreachedList{
+		file: file,
+		size: info.Size(),
+	}, nil
+}
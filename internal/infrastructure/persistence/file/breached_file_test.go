@@ -0,0 +1,133 @@
+package file
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeList writes the lines sorted, like the HIBP dump, n' opens the list
+func writeList(t *testing.T, lines []string) *BreachedList {
+	t.Helper()
+
+	slices.Sort(lines)
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+
+	list, err := NewBreachedList(path)
+	if err != nil {
+		t.Fatalf("failed to open list: %v", err)
+	}
+	t.Cleanup(func() { list.Close() })
+
+	return list
+}
+
+func TestBreachedListContains(t *testing.T) {
+	tests := []struct {
+		name string
+		// line turns the hash into a line of the file
+		line func(hash string, i int) string
+	}{
+		{name: "full hashes", line: func(hash string, i int) string { return fmt.Sprintf("%s:%d", hash, i+1) }},
+		{name: "prefixes", line: func(hash string, i int) string { return fmt.Sprintf("%s:%d", hash[:20], i+1) }},
+		{name: "lowercase n' crlf", line: func(hash string, i int) string { return strings.ToLower(hash) + ":1\r" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make([]string, 0, 500)
+			for i := range 500 {
+				lines = append(lines, tt.line(sha1Hex(fmt.Sprintf("leaked-%d", i)), i))
+			}
+			list := writeList(t, lines)
+
+			for i := range 500 {
+				ok, err := list.Contains(fmt.Sprintf("leaked-%d", i))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !ok {
+					t.Fatalf("leaked-%d isn't found", i)
+				}
+
+				ok, err = list.Contains(fmt.Sprintf("safe-%d", i))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if ok {
+					t.Fatalf("safe-%d is found", i)
+				}
+			}
+		})
+	}
+}
+
+func TestBreachedListEdges(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  bool
+	}{
+		{name: "only line", lines: []string{sha1Hex("password") + ":3861493"}, want: true},
+		{name: "first line", lines: []string{sha1Hex("password") + ":1", "FFFFFFFFFF:1"}, want: true},
+		{name: "last line", lines: []string{"0000000000:1", sha1Hex("password") + ":1"}, want: true},
+		{name: "between lines", lines: []string{"0000000000:1", "FFFFFFFFFF:1"}, want: false},
+		{name: "blank lines", lines: []string{"", "", sha1Hex("password") + ":1"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := writeList(t, tt.lines).Contains("password")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.want {
+				t.Fatalf("got %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachedListEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+
+	list, err := NewBreachedList(path)
+	if err != nil {
+		t.Fatalf("failed to open list: %v", err)
+	}
+	defer list.Close()
+
+	if ok, err := list.Contains("password"); err != nil || ok {
+		t.Fatalf("got %v, %v, want false", ok, err)
+	}
+}
+
+func TestBreachedListTooLongLine(t *testing.T) {
+	list := writeList(t, []string{"0000000000:1", "8" + strings.Repeat("0", maxLineLen), "FFFFFFFFFF:1"})
+
+	if _, err := list.Contains("password"); err == nil {
+		t.Fatal("too long line isn't reported")
+	}
+}
+
+func TestNewBreachedListMissingFile(t *testing.T) {
+	if _, err := NewBreachedList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("missing file isn't reported")
+	}
+}
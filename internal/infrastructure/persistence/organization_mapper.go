@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	domain "github.com/devathh/staffy-sso/internal/domain/organization"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type OrganizationMapper struct {
+}
+
+func (o *OrganizationMapper) ToModel(organization *domain.Organization) (*OrganizationModel, error) {
+	if organization == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	members := make([]OrganizationMemberModel, 0, len(organization.Members()))
+	for _, member := range organization.Members() {
+		members = append(members, OrganizationMemberModel{
+			OrganizationID: organization.ID(),
+			UserID:         member.UserID(),
+			Role:           string(member.Role()),
+			JoinedAt:       member.JoinedAt(),
+		})
+	}
+
+	return &OrganizationModel{
+		ID:        organization.ID(),
+		Name:      organization.Name(),
+		CreatedAt: organization.CreatedAt(),
+		Members:   members,
+	}, nil
+}
+
+func (o *OrganizationMapper) ToDomain(organization *OrganizationModel) (*domain.Organization, error) {
+	if organization == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	members := make([]domain.Member, 0, len(organization.Members))
+	for _, member := range organization.Members {
+		members = append(members, domain.MemberFromPersistence(
+			member.UserID, domain.MemberRole(member.Role), member.JoinedAt,
+		))
+	}
+
+	return domain.OrganizationFromPersistence(
+		organization.ID, organization.Name,
+		organization.CreatedAt, members,
+	), nil
+}
+
+func (o *OrganizationMapper) InvitationToModel(invitation *domain.Invitation) (*InvitationModel, error) {
+	if invitation == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &InvitationModel{
+		Hash:           invitation.Hash(),
+		OrganizationID: invitation.OrganizationID(),
+		Email:          invitation.Email(),
+		Role:           string(invitation.Role()),
+		InvitedBy:      invitation.InvitedBy(),
+		CreatedAt:      invitation.CreatedAt(),
+		ExpiresAt:      invitation.ExpiresAt(),
+	}, nil
+}
+
+func (o *OrganizationMapper) InvitationToDomain(invitation *InvitationModel) (*domain.Invitation, error) {
+	if invitation == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return domain.InvitationFromPersistence(
+		invitation.Hash, invitation.OrganizationID,
+		invitation.Email, domain.MemberRole(invitation.Role),
+		invitation.InvitedBy, invitation.CreatedAt, invitation.ExpiresAt,
+	), nil
+}
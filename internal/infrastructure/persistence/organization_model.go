@@ -0,0 +1,45 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OrganizationModel struct {
+	ID        uuid.UUID                 `gorm:"primarykey"`
+	Name      string                    `gorm:"not null"`
+	CreatedAt time.Time                 `gorm:"not null"`
+	Members   []OrganizationMemberModel `gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE"`
+}
+
+func (OrganizationModel) TableName() string {
+	return "organizations"
+}
+
+// OrganizationMemberModel is dropped together with the user
+type OrganizationMemberModel struct {
+	OrganizationID uuid.UUID  `gorm:"primarykey"`
+	UserID         uuid.UUID  `gorm:"primarykey;index"`
+	User           *UserModel `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Role           string     `gorm:"not null"`
+	JoinedAt       time.Time  `gorm:"not null"`
+}
+
+func (OrganizationMemberModel) TableName() string {
+	return "organization_members"
+}
+
+type InvitationModel struct {
+	Hash           string    `gorm:"primarykey"`
+	OrganizationID uuid.UUID `gorm:"not null;index"`
+	Email          string    `gorm:"not null"`
+	Role           string    `gorm:"not null"`
+	InvitedBy      uuid.UUID `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"not null"`
+	ExpiresAt      time.Time `gorm:"not null"`
+}
+
+func (InvitationModel) TableName() string {
+	return "organization_invitations"
+}
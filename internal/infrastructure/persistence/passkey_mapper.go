@@ -0,0 +1,42 @@
+package persistence
+
+import (
+	domain "github.com/devathh/staffy-sso/internal/domain/passkey"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type PasskeyMapper struct {
+}
+
+func (p *PasskeyMapper) ToModel(passkey *domain.Passkey) (*PasskeyModel, error) {
+	if passkey == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &PasskeyModel{
+		ID:              passkey.ID(),
+		UserID:          passkey.UserID(),
+		PublicKey:       passkey.PublicKey(),
+		AttestationType: passkey.AttestationType(),
+		AAGUID:          passkey.AAGUID(),
+		SignCount:       passkey.SignCount(),
+		Transports:      passkey.Transports(),
+		BackupEligible:  passkey.IsBackupEligible(),
+		BackupState:     passkey.IsBackedUp(),
+		CreatedAt:       passkey.CreatedAt(),
+		LastUsedAt:      passkey.LastUsedAt(),
+	}, nil
+}
+
+func (p *PasskeyMapper) ToDomain(passkey *PasskeyModel) (*domain.Passkey, error) {
+	if passkey == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return domain.PasskeyFromPersistence(
+		passkey.ID, passkey.UserID, passkey.PublicKey,
+		passkey.AttestationType, passkey.AAGUID, passkey.SignCount,
+		passkey.Transports, passkey.BackupEligible, passkey.BackupState,
+		passkey.CreatedAt, passkey.LastUsedAt,
+	), nil
+}
@@ -0,0 +1,27 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PasskeyModel is dropped together with the user
+type PasskeyModel struct {
+	ID              []byte     `gorm:"primarykey"`
+	UserID          uuid.UUID  `gorm:"not null;index"`
+	User            *UserModel `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	PublicKey       []byte     `gorm:"not null"`
+	AttestationType string     `gorm:"not null"`
+	AAGUID          []byte     `gorm:"column:aaguid"`
+	SignCount       uint32     `gorm:"not null"`
+	Transports      []string   `gorm:"serializer:json"`
+	BackupEligible  bool       `gorm:"not null"`
+	BackupState     bool       `gorm:"not null"`
+	CreatedAt       time.Time  `gorm:"not null"`
+	LastUsedAt      time.Time  `gorm:"not null"`
+}
+
+func (PasskeyModel) TableName() string {
+	return "passkeys"
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type clientRepository struct {
+	db     *gorm.DB
+	mapper persistence.ClientMapper
+}
+
+func (cr *clientRepository) Save(ctx context.Context, client *domain.Client) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	clientModel, err := cr.mapper.ToModel(client)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	if err := cr.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(clientModel).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save client: %w", err)
+	}
+
+	return nil
+}
+
+func (cr *clientRepository) GetByID(ctx context.Context, id string) (*domain.Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var clientModel persistence.ClientModel
+	if err := cr.db.WithContext(ctx).First(&clientModel, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, consts.ErrClientDoesntExist
+		}
+
+		return nil, fmt.Errorf("failed to get client by id: %w", err)
+	}
+
+	client, err := cr.mapper.ToDomain(&clientModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+	}
+
+	return client, nil
+}
+
+func NewClientRepository(db *gorm.DB) (domain.ClientRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	return &clientRepository{
+		db:     db,
+		mapper: persistence.ClientMapper{},
+	}, nil
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/oauth"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type consentRepository struct {
+	db     *gorm.DB
+	mapper persistence.ConsentMapper
+}
+
+func (cr *consentRepository) Save(ctx context.Context, consent *domain.Consent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	consentModel, err := cr.mapper.ToModel(consent)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	if err := cr.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(consentModel).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save consent: %w", err)
+	}
+
+	return nil
+}
+
+func (cr *consentRepository) Get(ctx context.Context, userID uuid.UUID, clientID string) (*domain.Consent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var consentModel persistence.ConsentModel
+	if err := cr.db.WithContext(ctx).First(&consentModel, "user_id = ? AND client_id = ?", userID, clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, consts.ErrConsentDoesntExist
+		}
+
+		return nil, fmt.Errorf("failed to get consent: %w", err)
+	}
+
+	consent, err := cr.mapper.ToDomain(&consentModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+	}
+
+	return consent, nil
+}
+
+func NewConsentRepository(db *gorm.DB) (domain.ConsentRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	return &consentRepository{
+		db:     db,
+		mapper: persistence.ConsentMapper{},
+	}, nil
+}
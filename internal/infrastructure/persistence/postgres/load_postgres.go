@@ -47,5 +47,16 @@ func MustLoadDB(cfg *config.Config) *gorm.DB {
 }
 
 func SyncDB(db *gorm.DB) error {
-	return db.AutoMigrate(&persistence.UserModel{})
+	return db.AutoMigrate(
+		&persistence.UserModel{},
+		&persistence.ClientModel{},
+		&persistence.ConsentModel{},
+		&persistence.RoleChangeModel{},
+		&persistence.RoleModel{},
+		&persistence.OrganizationModel{},
+		&persistence.OrganizationMemberModel{},
+		&persistence.InvitationModel{},
+		&persistence.TOTPModel{},
+		&persistence.PasskeyModel{},
+	)
 }
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/organization"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type organizationRepository struct {
+	db     *gorm.DB
+	mapper persistence.OrganizationMapper
+}
+
+// Save writes the organization n' its members in one transaction
+func (or *organizationRepository) Save(ctx context.Context, organization *domain.Organization) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	organizationModel, err := or.mapper.ToModel(organization)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	err = or.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(organizationModel).Error; err != nil {
+			return err
+		}
+
+		if len(organizationModel.Members) == 0 {
+			return nil
+		}
+
+		return tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&organizationModel.Members).Error
+	})
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save organization: %w", err)
+	}
+
+	return nil
+}
+
+func (or *organizationRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var organizationModel persistence.OrganizationModel
+	if err := or.db.WithContext(ctx).Preload("Members").First(&organizationModel, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, consts.ErrOrganizationDoesntExist
+		}
+
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	organization, err := or.mapper.ToDomain(&organizationModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+	}
+
+	return organization, nil
+}
+
+func NewOrganizationRepository(db *gorm.DB) (domain.OrganizationRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	return &organizationRepository{
+		db:     db,
+		mapper: persistence.OrganizationMapper{},
+	}, nil
+}
+
+type invitationRepository struct {
+	db     *gorm.DB
+	mapper persistence.OrganizationMapper
+}
+
+func (ir *invitationRepository) Save(ctx context.Context, invitation *domain.Invitation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	invitationModel, err := ir.mapper.InvitationToModel(invitation)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	if err := ir.db.WithContext(ctx).Create(invitationModel).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	return nil
+}
+
+// Consume deletes the invitation n' returns the deleted row, so only one request gets it
+func (ir *invitationRepository) Consume(ctx context.Context, hash string) (*domain.Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var invitationModel persistence.InvitationModel
+	result := ir.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("hash = ?", hash).
+		Delete(&invitationModel)
+	if result.Error != nil {
+		if errors.Is(result.Error, context.DeadlineExceeded) ||
+			errors.Is(result.Error, context.Canceled) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to consume invitation: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, consts.ErrTokenDoesntExist
+	}
+
+	invitation, err := ir.mapper.InvitationToDomain(&invitationModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+	}
+
+	return invitation, nil
+}
+
+func NewInvitationRepository(db *gorm.DB) (domain.InvitationRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	return &invitationRepository{
+		db:     db,
+		mapper: persistence.OrganizationMapper{},
+	}, nil
+}
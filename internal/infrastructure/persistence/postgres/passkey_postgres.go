@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/passkey"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type passkeyRepository struct {
+	db     *gorm.DB
+	mapper persistence.PasskeyMapper
+}
+
+func (pr *passkeyRepository) Save(ctx context.Context, passkey *domain.Passkey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	passkeyModel, err := pr.mapper.ToModel(passkey)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	// The owner n' the key of the passkey never change, so another user can't take it over
+	if err := pr.db.WithContext(ctx).Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"sign_count", "backup_state", "last_used_at"}),
+		}).
+		Create(passkeyModel).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save passkey: %w", err)
+	}
+
+	return nil
+}
+
+func (pr *passkeyRepository) UpdateSignCount(ctx context.Context, passkey *domain.Passkey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	query := pr.db.WithContext(ctx).Model(&persistence.PasskeyModel{}).Where("id = ?", passkey.ID())
+	// Authenticators without a counter always send 0, there is nothing to compare then
+	if passkey.SignCount() != 0 {
+		query = query.Where("sign_count < ?", passkey.SignCount())
+	} else {
+		query = query.Where("sign_count = 0")
+	}
+
+	result := query.Updates(map[string]any{
+		"sign_count":   passkey.SignCount(),
+		"backup_state": passkey.IsBackedUp(),
+		"last_used_at": passkey.LastUsedAt(),
+	})
+	if result.Error != nil {
+		if errors.Is(result.Error, context.DeadlineExceeded) || errors.Is(result.Error, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to update passkey: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return consts.ErrInvalidPasskey
+	}
+
+	return nil
+}
+
+func (pr *passkeyRepository) GetByID(ctx context.Context, id []byte) (*domain.Passkey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var passkeyModel persistence.PasskeyModel
+	if err := pr.db.WithContext(ctx).First(&passkeyModel, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, consts.ErrPasskeyDoesntExist
+		}
+
+		return nil, fmt.Errorf("failed to get passkey: %w", err)
+	}
+
+	passkey, err := pr.mapper.ToDomain(&passkeyModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+	}
+
+	return passkey, nil
+}
+
+func (pr *passkeyRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.Passkey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var passkeyModels []persistence.PasskeyModel
+	if err := pr.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&passkeyModels).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	}
+
+	passkeys := make([]*domain.Passkey, 0, len(passkeyModels))
+	for i := range passkeyModels {
+		passkey, err := pr.mapper.ToDomain(&passkeyModels[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+		}
+		passkeys = append(passkeys, passkey)
+	}
+
+	return passkeys, nil
+}
+
+func NewPasskeyRepository(db *gorm.DB) (domain.PasskeyRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	return &passkeyRepository{
+		db:     db,
+		mapper: persistence.PasskeyMapper{},
+	}, nil
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	domain "github.com/devathh/staffy-sso/internal/domain/passkey"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+)
+
+func TestPasskeyRepositoryUpdateSignCount(t *testing.T) {
+	updateQuery := regexp.QuoteMeta(`UPDATE "passkeys" SET "backup_state"=$1,"last_used_at"=$2,"sign_count"=$3 WHERE id = $4 AND `)
+
+	tests := []struct {
+		name      string
+		signCount uint32
+		// condition is how the stored count is compared, rowsAffected is what the conditional update reports
+		condition     string
+		conditionArgs []driver.Value
+		rowsAffected  int64
+		wantErr       error
+	}{
+		{
+			name:          "count has grown",
+			signCount:     8,
+			condition:     `sign_count < $5`,
+			conditionArgs: []driver.Value{int64(8)},
+			rowsAffected:  1,
+		},
+		{
+			name:          "count is already raised by another login",
+			signCount:     8,
+			condition:     `sign_count < $5`,
+			conditionArgs: []driver.Value{int64(8)},
+			rowsAffected:  0,
+			wantErr:       consts.ErrInvalidPasskey,
+		},
+		{
+			name:         "authenticator without a counter",
+			signCount:    0,
+			condition:    `sign_count = 0`,
+			rowsAffected: 1,
+		},
+		{
+			name:         "authenticator has started counting",
+			signCount:    0,
+			condition:    `sign_count = 0`,
+			rowsAffected: 0,
+			wantErr:      consts.ErrInvalidPasskey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newTestDB(t)
+			repo, err := NewPasskeyRepository(db)
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			now := time.Now().UTC()
+			passkey := domain.PasskeyFromPersistence([]byte("credential"), uuid.New(), []byte("key"), "none", nil,
+				tt.signCount, nil, true, true, now, now)
+
+			args := append([]driver.Value{true, sqlmock.AnyArg(), int64(tt.signCount), []byte("credential")}, tt.conditionArgs...)
+
+			mock.ExpectBegin()
+			mock.ExpectExec(updateQuery + regexp.QuoteMeta(tt.condition)).
+				WithArgs(args...).
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+			mock.ExpectCommit()
+
+			if err := repo.UpdateSignCount(t.Context(), passkey); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
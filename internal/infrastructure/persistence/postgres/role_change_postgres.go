@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/role"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type roleChangeRepository struct {
+	db     *gorm.DB
+	mapper persistence.RoleChangeMapper
+}
+
+func (rr *roleChangeRepository) Save(ctx context.Context, change *domain.RoleChange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	changeModel, err := rr.mapper.ToModel(change)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	if err := rr.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(changeModel).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save role change: %w", err)
+	}
+
+	return nil
+}
+
+func (rr *roleChangeRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.RoleChange, error) {
+	return rr.get(ctx, "id = ?", id)
+}
+
+func (rr *roleChangeRepository) GetPending(ctx context.Context, userID uuid.UUID) (*domain.RoleChange, error) {
+	return rr.get(ctx, "user_id = ? AND status = ?", userID, string(domain.ChangePending))
+}
+
+func (rr *roleChangeRepository) get(ctx context.Context, query string, args ...any) (*domain.RoleChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var changeModel persistence.RoleChangeModel
+	if err := rr.db.WithContext(ctx).Where(query, args...).First(&changeModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, consts.ErrRoleChangeDoesntExist
+		}
+
+		return nil, fmt.Errorf("failed to get role change: %w", err)
+	}
+
+	change, err := rr.mapper.ToDomain(&changeModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+	}
+
+	return change, nil
+}
+
+func NewRoleChangeRepository(db *gorm.DB) (domain.RoleChangeRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	return &roleChangeRepository{
+		db:     db,
+		mapper: persistence.RoleChangeMapper{},
+	}, nil
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/role"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type roleRepository struct {
+	db     *gorm.DB
+	mapper persistence.RoleMapper
+}
+
+func (rr *roleRepository) Save(ctx context.Context, role *domain.Role) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	roleModel, err := rr.mapper.ToModel(role)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	if err := rr.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(roleModel).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save role: %w", err)
+	}
+
+	return nil
+}
+
+func (rr *roleRepository) GetByNames(ctx context.Context, names []string) ([]*domain.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var roleModels []persistence.RoleModel
+	if err := rr.db.WithContext(ctx).Where("name IN ?", names).Find(&roleModels).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return nil, consts.ErrContext
+		}
+
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	roles := make([]*domain.Role, 0, len(roleModels))
+	for i := range roleModels {
+		role, err := rr.mapper.ToDomain(&roleModels[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+func NewRoleRepository(db *gorm.DB) (domain.RoleRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	return &roleRepository{
+		db:     db,
+		mapper: persistence.RoleMapper{},
+	}, nil
+}
@@ -0,0 +1,222 @@
+package postgres
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/mfa"
+	"github.com/devathh/staffy-sso/internal/infrastructure/persistence"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// totpRepository keeps secrets encrypted, so a dump of the db doesn't give away second factors
+type totpRepository struct {
+	db     *gorm.DB
+	aead   cipher.AEAD
+	mapper persistence.TOTPMapper
+}
+
+func (tr *totpRepository) Save(ctx context.Context, totp *domain.TOTP) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	totpModel, err := tr.mapper.ToModel(totp)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	totpModel.Secret, err = tr.seal(totpModel.Secret, totpModel.UserID)
+	if err != nil {
+		return err
+	}
+
+	// The replaced enrollment gets a new version, so a stale update of it can't overwrite the new secret
+	if err := tr.db.WithContext(ctx).Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}},
+			DoUpdates: append(
+				clause.AssignmentColumns([]string{"secret", "confirmed", "recovery_codes", "last_step", "created_at"}),
+				clause.Assignment{Column: clause.Column{Name: "version"}, Value: gorm.Expr(`"user_totp"."version" + 1`)},
+			),
+		}).
+		Create(totpModel).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to save totp: %w", err)
+	}
+
+	return nil
+}
+
+func (tr *totpRepository) Update(ctx context.Context, totp *domain.TOTP) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	totpModel, err := tr.mapper.ToModel(totp)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	totpModel.Secret, err = tr.seal(totpModel.Secret, totpModel.UserID)
+	if err != nil {
+		return err
+	}
+
+	totpModel.Version = totp.Version() + 1
+
+	result := tr.db.WithContext(ctx).
+		Model(&persistence.TOTPModel{}).
+		Omit(clause.Associations).
+		Where("user_id = ? AND version = ?", totpModel.UserID, totp.Version()).
+		Select("*").
+		Updates(totpModel)
+	if result.Error != nil {
+		if errors.Is(result.Error, context.DeadlineExceeded) ||
+			errors.Is(result.Error, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to update totp: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return tr.missedUpdate(ctx, totpModel.UserID)
+	}
+
+	totp.IncrementVersion()
+	return nil
+}
+
+// missedUpdate tells the deleted totp from the one, which has been updated by someone else
+func (tr *totpRepository) missedUpdate(ctx context.Context, userID uuid.UUID) error {
+	var count int64
+	if err := tr.db.WithContext(ctx).Model(&persistence.TOTPModel{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to check totp: %w", err)
+	}
+
+	if count == 0 {
+		return consts.ErrMFANotEnrolled
+	}
+
+	return consts.ErrVersionConflict
+}
+
+func (tr *totpRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*domain.TOTP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var totpModel persistence.TOTPModel
+	if err := tr.db.WithContext(ctx).First(&totpModel, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, consts.ErrMFANotEnrolled
+		}
+
+		return nil, fmt.Errorf("failed to get totp: %w", err)
+	}
+
+	secret, err := tr.open(totpModel.Secret, totpModel.UserID)
+	if err != nil {
+		return nil, err
+	}
+	totpModel.Secret = secret
+
+	totp, err := tr.mapper.ToDomain(&totpModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert from model to domain: %w", err)
+	}
+
+	return totp, nil
+}
+
+func (tr *totpRepository) Delete(ctx context.Context, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := tr.db.WithContext(ctx).Delete(&persistence.TOTPModel{}, "user_id = ?", userID)
+	if result.Error != nil {
+		if errors.Is(result.Error, context.DeadlineExceeded) ||
+			errors.Is(result.Error, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to delete totp: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return consts.ErrMFANotEnrolled
+	}
+
+	return nil
+}
+
+// seal encrypts the secret n' binds it to the user, so it can't be moved to another row
+func (tr *totpRepository) seal(secret string, userID uuid.UUID) (string, error) {
+	nonce := make([]byte, tr.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := tr.aead.Seal(nonce, nonce, []byte(secret), userID[:])
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (tr *totpRepository) open(sealed string, userID uuid.UUID) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < tr.aead.NonceSize() {
+		return "", errors.New("totp secret is malformed")
+	}
+
+	nonce, ciphertext := raw[:tr.aead.NonceSize()], raw[tr.aead.NonceSize():]
+	secret, err := tr.aead.Open(nil, nonce, ciphertext, userID[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+
+	return string(secret), nil
+}
+
+// NewTOTPRepository takes the base64 key from the config
+func NewTOTPRepository(db *gorm.DB, key string) (domain.TOTPRepository, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be empty")
+	}
+
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mfa key: %w", err)
+	}
+
+	block, err := aes.NewCipher(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+
+	return &totpRepository{
+		db:     db,
+		aead:   aead,
+		mapper: persistence.TOTPMapper{},
+	}, nil
+}
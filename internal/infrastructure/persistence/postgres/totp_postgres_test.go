@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	domain "github.com/devathh/staffy-sso/internal/domain/mfa"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+)
+
+func TestTOTPRepositoryUpdateOptimisticLocking(t *testing.T) {
+	updateQuery := regexp.QuoteMeta(`UPDATE "user_totp" SET`) + `.*` + regexp.QuoteMeta(`WHERE user_id = $`) + `\d+` + regexp.QuoteMeta(` AND version = $`)
+	countQuery := regexp.QuoteMeta(`SELECT count(*) FROM "user_totp" WHERE user_id = $1`)
+
+	tests := []struct {
+		name string
+		// rowsAffected is what the conditional update reports, count is the number of enrollments of the user
+		rowsAffected int64
+		count        int64
+		wantErr      error
+		wantVersion  int64
+	}{
+		{name: "version matches", rowsAffected: 1, wantVersion: 4},
+		{name: "code used by a parallel login", rowsAffected: 0, count: 1, wantErr: consts.ErrVersionConflict, wantVersion: 3},
+		{name: "disabled in the meantime", rowsAffected: 0, count: 0, wantErr: consts.ErrMFANotEnrolled, wantVersion: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newTestDB(t)
+			repo, err := NewTOTPRepository(db, base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			totp := domain.TOTPFromPersistence(uuid.New(), "JBSWY3DPEHPK3PXP", true, nil, 100, 3, time.Now())
+
+			mock.ExpectBegin()
+			mock.ExpectExec(updateQuery).
+				WithArgs(totp.UserID(), sqlmock.AnyArg(), true, sqlmock.AnyArg(), int64(100), int64(4), sqlmock.AnyArg(),
+					totp.UserID(), int64(3)).
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+			mock.ExpectCommit()
+			if tt.rowsAffected == 0 {
+				mock.ExpectQuery(countQuery).
+					WithArgs(totp.UserID()).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+			}
+
+			err = repo.Update(t.Context(), totp)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if totp.Version() != tt.wantVersion {
+				t.Fatalf("got version %d, want %d", totp.Version(), tt.wantVersion)
+			}
+		})
+	}
+}
@@ -48,6 +48,67 @@ func (ur *userRepository) Save(ctx context.Context, user *domain.User) (uuid.UUI
 	return userModel.ID, nil
 }
 
+// Update overwrites all fields of the user, if it hasn't been updated since it was read.
+// The version of the user is bumped on success.
+func (ur *userRepository) Update(ctx context.Context, user *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if user == nil {
+		return consts.ErrEmptyUser
+	}
+
+	userModel, err := ur.mapper.ToModel(user)
+	if err != nil {
+		return fmt.Errorf("failed to convert from domain to model: %w", err)
+	}
+
+	userModel.Version = user.Version() + 1
+
+	result := ur.db.WithContext(ctx).
+		Model(&persistence.UserModel{}).
+		Where("id = ? AND version = ?", userModel.ID, user.Version()).
+		Select("*").
+		Updates(userModel)
+	if result.Error != nil {
+		if errors.Is(ur.pgDialector.Translate(result.Error), gorm.ErrDuplicatedKey) {
+			return consts.ErrUserAlreadyExists
+		}
+		if errors.Is(result.Error, context.DeadlineExceeded) ||
+			errors.Is(result.Error, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to update user: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ur.missedUpdate(ctx, user.ID())
+	}
+
+	user.IncrementVersion()
+	return nil
+}
+
+// missedUpdate tells whether the user was deleted or updated by someone else
+func (ur *userRepository) missedUpdate(ctx context.Context, id uuid.UUID) error {
+	var count int64
+	if err := ur.db.WithContext(ctx).Model(&persistence.UserModel{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return consts.ErrContext
+		}
+
+		return fmt.Errorf("failed to check user: %w", err)
+	}
+
+	if count == 0 {
+		return consts.ErrUserDoesntExist
+	}
+
+	return consts.ErrVersionConflict
+}
+
 func (ur *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	if err := ctx.Err(); err != nil {
 		return err
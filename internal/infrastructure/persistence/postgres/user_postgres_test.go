@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	domain "github.com/devathh/staffy-sso/internal/domain/user"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+)
+
+func TestUserRepositoryUpdateOptimisticLocking(t *testing.T) {
+	updateQuery := regexp.QuoteMeta(`UPDATE "user_models" SET`) + `.*` + regexp.QuoteMeta(`WHERE id = $`) + `\d+` + regexp.QuoteMeta(` AND version = $`)
+	countQuery := regexp.QuoteMeta(`SELECT count(*) FROM "user_models" WHERE id = $1`)
+
+	tests := []struct {
+		name string
+		// rowsAffected is what the conditional update reports, count is the number of users with the id
+		rowsAffected int64
+		count        int64
+		wantErr      error
+		wantVersion  int64
+	}{
+		{name: "version matches", rowsAffected: 1, wantVersion: 4},
+		{name: "updated by someone else", rowsAffected: 0, count: 1, wantErr: consts.ErrVersionConflict, wantVersion: 3},
+		{name: "deleted in the meantime", rowsAffected: 0, count: 0, wantErr: consts.ErrUserDoesntExist, wantVersion: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newTestDB(t)
+			repo, err := NewUserRepository(db)
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			email, _ := domain.NewEmail("user@example.com")
+			user := domain.FromPersistence(uuid.New(), email, "Test", "User", "hash", nil, false, true, 3)
+
+			mock.ExpectBegin()
+			mock.ExpectExec(updateQuery).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+					sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), int64(4), user.ID(), int64(3)).
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+			mock.ExpectCommit()
+			if tt.rowsAffected == 0 {
+				mock.ExpectQuery(countQuery).
+					WithArgs(user.ID()).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+			}
+
+			err = repo.Update(t.Context(), user)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if user.Version() != tt.wantVersion {
+				t.Fatalf("got version %d, want %d", user.Version(), tt.wantVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package persistence
+
+import (
+	"time"
+
+	domain "github.com/devathh/staffy-sso/internal/domain/role"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"github.com/google/uuid"
+)
+
+type RoleChangeMapper struct {
+}
+
+func (r *RoleChangeMapper) ToModel(change *domain.RoleChange) (*RoleChangeModel, error) {
+	if change == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	model := &RoleChangeModel{
+		ID:          change.ID(),
+		UserID:      change.UserID(),
+		ActorID:     change.ActorID(),
+		ToRecruiter: change.ToRecruiter(),
+		Status:      string(change.Status()),
+		CreatedAt:   change.CreatedAt(),
+	}
+
+	if reviewerID := change.ReviewerID(); reviewerID != uuid.Nil {
+		model.ReviewerID = &reviewerID
+	}
+	if decidedAt := change.DecidedAt(); !decidedAt.IsZero() {
+		model.DecidedAt = &decidedAt
+	}
+
+	return model, nil
+}
+
+func (r *RoleChangeMapper) ToDomain(change *RoleChangeModel) (*domain.RoleChange, error) {
+	if change == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	var reviewerID uuid.UUID
+	if change.ReviewerID != nil {
+		reviewerID = *change.ReviewerID
+	}
+
+	var decidedAt time.Time
+	if change.DecidedAt != nil {
+		decidedAt = *change.DecidedAt
+	}
+
+	return domain.RoleChangeFromPersistence(
+		change.ID, change.UserID, change.ActorID,
+		change.ToRecruiter, domain.ChangeStatus(change.Status),
+		reviewerID, change.CreatedAt, decidedAt,
+	), nil
+}
@@ -0,0 +1,23 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RoleChangeModel struct {
+	ID          uuid.UUID `gorm:"primarykey"`
+	UserID      uuid.UUID `gorm:"not null;index"`
+	ActorID     uuid.UUID `gorm:"not null"`
+	ToRecruiter bool
+	Status      string `gorm:"not null;index"`
+	// ReviewerID n' DecidedAt are empty, while the change is pending
+	ReviewerID *uuid.UUID
+	CreatedAt  time.Time `gorm:"not null"`
+	DecidedAt  *time.Time
+}
+
+func (RoleChangeModel) TableName() string {
+	return "role_changes"
+}
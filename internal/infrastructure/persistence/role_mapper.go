@@ -0,0 +1,29 @@
+package persistence
+
+import (
+	domain "github.com/devathh/staffy-sso/internal/domain/role"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type RoleMapper struct {
+}
+
+func (r *RoleMapper) ToModel(role *domain.Role) (*RoleModel, error) {
+	if role == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &RoleModel{
+		Name:        role.Name(),
+		Description: role.Description(),
+		Permissions: role.Permissions(),
+	}, nil
+}
+
+func (r *RoleMapper) ToDomain(role *RoleModel) (*domain.Role, error) {
+	if role == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return domain.RoleFromPersistence(role.Name, role.Description, role.Permissions), nil
+}
@@ -0,0 +1,11 @@
+package persistence
+
+type RoleModel struct {
+	Name        string `gorm:"primarykey"`
+	Description string
+	Permissions []string `gorm:"serializer:json"`
+}
+
+func (RoleModel) TableName() string {
+	return "roles"
+}
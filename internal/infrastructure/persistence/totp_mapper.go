@@ -0,0 +1,36 @@
+package persistence
+
+import (
+	domain "github.com/devathh/staffy-sso/internal/domain/mfa"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type TOTPMapper struct {
+}
+
+func (t *TOTPMapper) ToModel(totp *domain.TOTP) (*TOTPModel, error) {
+	if totp == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &TOTPModel{
+		UserID:        totp.UserID(),
+		Secret:        totp.Secret(),
+		Confirmed:     totp.IsConfirmed(),
+		RecoveryCodes: totp.RecoveryCodes(),
+		LastStep:      totp.LastStep(),
+		Version:       totp.Version(),
+		CreatedAt:     totp.CreatedAt(),
+	}, nil
+}
+
+func (t *TOTPMapper) ToDomain(totp *TOTPModel) (*domain.TOTP, error) {
+	if totp == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return domain.TOTPFromPersistence(
+		totp.UserID, totp.Secret, totp.Confirmed,
+		totp.RecoveryCodes, totp.LastStep, totp.Version, totp.CreatedAt,
+	), nil
+}
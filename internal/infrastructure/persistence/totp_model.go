@@ -0,0 +1,23 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTPModel is dropped together with the user. Secret is encrypted by the repository.
+type TOTPModel struct {
+	UserID        uuid.UUID  `gorm:"primarykey"`
+	User          *UserModel `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Secret        string     `gorm:"not null"`
+	Confirmed     bool       `gorm:"not null"`
+	RecoveryCodes []string   `gorm:"serializer:json"`
+	LastStep      int64      `gorm:"not null"`
+	Version       int64      `gorm:"not null;default:0"`
+	CreatedAt     time.Time  `gorm:"not null"`
+}
+
+func (TOTPModel) TableName() string {
+	return "user_totp"
+}
@@ -20,7 +20,11 @@ func (u *UserMapper) ToModel(user *domain.User) (*UserModel, error) {
 		Name:        user.Name(),
 		Surname:     user.Surname(),
 		IsRecruiter: user.IsRecruiter(),
+		Roles:       user.Roles(),
 		Password:    user.Password(),
+
+		EmailVerified: user.IsEmailVerified(),
+		Version:       user.Version(),
 	}, nil
 }
 
@@ -36,6 +40,7 @@ func (u *UserMapper) ToDomain(user *UserModel) (*domain.User, error) {
 
 	return domain.FromPersistence(
 		user.ID, email, user.Name,
-		user.Surname, user.Password, user.IsRecruiter,
+		user.Surname, user.Password, user.Roles, user.IsRecruiter,
+		user.EmailVerified, user.Version,
 	), nil
 }
@@ -9,4 +9,10 @@ type UserModel struct {
 	Surname     string
 	IsRecruiter bool
 	Password    string
+	// Roles are empty for rows stored before roles were introduced, IsRecruiter is used for them
+	Roles []string `gorm:"serializer:json"`
+	// EmailVerified is false for users registered before verification was introduced
+	EmailVerified bool `gorm:"not null;default:false"`
+	// Version is checked n' bumped by every update
+	Version int64 `gorm:"not null;default:0"`
 }
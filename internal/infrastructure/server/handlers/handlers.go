@@ -3,17 +3,29 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"math"
+	"net/url"
+	"strings"
+	"time"
 
 	staffy "github.com/devathh/staffy-proto/gen/go"
 	"github.com/devathh/staffy-sso/internal/application/services"
 	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type SSOHandlers struct {
 	service services.SSOService
+	oauth   services.OAuthService
+	tokens  services.IntrospectionService
 
 	staffy.UnimplementedSSOServer
 }
@@ -48,9 +60,18 @@ func (h *SSOHandlers) Login(ctx context.Context, req *staffy.LoginRequest) (*sta
 		if errors.Is(err, consts.ErrInvalidArgs) {
 			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
+		if errors.Is(err, consts.ErrTooManyAttempts) {
+			return nil, retryError(err)
+		}
 		if errors.Is(err, consts.ErrInvalidCredentials) {
 			return nil, status.Error(codes.Unauthenticated, err.Error())
 		}
+		if errors.Is(err, consts.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
 
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -65,12 +86,18 @@ func (h *SSOHandlers) Register(ctx context.Context, req *staffy.RegisterRequest)
 
 	resp, err := h.service.Register(ctx, req)
 	if err != nil {
+		if errors.Is(err, consts.ErrWeakPassword) {
+			return nil, badRequestError(err)
+		}
 		if errors.Is(err, consts.ErrCreateUser) {
 			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
 		if errors.Is(err, consts.ErrUserAlreadyExists) {
 			return nil, status.Error(codes.AlreadyExists, err.Error())
 		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
 
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -98,16 +125,23 @@ func (h *SSOHandlers) Delete(ctx context.Context, token *staffy.Token) (*staffy.
 	return resp, nil
 }
 
-func (h *SSOHandlers) Refresh(ctx context.Context, token *staffy.Token) (*staffy.Token, error) {
+func (h *SSOHandlers) Refresh(ctx context.Context, token *staffy.Token) (*staffy.AuthResponse, error) {
 	if token == nil {
 		return nil, status.Error(codes.InvalidArgument, "token cannot be empty")
 	}
 
 	resp, err := h.service.Refresh(ctx, token)
 	if err != nil {
-		if errors.Is(err, consts.ErrInvalidToken) {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) {
 			return nil, status.Error(codes.InvalidArgument, "token is invalid")
 		}
+		if errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, status.Error(codes.Unauthenticated, "token is invalid")
+		}
+		if errors.Is(err, consts.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
 
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -115,8 +149,749 @@ func (h *SSOHandlers) Refresh(ctx context.Context, token *staffy.Token) (*staffy
 	return resp, err
 }
 
-func NewHandler(service services.SSOService) *SSOHandlers {
+func (h *SSOHandlers) Logout(ctx context.Context, token *staffy.Token) (*staffy.StatusResponse, error) {
+	if token == nil {
+		return nil, status.Error(codes.InvalidArgument, "token cannot be empty")
+	}
+
+	resp, err := h.service.Logout(ctx, token)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) {
+			return nil, status.Error(codes.Unauthenticated, "token is invalid")
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) GetJWKS(ctx context.Context, _ *emptypb.Empty) (*staffy.JWKS, error) {
+	resp, err := h.service.GetJWKS(ctx)
+	if err != nil {
+		if errors.Is(err, consts.ErrContext) {
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) RequestPasswordReset(ctx context.Context, req *staffy.PasswordResetRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.RequestPasswordReset(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) ConfirmPasswordReset(ctx context.Context, req *staffy.ConfirmPasswordResetRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.ConfirmPasswordReset(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) {
+			return nil, status.Error(codes.InvalidArgument, "reset token is invalid or expired")
+		}
+		if errors.Is(err, consts.ErrWeakPassword) {
+			return nil, badRequestError(err)
+		}
+		if errors.Is(err, consts.ErrInvalidArgs) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) RequestMagicLink(ctx context.Context, req *staffy.MagicLinkRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.RequestMagicLink(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) RedeemMagicLink(ctx context.Context, req *staffy.RedeemMagicLinkRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.RedeemMagicLink(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) {
+			return nil, status.Error(codes.Unauthenticated, "login link is invalid or expired")
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) ChangePassword(ctx context.Context, req *staffy.ChangePasswordRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.ChangePassword(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) ||
+			errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, status.Error(codes.Unauthenticated, "token is invalid")
+		}
+		if errors.Is(err, consts.ErrInvalidCredentials) {
+			return nil, status.Error(codes.PermissionDenied, "old password is wrong")
+		}
+		if errors.Is(err, consts.ErrWeakPassword) {
+			return nil, badRequestError(err)
+		}
+		if errors.Is(err, consts.ErrInvalidArgs) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) RequestEmailChange(ctx context.Context, req *staffy.EmailChangeRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.RequestEmailChange(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) ||
+			errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, status.Error(codes.Unauthenticated, "token is invalid")
+		}
+		if errors.Is(err, consts.ErrInvalidCredentials) {
+			return nil, status.Error(codes.PermissionDenied, "password is wrong")
+		}
+		if errors.Is(err, consts.ErrInvalidEmail) || errors.Is(err, consts.ErrInvalidArgs) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, consts.ErrUserAlreadyExists) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) ConfirmEmailChange(ctx context.Context, req *staffy.ConfirmEmailChangeRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.ConfirmEmailChange(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) || errors.Is(err, consts.ErrNilToken) {
+			return nil, status.Error(codes.InvalidArgument, "token is invalid or expired")
+		}
+		if errors.Is(err, consts.ErrUserAlreadyExists) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) UpdateProfile(ctx context.Context, req *staffy.UpdateProfileRequest) (*staffy.User, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.UpdateProfile(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) ||
+			errors.Is(err, consts.ErrUserDoesntExist) {
+			return nil, status.Error(codes.Unauthenticated, "token is invalid")
+		}
+		if errors.Is(err, consts.ErrVersionConflict) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, consts.ErrInvalidArgs) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) SwitchRole(ctx context.Context, req *staffy.SwitchRoleRequest) (*staffy.RoleChangeResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.SwitchRole(ctx, req)
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) ReviewRoleChange(ctx context.Context, req *staffy.ReviewRoleChangeRequest) (*staffy.RoleChangeResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.ReviewRoleChange(ctx, req)
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) CheckPermission(ctx context.Context, req *staffy.CheckPermissionRequest) (*staffy.CheckPermissionResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.CheckPermission(ctx, req)
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) AssignRole(ctx context.Context, req *staffy.RoleAssignmentRequest) (*staffy.User, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.AssignRole(ctx, req)
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) RevokeRole(ctx context.Context, req *staffy.RoleAssignmentRequest) (*staffy.User, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.RevokeRole(ctx, req)
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return resp, nil
+}
+
+func roleError(err error) error {
+	switch {
+	case errors.Is(err, consts.ErrInvalidToken),
+		errors.Is(err, consts.ErrNilToken),
+		errors.Is(err, consts.ErrUserDoesntExist):
+		return status.Error(codes.Unauthenticated, "token is invalid")
+	case errors.Is(err, consts.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, consts.ErrRoleChangeDoesntExist),
+		errors.Is(err, consts.ErrRoleDoesntExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, consts.ErrRoleChangePending):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, consts.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, consts.ErrInvalidArgs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (h *SSOHandlers) CreateOrganization(ctx context.Context, req *staffy.CreateOrganizationRequest) (*staffy.Organization, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.CreateOrganization(ctx, req)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) InviteMember(ctx context.Context, req *staffy.InviteMemberRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.InviteMember(ctx, req)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) AcceptInvitation(ctx context.Context, req *staffy.AcceptInvitationRequest) (*staffy.Organization, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.AcceptInvitation(ctx, req)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) ListMembers(ctx context.Context, req *staffy.ListMembersRequest) (*staffy.ListMembersResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.ListMembers(ctx, req)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) SwitchOrganization(ctx context.Context, req *staffy.SwitchOrganizationRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.SwitchOrganization(ctx, req)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	return resp, nil
+}
+
+func organizationError(err error) error {
+	switch {
+	case errors.Is(err, consts.ErrInvalidToken),
+		errors.Is(err, consts.ErrNilToken),
+		errors.Is(err, consts.ErrUserDoesntExist):
+		return status.Error(codes.Unauthenticated, "token is invalid")
+	case errors.Is(err, consts.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, consts.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, consts.ErrOrganizationDoesntExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, consts.ErrAlreadyMember):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, consts.ErrInvalidEmail),
+		errors.Is(err, consts.ErrInvalidArgs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, consts.ErrOverloaded):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (h *SSOHandlers) EnrollTOTP(ctx context.Context, req *staffy.EnrollTOTPRequest) (*staffy.EnrollTOTPResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.EnrollTOTP(ctx, req)
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) ConfirmTOTP(ctx context.Context, req *staffy.ConfirmTOTPRequest) (*staffy.RecoveryCodesResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.ConfirmTOTP(ctx, req)
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) DisableTOTP(ctx context.Context, req *staffy.DisableTOTPRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.DisableTOTP(ctx, req)
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) VerifyMFA(ctx context.Context, req *staffy.VerifyMFARequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.VerifyMFA(ctx, req)
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return resp, nil
+}
+
+func mfaError(err error) error {
+	switch {
+	case errors.Is(err, consts.ErrInvalidToken),
+		errors.Is(err, consts.ErrNilToken),
+		errors.Is(err, consts.ErrUserDoesntExist):
+		return status.Error(codes.Unauthenticated, "token is invalid")
+	case errors.Is(err, consts.ErrInvalidCredentials),
+		errors.Is(err, consts.ErrInvalidMFACode):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, consts.ErrMFAAlreadyEnabled),
+		errors.Is(err, consts.ErrMFANotEnrolled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, consts.ErrInvalidArgs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, consts.ErrOverloaded):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (h *SSOHandlers) BeginPasskeyRegistration(ctx context.Context, req *staffy.BeginPasskeyRegistrationRequest) (*staffy.PasskeyCeremonyResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.BeginPasskeyRegistration(ctx, req)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) FinishPasskeyRegistration(ctx context.Context, req *staffy.FinishPasskeyRegistrationRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.FinishPasskeyRegistration(ctx, req)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) BeginPasskeyLogin(ctx context.Context, _ *emptypb.Empty) (*staffy.PasskeyCeremonyResponse, error) {
+	resp, err := h.service.BeginPasskeyLogin(ctx)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) FinishPasskeyLogin(ctx context.Context, req *staffy.FinishPasskeyLoginRequest) (*staffy.AuthResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.FinishPasskeyLogin(ctx, req)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	return resp, nil
+}
+
+func passkeyError(err error) error {
+	switch {
+	case errors.Is(err, consts.ErrInvalidToken),
+		errors.Is(err, consts.ErrNilToken),
+		errors.Is(err, consts.ErrUserDoesntExist):
+		return status.Error(codes.Unauthenticated, "token is invalid")
+	case errors.Is(err, consts.ErrInvalidPasskey):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, consts.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, consts.ErrInvalidArgs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, consts.ErrOverloaded):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// badRequestError is InvalidArgument with BadRequest, which lists every broken rule of the password
+func badRequestError(err error) error {
+	var policy *consts.PasswordPolicyError
+	if !errors.As(err, &policy) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(policy.Violations))
+	for _, description := range policy.Violations {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       policy.Field,
+			Description: description,
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, consts.ErrWeakPassword.Error())
+	detailed, detailsErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// errorDomain is the domain of ErrorInfo details, reasons are unique within it
+const errorDomain = "staffy-sso"
+
+// retryError is ResourceExhausted with RetryInfo, so clients know when to try again,
+// n' ErrorInfo, which tells a locked account from the rate limit
+func retryError(err error) error {
+	var retry *consts.RetryAfterError
+	if !errors.As(err, &retry) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	st := status.New(codes.ResourceExhausted, err.Error())
+	// Rounding up, retrying a bit earlier would be rejected again
+	delay := time.Duration(math.Ceil(retry.RetryAfter.Seconds())) * time.Second
+	details := []protoadapt.MessageV1{&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}}
+	if retry.Reason != "" {
+		details = append(details, &errdetails.ErrorInfo{
+			Reason: retry.Reason,
+			Domain: errorDomain,
+		})
+	}
+
+	detailed, detailsErr := st.WithDetails(details...)
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+func (h *SSOHandlers) VerifyEmail(ctx context.Context, req *staffy.VerifyEmailRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.VerifyEmail(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidToken) ||
+			errors.Is(err, consts.ErrNilToken) {
+			return nil, status.Error(codes.InvalidArgument, "verification token is invalid or expired")
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+func (h *SSOHandlers) ResendVerification(ctx context.Context, req *staffy.ResendVerificationRequest) (*staffy.StatusResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.service.ResendVerification(ctx, req)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+// IssueServiceToken exchanges credentials of the backend service for a token
+func (h *SSOHandlers) IssueServiceToken(ctx context.Context, req *staffy.ClientCredentialsRequest) (*staffy.ServiceTokenResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	resp, err := h.oauth.Token(ctx, &services.TokenRequest{
+		GrantType:    services.GrantTypeClientCredentials,
+		ClientID:     req.GetClientId(),
+		ClientSecret: req.GetClientSecret(),
+		Scope:        req.GetScope(),
+	})
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidClient) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, consts.ErrUnauthorizedClient) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if errors.Is(err, consts.ErrInvalidScope) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &staffy.ServiceTokenResponse{
+		AccessToken: resp.AccessToken,
+		TokenType:   resp.TokenType,
+		ExpiresIn:   resp.ExpiresIn,
+		Scope:       resp.Scope,
+	}, nil
+}
+
+// Introspect reports whether the token is active, inactive tokens aren't an error
+func (h *SSOHandlers) Introspect(ctx context.Context, req *staffy.IntrospectRequest) (*staffy.IntrospectResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be empty")
+	}
+
+	clientID, secret, err := basicCredentials(ctx)
+	if err != nil {
+		return nil, introspectionError(err)
+	}
+
+	if err := h.tokens.AuthenticateResourceServer(ctx, clientID, secret); err != nil {
+		return nil, introspectionError(err)
+	}
+
+	resp, err := h.tokens.Introspect(ctx, req.GetToken(), req.GetSkipUserLookup())
+	if err != nil {
+		return nil, introspectionError(err)
+	}
+
+	return &staffy.IntrospectResponse{
+		Active:   resp.Active,
+		Sub:      resp.Subject,
+		Exp:      resp.Expires,
+		Iat:      resp.IssuedAt,
+		Scope:    resp.Scope,
+		ClientId: resp.ClientID,
+		Type:     resp.Type,
+	}, nil
+}
+
+// basicCredentials reads credentials of the resource server from "authorization: Basic" metadata,
+// they're form-urlencoded the same way as at POST /introspect (RFC 6749 2.3.1)
+func basicCredentials(ctx context.Context) (string, string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) != 1 {
+		return "", "", consts.ErrInvalidClient
+	}
+
+	scheme, encoded, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", consts.ErrInvalidClient
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", consts.ErrInvalidClient
+	}
+
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", consts.ErrInvalidClient
+	}
+
+	clientID, errID := url.QueryUnescape(id)
+	clientSecret, errSecret := url.QueryUnescape(secret)
+	if errID != nil || errSecret != nil {
+		return "", "", consts.ErrInvalidClient
+	}
+
+	return clientID, clientSecret, nil
+}
+
+func introspectionError(err error) error {
+	switch {
+	case errors.Is(err, consts.ErrInvalidClient):
+		return status.Error(codes.Unauthenticated, "client authentication failed")
+	case errors.Is(err, consts.ErrOverloaded),
+		errors.Is(err, consts.ErrCache),
+		errors.Is(err, consts.ErrDatabase):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func NewHandler(service services.SSOService, oauth services.OAuthService, tokens services.IntrospectionService) *SSOHandlers {
 	return &SSOHandlers{
 		service: service,
+		oauth:   oauth,
+		tokens:  tokens,
 	}
 }
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	"github.com/devathh/staffy-sso/internal/application/services"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantDelay  time.Duration
+		wantReason string
+	}{
+		{
+			name:       "locked account",
+			err:        &consts.RetryAfterError{RetryAfter: 14*time.Minute + 100*time.Millisecond, Reason: consts.RetryReasonAccountLocked},
+			wantDelay:  14*time.Minute + time.Second,
+			wantReason: consts.RetryReasonAccountLocked,
+		},
+		{
+			name:       "rate limit",
+			err:        &consts.RetryAfterError{RetryAfter: 1500 * time.Millisecond, Reason: consts.RetryReasonRateLimited},
+			wantDelay:  2 * time.Second,
+			wantReason: consts.RetryReasonRateLimited,
+		},
+		{
+			name:      "without reason",
+			err:       &consts.RetryAfterError{RetryAfter: time.Second},
+			wantDelay: time.Second,
+		},
+		{
+			name: "plain error",
+			err:  consts.ErrTooManyAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, ok := status.FromError(retryError(tt.err))
+			if !ok || st.Code() != codes.ResourceExhausted {
+				t.Fatalf("got %v, want ResourceExhausted", st)
+			}
+
+			var (
+				delay time.Duration
+				info  *errdetails.ErrorInfo
+			)
+			for _, detail := range st.Details() {
+				switch d := detail.(type) {
+				case *errdetails.RetryInfo:
+					delay = d.GetRetryDelay().AsDuration()
+				case *errdetails.ErrorInfo:
+					info = d
+				case error:
+					t.Fatalf("failed to decode detail: %v", d)
+				}
+			}
+
+			if delay != tt.wantDelay {
+				t.Fatalf("retry delay: got %s, want %s", delay, tt.wantDelay)
+			}
+
+			if tt.wantReason == "" {
+				if info != nil {
+					t.Fatalf("unexpected ErrorInfo: %v", info)
+				}
+				return
+			}
+			if info == nil || info.GetReason() != tt.wantReason || info.GetDomain() != errorDomain {
+				t.Fatalf("got ErrorInfo %v, want reason %s", info, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRetryErrorMatchesTooManyAttempts(t *testing.T) {
+	if !errors.Is(&consts.RetryAfterError{RetryAfter: time.Second}, consts.ErrTooManyAttempts) {
+		t.Fatal("RetryAfterError doesn't match ErrTooManyAttempts")
+	}
+}
+
+// introspectionTokens accepts only the gateway client n' reports every token as active
+type introspectionTokens struct {
+	services.IntrospectionService
+	err error
+}
+
+func (introspectionTokens) AuthenticateResourceServer(_ context.Context, clientID, secret string) error {
+	if clientID != "gateway/eu" || secret != "s3cret" {
+		return consts.ErrInvalidClient
+	}
+	return nil
+}
+
+func (f introspectionTokens) Introspect(context.Context, string, bool) (*services.Introspection, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &services.Introspection{Active: true, Subject: "user"}, nil
+}
+
+func TestIntrospectAuthenticatesClient(t *testing.T) {
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	tests := []struct {
+		name          string
+		authorization []string
+		err           error
+		want          codes.Code
+	}{
+		{name: "valid credentials", authorization: []string{basic("gateway%2Feu:s3cret")}, want: codes.OK},
+		{name: "case-insensitive scheme", authorization: []string{"basic " + basic("gateway%2Feu:s3cret")[6:]}, want: codes.OK},
+		{name: "no credentials", want: codes.Unauthenticated},
+		{name: "wrong secret", authorization: []string{basic("gateway%2Feu:secret")}, want: codes.Unauthenticated},
+		{name: "bearer token", authorization: []string{"Bearer s3cret"}, want: codes.Unauthenticated},
+		{name: "invalid base64", authorization: []string{"Basic %%%"}, want: codes.Unauthenticated},
+		{name: "no separator", authorization: []string{basic("gateway")}, want: codes.Unauthenticated},
+		{name: "several credentials", authorization: []string{basic("gateway%2Feu:s3cret"), basic("other:secret")}, want: codes.Unauthenticated},
+		{name: "revocation list is unavailable", authorization: []string{basic("gateway%2Feu:s3cret")}, err: consts.ErrCache, want: codes.Unavailable},
+		{name: "unexpected error", authorization: []string{basic("gateway%2Feu:s3cret")}, err: errors.New("boom"), want: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, nil, introspectionTokens{err: tt.err})
+
+			md := metadata.MD{}
+			for _, value := range tt.authorization {
+				md.Append("authorization", value)
+			}
+			ctx := metadata.NewIncomingContext(t.Context(), md)
+
+			resp, err := h.Introspect(ctx, &staffy.IntrospectRequest{Token: "token"})
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			if err == nil && !resp.Active {
+				t.Fatal("token isn't active")
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/devathh/staffy-sso/internal/application/services"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/jwt"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+type HTTPHandlers struct {
+	log    *slog.Logger
+	cfg    *config.Config
+	jwt    *jwt.JWT
+	oauth  services.OAuthService
+	oidc   services.OIDCService
+	tokens services.IntrospectionService
+	// limiter is optional, endpoints aren't limited without it
+	limiter *RateLimiter
+}
+
+// oauthError is the error response of RFC 6749 5.2
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (h *HTTPHandlers) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/jwks.json", h.JWKS)
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.Discovery)
+	mux.HandleFunc("GET /authorize", h.limited("/authorize", h.Authorize))
+	mux.HandleFunc("POST /authorize", h.limited("/authorize", h.Consent))
+	mux.HandleFunc("POST /token", h.limited("/token", h.Token))
+	mux.HandleFunc("POST /introspect", h.limited("/introspect", h.Introspect))
+	mux.HandleFunc("GET /userinfo", h.UserInfo)
+	mux.HandleFunc("POST /userinfo", h.UserInfo)
+
+	return mux
+}
+
+// limited passes requests through limits of the path, e.g. /token, the same way rpcs are limited.
+// Throttled requests get 429 with Retry-After
+func (h *HTTPHandlers) limited(path string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.limiter == nil {
+			next(w, r)
+			return
+		}
+
+		err := h.limiter.allow(r.Context(), path, nil)
+		if err == nil {
+			next(w, r)
+			return
+		}
+
+		var retry *consts.RetryAfterError
+		if errors.As(err, &retry) {
+			// Rounding up, retrying a bit earlier would be rejected again
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.RetryAfter.Seconds()))))
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		h.writeOAuthError(w, http.StatusTooManyRequests, "temporarily_unavailable", err.Error())
+	}
+}
+
+// JWKS serves public keys, so other services can verify tokens offline
+func (h *HTTPHandlers) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.writeJSON(w, http.StatusOK, h.jwt.JWKS())
+}
+
+// Discovery serves the OpenID Provider configuration. There's no provider, while the active key is symmetric
+func (h *HTTPHandlers) Discovery(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.oidc.Discovery()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.writeJSON(w, http.StatusOK, metadata)
+}
+
+// UserInfo returns claims of the user by the access token of the client (OIDC Core 5.3)
+func (h *HTTPHandlers) UserInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := h.oidc.UserInfo(r.Context(), h.accessToken(r, false))
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidToken), errors.Is(err, consts.ErrNilToken):
+			// RFC 6750 3: the error is sent in the challenge
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			h.writeOAuthError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		default:
+			h.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, http.StatusOK, info)
+}
+
+// Authorize starts the authorization code flow. The user is sent to the login page
+// or the consent page, if it's needed, otherwise straight back to the client with the code.
+func (h *HTTPHandlers) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequestFromValues(r.URL.Query())
+
+	redirectURI, err := h.oauth.Authorize(r.Context(), h.accessToken(r, true), req)
+	if err != nil {
+		// With prompt=none the user mustn't see any page, so the client gets the error
+		promptNone := req.Prompt == services.PromptNone
+
+		switch {
+		case promptNone && errors.Is(err, consts.ErrLoginRequired):
+			redirectURI, err = h.authorizeErrorRedirect(req, err)
+		case promptNone && errors.Is(err, consts.ErrConsentRequired):
+			redirectURI, err = h.authorizeErrorRedirect(req, err)
+		case errors.Is(err, consts.ErrLoginRequired):
+			redirectURI, err = services.RedirectWithParams(
+				h.cfg.OAuth.LoginURL,
+				url.Values{"return_to": {r.URL.RequestURI()}},
+			)
+		case errors.Is(err, consts.ErrConsentRequired):
+			redirectURI, err = services.RedirectWithParams(h.cfg.OAuth.ConsentURL, r.URL.Query())
+		default:
+			redirectURI, err = h.authorizeErrorRedirect(req, err)
+		}
+
+		if err != nil {
+			h.writeAuthorizeError(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
+
+// Consent is called by the consent page with the decision of the user. The token is accepted
+// only from the Authorization header, so the decision can't be forged by another site.
+func (h *HTTPHandlers) Consent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+
+	req := authorizeRequestFromValues(r.PostForm)
+	approved := r.PostForm.Get("decision") == "allow"
+
+	redirectURI, err := h.oauth.Consent(r.Context(), h.accessToken(r, false), req, approved)
+	if err != nil {
+		if errors.Is(err, consts.ErrLoginRequired) {
+			h.writeOAuthError(w, http.StatusUnauthorized, "login_required", err.Error())
+			return
+		}
+
+		redirectURI, err = h.authorizeErrorRedirect(req, err)
+		if err != nil {
+			h.writeAuthorizeError(w, err)
+			return
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]string{"redirect_to": redirectURI})
+}
+
+// Token exchanges the code or the refresh token for tokens
+func (h *HTTPHandlers) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+
+	req := &services.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+	}
+
+	clientID, clientSecret, basicAuth, err := clientCredentials(r)
+	if err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	req.ClientID, req.ClientSecret = clientID, clientSecret
+
+	resp, err := h.oauth.Token(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidClient):
+			if basicAuth {
+				w.Header().Set("WWW-Authenticate", `Basic realm="staffy"`)
+			}
+			h.writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		case errors.Is(err, consts.ErrInvalidGrant):
+			h.writeOAuthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		case errors.Is(err, consts.ErrUnauthorizedClient):
+			h.writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", err.Error())
+		case errors.Is(err, consts.ErrUnsupportedGrantType):
+			h.writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", err.Error())
+		case errors.Is(err, consts.ErrInvalidScope):
+			h.writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		case errors.Is(err, consts.ErrInvalidArgs):
+			h.writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		case errors.Is(err, consts.ErrOverloaded):
+			h.writeOverloaded(w)
+		default:
+			h.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// Introspect serves RFC 7662 for resource servers, which authenticate as confidential clients.
+// skip_user_lookup=true is an extension, which checks the token without loading the user.
+func (h *HTTPHandlers) Introspect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+
+	clientID, secret, _, err := clientCredentials(r)
+	if err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if err := h.tokens.AuthenticateResourceServer(r.Context(), clientID, secret); err != nil {
+		if errors.Is(err, consts.ErrInvalidClient) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="staffy"`)
+			h.writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+			return
+		}
+		if errors.Is(err, consts.ErrOverloaded) {
+			h.writeOverloaded(w)
+			return
+		}
+
+		h.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	skipUserLookup := r.PostForm.Get("skip_user_lookup") == "true"
+	resp, err := h.tokens.Introspect(r.Context(), r.PostForm.Get("token"), skipUserLookup)
+	if err != nil {
+		h.writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// authorizeErrorRedirect builds the redirect to the client with the error (RFC 6749 4.1.2.1).
+// If the client or the redirect uri is invalid, the error is returned instead.
+func (h *HTTPHandlers) authorizeErrorRedirect(req *services.AuthorizeRequest, err error) (string, error) {
+	var code string
+	switch {
+	case errors.Is(err, consts.ErrInvalidClient), errors.Is(err, consts.ErrInvalidRedirectURI):
+		return "", err
+	case errors.Is(err, consts.ErrAccessDenied):
+		code = "access_denied"
+	case errors.Is(err, consts.ErrLoginRequired):
+		code = "login_required"
+	case errors.Is(err, consts.ErrConsentRequired):
+		code = "consent_required"
+	case errors.Is(err, consts.ErrInvalidScope):
+		code = "invalid_scope"
+	case errors.Is(err, consts.ErrUnauthorizedClient):
+		code = "unauthorized_client"
+	case errors.Is(err, consts.ErrUnsupportedResponseType):
+		code = "unsupported_response_type"
+	case errors.Is(err, consts.ErrInvalidArgs):
+		code = "invalid_request"
+	default:
+		h.log.Error("failed to authorize", slog.String("error", err.Error()))
+		code = "server_error"
+	}
+
+	params := url.Values{"error": {code}}
+	if code != "server_error" {
+		params.Set("error_description", err.Error())
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return services.RedirectWithParams(req.RedirectURI, params)
+}
+
+func (h *HTTPHandlers) writeAuthorizeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, consts.ErrInvalidClient):
+		h.writeOAuthError(w, http.StatusBadRequest, "invalid_client", err.Error())
+	case errors.Is(err, consts.ErrInvalidRedirectURI):
+		h.writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	default:
+		h.log.Error("failed to build redirect", slog.String("error", err.Error()))
+		h.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+	}
+}
+
+// accessToken takes the token of the user from the Authorization header n', if it's allowed, from the session cookie
+func (h *HTTPHandlers) accessToken(r *http.Request, allowCookie bool) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+
+	if allowCookie && h.cfg.OAuth.SessionCookie != "" {
+		if cookie, err := r.Cookie(h.cfg.OAuth.SessionCookie); err == nil {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+func (h *HTTPHandlers) writeOAuthError(w http.ResponseWriter, code int, oauthCode, description string) {
+	h.writeJSON(w, code, oauthError{
+		Error:       oauthCode,
+		Description: description,
+	})
+}
+
+// writeOverloaded is 503 with Retry-After, the same as Unavailable of grpc, the hashing pool frees up quickly
+func (h *HTTPHandlers) writeOverloaded(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	h.writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", consts.ErrOverloaded.Error())
+}
+
+func (h *HTTPHandlers) writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.log.Warn("failed to write response", slog.String("error", err.Error()))
+	}
+}
+
+// clientCredentials takes credentials of the client from the basic scheme or, if it's absent, from the form
+func clientCredentials(r *http.Request) (string, string, bool, error) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false, nil
+	}
+
+	// Credentials of the basic scheme are form-urlencoded (RFC 6749 2.3.1)
+	clientID, errID := url.QueryUnescape(id)
+	clientSecret, errSecret := url.QueryUnescape(secret)
+	if errID != nil || errSecret != nil {
+		return "", "", true, errors.New("invalid client credentials")
+	}
+
+	return clientID, clientSecret, true, nil
+}
+
+func authorizeRequestFromValues(values url.Values) *services.AuthorizeRequest {
+	return &services.AuthorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+		Prompt:              values.Get("prompt"),
+	}
+}
+
+func NewHTTPHandler(cfg *config.Config, log *slog.Logger, jwt *jwt.JWT, oauth services.OAuthService, oidc services.OIDCService, tokens services.IntrospectionService, limiter *RateLimiter) *HTTPHandlers {
+	return &HTTPHandlers{
+		log:     log,
+		cfg:     cfg,
+		jwt:     jwt,
+		oauth:   oauth,
+		oidc:    oidc,
+		tokens:  tokens,
+		limiter: limiter,
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+)
+
+func TestHTTPOverloadedIsUnavailable(t *testing.T) {
+	h := NewHTTPHandler(&config.Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil,
+		overloadedOAuth{}, nil, overloadedTokens{}, nil)
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"service"},
+		"client_secret": {"secret"},
+		"token":         {"token"},
+	}
+
+	for _, path := range []string{"/token", "/introspect"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			h.Routes().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status: got %d, want %d", rec.Code, http.StatusServiceUnavailable)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Fatal("Retry-After is missing")
+			}
+
+			var body oauthError
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode body: %v", err)
+			}
+			if body.Error != "temporarily_unavailable" {
+				t.Fatalf("error: got %q, want temporarily_unavailable", body.Error)
+			}
+		})
+	}
+}
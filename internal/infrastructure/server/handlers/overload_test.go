@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	"github.com/devathh/staffy-sso/internal/application/services"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// overloadedService fails every call, which can reach the hashing pool, with ErrOverloaded
+type overloadedService struct {
+	services.SSOService
+}
+
+func (overloadedService) Login(context.Context, *staffy.LoginRequest) (*staffy.AuthResponse, error) {
+	return nil, consts.ErrOverloaded
+}
+
+func (overloadedService) ConfirmEmailChange(context.Context, *staffy.ConfirmEmailChangeRequest) (*staffy.AuthResponse, error) {
+	return nil, consts.ErrOverloaded
+}
+
+func (overloadedService) DisableTOTP(context.Context, *staffy.DisableTOTPRequest) (*staffy.StatusResponse, error) {
+	return nil, consts.ErrOverloaded
+}
+
+func (overloadedService) AcceptInvitation(context.Context, *staffy.AcceptInvitationRequest) (*staffy.Organization, error) {
+	return nil, consts.ErrOverloaded
+}
+
+func (overloadedService) FinishPasskeyLogin(context.Context, *staffy.FinishPasskeyLoginRequest) (*staffy.AuthResponse, error) {
+	return nil, consts.ErrOverloaded
+}
+
+type overloadedOAuth struct {
+	services.OAuthService
+}
+
+func (overloadedOAuth) Token(context.Context, *services.TokenRequest) (*services.TokenResponse, error) {
+	return nil, consts.ErrOverloaded
+}
+
+type overloadedTokens struct {
+	services.IntrospectionService
+}
+
+func (overloadedTokens) AuthenticateResourceServer(context.Context, string, string) error {
+	return consts.ErrOverloaded
+}
+
+func TestOverloadedIsUnavailable(t *testing.T) {
+	h := NewHandler(overloadedService{}, overloadedOAuth{}, overloadedTokens{})
+	ctx := t.Context()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "Login",
+			call: func() error {
+				_, err := h.Login(ctx, &staffy.LoginRequest{})
+				return err
+			},
+		},
+		{
+			name: "ConfirmEmailChange",
+			call: func() error {
+				_, err := h.ConfirmEmailChange(ctx, &staffy.ConfirmEmailChangeRequest{})
+				return err
+			},
+		},
+		{
+			name: "DisableTOTP",
+			call: func() error {
+				_, err := h.DisableTOTP(ctx, &staffy.DisableTOTPRequest{})
+				return err
+			},
+		},
+		{
+			name: "AcceptInvitation",
+			call: func() error {
+				_, err := h.AcceptInvitation(ctx, &staffy.AcceptInvitationRequest{})
+				return err
+			},
+		},
+		{
+			name: "FinishPasskeyLogin",
+			call: func() error {
+				_, err := h.FinishPasskeyLogin(ctx, &staffy.FinishPasskeyLoginRequest{})
+				return err
+			},
+		},
+		{
+			name: "Introspect",
+			call: func() error {
+				md := metadata.Pairs("authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("gateway:secret")))
+				_, err := h.Introspect(metadata.NewIncomingContext(ctx, md), &staffy.IntrospectRequest{})
+				return err
+			},
+		},
+		{
+			name: "IssueServiceToken",
+			call: func() error {
+				_, err := h.IssueServiceToken(ctx, &staffy.ClientCredentialsRequest{})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call()); got != codes.Unavailable {
+				t.Fatalf("got %s, want Unavailable", got)
+			}
+		})
+	}
+}
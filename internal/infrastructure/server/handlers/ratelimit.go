@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/devathh/staffy-sso/internal/domain/observability"
+	domainRateLimit "github.com/devathh/staffy-sso/internal/domain/ratelimit"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/clientip"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"google.golang.org/grpc"
+)
+
+// emailRequest is a request, which targets an account by email, e.g. LoginRequest
+type emailRequest interface {
+	GetEmail() string
+}
+
+// rateCheck is one counter, which the call is charged to
+type rateCheck struct {
+	dimension domainRateLimit.Dimension
+	subject   string
+	limit     domainRateLimit.Limit
+}
+
+type RateLimiter struct {
+	log     *slog.Logger
+	cfg     *config.Config
+	limiter domainRateLimit.Limiter
+	ch      observability.UserCH
+}
+
+// Unary rejects calls over the limits of the method with ResourceExhausted n' RetryInfo
+func (rl *RateLimiter) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := rl.allow(ctx, info.FullMethod, req); err != nil {
+		return nil, retryError(err)
+	}
+
+	return handler(ctx, req)
+}
+
+// allow returns RetryAfterError, if the call is over the limits of the method. All counters are checked at once
+// n' the call is counted only if it fits every one of them. Counters of the call share the hash tag of the method,
+// so the script runs on one node of Redis Cluster.
+// Errors of redis don't reject calls, limits are a protection, not a dependency
+func (rl *RateLimiter) allow(ctx context.Context, method string, req any) error {
+	if !rl.cfg.RateLimit.Enabled {
+		return nil
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, rl.cfg.Server.RWTimeout)
+	defer cancel()
+
+	checks := rl.checks(ctx, req, method)
+	counters := make([]domainRateLimit.Counter, 0, len(checks))
+	for _, check := range checks {
+		counters = append(counters, domainRateLimit.Counter{
+			Key:   fmt.Sprintf("{%s}:%s:%s", method, check.dimension, check.subject),
+			Limit: check.limit,
+		})
+	}
+
+	decision, err := rl.limiter.Allow(ctxTimeout, counters)
+	if err != nil {
+		rl.log.Error("failed to check rate limit", slog.String("method", method), slog.String("error", err.Error()))
+		return nil
+	}
+
+	if !decision.Allowed {
+		check := checks[decision.Exceeded]
+		go rl.ch.SaveThrottleEvent(context.TODO(), &observability.ThrottleEvent{
+			Method:     method,
+			Dimension:  string(check.dimension),
+			Subject:    check.subject,
+			RetryAfter: decision.RetryAfter,
+		})
+
+		return &consts.RetryAfterError{
+			RetryAfter: decision.RetryAfter,
+			Reason:     consts.RetryReasonRateLimited,
+		}
+	}
+
+	return nil
+}
+
+// checks returns counters of the call, limits of the method replace the default ones. Http endpoints
+// are limited by their path, e.g. /token
+func (rl *RateLimiter) checks(ctx context.Context, req any, method string) []rateCheck {
+	limits, ok := rl.cfg.RateLimit.Methods[method]
+	if !ok {
+		limits = rl.cfg.RateLimit.Default
+	}
+
+	checks := []rateCheck{{
+		dimension: domainRateLimit.DimensionMethod,
+		limit:     domainRateLimit.Limit{Requests: limits.Method.Requests, Window: limits.Method.Window},
+	}}
+
+	if ip := clientip.FromContext(ctx); ip != "" {
+		checks = append(checks, rateCheck{
+			dimension: domainRateLimit.DimensionIP,
+			subject:   ip,
+			limit:     domainRateLimit.Limit{Requests: limits.IP.Requests, Window: limits.IP.Window},
+		})
+	}
+
+	if r, ok := req.(emailRequest); ok {
+		if email := strings.ToLower(strings.TrimSpace(r.GetEmail())); email != "" {
+			checks = append(checks, rateCheck{
+				dimension: domainRateLimit.DimensionEmail,
+				subject:   email,
+				limit:     domainRateLimit.Limit{Requests: limits.Email.Requests, Window: limits.Email.Window},
+			})
+		}
+	}
+
+	return checks
+}
+
+func NewRateLimiter(cfg *config.Config, log *slog.Logger, limiter domainRateLimit.Limiter, ch observability.UserCH) (*RateLimiter, error) {
+	if cfg == nil {
+		return nil, consts.ErrNilCfg
+	}
+	if log == nil || limiter == nil || ch == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	return &RateLimiter{
+		log:     log,
+		cfg:     cfg,
+		limiter: limiter,
+		ch:      ch,
+	}, nil
+}
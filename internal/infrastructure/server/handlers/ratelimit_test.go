@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	staffy "github.com/devathh/staffy-proto/gen/go"
+	"github.com/devathh/staffy-sso/internal/domain/observability"
+	domainRateLimit "github.com/devathh/staffy-sso/internal/domain/ratelimit"
+	"github.com/devathh/staffy-sso/internal/infrastructure/cache/redis"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/internal/lib/clientip"
+	goredis "github.com/redis/go-redis/v9"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const loginMethod = "/sso.SSO/Login"
+
+// throttleCH keeps throttle events, the rest is dropped
+type throttleCH struct {
+	mu     sync.Mutex
+	events []*observability.ThrottleEvent
+}
+
+func (c *throttleCH) SavePerformanceLog(context.Context, *observability.PerformanceLog) {}
+func (c *throttleCH) SaveLockoutEvent(context.Context, *observability.LockoutEvent)     {}
+func (c *throttleCH) SaveHashingMetric(context.Context, *observability.HashingMetric)   {}
+
+func (c *throttleCH) SaveThrottleEvent(_ context.Context, event *observability.ThrottleEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.events = append(c.events, event)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, []domainRateLimit.Counter) (domainRateLimit.Decision, error) {
+	return domainRateLimit.Decision{}, errors.New("redis is unavailable")
+}
+
+func newTestRateLimiter(t *testing.T, limiter domainRateLimit.Limiter) (*RateLimiter, *throttleCH) {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Server.RWTimeout = 5 * time.Second
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Default.Method.Requests = 5
+	cfg.RateLimit.Default.Method.Window = time.Minute
+	cfg.RateLimit.Default.IP.Requests = 2
+	cfg.RateLimit.Default.IP.Window = time.Minute
+	cfg.RateLimit.Default.Email.Requests = 3
+	cfg.RateLimit.Default.Email.Window = time.Minute
+
+	if limiter == nil {
+		mr := miniredis.RunT(t)
+		client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+
+		store, err := redis.NewRateLimitStore(client)
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		limiter = store
+	}
+
+	ch := &throttleCH{}
+	rl, err := NewRateLimiter(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), limiter, ch)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+
+	return rl, ch
+}
+
+func contextFromIP(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 51000},
+	})
+}
+
+func okHandler(context.Context, any) (any, error) {
+	return "ok", nil
+}
+
+func TestRateLimiterUnary(t *testing.T) {
+	type call struct {
+		ip    string
+		email string
+		// wantDimension is the dimension, which rejects the call, empty if it's allowed
+		wantDimension string
+	}
+
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "ip limit doesn't use up the method",
+			calls: []call{
+				{ip: "203.0.113.7", email: "a@example.com"},
+				{ip: "203.0.113.7", email: "b@example.com"},
+				{ip: "203.0.113.7", email: "c@example.com", wantDimension: "ip"},
+				{ip: "203.0.113.7", email: "d@example.com", wantDimension: "ip"},
+				{ip: "203.0.113.7", email: "e@example.com", wantDimension: "ip"},
+				{ip: "198.51.100.1", email: "f@example.com"},
+				{ip: "198.51.100.1", email: "g@example.com"},
+				{ip: "198.51.100.2", email: "h@example.com"},
+				{ip: "198.51.100.3", email: "i@example.com", wantDimension: "method"},
+			},
+		},
+		{
+			name: "email limit across addresses",
+			calls: []call{
+				{ip: "203.0.113.1", email: "victim@example.com"},
+				{ip: "203.0.113.2", email: "Victim@example.com"},
+				{ip: "203.0.113.3", email: "victim@example.com "},
+				{ip: "203.0.113.4", email: "victim@example.com", wantDimension: "email"},
+				{ip: "203.0.113.4", email: "other@example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl, ch := newTestRateLimiter(t, nil)
+			info := &grpc.UnaryServerInfo{FullMethod: loginMethod}
+
+			rejected := 0
+			for i, c := range tt.calls {
+				_, err := rl.Unary(contextFromIP(c.ip), &staffy.LoginRequest{Email: c.email}, info, okHandler)
+				if c.wantDimension == "" {
+					if err != nil {
+						t.Fatalf("call %d: unexpected error: %v", i+1, err)
+					}
+					continue
+				}
+
+				rejected++
+				st, _ := status.FromError(err)
+				if st.Code() != codes.ResourceExhausted {
+					t.Fatalf("call %d: got %v, want ResourceExhausted", i+1, err)
+				}
+
+				var reason string
+				for _, detail := range st.Details() {
+					if errorInfo, ok := detail.(*errdetails.ErrorInfo); ok {
+						reason = errorInfo.GetReason()
+					}
+				}
+				if reason != "RATE_LIMITED" {
+					t.Fatalf("call %d: got reason %q, want RATE_LIMITED", i+1, reason)
+				}
+
+				// Events are written in background
+				deadline := time.Now().Add(time.Second)
+				for {
+					ch.mu.Lock()
+					n := len(ch.events)
+					var last *observability.ThrottleEvent
+					if n > 0 {
+						last = ch.events[n-1]
+					}
+					ch.mu.Unlock()
+
+					if n == rejected {
+						if last.Dimension != c.wantDimension || last.Method != loginMethod {
+							t.Fatalf("call %d: got event %+v, want dimension %s", i+1, last, c.wantDimension)
+						}
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("call %d: throttle event isn't written", i+1)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterUnaryAllowsWhenRedisFails(t *testing.T) {
+	rl, _ := newTestRateLimiter(t, failingLimiter{})
+	info := &grpc.UnaryServerInfo{FullMethod: loginMethod}
+
+	for range 10 {
+		resp, err := rl.Unary(contextFromIP("203.0.113.7"), &staffy.LoginRequest{Email: "a@example.com"}, info, okHandler)
+		if err != nil || resp != "ok" {
+			t.Fatalf("got %v n' %v, want the call to pass", resp, err)
+		}
+	}
+}
+
+func TestRateLimiterUnaryDisabled(t *testing.T) {
+	rl, _ := newTestRateLimiter(t, failingLimiter{})
+	rl.cfg.RateLimit.Enabled = false
+
+	if _, err := rl.Unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: loginMethod}, okHandler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRateLimiterKeysShareHashTag(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	store, err := redis.NewRateLimitStore(client)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	rl, _ := newTestRateLimiter(t, store)
+	info := &grpc.UnaryServerInfo{FullMethod: loginMethod}
+	if _, err := rl.Unary(contextFromIP("203.0.113.7"), &staffy.LoginRequest{Email: "a@example.com"}, info, okHandler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Redis Cluster hashes only the part in braces, so all counters of the script are in one slot
+	keys := mr.Keys()
+	if len(keys) != 3 {
+		t.Fatalf("got keys %v, want method, ip n' email", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "ratelimit:{"+loginMethod+"}:") {
+			t.Fatalf("key %q isn't tagged with the method", key)
+		}
+	}
+}
+
+func TestRateLimiterHTTP(t *testing.T) {
+	rl, _ := newTestRateLimiter(t, nil)
+	h := NewHTTPHandler(rl.cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil,
+		overloadedOAuth{}, nil, overloadedTokens{}, rl)
+
+	resolver, err := clientip.NewResolver("X-Forwarded-For", []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+	routes := resolver.Middleware(h.Routes())
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"service"},
+		"client_secret": {"secret"},
+		"token":         {"token"},
+	}
+
+	// The limiter passes requests to handlers, which answer 503, the ip limit of tests is 2
+	requests := []struct {
+		path     string
+		client   string
+		wantCode int
+	}{
+		{path: "/token", client: "203.0.113.7", wantCode: http.StatusServiceUnavailable},
+		{path: "/token", client: "203.0.113.7", wantCode: http.StatusServiceUnavailable},
+		{path: "/token", client: "203.0.113.7", wantCode: http.StatusTooManyRequests},
+		{path: "/token", client: "198.51.100.1", wantCode: http.StatusServiceUnavailable},
+		{path: "/introspect", client: "203.0.113.7", wantCode: http.StatusServiceUnavailable},
+	}
+
+	for i, r := range requests {
+		req := httptest.NewRequest(http.MethodPost, r.path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", r.client)
+		req.RemoteAddr = "10.0.0.1:51000"
+		rec := httptest.NewRecorder()
+
+		routes.ServeHTTP(rec, req)
+
+		if rec.Code != r.wantCode {
+			t.Fatalf("request %d: got status %d, want %d", i+1, rec.Code, r.wantCode)
+		}
+		if r.wantCode != http.StatusTooManyRequests {
+			continue
+		}
+
+		if got := rec.Header().Get("Retry-After"); got != "60" {
+			t.Fatalf("request %d: got Retry-After %q, want the window", i+1, got)
+		}
+
+		var body oauthError
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		if body.Error != "temporarily_unavailable" {
+			t.Fatalf("error: got %q, want temporarily_unavailable", body.Error)
+		}
+	}
+}
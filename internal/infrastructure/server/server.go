@@ -3,8 +3,10 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 
 	"github.com/devathh/staffy-sso/internal/infrastructure/config"
 	"github.com/devathh/staffy-sso/pkg/consts"
@@ -13,9 +15,11 @@ import (
 
 type Server struct {
 	grpcServer *grpc.Server
+	httpServer *http.Server
 	cfg        *config.Config
 }
 
+// Start serves grpc n' http, it returns when one of them stops
 func (s *Server) Start() error {
 	lis, err := net.Listen(
 		s.cfg.Server.GRPC.Protocol,
@@ -29,14 +33,34 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to create listener: %w", err)
 	}
 
-	if err := s.grpcServer.Serve(lis); err != nil {
-		return fmt.Errorf("failed to serve listener: %w", err)
+	httpLis, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to create http listener: %w", err)
 	}
 
-	return nil
+	errCh := make(chan error, 2)
+	go func() {
+		if err := s.grpcServer.Serve(lis); err != nil {
+			errCh <- fmt.Errorf("failed to serve listener: %w", err)
+			return
+		}
+		errCh <- nil
+	}()
+
+	go func() {
+		if err := s.httpServer.Serve(httpLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("failed to serve http listener: %w", err)
+			return
+		}
+		errCh <- nil
+	}()
+
+	return <-errCh
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	httpErr := s.httpServer.Shutdown(ctx)
+
 	stopped := make(chan struct{})
 	go func() {
 		s.grpcServer.GracefulStop()
@@ -48,17 +72,26 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.grpcServer.Stop()
 		return ctx.Err()
 	case <-stopped:
-		return nil
+		return httpErr
 	}
 }
 
-func NewServer(cfg *config.Config, grpcServer *grpc.Server) (*Server, error) {
+func NewServer(cfg *config.Config, grpcServer *grpc.Server, httpHandler http.Handler) (*Server, error) {
 	if cfg == nil {
 		return nil, consts.ErrNilCfg
 	}
 
 	return &Server{
 		grpcServer: grpcServer,
-		cfg:        cfg,
+		httpServer: &http.Server{
+			Addr: net.JoinHostPort(
+				cfg.Server.HTTP.Host,
+				cfg.Server.HTTP.Port,
+			),
+			Handler:      httpHandler,
+			ReadTimeout:  cfg.Server.RWTimeout,
+			WriteTimeout: cfg.Server.RWTimeout,
+		},
+		cfg: cfg,
 	}, nil
 }
@@ -0,0 +1,149 @@
+// Package clientip finds out the address of the client, also behind trusted proxies
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type ctxKey struct{}
+
+// NewContext keeps the resolved address of the client, FromContext returns it
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ip)
+}
+
+// FromContext returns the address resolved by the Resolver. Without it, it's the ip of the grpc peer
+// without the port, or an empty string if it's unknown
+func FromContext(ctx context.Context) string {
+	if ip, ok := ctx.Value(ctxKey{}).(string); ok {
+		return ip
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	return hostOf(p.Addr.String())
+}
+
+// Resolver takes the client from the header only, if the peer is one of trusted proxies. The header
+// is read from the right, each proxy appends the address it has got the request from, so the first
+// untrusted address is the client n' everything to the left of it may be forged.
+type Resolver struct {
+	header  string
+	trusted []netip.Prefix
+}
+
+// Resolve returns the client of the request from the peer n' values of the header
+func (r *Resolver) Resolve(peerAddr string, values []string) string {
+	client := hostOf(peerAddr)
+	if r.header == "" || !r.isTrusted(client) {
+		return client
+	}
+
+	var hops []string
+	for _, value := range values {
+		for hop := range strings.SplitSeq(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// A garbled hop can't be trusted to point further, the last known proxy is the client
+			return client
+		}
+
+		client = addr.Unmap().String()
+		if !r.isTrusted(client) {
+			return client
+		}
+	}
+
+	return client
+}
+
+// UnaryInterceptor resolves the client of the grpc call, it goes before interceptors, which need the ip
+func (r *Resolver) UnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var peerAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+
+	var values []string
+	if r.header != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values = md.Get(r.header)
+	}
+
+	return handler(NewContext(ctx, r.Resolve(peerAddr, values)), req)
+}
+
+// Middleware resolves the client of the http request
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var values []string
+		if r.header != "" {
+			values = req.Header.Values(r.header)
+		}
+
+		ip := r.Resolve(req.RemoteAddr, values)
+		next.ServeHTTP(w, req.WithContext(NewContext(req.Context(), ip)))
+	})
+}
+
+func (r *Resolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hostOf drops the port, addresses without it are returned as they are
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// NewResolver takes the header, e.g. X-Forwarded-For, n' CIDRs of proxies, which are trusted to set it.
+// Without trusted proxies the header is ignored
+func NewResolver(header string, trustedProxies []string) (*Resolver, error) {
+	trusted := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, cidr := range trustedProxies {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+
+		trusted = append(trusted, prefix.Masked())
+	}
+
+	return &Resolver{
+		header:  strings.TrimSpace(header),
+		trusted: trusted,
+	}, nil
+}
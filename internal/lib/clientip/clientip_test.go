@@ -0,0 +1,166 @@
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestFromContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "no peer", ctx: context.Background(), want: ""},
+		{name: "peer without address", ctx: peer.NewContext(context.Background(), &peer.Peer{}), want: ""},
+		{
+			name: "ipv4 with port",
+			ctx:  peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51000}}),
+			want: "203.0.113.7",
+		},
+		{
+			name: "ipv6 with port",
+			ctx:  peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51000}}),
+			want: "2001:db8::1",
+		},
+		{
+			name: "address without port",
+			ctx:  peer.NewContext(context.Background(), &peer.Peer{Addr: &net.UnixAddr{Name: "/run/sso.sock", Net: "unix"}}),
+			want: "/run/sso.sock",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromContext(tt.ctx); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromContextPrefersResolved(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 51000}})
+	if got := FromContext(NewContext(ctx, "203.0.113.7")); got != "203.0.113.7" {
+		t.Fatalf("got %q, want the resolved address", got)
+	}
+}
+
+func TestResolverResolve(t *testing.T) {
+	resolver, err := NewResolver("X-Forwarded-For", []string{"10.0.0.0/8", "2001:db8:ffff::/48"})
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		resolver *Resolver
+		peer     string
+		values   []string
+		want     string
+	}{
+		{name: "untrusted peer can't set the header", peer: "198.51.100.9:51000", values: []string{"203.0.113.7"}, want: "198.51.100.9"},
+		{name: "trusted proxy without the header", peer: "10.0.0.1:51000", want: "10.0.0.1"},
+		{name: "client behind one proxy", peer: "10.0.0.1:51000", values: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{
+			name:   "forged addresses to the left are skipped",
+			peer:   "10.0.0.1:51000",
+			values: []string{"192.0.2.1, 203.0.113.7"},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "chain of trusted proxies",
+			peer:   "10.0.0.1:51000",
+			values: []string{"203.0.113.7, 10.1.0.1", "10.2.0.1"},
+			want:   "203.0.113.7",
+		},
+		{name: "only proxies in the header", peer: "10.0.0.1:51000", values: []string{"10.1.0.1, 10.2.0.1"}, want: "10.1.0.1"},
+		{
+			name:   "garbled hop stops at the last proxy",
+			peer:   "10.0.0.1:51000",
+			values: []string{"203.0.113.7, unknown, 10.2.0.1"},
+			want:   "10.2.0.1",
+		},
+		{name: "ipv6 proxy n' client", peer: "[2001:db8:ffff::1]:51000", values: []string{"2001:db8::7"}, want: "2001:db8::7"},
+		{name: "ipv4 mapped client", peer: "10.0.0.1:51000", values: []string{"::ffff:203.0.113.7"}, want: "203.0.113.7"},
+		{
+			name:     "header is ignored without trusted proxies",
+			resolver: &Resolver{header: "X-Forwarded-For"},
+			peer:     "10.0.0.1:51000",
+			values:   []string{"203.0.113.7"},
+			want:     "10.0.0.1",
+		},
+		{name: "unknown peer", peer: "", values: []string{"203.0.113.7"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := resolver
+			if tt.resolver != nil {
+				r = tt.resolver
+			}
+
+			if got := r.Resolve(tt.peer, tt.values); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResolverRejectsInvalidProxy(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.1", "10.0.0.0/33", "proxy"} {
+		if _, err := NewResolver("X-Forwarded-For", []string{cidr}); err == nil {
+			t.Fatalf("%q is accepted", cidr)
+		}
+	}
+}
+
+func TestResolverUnaryInterceptor(t *testing.T) {
+	resolver, err := NewResolver("X-Forwarded-For", []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 51000}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "203.0.113.7"))
+
+	var got string
+	_, err = resolver.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ any) (any, error) {
+		got = FromContext(ctx)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "203.0.113.7" {
+		t.Fatalf("got %q, want 203.0.113.7", got)
+	}
+}
+
+func TestResolverMiddleware(t *testing.T) {
+	resolver, err := NewResolver("X-Forwarded-For", []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+
+	var got string
+	handler := resolver.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/token", nil)
+	req.RemoteAddr = "10.0.0.1:51000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "203.0.113.7" {
+		t.Fatalf("got %q, want 203.0.113.7", got)
+	}
+}
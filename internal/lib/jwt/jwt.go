@@ -2,40 +2,220 @@
 package jwt
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	domain "github.com/devathh/staffy-sso/internal/domain/token"
 	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrRevokedToken = errors.New("token has been revoked")
+	// ErrTokenType means the token isn't an access token, e.g. it's an ID token signed by the same keys
+	ErrTokenType = errors.New("token isn't an access token")
+	// ErrRevocationUnavailable means the token couldn't be checked, not that it's invalid
+	ErrRevocationUnavailable = errors.New("revocation list is unavailable")
+	// ErrSymmetricKey means the ID token can't be signed, clients can't verify HMAC signatures without the secret
+	ErrSymmetricKey = errors.New("id token cannot be signed with symmetric key")
+)
+
+// TokenTypeService marks tokens of backend services, they have no user
+const TokenTypeService = "service"
+
+// Kinds of access tokens, which tell whom the token was issued to
+const (
+	TokenKindUser      = "user"
+	TokenKindDelegated = "delegated"
+	TokenKindService   = "service"
+)
+
+// NumericDates are fractional (RFC 7519 allows it), so a token issued in the same second as the revocation
+// of the user is told from tokens issued before it. Tokens are issued at whole milliseconds, but they're parsed
+// at microseconds: the float64 of the claim may be a bit less than the millisecond, n' it's rounded back then
+func init() {
+	jwt.TimePrecision = time.Microsecond
+}
+
+// now is the issuance time of tokens, the watermark of revocations has the same precision
+func now() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
+
+// HeaderTypeAccessToken is the typ header of access tokens (RFC 9068). ID tokens keep the default JWT
+const HeaderTypeAccessToken = "at+jwt"
+
 type CustomClaims struct {
 	Email string
 	ID    uuid.UUID
+	// SessionID is the family of refresh tokens, the token was issued with
+	SessionID uuid.UUID
+	// ClientID n' Scope are set for tokens, which were issued to oauth clients
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// AuthTime is the time, when the user has entered credentials
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// Type is empty for tokens of users
+	Type          string `json:"type,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	// Roles are roles of the user, when the token was issued
+	Roles []string `json:"roles,omitempty"`
+	// OrgID is the active organization of the user n' OrgRole is the role inside it
+	OrgID   string `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IsDelegated reports whether the token was issued to a third-party client
+func (c *CustomClaims) IsDelegated() bool {
+	return c.ClientID != ""
+}
+
+// IsService reports whether the token was issued to a backend service by client credentials
+func (c *CustomClaims) IsService() bool {
+	return c.Type == TokenTypeService
+}
+
+// Kind is one of TokenKindUser, TokenKindDelegated n' TokenKindService. It's empty,
+// if the claims don't belong to any kind of access token
+func (c *CustomClaims) Kind() string {
+	switch {
+	case c.IsService():
+		if c.ClientID == "" {
+			return ""
+		}
+		return TokenKindService
+	case c.Type != "" || c.ID == uuid.Nil:
+		return ""
+	case c.IsDelegated():
+		return TokenKindDelegated
+	default:
+		return TokenKindUser
+	}
+}
+
+// IDTokenClaims are claims of OpenID Connect ID token. Profile claims are set according to granted scopes.
+type IDTokenClaims struct {
+	Nonce      string           `json:"nonce,omitempty"`
+	AuthTime   *jwt.NumericDate `json:"auth_time,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	GivenName  string           `json:"given_name,omitempty"`
+	FamilyName string           `json:"family_name,omitempty"`
+	Email      string           `json:"email,omitempty"`
+	// EmailVerified is set along with Email
+	EmailVerified *bool `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type TokenOption func(*CustomClaims)
+
+// WithClient marks the token as issued to the oauth client with the given scopes
+func WithClient(clientID string, scopes []string) TokenOption {
+	return func(c *CustomClaims) {
+		c.ClientID = clientID
+		c.Scope = strings.Join(scopes, " ")
+	}
+}
+
+func WithEmailVerified(verified bool) TokenOption {
+	return func(c *CustomClaims) {
+		c.EmailVerified = verified
+	}
+}
+
+func WithRoles(roles []string) TokenOption {
+	return func(c *CustomClaims) {
+		c.Roles = roles
+	}
+}
+
+func WithOrganization(orgID uuid.UUID, role string) TokenOption {
+	return func(c *CustomClaims) {
+		c.OrgID = orgID.String()
+		c.OrgRole = role
+	}
+}
+
+func WithAuthTime(authTime time.Time) TokenOption {
+	return func(c *CustomClaims) {
+		c.AuthTime = jwt.NewNumericDate(authTime)
+	}
+}
+
+// WithTokenID sets the jti, which is known before the token is issued, so it can be revoked later
+func WithTokenID(id string) TokenOption {
+	return func(c *CustomClaims) {
+		c.RegisteredClaims.ID = id
+	}
+}
+
 type JWT struct {
-	cfg *config.Config
+	cfg         *config.Config
+	keyring     *Keyring
+	revocations domain.RevocationList
 }
 
-func (j *JWT) GenerateToken(email string, id uuid.UUID) (string, error) {
-	secretKey := []byte(j.cfg.Secrets.JWT.SecretKey)
+func (j *JWT) GenerateToken(email string, id, sessionID uuid.UUID, opts ...TokenOption) (string, error) {
+	key := j.keyring.active()
+	issuedAt := now()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &CustomClaims{
-		Email: email,
-		ID:    id,
+	claims := &CustomClaims{
+		Email:     email,
+		ID:        id,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "staffy",
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.cfg.Secrets.JWT.TTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			Issuer:    j.cfg.Secrets.JWT.Issuer,
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(j.cfg.Secrets.JWT.TTL)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
 			Subject:   id.String(),
 		},
-	})
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	token.Header["typ"] = HeaderTypeAccessToken
+
+	tokenString, err := token.SignedString(key.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to get string of token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// GenerateServiceToken issues the token of the backend service. Its subject is the client id.
+func (j *JWT) GenerateServiceToken(clientID string, scopes []string) (string, error) {
+	key := j.keyring.active()
+	issuedAt := now()
+
+	claims := &CustomClaims{
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+		Type:     TokenTypeService,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    j.cfg.Secrets.JWT.Issuer,
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(j.cfg.OAuth.ServiceTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			Subject:   clientID,
+		},
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	token.Header["typ"] = HeaderTypeAccessToken
 
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString(key.private)
 	if err != nil {
 		return "", fmt.Errorf("failed to get string of token: %w", err)
 	}
@@ -43,30 +223,182 @@ func (j *JWT) GenerateToken(email string, id uuid.UUID) (string, error) {
 	return tokenString, nil
 }
 
-func (j *JWT) ValidateToken(tokenString string) (*CustomClaims, error) {
-	secretKey := []byte(j.cfg.Secrets.JWT.SecretKey)
+// GenerateIDToken signs the ID token for the client. Registered claims except subject n' audience are set here.
+// Only asymmetric keys sign ID tokens, the HMAC secret is shared by nobody but this service
+func (j *JWT) GenerateIDToken(claims *IDTokenClaims) (string, error) {
+	key := j.keyring.active()
+	if !key.isAsymmetric() {
+		return "", ErrSymmetricKey
+	}
+
+	issuedAt := now()
+	claims.Issuer = j.cfg.Secrets.JWT.Issuer
+	claims.IssuedAt = jwt.NewNumericDate(issuedAt)
+	claims.ExpiresAt = jwt.NewNumericDate(issuedAt.Add(j.cfg.Secrets.JWT.TTL))
 
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid token")
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	tokenString, err := token.SignedString(key.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to get string of id token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// IDTokenSigningAlgorithms returns algorithms of the published keys, which clients verify ID tokens with.
+// It's empty, if the active key is an HMAC secret n' ID tokens can't be issued
+func (j *JWT) IDTokenSigningAlgorithms() []string {
+	if !j.keyring.active().isAsymmetric() {
+		return nil
+	}
+
+	var algorithms []string
+	for _, jwk := range j.JWKS().Keys {
+		if !slices.Contains(algorithms, jwk.Alg) {
+			algorithms = append(algorithms, jwk.Alg)
 		}
+	}
 
-		return secretKey, nil
-	})
+	return algorithms
+}
+
+// ValidateToken checks signature n' expiration of the access token, n' that it hasn't been revoked
+func (j *JWT) ValidateToken(ctx context.Context, tokenString string) (*CustomClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, j.keyFunc)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*CustomClaims); ok {
-		return claims, nil
+	claims, ok := token.Claims.(*CustomClaims)
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+
+	if err := checkAccessToken(token, claims); err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("invalid token")
+	if err := j.checkRevocation(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
-func NewJWT(cfg *config.Config) *JWT {
-	return &JWT{
-		cfg: cfg,
+// checkAccessToken rejects tokens of other types. Access tokens have no audience n' are of a known kind.
+// Access tokens issued before the at+jwt header have the default typ, they're accepted until they expire.
+// ID tokens have the default typ as well, but they're told by the audience
+func checkAccessToken(token *jwt.Token, claims *CustomClaims) error {
+	typ, _ := token.Header["typ"].(string)
+	if !strings.EqualFold(typ, HeaderTypeAccessToken) && typ != "" && !strings.EqualFold(typ, "JWT") {
+		return ErrTokenType
+	}
+
+	if len(claims.Audience) > 0 || claims.Kind() == "" {
+		return ErrTokenType
+	}
+
+	return nil
+}
+
+// keyFunc picks the key by kid header. Tokens without kid were issued with the single HS256 secret,
+// before keys had ids. They're verified with the active key, so they're valid only while that secret is active
+func (j *JWT) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	key, ok := j.keyring.get(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown kid: %s", kid)
+	}
+
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.public, nil
+}
+
+func (j *JWT) checkRevocation(ctx context.Context, claims *CustomClaims) error {
+	if claims.RegisteredClaims.ID != "" {
+		revoked, err := j.revocations.IsTokenRevoked(ctx, claims.RegisteredClaims.ID)
+		if err != nil {
+			return fmt.Errorf("%w: failed to check token revocation: %w", ErrRevocationUnavailable, err)
+		}
+		if revoked {
+			return ErrRevokedToken
+		}
+	}
+
+	// Services have no user, whose tokens could be revoked
+	if claims.IsService() {
+		return nil
+	}
+
+	revokedBefore, err := j.revocations.UserRevokedBefore(ctx, claims.ID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check user's revocation: %w", ErrRevocationUnavailable, err)
+	}
+
+	if claims.IssuedAt == nil {
+		return ErrRevokedToken
+	}
+
+	// Tokens issued before the millisecond precision have iat truncated to seconds, they're revoked in the second
+	// of the revocation too. The token issued in the same millisecond, e.g. the new token of ChangePassword, stays valid
+	if claims.IssuedAt.Round(time.Millisecond).Before(revokedBefore) {
+		return ErrRevokedToken
+	}
+
+	return nil
+}
+
+// JWKS returns public keys, which tokens can be verified with. HMAC secrets are never published.
+func (j *JWT) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range j.keyring.verificationKeys() {
+		if !key.isAsymmetric() {
+			continue
+		}
+
+		jwk, err := toJWK(key)
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// ReloadKeys re-reads the keyring, so keys can be promoted n' retired without a restart.
+// If the keyring is invalid, the current one is kept.
+func (j *JWT) ReloadKeys() error {
+	keys, activeID, err := loadKeys(j.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to reload keyring: %w", err)
 	}
+
+	j.keyring.set(keys, activeID)
+	return nil
+}
+
+func NewJWT(cfg *config.Config, revocations domain.RevocationList) (*JWT, error) {
+	if cfg == nil {
+		return nil, consts.ErrNilCfg
+	}
+
+	keyring, err := newKeyring(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring: %w", err)
+	}
+
+	return &JWT{
+		cfg:         cfg,
+		keyring:     keyring,
+		revocations: revocations,
+	}, nil
 }
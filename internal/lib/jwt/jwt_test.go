@@ -0,0 +1,442 @@
+package jwt
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// fakeRevocations is an in-memory revocation list
+type fakeRevocations struct {
+	mu     sync.Mutex
+	tokens map[string]bool
+	users  map[uuid.UUID]time.Time
+	err    error
+}
+
+func newFakeRevocations() *fakeRevocations {
+	return &fakeRevocations{
+		tokens: make(map[string]bool),
+		users:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (f *fakeRevocations) RevokeToken(_ context.Context, jti string, _ time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tokens[jti] = true
+	return f.err
+}
+
+func (f *fakeRevocations) IsTokenRevoked(_ context.Context, jti string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.tokens[jti], f.err
+}
+
+func (f *fakeRevocations) RevokeUser(_ context.Context, userID uuid.UUID, before time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.users[userID] = before
+	return f.err
+}
+
+func (f *fakeRevocations) UserRevokedBefore(_ context.Context, userID uuid.UUID) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.users[userID], f.err
+}
+
+func newTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Secrets.JWT.Issuer = "staffy-test"
+	cfg.Secrets.JWT.TTL = time.Hour
+	cfg.Secrets.JWT.RefreshTTL = 24 * time.Hour
+	cfg.Secrets.JWT.SecretKey = "test-secret-key-of-32-characters"
+	cfg.Secrets.JWT.Algorithm = AlgorithmHS256
+	cfg.OAuth.ServiceTokenTTL = time.Hour
+
+	return cfg
+}
+
+func newTestJWT(t *testing.T, cfg *config.Config, revocations *fakeRevocations) *JWT {
+	t.Helper()
+
+	j, err := NewJWT(cfg, revocations)
+	if err != nil {
+		t.Fatalf("failed to create jwt: %v", err)
+	}
+
+	return j
+}
+
+func TestValidateTokenRevocationWatermark(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name string
+		// revoke is called after the token has been issued
+		revoke  func(r *fakeRevocations, claims *CustomClaims)
+		wantErr error
+	}{
+		{
+			name:    "not revoked",
+			revoke:  func(*fakeRevocations, *CustomClaims) {},
+			wantErr: nil,
+		},
+		{
+			name: "watermark after issuance",
+			revoke: func(r *fakeRevocations, _ *CustomClaims) {
+				r.users[userID] = time.Now().Add(time.Second)
+			},
+			wantErr: ErrRevokedToken,
+		},
+		{
+			name: "watermark a millisecond after issuance",
+			revoke: func(r *fakeRevocations, claims *CustomClaims) {
+				r.users[userID] = claims.IssuedAt.Add(time.Millisecond)
+			},
+			wantErr: ErrRevokedToken,
+		},
+		{
+			name: "watermark at issuance",
+			revoke: func(r *fakeRevocations, claims *CustomClaims) {
+				r.users[userID] = claims.IssuedAt.Time
+			},
+			wantErr: nil,
+		},
+		{
+			name: "watermark before issuance",
+			revoke: func(r *fakeRevocations, _ *CustomClaims) {
+				r.users[userID] = time.Now().Add(-time.Minute)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "watermark of another user",
+			revoke: func(r *fakeRevocations, _ *CustomClaims) {
+				r.users[uuid.New()] = time.Now().Add(time.Minute)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "revoked jti",
+			revoke: func(r *fakeRevocations, claims *CustomClaims) {
+				r.tokens[claims.RegisteredClaims.ID] = true
+			},
+			wantErr: ErrRevokedToken,
+		},
+		{
+			name: "revocation list is down",
+			revoke: func(r *fakeRevocations, _ *CustomClaims) {
+				r.err = errors.New("connection refused")
+			},
+			wantErr: ErrRevocationUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revocations := newFakeRevocations()
+			j := newTestJWT(t, newTestConfig(), revocations)
+
+			token, err := j.GenerateToken("user@example.com", userID, uuid.New())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			claims, err := j.ValidateToken(t.Context(), token)
+			if err != nil {
+				t.Fatalf("fresh token is invalid: %v", err)
+			}
+
+			tt.revoke(revocations, claims)
+
+			_, err = j.ValidateToken(t.Context(), token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateTokenIssuedAtWatermark checks tokens issued in the millisecond of the revocation.
+// iat goes through float64, so some milliseconds are parsed a millisecond earlier
+func TestValidateTokenIssuedAtWatermark(t *testing.T) {
+	revocations := newFakeRevocations()
+	j := newTestJWT(t, newTestConfig(), revocations)
+	key := j.keyring.active()
+	userID := uuid.New()
+	base := time.Now().Truncate(time.Second)
+
+	for ms := range 1000 {
+		issuedAt := base.Add(time.Duration(ms) * time.Millisecond)
+		token := jwt.NewWithClaims(key.method, &CustomClaims{
+			ID: userID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+			},
+		})
+		token.Header["kid"] = key.id
+		token.Header["typ"] = HeaderTypeAccessToken
+		tokenString, err := token.SignedString(key.private)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+
+		// The watermark is what the revocation list keeps, milliseconds since epoch
+		revocations.users[userID] = time.UnixMilli(issuedAt.UnixMilli())
+		if _, err := j.ValidateToken(t.Context(), tokenString); err != nil {
+			t.Fatalf("token issued at %s: %v", issuedAt.Format(time.RFC3339Nano), err)
+		}
+
+		revocations.users[userID] = time.UnixMilli(issuedAt.UnixMilli() + 1)
+		if _, err := j.ValidateToken(t.Context(), tokenString); !errors.Is(err, ErrRevokedToken) {
+			t.Fatalf("token issued at %s: got %v, want %v", issuedAt.Format(time.RFC3339Nano), err, ErrRevokedToken)
+		}
+	}
+}
+
+func TestValidateServiceTokenIgnoresWatermark(t *testing.T) {
+	revocations := newFakeRevocations()
+	j := newTestJWT(t, newTestConfig(), revocations)
+
+	token, err := j.GenerateServiceToken("billing", []string{"users:read"})
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	// Service tokens have no user, the watermark of the nil user mustn't apply to them
+	revocations.users[uuid.Nil] = time.Now().Add(time.Minute)
+
+	if _, err := j.ValidateToken(t.Context(), token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateTokenType(t *testing.T) {
+	// ID tokens are signed only with asymmetric keys
+	cfg := newTestConfig()
+	cfg.Secrets.JWT.Algorithm = AlgorithmEdDSA
+	cfg.Secrets.JWT.PrivateKeyPath = writeKey(t, edKeyPEM(t))
+	revocations := newFakeRevocations()
+	j := newTestJWT(t, cfg, revocations)
+	userID := uuid.New()
+
+	// sign signs the claims with the active key n' the given typ header
+	sign := func(claims jwt.Claims, typ string) string {
+		key := j.keyring.active()
+		token := jwt.NewWithClaims(key.method, claims)
+		token.Header["kid"] = key.id
+		if typ != "" {
+			token.Header["typ"] = typ
+		} else {
+			delete(token.Header, "typ")
+		}
+
+		s, err := token.SignedString(key.private)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return s
+	}
+
+	registered := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		}
+	}
+
+	accessToken, err := j.GenerateToken("user@example.com", userID, uuid.New())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	serviceToken, err := j.GenerateServiceToken("billing", []string{"users:read"})
+	if err != nil {
+		t.Fatalf("failed to generate service token: %v", err)
+	}
+	idToken, err := j.GenerateIDToken(&IDTokenClaims{
+		Email: "user@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  userID.String(),
+			Audience: jwt.ClaimStrings{"app"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to generate id token: %v", err)
+	}
+
+	withAudience := registered()
+	withAudience.Audience = jwt.ClaimStrings{"app"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "access token", token: accessToken},
+		{name: "service token", token: serviceToken},
+		{name: "id token", token: idToken, wantErr: ErrTokenType},
+		{
+			name:  "legacy token without typ header",
+			token: sign(&CustomClaims{ID: userID, RegisteredClaims: registered()}, ""),
+		},
+		{
+			name:  "legacy token with default typ header",
+			token: sign(&CustomClaims{ID: userID, RegisteredClaims: registered()}, "JWT"),
+		},
+		{
+			name:    "legacy token with audience",
+			token:   sign(&CustomClaims{ID: userID, RegisteredClaims: withAudience}, "JWT"),
+			wantErr: ErrTokenType,
+		},
+		{
+			name:    "token of another type",
+			token:   sign(&CustomClaims{ID: userID, RegisteredClaims: registered()}, "logout+jwt"),
+			wantErr: ErrTokenType,
+		},
+		{
+			name:  "typ header is case-insensitive",
+			token: sign(&CustomClaims{ID: userID, RegisteredClaims: registered()}, "AT+JWT"),
+		},
+		{
+			name:    "access token with audience",
+			token:   sign(&CustomClaims{ID: userID, RegisteredClaims: withAudience}, HeaderTypeAccessToken),
+			wantErr: ErrTokenType,
+		},
+		{
+			name:    "user token without user",
+			token:   sign(&CustomClaims{RegisteredClaims: registered()}, HeaderTypeAccessToken),
+			wantErr: ErrTokenType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := j.ValidateToken(t.Context(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLegacyToken(t *testing.T) {
+	j := newTestJWT(t, newTestConfig(), newFakeRevocations())
+	userID := uuid.New()
+
+	// Tokens issued before the keyring n' at+jwt: HS256 with the default typ n' no kid
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &CustomClaims{
+		Email: "user@example.com",
+		ID:    userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	tokenString, err := token.SignedString([]byte(newTestConfig().Secrets.JWT.SecretKey))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	claims, err := j.ValidateToken(t.Context(), tokenString)
+	if err != nil {
+		t.Fatalf("legacy token is invalid: %v", err)
+	}
+	if claims.ID != userID {
+		t.Fatalf("got user %s, want %s", claims.ID, userID)
+	}
+}
+
+func TestIDTokenSigningKey(t *testing.T) {
+	claims := func() *IDTokenClaims {
+		return &IDTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:  uuid.NewString(),
+				Audience: jwt.ClaimStrings{"app"},
+			},
+		}
+	}
+
+	t.Run("hmac secret", func(t *testing.T) {
+		j := newTestJWT(t, newTestConfig(), newFakeRevocations())
+
+		if _, err := j.GenerateIDToken(claims()); !errors.Is(err, ErrSymmetricKey) {
+			t.Fatalf("got %v, want %v", err, ErrSymmetricKey)
+		}
+		if algorithms := j.IDTokenSigningAlgorithms(); len(algorithms) != 0 {
+			t.Fatalf("got %v, want none", algorithms)
+		}
+	})
+
+	t.Run("asymmetric key", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Secrets.JWT.Algorithm = AlgorithmES256
+		cfg.Secrets.JWT.PrivateKeyPath = writeKey(t, ecKeyPEM(t, elliptic.P256()))
+		j := newTestJWT(t, cfg, newFakeRevocations())
+
+		if _, err := j.GenerateIDToken(claims()); err != nil {
+			t.Fatalf("failed to generate id token: %v", err)
+		}
+		if algorithms := j.IDTokenSigningAlgorithms(); !slices.Equal(algorithms, []string{AlgorithmES256}) {
+			t.Fatalf("got %v, want [%s]", algorithms, AlgorithmES256)
+		}
+	})
+
+	t.Run("keyring with hmac key", func(t *testing.T) {
+		keyring := newTestKeyring(t)
+		cfg := newTestConfig()
+		cfg.Secrets.JWT.KeyringPath = keyring.writeManifest(t, "es-1",
+			manifestKey{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+			manifestKey{kid: "ed-1", algorithm: AlgorithmEdDSA, file: "ed-1.pem"},
+			manifestKey{kid: "hs-1", algorithm: AlgorithmHS256, file: "hs-1.key"},
+		)
+		j := newTestJWT(t, cfg, newFakeRevocations())
+
+		// Only algorithms of the published keys are advertised
+		algorithms := j.IDTokenSigningAlgorithms()
+		slices.Sort(algorithms)
+		if !slices.Equal(algorithms, []string{AlgorithmES256, AlgorithmEdDSA}) {
+			t.Fatalf("got %v, want [%s %s]", algorithms, AlgorithmES256, AlgorithmEdDSA)
+		}
+	})
+}
+
+func TestCustomClaimsKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims CustomClaims
+		want   string
+	}{
+		{name: "user", claims: CustomClaims{ID: uuid.New()}, want: TokenKindUser},
+		{name: "delegated", claims: CustomClaims{ID: uuid.New(), ClientID: "app"}, want: TokenKindDelegated},
+		{name: "service", claims: CustomClaims{ClientID: "billing", Type: TokenTypeService}, want: TokenKindService},
+		{name: "service without client", claims: CustomClaims{Type: TokenTypeService}, want: ""},
+		{name: "no user", claims: CustomClaims{}, want: ""},
+		{name: "unknown type", claims: CustomClaims{ID: uuid.New(), Type: "refresh"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.Kind(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
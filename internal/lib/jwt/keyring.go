@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/goccy/go-yaml"
+)
+
+// Keyring keeps signing keys by their ids. Tokens are signed with the active key, n'
+// retired keys are still accepted for verification during the grace period.
+type Keyring struct {
+	mu       sync.RWMutex
+	keys     map[string]*signingKey
+	activeID string
+	grace    time.Duration
+}
+
+// keyringManifest describes keys of the keyring. Key files are resolved relative to the manifest.
+//
+//	active: 2026-10
+//	keys:
+//	  - kid: 2026-10
+//	    algorithm: ES256
+//	    file: 2026-10.pem
+//	  - kid: 2026-04
+//	    algorithm: ES256
+//	    file: 2026-04.pem
+//	    retired_at: 2026-10-17T00:00:00Z
+type keyringManifest struct {
+	Active string `yaml:"active"`
+	Keys   []struct {
+		ID        string `yaml:"kid"`
+		Algorithm string `yaml:"algorithm"`
+		File      string `yaml:"file"`
+		RetiredAt string `yaml:"retired_at"`
+	} `yaml:"keys"`
+}
+
+func (k *Keyring) active() *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[k.activeID]
+}
+
+// get returns the key, which token can be verified with
+func (k *Keyring) get(kid string) (*signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" {
+		kid = k.activeID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok || k.isExpired(key) {
+		return nil, false
+	}
+
+	return key, true
+}
+
+// verificationKeys returns all keys, which are still accepted
+func (k *Keyring) verificationKeys() []*signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]*signingKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		if !k.isExpired(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (k *Keyring) isExpired(key *signingKey) bool {
+	return key.isRetired() && time.Now().After(key.retiredAt.Add(k.grace))
+}
+
+func (k *Keyring) set(keys map[string]*signingKey, activeID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = keys
+	k.activeID = activeID
+}
+
+// loadKeys reads the keyring manifest, or the single key from secrets.jwt if there's no manifest
+func loadKeys(cfg *config.Config) (map[string]*signingKey, string, error) {
+	if cfg.Secrets.JWT.KeyringPath == "" {
+		key, err := loadSigningKey(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return map[string]*signingKey{key.id: key}, key.id, nil
+	}
+
+	data, err := os.ReadFile(cfg.Secrets.JWT.KeyringPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read keyring manifest: %w", err)
+	}
+
+	var manifest keyringManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal keyring manifest: %w", err)
+	}
+
+	dir := filepath.Dir(cfg.Secrets.JWT.KeyringPath)
+	keys := make(map[string]*signingKey, len(manifest.Keys))
+	for _, entry := range manifest.Keys {
+		if entry.ID == "" {
+			return nil, "", errors.New("kid cannot be empty")
+		}
+		if _, ok := keys[entry.ID]; ok {
+			return nil, "", fmt.Errorf("duplicated kid: %s", entry.ID)
+		}
+
+		path := entry.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		keyData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read key %s: %w", entry.ID, err)
+		}
+		if entry.Algorithm == AlgorithmHS256 {
+			keyData = bytes.TrimSpace(keyData)
+		}
+
+		key, err := parseSigningKey(entry.ID, entry.Algorithm, keyData)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid key %s: %w", entry.ID, err)
+		}
+
+		if entry.RetiredAt != "" {
+			key.retiredAt, err = time.Parse(time.RFC3339, entry.RetiredAt)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid retired_at of key %s: %w", entry.ID, err)
+			}
+		}
+
+		keys[key.id] = key
+	}
+
+	active, ok := keys[manifest.Active]
+	if !ok {
+		return nil, "", fmt.Errorf("active key %q isn't in the keyring", manifest.Active)
+	}
+	if active.isRetired() {
+		return nil, "", fmt.Errorf("active key %q is retired", manifest.Active)
+	}
+
+	return keys, active.id, nil
+}
+
+func newKeyring(cfg *config.Config) (*Keyring, error) {
+	keys, activeID, err := loadKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retired keys must outlive the tokens they've signed
+	grace := cfg.Secrets.JWT.KeyGracePeriod
+	if grace == 0 {
+		grace = cfg.Secrets.JWT.TTL
+	}
+
+	return &Keyring{
+		keys:     keys,
+		activeID: activeID,
+		grace:    grace,
+	}, nil
+}
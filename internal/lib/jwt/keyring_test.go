@@ -0,0 +1,364 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// testKeyring writes keys n' manifests of the keyring into a temporary directory
+type testKeyring struct {
+	dir string
+}
+
+func newTestKeyring(t *testing.T) *testKeyring {
+	t.Helper()
+
+	k := &testKeyring{dir: t.TempDir()}
+	k.writeES256(t, "es-1")
+	k.writeES256(t, "es-2")
+	k.writeEdDSA(t, "ed-1")
+	k.writeFile(t, "hs-1.key", []byte("test-secret-key-of-32-characters\n"))
+
+	return k
+}
+
+func (k *testKeyring) writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(k.dir, name), data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+func (k *testKeyring) writeES256(t *testing.T, kid string) {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	k.writeFile(t, kid+".pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+func (k *testKeyring) writeEdDSA(t *testing.T, kid string) {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	k.writeFile(t, kid+".pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// manifestKey is an entry of the manifest, retiredAt is empty for keys in use
+type manifestKey struct {
+	kid, algorithm, file, retiredAt string
+}
+
+func (k *testKeyring) writeManifest(t *testing.T, active string, keys ...manifestKey) string {
+	t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "active: %q\nkeys:\n", active)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "  - kid: %q\n    algorithm: %s\n    file: %s\n", key.kid, key.algorithm, key.file)
+		if key.retiredAt != "" {
+			fmt.Fprintf(&b, "    retired_at: %q\n", key.retiredAt)
+		}
+	}
+
+	k.writeFile(t, "keyring.yml", []byte(b.String()))
+	return filepath.Join(k.dir, "keyring.yml")
+}
+
+func kidOf(t *testing.T, tokenString string) string {
+	t.Helper()
+
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &CustomClaims{})
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func jwksKids(j *JWT) []string {
+	var kids []string
+	for _, key := range j.JWKS().Keys {
+		kids = append(kids, key.Kid)
+	}
+	slices.Sort(kids)
+
+	return kids
+}
+
+func TestKeyRotationByKid(t *testing.T) {
+	keyring := newTestKeyring(t)
+	cfg := newTestConfig()
+	cfg.Secrets.JWT.KeyringPath = keyring.writeManifest(t, "es-1",
+		manifestKey{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+	)
+
+	j := newTestJWT(t, cfg, newFakeRevocations())
+	old, err := j.GenerateToken("user@example.com", uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	if kid := kidOf(t, old); kid != "es-1" {
+		t.Fatalf("got kid %q, want es-1", kid)
+	}
+
+	steps := []struct {
+		name      string
+		active    string
+		retiredAt string
+		// wantOld is whether the token signed by es-1 is still accepted
+		wantOld  bool
+		wantKid  string
+		wantJWKS []string
+	}{
+		{
+			name:      "promoted key signs, retired one still verifies",
+			active:    "es-2",
+			retiredAt: time.Now().UTC().Format(time.RFC3339),
+			wantOld:   true,
+			wantKid:   "es-2",
+			wantJWKS:  []string{"es-1", "es-2"},
+		},
+		{
+			name:      "key is dropped after the grace period",
+			active:    "es-2",
+			retiredAt: time.Now().UTC().Add(-2 * cfg.Secrets.JWT.TTL).Format(time.RFC3339),
+			wantOld:   false,
+			wantKid:   "es-2",
+			wantJWKS:  []string{"es-2"},
+		},
+	}
+
+	for _, step := range steps {
+		keyring.writeManifest(t, step.active,
+			manifestKey{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem", retiredAt: step.retiredAt},
+			manifestKey{kid: "es-2", algorithm: AlgorithmES256, file: "es-2.pem"},
+		)
+		if err := j.ReloadKeys(); err != nil {
+			t.Fatalf("%s: failed to reload keys: %v", step.name, err)
+		}
+
+		_, err := j.ValidateToken(t.Context(), old)
+		if got := err == nil; got != step.wantOld {
+			t.Fatalf("%s: old token accepted = %v, want %v (%v)", step.name, got, step.wantOld, err)
+		}
+
+		fresh, err := j.GenerateToken("user@example.com", uuid.New(), uuid.New())
+		if err != nil {
+			t.Fatalf("%s: failed to generate token: %v", step.name, err)
+		}
+		if kid := kidOf(t, fresh); kid != step.wantKid {
+			t.Fatalf("%s: got kid %q, want %q", step.name, kid, step.wantKid)
+		}
+		if _, err := j.ValidateToken(t.Context(), fresh); err != nil {
+			t.Fatalf("%s: fresh token is invalid: %v", step.name, err)
+		}
+
+		if kids := jwksKids(j); !slices.Equal(kids, step.wantJWKS) {
+			t.Fatalf("%s: got jwks %v, want %v", step.name, kids, step.wantJWKS)
+		}
+	}
+}
+
+func TestReloadKeysKeepsKeyringOnError(t *testing.T) {
+	keyring := newTestKeyring(t)
+	cfg := newTestConfig()
+	cfg.Secrets.JWT.KeyringPath = keyring.writeManifest(t, "es-1",
+		manifestKey{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+	)
+
+	j := newTestJWT(t, cfg, newFakeRevocations())
+	token, err := j.GenerateToken("user@example.com", uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	keyring.writeManifest(t, "missing",
+		manifestKey{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+	)
+	if err := j.ReloadKeys(); err == nil {
+		t.Fatal("expected an error for invalid keyring")
+	}
+
+	if _, err := j.ValidateToken(t.Context(), token); err != nil {
+		t.Fatalf("keyring has been replaced by the invalid one: %v", err)
+	}
+}
+
+func TestLoadKeysValidation(t *testing.T) {
+	keyring := newTestKeyring(t)
+	past := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name    string
+		active  string
+		keys    []manifestKey
+		wantErr bool
+	}{
+		{
+			name:   "mixed algorithms",
+			active: "ed-1",
+			keys: []manifestKey{
+				{kid: "ed-1", algorithm: AlgorithmEdDSA, file: "ed-1.pem"},
+				{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+				{kid: "hs-1", algorithm: AlgorithmHS256, file: "hs-1.key"},
+			},
+		},
+		{
+			name:    "empty kid",
+			active:  "es-1",
+			keys:    []manifestKey{{kid: "", algorithm: AlgorithmES256, file: "es-1.pem"}},
+			wantErr: true,
+		},
+		{
+			name:   "duplicated kid",
+			active: "es-1",
+			keys: []manifestKey{
+				{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+				{kid: "es-1", algorithm: AlgorithmES256, file: "es-2.pem"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "active key isn't in the keyring",
+			active:  "es-2",
+			keys:    []manifestKey{{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"}},
+			wantErr: true,
+		},
+		{
+			name:    "active key is retired",
+			active:  "es-1",
+			keys:    []manifestKey{{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem", retiredAt: past}},
+			wantErr: true,
+		},
+		{
+			name:   "invalid retired_at",
+			active: "es-1",
+			keys: []manifestKey{
+				{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+				{kid: "es-2", algorithm: AlgorithmES256, file: "es-2.pem", retiredAt: "yesterday"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "algorithm doesn't match the key",
+			active:  "es-1",
+			keys:    []manifestKey{{kid: "es-1", algorithm: AlgorithmEdDSA, file: "es-1.pem"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing key file",
+			active:  "es-3",
+			keys:    []manifestKey{{kid: "es-3", algorithm: AlgorithmES256, file: "es-3.pem"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Secrets.JWT.KeyringPath = keyring.writeManifest(t, tt.active, tt.keys...)
+
+			_, _, err := loadKeys(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsForeignKeys(t *testing.T) {
+	keyring := newTestKeyring(t)
+	cfg := newTestConfig()
+	cfg.Secrets.JWT.KeyringPath = keyring.writeManifest(t, "es-1",
+		manifestKey{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+		manifestKey{kid: "hs-1", algorithm: AlgorithmHS256, file: "hs-1.key"},
+	)
+	j := newTestJWT(t, cfg, newFakeRevocations())
+
+	other := newTestKeyring(t)
+	otherCfg := newTestConfig()
+	otherCfg.Secrets.JWT.KeyringPath = other.writeManifest(t, "es-1",
+		manifestKey{kid: "es-1", algorithm: AlgorithmES256, file: "es-1.pem"},
+	)
+	foreign := newTestJWT(t, otherCfg, newFakeRevocations())
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, &CustomClaims{
+			ID: uuid.New(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+			},
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		token.Header["typ"] = HeaderTypeAccessToken
+
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return s
+	}
+
+	esKey, _ := j.keyring.get("es-1")
+	hsKey, _ := j.keyring.get("hs-1")
+	foreignToken, err := foreign.GenerateToken("user@example.com", uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "known kid", token: sign(jwt.SigningMethodES256, "es-1", esKey.private)},
+		{name: "no kid is verified with the active key", token: sign(jwt.SigningMethodES256, "", esKey.private)},
+		{name: "unknown kid", token: sign(jwt.SigningMethodES256, "es-9", esKey.private), wantErr: true},
+		{name: "same kid of another keyring", token: foreignToken, wantErr: true},
+		{name: "algorithm of another key", token: sign(jwt.SigningMethodHS256, "es-1", hsKey.private), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := j.ValidateToken(t.Context(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
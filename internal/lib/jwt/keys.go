@@ -0,0 +1,227 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultKeyID identifies the key from SECRET_KEY
+const defaultKeyID = "default"
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// signingKey is a key, which tokens are signed n' verified with
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   any
+	public    any
+	retiredAt time.Time
+}
+
+// isAsymmetric reports whether the key can be published
+func (k *signingKey) isAsymmetric() bool {
+	return k.method.Alg() != AlgorithmHS256
+}
+
+func (k *signingKey) isRetired() bool {
+	return !k.retiredAt.IsZero()
+}
+
+// loadSigningKey loads the single key from secrets.jwt, it's used when there's no keyring
+func loadSigningKey(cfg *config.Config) (*signingKey, error) {
+	algorithm := cfg.Secrets.JWT.Algorithm
+	if algorithm == "" || algorithm == AlgorithmHS256 {
+		return parseSigningKey(defaultKeyID, AlgorithmHS256, []byte(cfg.Secrets.JWT.SecretKey))
+	}
+
+	pemBytes, err := os.ReadFile(cfg.Secrets.JWT.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	return parseSigningKey("", algorithm, pemBytes)
+}
+
+// parseSigningKey parses PEM private key or HMAC secret. If kid is empty, the key is
+// identified by its RFC 7638 thumbprint.
+func parseSigningKey(kid, algorithm string, data []byte) (*signingKey, error) {
+	var key signingKey
+
+	switch algorithm {
+	case AlgorithmHS256:
+		if len(data) == 0 {
+			return nil, errors.New("jwt secret key is empty")
+		}
+
+		key = signingKey{method: jwt.SigningMethodHS256, private: data, public: data}
+	case AlgorithmRS256:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rsa key: %w", err)
+		}
+		if private.N.BitLen() < 2048 {
+			return nil, errors.New("rsa key must be at least 2048 bits")
+		}
+
+		key = signingKey{method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey}
+	case AlgorithmES256:
+		private, err := jwt.ParseECPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ecdsa key: %w", err)
+		}
+		if private.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 requires a P-256 key")
+		}
+
+		key = signingKey{method: jwt.SigningMethodES256, private: private, public: &private.PublicKey}
+	case AlgorithmEdDSA:
+		private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ed25519 key: %w", err)
+		}
+
+		edPrivate, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid ed25519 key")
+		}
+
+		key = signingKey{method: jwt.SigningMethodEdDSA, private: edPrivate, public: edPrivate.Public()}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	key.id = kid
+	if key.id != "" {
+		return &key, nil
+	}
+
+	if !key.isAsymmetric() {
+		return nil, errors.New("kid of hmac key cannot be empty")
+	}
+
+	jwk, err := toJWK(&key)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	key.id = id
+
+	return &key, nil
+}
+
+// JWK is a public key in the format of RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func toJWK(key *signingKey) (JWK, error) {
+	jwk := JWK{
+		Kid: key.id,
+		Use: "sig",
+		Alg: key.method.Alg(),
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64(public.N.Bytes())
+		jwk.E = encodeBase64(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdh, err := public.ECDH()
+		if err != nil {
+			return JWK{}, fmt.Errorf("invalid ecdsa key: %w", err)
+		}
+
+		// Uncompressed point is 0x04 || X || Y
+		point := ecdh.Bytes()[1:]
+		size := len(point) / 2
+
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = encodeBase64(point[:size])
+		jwk.Y = encodeBase64(point[size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64(public)
+	default:
+		return JWK{}, errors.New("key cannot be published")
+	}
+
+	return jwk, nil
+}
+
+// thumbprint returns RFC 7638 thumbprint of the key, which is used as its id
+func thumbprint(jwk JWK) (string, error) {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwk: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return encodeBase64(sum[:]), nil
+}
+
+func encodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
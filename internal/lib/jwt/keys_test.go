@@ -0,0 +1,230 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// writeKey writes the PEM of the private key into a temporary file
+func writeKey(t *testing.T, block *pem.Block) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "private.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return path
+}
+
+func rsaKeyPEM(t *testing.T, bits int) *pem.Block {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}
+}
+
+func ecKeyPEM(t *testing.T, curve elliptic.Curve) *pem.Block {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+}
+
+func edKeyPEM(t *testing.T) *pem.Block {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+}
+
+// publicKeyOf rebuilds the public key from the published JWK, as relying parties do
+func publicKeyOf(t *testing.T, jwk JWK) any {
+	t.Helper()
+
+	decode := func(s string) []byte {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("invalid base64url %q: %v", s, err)
+		}
+		return data
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decode(jwk.N)),
+			E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64()),
+		}
+	case "EC":
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(decode(jwk.X)),
+			Y:     new(big.Int).SetBytes(decode(jwk.Y)),
+		}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	default:
+		t.Fatalf("unexpected kty: %s", jwk.Kty)
+		return nil
+	}
+}
+
+func TestAsymmetricSigningWithJWKS(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		key       func(t *testing.T) *pem.Block
+		kty, crv  string
+	}{
+		{algorithm: AlgorithmRS256, key: func(t *testing.T) *pem.Block { return rsaKeyPEM(t, 2048) }, kty: "RSA"},
+		{algorithm: AlgorithmES256, key: func(t *testing.T) *pem.Block { return ecKeyPEM(t, elliptic.P256()) }, kty: "EC", crv: "P-256"},
+		{algorithm: AlgorithmEdDSA, key: edKeyPEM, kty: "OKP", crv: "Ed25519"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Secrets.JWT.Algorithm = tt.algorithm
+			cfg.Secrets.JWT.PrivateKeyPath = writeKey(t, tt.key(t))
+			j := newTestJWT(t, cfg, newFakeRevocations())
+
+			tokenString, err := j.GenerateToken("user@example.com", uuid.New(), uuid.New())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+			if _, err := j.ValidateToken(t.Context(), tokenString); err != nil {
+				t.Fatalf("token is invalid: %v", err)
+			}
+
+			jwks := j.JWKS()
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("got %d keys, want 1", len(jwks.Keys))
+			}
+			jwk := jwks.Keys[0]
+			if jwk.Kty != tt.kty || jwk.Crv != tt.crv || jwk.Alg != tt.algorithm || jwk.Use != "sig" {
+				t.Fatalf("unexpected jwk: %+v", jwk)
+			}
+
+			// Without a keyring the kid is the RFC 7638 thumbprint, so it changes with the key
+			thumb, err := thumbprint(jwk)
+			if err != nil {
+				t.Fatalf("failed to get thumbprint: %v", err)
+			}
+			if jwk.Kid != thumb || kidOf(t, tokenString) != thumb {
+				t.Fatalf("kid: got %s n' %s, want %s", jwk.Kid, kidOf(t, tokenString), thumb)
+			}
+
+			// A relying party verifies the token offline with the published key only
+			public := publicKeyOf(t, jwk)
+			_, err = jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(*jwt.Token) (any, error) { return public, nil },
+				jwt.WithValidMethods([]string{tt.algorithm}))
+			if err != nil {
+				t.Fatalf("token isn't verified with the jwk: %v", err)
+			}
+		})
+	}
+}
+
+func TestHMACSecretIsNotPublished(t *testing.T) {
+	j := newTestJWT(t, newTestConfig(), newFakeRevocations())
+
+	if keys := j.JWKS().Keys; len(keys) != 0 {
+		t.Fatalf("got %d keys, want none", len(keys))
+	}
+}
+
+func TestLoadSigningKeyValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		key       *pem.Block
+	}{
+		{name: "short rsa key", algorithm: AlgorithmRS256, key: rsaKeyPEM(t, 1024)},
+		{name: "ES256 with P-384", algorithm: AlgorithmES256, key: ecKeyPEM(t, elliptic.P384())},
+		{name: "key of another algorithm", algorithm: AlgorithmEdDSA, key: ecKeyPEM(t, elliptic.P256())},
+		{name: "unsupported algorithm", algorithm: "HS512", key: edKeyPEM(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Secrets.JWT.Algorithm = tt.algorithm
+			cfg.Secrets.JWT.PrivateKeyPath = writeKey(t, tt.key)
+
+			if _, err := NewJWT(cfg, newFakeRevocations()); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsAlgorithmConfusion(t *testing.T) {
+	block := rsaKeyPEM(t, 2048)
+	cfg := newTestConfig()
+	cfg.Secrets.JWT.Algorithm = AlgorithmRS256
+	cfg.Secrets.JWT.PrivateKeyPath = writeKey(t, block)
+	j := newTestJWT(t, cfg, newFakeRevocations())
+
+	// The public key is published, so anyone could use it as an HMAC secret
+	private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &CustomClaims{
+		ID: uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	token.Header["kid"] = j.JWKS().Keys[0].Kid
+	token.Header["typ"] = HeaderTypeAccessToken
+	tokenString, err := token.SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	if _, err := j.ValidateToken(t.Context(), tokenString); err == nil {
+		t.Fatal("expected error")
+	}
+}
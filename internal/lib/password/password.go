@@ -0,0 +1,175 @@
+// Package password hashes passwords with argon2id or bcrypt n' keeps hashes in the PHC string format
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+const (
+	saltLen = 16
+	keyLen  = 32
+)
+
+// argon2Params are parameters of argon2id, they're encoded in every hash
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	keyLen      uint32
+}
+
+// Hasher hashes new passwords with the algorithm of the config n' verifies hashes of both algorithms,
+// so hashes made before the config has changed keep working until they're upgraded
+type Hasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     argon2Params
+	// dummyHash is a hash of a random password, it's compared for unknown users
+	dummyHash string
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if password == "" {
+		return "", errors.New("password cannot be empty")
+	}
+
+	if h.algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate bcrypt hash: %w", err)
+		}
+
+		return string(hash), nil
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.argon2.iterations, h.argon2.memory, h.argon2.parallelism, h.argon2.keyLen)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id, argon2.Version,
+		h.argon2.memory, h.argon2.iterations, h.argon2.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// DummyHash costs as much to verify as real hashes of the config
+func (h *Hasher) DummyHash() string {
+	return h.dummyHash
+}
+
+// Verify is false for wrong passwords n' for hashes, which can't be decoded
+func (h *Hasher) Verify(password, hash string) bool {
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, params.keyLen)
+
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// NeedsRehash is true for hashes of the other algorithm or with other parameters than in the config
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if h.algorithm == AlgorithmBcrypt {
+		if !isBcrypt(hash) {
+			return true
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.bcryptCost
+	}
+
+	params, _, _, err := decodeArgon2(hash)
+	return err != nil || params != h.argon2
+}
+
+// isBcrypt checks the prefix of the modular crypt format, which bcrypt hashes keep in PHC
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+// decodeArgon2 parses $argon2id$v=19$m=65536,t=3,p=2$salt$key
+func decodeArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return argon2Params{}, nil, nil, errors.New("hash isn't argon2id")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid key: %w", err)
+	}
+	if len(salt) == 0 || len(key) == 0 {
+		return argon2Params{}, nil, nil, errors.New("salt n' key cannot be empty")
+	}
+	params.keyLen = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+func NewHasher(cfg *config.Config) (*Hasher, error) {
+	if cfg == nil {
+		return nil, consts.ErrNilCfg
+	}
+
+	hasher := &Hasher{
+		algorithm:  cfg.Password.Algorithm,
+		bcryptCost: cfg.Password.BcryptCost,
+		argon2: argon2Params{
+			memory:      cfg.Password.Argon2.Memory,
+			iterations:  cfg.Password.Argon2.Iterations,
+			parallelism: cfg.Password.Argon2.Parallelism,
+			keyLen:      keyLen,
+		},
+	}
+
+	dummyHash, err := hasher.Hash(rand.Text())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate dummy hash: %w", err)
+	}
+	hasher.dummyHash = dummyHash
+
+	return hasher, nil
+}
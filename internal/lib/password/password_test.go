@@ -0,0 +1,188 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestHasher uses cheap parameters, the config doesn't allow them, but the format is the same
+func newTestHasher(t *testing.T, algorithm string, memory uint32, cost int) *Hasher {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Password.Algorithm = algorithm
+	cfg.Password.BcryptCost = cost
+	cfg.Password.Argon2.Memory = memory
+	cfg.Password.Argon2.Iterations = 1
+	cfg.Password.Argon2.Parallelism = 1
+
+	hasher, err := NewHasher(cfg)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	return hasher
+}
+
+func TestHasherHashNVerify(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		prefix    string
+	}{
+		{algorithm: AlgorithmArgon2id, prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{algorithm: AlgorithmBcrypt, prefix: "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			hasher := newTestHasher(t, tt.algorithm, 64, bcrypt.MinCost)
+
+			hash, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Fatalf("got %s, want prefix %s", hash, tt.prefix)
+			}
+
+			if !hasher.Verify("correct horse", hash) {
+				t.Fatal("right password is rejected")
+			}
+			if hasher.Verify("correct horse!", hash) {
+				t.Fatal("wrong password is accepted")
+			}
+
+			other, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if other == hash {
+				t.Fatal("hashes of the same password are equal, salt isn't random")
+			}
+
+			if _, err := hasher.Hash(""); err == nil {
+				t.Fatal("empty password is hashed")
+			}
+		})
+	}
+}
+
+func TestHasherVerifiesBothAlgorithms(t *testing.T) {
+	argon := newTestHasher(t, AlgorithmArgon2id, 64, bcrypt.MinCost)
+	bcryptHasher := newTestHasher(t, AlgorithmBcrypt, 64, bcrypt.MinCost)
+
+	argonHash, err := argon.Hash("password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bcryptHash, err := bcryptHasher.Hash("password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !argon.Verify("password", bcryptHash) {
+		t.Fatal("argon2id hasher rejects a bcrypt hash")
+	}
+	if !bcryptHasher.Verify("password", argonHash) {
+		t.Fatal("bcrypt hasher rejects an argon2id hash")
+	}
+}
+
+func TestHasherVerifyMalformed(t *testing.T) {
+	hasher := newTestHasher(t, AlgorithmArgon2id, 64, bcrypt.MinCost)
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "plain text", hash: "password"},
+		{name: "other algorithm", hash: "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{name: "other version", hash: "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{name: "broken parameters", hash: "$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{name: "broken salt", hash: "$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5a2V5"},
+		{name: "broken key", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$!!!"},
+		{name: "empty key", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$"},
+		{name: "missing part", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hasher.Verify("password", tt.hash) {
+				t.Fatal("malformed hash is accepted")
+			}
+			if !hasher.NeedsRehash(tt.hash) {
+				t.Fatal("malformed hash doesn't need rehash")
+			}
+		})
+	}
+}
+
+func TestHasherNeedsRehash(t *testing.T) {
+	argon := newTestHasher(t, AlgorithmArgon2id, 64, bcrypt.MinCost)
+	weakerArgon := newTestHasher(t, AlgorithmArgon2id, 32, bcrypt.MinCost)
+	bcryptHasher := newTestHasher(t, AlgorithmBcrypt, 64, bcrypt.MinCost)
+	costlierBcrypt := newTestHasher(t, AlgorithmBcrypt, 64, bcrypt.MinCost+1)
+
+	hash := func(h *Hasher) string {
+		hash, err := h.Hash("password")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return hash
+	}
+
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		hash   string
+		want   bool
+	}{
+		{name: "argon2id with same parameters", hasher: argon, hash: hash(argon), want: false},
+		{name: "argon2id with other memory", hasher: argon, hash: hash(weakerArgon), want: true},
+		{name: "bcrypt for argon2id", hasher: argon, hash: hash(bcryptHasher), want: true},
+		{name: "bcrypt with same cost", hasher: bcryptHasher, hash: hash(bcryptHasher), want: false},
+		{name: "bcrypt with other cost", hasher: bcryptHasher, hash: hash(costlierBcrypt), want: true},
+		{name: "argon2id for bcrypt", hasher: bcryptHasher, hash: hash(argon), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasherDummyHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		// prefix is the algorithm of real hashes
+		prefix string
+	}{
+		{name: "argon2id", hasher: newTestHasher(t, AlgorithmArgon2id, 64, bcrypt.MinCost), prefix: "$argon2id$"},
+		{name: "bcrypt", hasher: newTestHasher(t, AlgorithmBcrypt, 64, bcrypt.MinCost+1), prefix: "$2a$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dummy := tt.hasher.DummyHash()
+
+			// Verifying the dummy must cost as much as verifying a real hash, so it has the parameters of the config
+			if !strings.HasPrefix(dummy, tt.prefix) {
+				t.Fatalf("dummy hash %q isn't made by %s", dummy, tt.name)
+			}
+			if tt.hasher.NeedsRehash(dummy) {
+				t.Fatal("dummy hash has other parameters than the config")
+			}
+			if tt.hasher.Verify("", dummy) {
+				t.Fatal("dummy hash accepts an empty password")
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package password
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/devathh/staffy-sso/internal/domain/observability"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+)
+
+// Outcomes of hashing tasks in metrics
+const (
+	outcomeOK       = "ok"
+	outcomeRejected = "rejected"
+	outcomeTimeout  = "timeout"
+)
+
+type task struct {
+	ctx       context.Context
+	operation string
+	run       func()
+	queuedAt  time.Time
+	// skipped is set, when the task has waited too long. It's read after done is closed
+	skipped bool
+	// done is closed, when run has finished or the task has been skipped
+	done chan struct{}
+}
+
+// Pool hashes passwords on a fixed number of workers, so a burst of logins can't take all cpus
+// n' the memory of argon2. Calls wait in the queue for RWTimeout at most, calls over the queue depth
+// are rejected at once, both with consts.ErrOverloaded
+type Pool struct {
+	hasher  *Hasher
+	tasks   chan *task
+	quit    chan struct{}
+	timeout time.Duration
+	ch      observability.UserCH
+}
+
+func (p *Pool) Hash(ctx context.Context, password string) (string, error) {
+	var (
+		hash string
+		err  error
+	)
+	if err := p.submit(ctx, "hash", func() { hash, err = p.hasher.Hash(password) }); err != nil {
+		return "", err
+	}
+
+	return hash, err
+}
+
+func (p *Pool) Verify(ctx context.Context, password, hash string) (bool, error) {
+	var ok bool
+	if err := p.submit(ctx, "verify", func() { ok = p.hasher.Verify(password, hash) }); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// NeedsRehash only parses the hash, so it doesn't take a worker
+func (p *Pool) NeedsRehash(hash string) bool {
+	return p.hasher.NeedsRehash(hash)
+}
+
+func (p *Pool) DummyHash() string {
+	return p.hasher.DummyHash()
+}
+
+// submit queues run n' waits until a worker has finished it
+func (p *Pool) submit(ctx context.Context, operation string, run func()) error {
+	ctxTimeout, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	t := &task{
+		ctx:       ctxTimeout,
+		operation: operation,
+		run:       run,
+		queuedAt:  time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	select {
+	case p.tasks <- t:
+	default:
+		p.saveMetric(operation, 0, 0, outcomeRejected)
+		return consts.ErrOverloaded
+	}
+
+	select {
+	case <-t.done:
+		if t.skipped {
+			return consts.ErrOverloaded
+		}
+
+		return nil
+	case <-ctxTimeout.Done():
+		return consts.ErrOverloaded
+	}
+}
+
+func (p *Pool) work() {
+	for {
+		select {
+		case <-p.quit:
+			return
+		case t := <-p.tasks:
+			wait := time.Since(t.queuedAt)
+			if t.ctx.Err() != nil {
+				p.saveMetric(t.operation, wait, 0, outcomeTimeout)
+				t.skipped = true
+				close(t.done)
+				continue
+			}
+
+			start := time.Now()
+			t.run()
+			p.saveMetric(t.operation, wait, time.Since(start), outcomeOK)
+			close(t.done)
+		}
+	}
+}
+
+func (p *Pool) saveMetric(operation string, wait, duration time.Duration, outcome string) {
+	go p.ch.SaveHashingMetric(context.TODO(), &observability.HashingMetric{
+		Operation: operation,
+		QueueWait: wait,
+		Duration:  duration,
+		Outcome:   outcome,
+	})
+}
+
+// Close stops workers, queued tasks time out
+func (p *Pool) Close() {
+	close(p.quit)
+}
+
+func NewPool(cfg *config.Config, hasher *Hasher, ch observability.UserCH) (*Pool, error) {
+	if cfg == nil {
+		return nil, consts.ErrNilCfg
+	}
+	if hasher == nil || ch == nil {
+		return nil, consts.ErrInvalidArgs
+	}
+
+	workers := cfg.Password.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	p := &Pool{
+		hasher:  hasher,
+		tasks:   make(chan *task, cfg.Password.QueueDepth),
+		quit:    make(chan struct{}),
+		timeout: cfg.Server.RWTimeout,
+		ch:      ch,
+	}
+	for range workers {
+		go p.work()
+	}
+
+	return p, nil
+}
@@ -0,0 +1,168 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devathh/staffy-sso/internal/domain/observability"
+	"github.com/devathh/staffy-sso/internal/infrastructure/config"
+	"github.com/devathh/staffy-sso/pkg/consts"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// metricsCH records outcomes of hashing metrics
+type metricsCH struct {
+	mu       sync.Mutex
+	outcomes []string
+}
+
+func (c *metricsCH) SavePerformanceLog(context.Context, *observability.PerformanceLog) {}
+func (c *metricsCH) SaveLockoutEvent(context.Context, *observability.LockoutEvent)     {}
+func (c *metricsCH) SaveThrottleEvent(context.Context, *observability.ThrottleEvent)   {}
+
+func (c *metricsCH) SaveHashingMetric(_ context.Context, metric *observability.HashingMetric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.outcomes = append(c.outcomes, metric.Outcome)
+}
+
+// waitFor waits until the outcome has been recorded, metrics are saved in background
+func (c *metricsCH) waitFor(t *testing.T, outcome string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		found := slices.Contains(c.outcomes, outcome)
+		c.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("outcome %q hasn't been recorded", outcome)
+}
+
+func newTestPool(t *testing.T, workers, queueDepth int, timeout time.Duration) (*Pool, *metricsCH) {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Password.Workers = workers
+	cfg.Password.QueueDepth = queueDepth
+	cfg.Server.RWTimeout = timeout
+
+	ch := &metricsCH{}
+	pool, err := NewPool(cfg, newTestHasher(t, AlgorithmBcrypt, 64, bcrypt.MinCost), ch)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool, ch
+}
+
+// occupy blocks the only worker until the test ends
+func occupy(t *testing.T, pool *Pool) {
+	t.Helper()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go pool.submit(context.Background(), "hash", func() {
+		close(started)
+		<-release
+	})
+	t.Cleanup(func() { close(release) })
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("worker hasn't started")
+	}
+}
+
+func TestPoolHashNVerify(t *testing.T) {
+	pool, ch := newTestPool(t, 2, 4, time.Second)
+
+	hash, err := pool.Hash(t.Context(), "password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ok, err := pool.Verify(t.Context(), "password", hash)
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v, want true", ok, err)
+	}
+
+	ok, err = pool.Verify(t.Context(), "wrong", hash)
+	if err != nil || ok {
+		t.Fatalf("got %v, %v, want false", ok, err)
+	}
+
+	ch.waitFor(t, outcomeOK)
+}
+
+func TestPoolOverloaded(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	pool, ch := newTestPool(t, 1, 1, timeout)
+	occupy(t, pool)
+
+	// The call waits in the queue n' gives up after the timeout
+	start := time.Now()
+	if _, err := pool.Verify(t.Context(), "password", pool.DummyHash()); !errors.Is(err, consts.ErrOverloaded) {
+		t.Fatalf("queued call: got %v, want ErrOverloaded", err)
+	}
+	if waited := time.Since(start); waited < timeout {
+		t.Fatalf("queued call has waited %s, less than the timeout", waited)
+	}
+
+	// The queue is still full of the expired call, so the next one is rejected at once
+	if _, err := pool.Hash(t.Context(), "password"); !errors.Is(err, consts.ErrOverloaded) {
+		t.Fatalf("call over the queue depth: got %v, want ErrOverloaded", err)
+	}
+	ch.waitFor(t, outcomeRejected)
+}
+
+func TestPoolSkipsExpiredCalls(t *testing.T) {
+	pool, ch := newTestPool(t, 1, 1, time.Second)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go pool.submit(context.Background(), "hash", func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	ran := make(chan struct{}, 1)
+	if err := pool.submit(ctx, "verify", func() { ran <- struct{}{} }); !errors.Is(err, consts.ErrOverloaded) {
+		t.Fatalf("got %v, want ErrOverloaded", err)
+	}
+
+	// The worker frees up after the caller has gone, the call mustn't take it
+	close(release)
+	ch.waitFor(t, outcomeTimeout)
+
+	select {
+	case <-ran:
+		t.Fatal("expired call has been run")
+	default:
+	}
+}
+
+func TestNewPool(t *testing.T) {
+	hasher := newTestHasher(t, AlgorithmBcrypt, 64, bcrypt.MinCost)
+
+	if _, err := NewPool(nil, hasher, &metricsCH{}); !errors.Is(err, consts.ErrNilCfg) {
+		t.Fatalf("nil config: got %v, want ErrNilCfg", err)
+	}
+	if _, err := NewPool(&config.Config{}, nil, &metricsCH{}); !errors.Is(err, consts.ErrInvalidArgs) {
+		t.Fatalf("nil hasher: got %v, want ErrInvalidArgs", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package totp generates n' validates RFC 6238 codes of authenticator apps
+package totp
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	period = 30
+	// skew is how many steps before n' after the current one are accepted, clocks of phones drift
+	skew = 1
+)
+
+var opts = totp.ValidateOpts{
+	Period:    period,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// Generate returns a new secret n' the otpauth uri, which is shown to the user as a qr code
+func Generate(issuer, account string) (string, string, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		Period:      period,
+		Digits:      opts.Digits,
+		Algorithm:   opts.Algorithm,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate totp key: %w", err)
+	}
+
+	return key.Secret(), key.URL(), nil
+}
+
+// Validate returns the time step, the code belongs to. The step lets the caller reject replayed codes.
+func Validate(secret, code string, now time.Time) (int64, bool) {
+	for i := -skew; i <= skew; i++ {
+		at := now.Add(time.Duration(i*period) * time.Second)
+
+		expected, err := totp.GenerateCodeCustom(secret, at, opts)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / period, true
+		}
+	}
+
+	return 0, false
+}
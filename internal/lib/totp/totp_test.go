@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestGenerate(t *testing.T) {
+	secret, uri, err := Generate("staffy", "user@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if secret == "" {
+		t.Fatal("secret is empty")
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("invalid uri: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Fatalf("unexpected uri: %s", uri)
+	}
+	if got := parsed.Query().Get("secret"); got != secret {
+		t.Fatalf("uri secret: got %q, want %q", got, secret)
+	}
+	if got := parsed.Query().Get("issuer"); got != "staffy" {
+		t.Fatalf("uri issuer: got %q, want %q", got, "staffy")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, _, err := Generate("staffy", "user@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The middle of a step, so the shifts below don't cross extra boundaries
+	now := time.Unix(1_700_000_000/period*period+period/2, 0)
+	step := now.Unix() / period
+
+	tests := []struct {
+		name     string
+		codeAt   time.Time
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", codeAt: now, wantStep: step, wantOK: true},
+		{name: "previous step within skew", codeAt: now.Add(-period * time.Second), wantStep: step - 1, wantOK: true},
+		{name: "next step within skew", codeAt: now.Add(period * time.Second), wantStep: step + 1, wantOK: true},
+		{name: "two steps behind", codeAt: now.Add(-2 * period * time.Second), wantOK: false},
+		{name: "two steps ahead", codeAt: now.Add(2 * period * time.Second), wantOK: false},
+		{name: "malformed code", code: "12345a", wantOK: false},
+		{name: "empty code", code: "", codeAt: time.Time{}, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := tt.code
+			if !tt.codeAt.IsZero() {
+				code, err = totp.GenerateCodeCustom(secret, tt.codeAt, opts)
+				if err != nil {
+					t.Fatalf("failed to generate code: %v", err)
+				}
+			}
+
+			gotStep, ok := Validate(secret, code, now)
+			if ok != tt.wantOK {
+				t.Fatalf("ok: got %v, want %v", ok, tt.wantOK)
+			}
+			if ok && gotStep != tt.wantStep {
+				t.Fatalf("step: got %d, want %d", gotStep, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidSecret(t *testing.T) {
+	if _, ok := Validate("not base32!", "123456", time.Now()); ok {
+		t.Fatal("code is accepted for an invalid secret")
+	}
+}
@@ -1,7 +1,12 @@
 // Package consts is just a set of constrains and errors
 package consts
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 var (
 	ErrEmptyUser         = errors.New("user cannot be empty")
@@ -9,17 +14,91 @@ var (
 	ErrUserAlreadyExists = errors.New("user already exists")
 	ErrInvalidEmail      = errors.New("email is invalid")
 	ErrCreateUser        = errors.New("failed to create user")
+	ErrEmailNotVerified  = errors.New("email isn't verified")
+	ErrVersionConflict   = errors.New("user has been modified concurrently")
+	ErrWeakPassword      = errors.New("password doesn't meet the policy")
+
+	ErrRoleChangeDoesntExist = errors.New("role change doesn't exist")
+	ErrRoleChangePending     = errors.New("role change is already waiting for approval")
+	ErrRoleDoesntExist       = errors.New("role doesn't exist")
+
+	ErrOrganizationDoesntExist = errors.New("organization doesn't exist")
+	ErrAlreadyMember           = errors.New("user is already a member of the organization")
+
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+	ErrMFANotEnrolled    = errors.New("mfa isn't enrolled")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+
+	ErrPasskeyDoesntExist = errors.New("passkey doesn't exist")
+	ErrInvalidPasskey     = errors.New("invalid passkey")
 
 	ErrContext  = errors.New("context was canceled or is timeout")
 	ErrDatabase = errors.New("error with database")
+	ErrCache    = errors.New("error with cache")
+	// ErrOverloaded is returned, when there's no free worker in time, the client should retry later
+	ErrOverloaded = errors.New("server is overloaded")
 
 	ErrNilToken           = errors.New("token cannot be nil")
 	ErrGenerateToken      = errors.New("failed to generate new token")
 	ErrInvalidToken       = errors.New("invalid token")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrTooManyAttempts    = errors.New("too many attempts")
+	ErrTokenDoesntExist   = errors.New("token doesn't exist")
 
 	ErrNilRequest  = errors.New("request cannot be nil")
 	ErrInvalidArgs = errors.New("some args is invalid")
 
 	ErrNilCfg = errors.New("cfg cannot be nil")
+
+	ErrEmptyClient             = errors.New("client cannot be empty")
+	ErrClientDoesntExist       = errors.New("client doesn't exist")
+	ErrConsentDoesntExist      = errors.New("consent doesn't exist")
+	ErrInvalidClient           = errors.New("invalid client")
+	ErrInvalidRedirectURI      = errors.New("invalid redirect uri")
+	ErrInvalidGrant            = errors.New("invalid grant")
+	ErrInvalidScope            = errors.New("invalid scope")
+	ErrUnauthorizedClient      = errors.New("client is not allowed to use this grant")
+	ErrUnsupportedGrantType    = errors.New("unsupported grant type")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	ErrLoginRequired           = errors.New("login required")
+	ErrConsentRequired         = errors.New("consent required")
+	ErrAccessDenied            = errors.New("access denied")
+	// ErrOIDCDisabled means ID tokens can't be issued, because the active jwt key is an HMAC secret
+	ErrOIDCDisabled = errors.New("openid connect is disabled")
+)
+
+// Reasons of RetryAfterError, clients tell a locked account from too frequent calls by them
+const (
+	// RetryReasonAccountLocked means failed logins have blocked the account or the ip
+	RetryReasonAccountLocked = "ACCOUNT_LOCKED"
+	// RetryReasonRateLimited means the client calls the method too often
+	RetryReasonRateLimited = "RATE_LIMITED"
 )
+
+// RetryAfterError tells the client, when it may try again n' why. It matches ErrTooManyAttempts
+type RetryAfterError struct {
+	RetryAfter time.Duration
+	Reason     string
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RetryAfterError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// PasswordPolicyError lists rules, which the password of the Field has broken. It matches ErrWeakPassword
+type PasswordPolicyError struct {
+	Field      string
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWeakPassword, strings.Join(e.Violations, ", "))
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrWeakPassword
+}